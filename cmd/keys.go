@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/keys"
+	"github.com/xela07ax/universal-backend-streaming/internal/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	keysAlg         string
+	keysRetireAfter time.Duration
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Ключи подписи JWT (auth.keys_dir)",
+	Long: `Управляет набором ключей подписи JWT в auth.keys_dir. Открытые ключи публикуются
+в /.well-known/jwks.json. После generate и rotate перезапустите все узлы hydro serve.`,
+}
+
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Создать первый ключ подписи",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := viper.GetString("auth.keys_dir")
+		k, err := keys.Init(dir, keysAlg)
+		if err != nil {
+			exitKeys(err)
+		}
+		fmt.Printf("Generated %s key %s in %s\n", k.Alg, k.ID, dir)
+	},
+}
+
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Выпустить новый ключ подписи; прежний остается для проверки еще --retire-after",
+	Long: `Создает новый активный ключ. У прежнего удаляется закрытый ключ, открытый остается
+в JWKS, пока не истекут выданные им токены (--retire-after, по умолчанию auth.refresh_token_ttl).
+Открытые ключи, выведенные из подписи раньше, удаляются.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := viper.GetString("auth.keys_dir")
+		retireAfter := keysRetireAfter
+		if retireAfter == 0 {
+			retireAfter = viper.GetDuration("auth.refresh_token_ttl")
+		}
+		if retireAfter == 0 {
+			retireAfter = 168 * time.Hour
+		}
+
+		k, removed, err := keys.Rotate(dir, keysAlg, retireAfter)
+		if err != nil {
+			exitKeys(err)
+		}
+		fmt.Printf("Rotated: new %s key %s in %s\n", k.Alg, k.ID, dir)
+		for _, kid := range removed {
+			fmt.Printf("Removed retired key %s\n", kid)
+		}
+	},
+}
+
+// loadJWTKeys читает ключи подписи для hydro serve: auth.keys_dir и, для разработки, auth.jwt_secret.
+// При активном ключе секрет проверяет старые токены только до auth.accept_legacy_hs256_until.
+func loadJWTKeys(l *zap.Logger) (*keys.Set, error) {
+	legacyUntil := viper.GetTime("auth.accept_legacy_hs256_until")
+	set, err := keys.Load(viper.GetString("auth.keys_dir"), viper.GetString("auth.jwt_secret"), legacyUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	if k := set.Signing(); k != nil {
+		l.Info("🔑 JWT signing key loaded",
+			zap.String("kid", k.ID),
+			zap.String("alg", k.Alg),
+			zap.Int("verification_keys", len(set.Keys())))
+		if viper.GetString("auth.jwt_secret") != "" && time.Now().Before(legacyUntil) {
+			l.Warn("⚠️  Legacy HS256 tokens are accepted until deadline",
+				zap.Time("accept_legacy_hs256_until", legacyUntil))
+		}
+	} else if viper.GetString("env") == "production" {
+		l.Warn("⚠️  JWT is signed with shared auth.jwt_secret: run `hydro keys generate`")
+	}
+	return set, nil
+}
+
+func exitKeys(err error) {
+	l := logger.Get()
+	l.Error("❌ Keys command failed", zap.Error(err))
+	_ = l.Sync()
+	os.Exit(1)
+}
+
+func init() {
+	RootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysGenerateCmd, keysRotateCmd)
+
+	for _, c := range []*cobra.Command{keysGenerateCmd, keysRotateCmd} {
+		c.Flags().StringVar(&keysAlg, "alg", keys.AlgEdDSA, "алгоритм: EdDSA или RS256")
+	}
+	keysRotateCmd.Flags().DurationVar(&keysRetireAfter, "retire-after", 0, "сколько проверять токены прежнего ключа (0 — auth.refresh_token_ttl)")
+
+	viper.SetDefault("auth.keys_dir", "./keys")
+	viper.SetDefault("auth.accept_legacy_hs256_until", "")
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/database"
+	"github.com/xela07ax/universal-backend-streaming/internal/discovery"
+	"github.com/xela07ax/universal-backend-streaming/internal/logger"
+	"github.com/xela07ax/universal-backend-streaming/internal/purger"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
+)
+
+var purgeDryRun bool
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Окончательно удалить активы, пролежавшие в корзине дольше trash.retention",
+	Run:   runPurge,
+}
+
+func runPurge(cmd *cobra.Command, args []string) {
+	l := logger.Get()
+	defer func() { _ = l.Sync() }()
+
+	db, err := database.NewPostgresConn(discovery.NewConfigResolver(), l)
+	if err != nil {
+		l.Fatal("Failed to connect to postgres", zap.Error(err))
+	}
+	defer db.Close()
+
+	backend, err := newStorage(context.Background(), l)
+	if err != nil {
+		l.Fatal("storage init failed", zap.Error(err))
+	}
+
+	res, err := newPurger(db, backend, l, purgeDryRun).PurgeExpired(context.Background())
+	if err != nil {
+		l.Fatal("❌ Purge failed", zap.Error(err))
+	}
+	l.Info("✅ Purge completed",
+		zap.Int("assets", res.Assets),
+		zap.Int("files", res.Files),
+		zap.Int64("bytes", res.Bytes),
+		zap.Bool("dry_run", purgeDryRun))
+}
+
+// newPurger собирает очистку корзины по секции trash. Используется `hydro purge`
+// и фоновой очисткой в `hydro serve` (trash.purge_enabled).
+func newPurger(db *pgxpool.Pool, backend storage.Backend, l *zap.Logger, dryRun bool) *purger.Purger {
+	return purger.New(purger.Config{
+		Retention: viper.GetDuration("trash.retention"),
+		Interval:  viper.GetDuration("trash.purge_interval"),
+		BatchSize: viper.GetInt("trash.batch_size"),
+		DryRun:    dryRun,
+	}, repository.NewMediaRepository(db), backend, l)
+}
+
+func init() {
+	RootCmd.AddCommand(purgeCmd)
+
+	purgeCmd.Flags().BoolVar(&purgeDryRun, "dry-run", false, "только показать, что будет удалено")
+	purgeCmd.Flags().Duration("retention", 0, "срок хранения в корзине (по умолчанию trash.retention)")
+	if err := viper.BindPFlag("trash.retention", purgeCmd.Flags().Lookup("retention")); err != nil {
+		log.Fatalf("❌ FATAL: trash.retention flag binding failed: %v", err)
+	}
+
+	viper.SetDefault("trash.retention", "720h") // 30 дней
+	viper.SetDefault("trash.purge_enabled", true)
+	viper.SetDefault("trash.purge_interval", "1h")
+	viper.SetDefault("trash.batch_size", 100)
+}
@@ -64,8 +64,12 @@ func runServe(cmd *cobra.Command, args []string) {
 		log.Fatalf("failed to connect to postgres: %v", err)
 	}
 
-	// 4. Инициализация VideoProvider для генерации URL
-	videoProvider, err := streaming.NewVideoProvider(resolver, l)
+	// 4. Хранилище файлов (storage.driver) и VideoProvider для генерации URL
+	backend, err := newStorage(context.Background(), l)
+	if err != nil {
+		l.Fatal("storage init failed", zap.Error(err))
+	}
+	videoProvider, err := streaming.NewVideoProvider(resolver, backend, l)
 	if err != nil {
 		l.Fatal("video provider init failed", zap.Error(err))
 	}
@@ -77,8 +81,14 @@ func runServe(cmd *cobra.Command, args []string) {
 	}
 	l.Info("Connected to Redis", zap.String("addr", rdb.Options().Addr))
 
+	// 1.1. Ключи подписи JWT (auth.keys_dir, auth.jwt_secret)
+	jwtKeys, err := loadJWTKeys(l)
+	if err != nil {
+		l.Fatal("Failed to load JWT keys", zap.Error(err))
+	}
+
 	// 2. Создание и запуск API сервера
-	server, _ := api.NewServer(db, rdb, videoProvider, l, viper.GetString("auth.jwt_secret"))
+	server, err := api.NewServer(db, rdb, videoProvider, l, jwtKeys)
 
 	if err != nil {
 		l.Fatal("api server init failed", zap.Error(err))
@@ -90,6 +100,43 @@ func runServe(cmd *cobra.Command, args []string) {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	// Встроенный воркер обработки медиа для однонодовых установок (worker.embedded)
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	if viper.GetBool("worker.embedded") {
+		go func() {
+			defer close(workerDone)
+			newMediaWorker(db, videoProvider, l).Run(workerCtx)
+		}()
+	} else {
+		close(workerDone)
+	}
+
+	// Очистка корзины по сроку хранения (trash.retention). Несколько узлов не мешают друг другу:
+	// актив удаляет тот, чей DELETE прошел первым.
+	purgerDone := make(chan struct{})
+	if viper.GetBool("trash.purge_enabled") {
+		go func() {
+			defer close(purgerDone)
+			newPurger(db, backend, l, false).Run(workerCtx)
+		}()
+	} else {
+		close(purgerDone)
+	}
+
+	// Файлы брошенных tus-загрузок (состояние в Redis истекло через uploads.expiration)
+	// и просроченные записи карантина (uploads.quarantine_retention)
+	sweeperDone := make(chan struct{})
+	quarantineDone := make(chan struct{})
+	go func() {
+		defer close(sweeperDone)
+		server.SweepUploads(workerCtx)
+	}()
+	go func() {
+		defer close(quarantineDone)
+		server.SweepQuarantine(workerCtx)
+	}()
+
 	// 2. Запускаем сервер в отдельной горутине
 	go func() {
 		l.Info("Hydro Server start", zap.String("addr", addr))
@@ -110,6 +157,13 @@ func runServe(cmd *cobra.Command, args []string) {
 		l.Error("HTTP shutdown error", zap.Error(err))
 	}
 
+	// Воркер дорабатывает текущую задачу, очистка — текущий актив, и оба отпускают пул соединений
+	stopWorker()
+	<-workerDone
+	<-purgerDone
+	<-sweeperDone
+	<-quarantineDone
+
 	// ВТОРЫМ делом: Закрываем базу данных
 	// Это гарантирует, что активные транзакции из п.1 успели дойти до БД
 	server.Close()
@@ -126,7 +180,9 @@ func init() {
 	// --- Настройки безопасности ---
 	viper.SetDefault("auth_login_token_length", 8)
 	viper.SetDefault("auth_login_token_expiry", "11m")
-	viper.SetDefault("auth_jwt_secret", "random_secure_string_2026")
+	viper.SetDefault("auth.issuer", "hydro")            // iss в JWT; пусто — не проверяется
+	viper.SetDefault("auth.audience", "hydro-api")      // aud в JWT; пусто — не проверяется
+	viper.SetDefault("auth.refresh_reuse_grace", "10s") // Окно гонки вкладок: прежний refresh не считается украденным
 
 	// Настройки пула соединений
 	viper.SetDefault("database.max_conns", 25)
@@ -136,6 +192,31 @@ func init() {
 	// --- Системные настройки (ДЛЯ СТРИМИНГА) ---
 	viper.SetDefault("video.service_name", "video-storage")
 	viper.SetDefault("video.port", 8080)
+	viper.SetDefault("video.scheme", "http")
+	viper.SetDefault("video.absolute_urls", false)
+	viper.SetDefault("video.signed_urls", true)
+	viper.SetDefault("video.signing_secret", "")
+	viper.SetDefault("video.bind_urls_to_user", false)
+	viper.SetDefault("ingest.record_enabled", false)
+	viper.SetDefault("ingest.hls_enabled", true)
+	viper.SetDefault("vod.ffmpeg_path", "ffmpeg")
+	viper.SetDefault("vod.ffprobe_path", "ffprobe")
+	viper.SetDefault("vod.segment_duration", "4s")
+	viper.SetDefault("vod.packaging_timeout", "30m")
+	viper.SetDefault("uploads.max_size", int64(505<<20))
+	viper.SetDefault("uploads.tus_dir", "./tmp/tus")
+	viper.SetDefault("uploads.expiration", "24h")
+	viper.SetDefault("uploads.lock_timeout", "10m")
+	viper.SetDefault("uploads.sweep_interval", "1h")
+	viper.SetDefault("uploads.allowed_formats", []string{"mp4", "mov", "webm", "mkv"})
+	viper.SetDefault("uploads.quarantine_dir", "./tmp/quarantine")
+	viper.SetDefault("uploads.quarantine_retention", "720h")
+	viper.SetDefault("quotas.enabled", true)
+	viper.SetDefault("quotas.default_bytes", int64(10<<30))
+	viper.SetDefault("quotas.roles", map[string]int64{
+		"admin":    0, // Без ограничений
+		"streamer": 50 << 30,
+	})
 
 	// Мапинг для резолвера (пустой по умолчанию для Docker DNS)
 	viper.SetDefault("discovery.services", map[string]string{})
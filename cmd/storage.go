@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/database"
+	"github.com/xela07ax/universal-backend-streaming/internal/discovery"
+	"github.com/xela07ax/universal-backend-streaming/internal/fsck"
+	"github.com/xela07ax/universal-backend-streaming/internal/logger"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"github.com/xela07ax/universal-backend-streaming/internal/streaming"
+	"go.uber.org/zap"
+)
+
+// newStorage создает хранилище медиафайлов по секции storage (и video.storage_path для local)
+func newStorage(ctx context.Context, l *zap.Logger) (storage.Backend, error) {
+	return storage.New(ctx, storage.Config{
+		Driver: viper.GetString("storage.driver"),
+		Local: storage.LocalConfig{
+			Root:    viper.GetString("video.storage_path"),
+			BaseURL: streaming.StorageRoute,
+		},
+		S3: storage.S3Config{
+			Endpoint:     viper.GetString("storage.s3.endpoint"),
+			Region:       viper.GetString("storage.s3.region"),
+			Bucket:       viper.GetString("storage.s3.bucket"),
+			AccessKey:    viper.GetString("storage.s3.access_key"),
+			SecretKey:    viper.GetString("storage.s3.secret_key"),
+			UseSSL:       viper.GetBool("storage.s3.use_ssl"),
+			PathStyle:    viper.GetBool("storage.s3.path_style"),
+			CreateBucket: viper.GetBool("storage.s3.create_bucket"),
+		},
+	}, l)
+}
+
+var (
+	fsckOrphans    string
+	fsckMarkFailed bool
+	fsckJSON       bool
+)
+
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "Обслуживание хранилища медиафайлов",
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Сверить media_assets с хранилищем: сироты, пропавшие файлы, несовпадение размера",
+	Long: `Сверяет storage_path активов с содержимым хранилища.
+По умолчанию только печатает отчет. --orphans=quarantine переносит файлы без владельца
+в lost+found/, --orphans=delete удаляет их; --mark-failed переводит активы
+с пропавшим или битым файлом в failed.
+
+Код выхода 1, если найдены расхождения.`,
+	Run: runFsck,
+}
+
+func runFsck(cmd *cobra.Command, args []string) {
+	l := logger.Get()
+	defer func() { _ = l.Sync() }()
+
+	if !fsck.ValidOrphansMode(fsckOrphans) {
+		l.Fatal("--orphans must be report, quarantine or delete", zap.String("orphans", fsckOrphans))
+	}
+
+	db, err := database.NewPostgresConn(discovery.NewConfigResolver(), l)
+	if err != nil {
+		l.Fatal("Failed to connect to postgres", zap.Error(err))
+	}
+	defer db.Close()
+
+	backend, err := newStorage(context.Background(), l)
+	if err != nil {
+		l.Fatal("storage init failed", zap.Error(err))
+	}
+
+	checker := fsck.New(fsck.Config{
+		Orphans:    fsckOrphans,
+		MarkFailed: fsckMarkFailed,
+		MinAge:     viper.GetDuration("storage.fsck_min_age"),
+	}, repository.NewMediaRepository(db), backend, l)
+
+	report, err := checker.Run(context.Background())
+	if err != nil {
+		l.Fatal("❌ Fsck failed", zap.Error(err))
+	}
+
+	if fsckJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		l.Fatal("Failed to write report", zap.Error(err))
+	}
+
+	if !report.Clean() {
+		_ = l.Sync()
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(storageCmd)
+	storageCmd.AddCommand(fsckCmd)
+
+	fsckCmd.Flags().StringVar(&fsckOrphans, "orphans", fsck.OrphansReport, "что делать с файлами без владельца: report, quarantine (в lost+found/) или delete")
+	fsckCmd.Flags().BoolVar(&fsckMarkFailed, "mark-failed", false, "перевести активы с пропавшим или битым файлом в failed")
+	fsckCmd.Flags().BoolVar(&fsckJSON, "json", false, "вывести отчет в JSON")
+	fsckCmd.Flags().Duration("min-age", 0, "не считать сиротами файлы моложе (по умолчанию storage.fsck_min_age)")
+	if err := viper.BindPFlag("storage.fsck_min_age", fsckCmd.Flags().Lookup("min-age")); err != nil {
+		log.Fatalf("❌ FATAL: storage.fsck_min_age flag binding failed: %v", err)
+	}
+
+	viper.SetDefault("storage.fsck_min_age", "1h") // Загрузка пишет файл раньше, чем запись в media_assets
+	viper.SetDefault("video.storage_path", "./uploads")
+	viper.SetDefault("storage.driver", storage.DriverLocal)
+	viper.SetDefault("storage.work_dir", "./tmp")
+	viper.SetDefault("storage.direct_urls", false)
+	viper.SetDefault("storage.url_ttl", "1h")
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("storage.s3.use_ssl", true)
+	viper.SetDefault("storage.s3.path_style", true)
+	viper.SetDefault("storage.s3.create_bucket", false)
+}
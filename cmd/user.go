@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/xela07ax/universal-backend-streaming/internal/database"
+	"github.com/xela07ax/universal-backend-streaming/internal/discovery"
+	"github.com/xela07ax/universal-backend-streaming/internal/logger"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	userEmail    string
+	userPassword string
+	userRole     string
+	userListRole string
+	userEnable   bool
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Управление пользователями (те же правила, что в /api/v1/admin/users)",
+}
+
+var userCreateCmd = &cobra.Command{
+	Use:   "create <username>",
+	Short: "Создать пользователя",
+	Long: `Создает пользователя. Пароль берется из --password, а если флаг не задан —
+из первой строки stdin (echo "$PASS" | hydro user create alice --email alice@example.com).`,
+	Args: cobra.ExactArgs(1),
+	Run: withUsers(func(ctx context.Context, users *repository.UserRepository, args []string) error {
+		if problem := repository.CheckUser(args[0], userEmail, userRole); problem != "" {
+			return fmt.Errorf("%s", problem)
+		}
+
+		password := userPassword
+		if password == "" {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("password is required: --password or stdin")
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+		hash, err := repository.HashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		u := &repository.User{Username: args[0], Email: userEmail, PasswordHash: hash, Role: userRole}
+		if err := users.Create(ctx, u); err != nil {
+			return err
+		}
+		fmt.Printf("Created %s (%s), id %s\n", u.Username, u.Role, u.ID)
+		return nil
+	}),
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Список пользователей",
+	Args:  cobra.NoArgs,
+	Run: withUsers(func(ctx context.Context, users *repository.UserRepository, _ []string) error {
+		if userListRole != "" && !repository.ValidRole(userListRole) {
+			return fmt.Errorf("role must be one of %s", strings.Join(repository.Roles, ", "))
+		}
+		list, err := users.List(ctx, repository.UserFilter{Role: userListRole, Limit: 500})
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ID\tUSERNAME\tEMAIL\tROLE\tSTATUS")
+		for _, u := range list {
+			status := "active"
+			if u.Disabled() {
+				status = "disabled"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.ID, u.Username, u.Email, u.Role, status)
+		}
+		return tw.Flush()
+	}),
+}
+
+var userSetRoleCmd = &cobra.Command{
+	Use:   "set-role <username|id> <role>",
+	Short: "Сменить роль (admin, moderator, user, streamer)",
+	Args:  cobra.ExactArgs(2),
+	Run: withUsers(func(ctx context.Context, users *repository.UserRepository, args []string) error {
+		role := args[1]
+		if !repository.ValidRole(role) {
+			return fmt.Errorf("role must be one of %s", strings.Join(repository.Roles, ", "))
+		}
+		u, err := findUser(ctx, users, args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := users.Update(ctx, u.ID, repository.UserPatch{Role: &role}); err != nil {
+			return err
+		}
+		fmt.Printf("%s: role %s -> %s\n", u.Username, u.Role, role)
+		return nil
+	}),
+}
+
+var userDisableCmd = &cobra.Command{
+	Use:   "disable <username|id>",
+	Short: "Отключить пользователя (--enable — включить обратно)",
+	Args:  cobra.ExactArgs(1),
+	Run: withUsers(func(ctx context.Context, users *repository.UserRepository, args []string) error {
+		u, err := findUser(ctx, users, args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := users.SetDisabled(ctx, u.ID, !userEnable); err != nil {
+			return err
+		}
+		state := "disabled"
+		if userEnable {
+			state = "enabled"
+		}
+		fmt.Printf("%s: %s\n", u.Username, state)
+		return nil
+	}),
+}
+
+// withUsers подключается к Postgres и выполняет действие над UserRepository; ошибка — код выхода 1
+func withUsers(action func(ctx context.Context, users *repository.UserRepository, args []string) error) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		l := logger.Get()
+		defer func() { _ = l.Sync() }()
+
+		db, err := database.NewPostgresConn(discovery.NewConfigResolver(), l)
+		if err != nil {
+			l.Fatal("Failed to connect to postgres", zap.Error(err))
+		}
+		defer db.Close()
+
+		if err := action(context.Background(), repository.NewUserRepository(db), args); err != nil {
+			l.Error("❌ User command failed", zap.Error(err))
+			_ = l.Sync()
+			db.Close()
+			os.Exit(1)
+		}
+	}
+}
+
+// findUser ищет пользователя по ID или логину
+func findUser(ctx context.Context, users *repository.UserRepository, ref string) (*repository.User, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return users.GetByID(ctx, id)
+	}
+	return users.GetByUsername(ctx, ref)
+}
+
+func init() {
+	RootCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userCreateCmd, userListCmd, userSetRoleCmd, userDisableCmd)
+
+	userCreateCmd.Flags().StringVar(&userEmail, "email", "", "email (обязателен)")
+	userCreateCmd.Flags().StringVarP(&userPassword, "password", "p", "", "пароль; без флага читается из stdin")
+	userCreateCmd.Flags().StringVar(&userRole, "role", repository.RoleUser, "роль: admin, moderator, user или streamer")
+	_ = userCreateCmd.MarkFlagRequired("email")
+
+	userListCmd.Flags().StringVar(&userListRole, "role", "", "показать только эту роль")
+
+	userDisableCmd.Flags().BoolVar(&userEnable, "enable", false, "включить пользователя обратно")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/database"
+	"github.com/xela07ax/universal-backend-streaming/internal/discovery"
+	"github.com/xela07ax/universal-backend-streaming/internal/logger"
+	"github.com/xela07ax/universal-backend-streaming/internal/packager"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/streaming"
+	"github.com/xela07ax/universal-backend-streaming/internal/worker"
+	"go.uber.org/zap"
+)
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Запуск воркера фоновой обработки медиа (упаковка, превью)",
+	Run:   runWorker,
+}
+
+func runWorker(cmd *cobra.Command, args []string) {
+	l := logger.Get()
+	defer func() { _ = l.Sync() }()
+
+	resolver := discovery.NewConfigResolver()
+	db, err := database.NewPostgresConn(resolver, l)
+	if err != nil {
+		l.Fatal("Failed to connect to postgres", zap.Error(err))
+	}
+	defer db.Close()
+
+	// Воркер читает исходники и публикует результат в то же хранилище, из которого раздает API
+	backend, err := newStorage(context.Background(), l)
+	if err != nil {
+		l.Fatal("storage init failed", zap.Error(err))
+	}
+	videoProvider, err := streaming.NewVideoProvider(resolver, backend, l)
+	if err != nil {
+		l.Fatal("video provider init failed", zap.Error(err))
+	}
+
+	// Останавливаемся по Ctrl+C / SIGTERM, дорабатывая текущие задачи
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	newMediaWorker(db, videoProvider, l).Run(ctx)
+}
+
+// newMediaWorker собирает воркер с обработчиками задач медиа. Используется и `hydro worker`,
+// и встроенным режимом `hydro serve` (worker.embedded).
+func newMediaWorker(db *pgxpool.Pool, vp *streaming.VideoProvider, l *zap.Logger) *worker.Worker {
+	media := repository.NewMediaRepository(db)
+
+	w := worker.New(worker.Config{
+		Concurrency:  viper.GetInt("worker.concurrency"),
+		PollInterval: viper.GetDuration("worker.poll_interval"),
+		Lease:        viper.GetDuration("worker.lease"),
+		BackoffBase:  viper.GetDuration("worker.backoff_base"),
+		BackoffMax:   viper.GetDuration("worker.backoff_max"),
+	}, repository.NewJobRepository(db), media, l)
+
+	var renditions []packager.Rendition
+	if err := viper.UnmarshalKey("vod.renditions", &renditions); err != nil {
+		l.Warn("⚠️ Invalid vod.renditions, using default ladder", zap.Error(err))
+		renditions = nil
+	}
+	p := packager.New(packager.Config{
+		FFmpegPath:      viper.GetString("vod.ffmpeg_path"),
+		FFprobePath:     viper.GetString("vod.ffprobe_path"),
+		Storage:         vp.Storage(),
+		WorkDir:         viper.GetString("storage.work_dir"),
+		SegmentDuration: viper.GetDuration("vod.segment_duration"),
+		Renditions:      renditions,
+	}, repository.NewEndpointRepository(db), l)
+
+	// Без ffmpeg задачи все равно регистрируем: они уйдут в dead с понятной ошибкой,
+	// и их можно будет перезапустить из админки после установки ffmpeg
+	if err := p.Available(); err != nil {
+		l.Warn("⚠️ ffmpeg is not available, media jobs will fail", zap.Error(err))
+	}
+	src := worker.Source{Storage: vp.Storage(), WorkDir: filepath.Join(viper.GetString("storage.work_dir"), "sources")}
+	w.Handle(repository.JobTypePackage, worker.PackageHandler(p, src, viper.GetDuration("vod.packaging_timeout")))
+	w.Handle(repository.JobTypeThumbnail, worker.ThumbnailHandler(p, src, media))
+	return w
+}
+
+func init() {
+	RootCmd.AddCommand(workerCmd)
+
+	workerCmd.Flags().Int("concurrency", 2, "сколько задач выполнять параллельно")
+	if err := viper.BindPFlag("worker.concurrency", workerCmd.Flags().Lookup("concurrency")); err != nil {
+		log.Fatalf("❌ FATAL: worker.concurrency flag binding failed: %v", err)
+	}
+
+	viper.SetDefault("worker.embedded", false)
+	viper.SetDefault("worker.poll_interval", "2s")
+	viper.SetDefault("worker.lease", "45m") // Больше vod.packaging_timeout, иначе задачу заберут повторно
+	viper.SetDefault("worker.backoff_base", "10s")
+	viper.SetDefault("worker.backoff_max", "10m")
+	viper.SetDefault("worker.max_attempts", 5)
+}
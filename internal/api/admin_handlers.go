@@ -6,26 +6,19 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
 )
 
-// handleAdminListAssets возвращает список всех видео для таблицы в админке
-func (s *Server) handleAdminListAssets(w http.ResponseWriter, r *http.Request) {
-	// В реальном проекте здесь будет s.media.ListAssets(ctx) с пагинацией
-	assets, err := s.media.GetAllAssets(r.Context())
-	if err != nil {
-		s.respondError(w, http.StatusInternalServerError, "failed to fetch assets")
-		return
-	}
-	s.respond(w, http.StatusOK, assets)
-}
-
-// handleAdminCreateAsset принимает данные от формы создания на фронтенде
+// handleAdminCreateAsset регистрирует актив для файла, который уже лежит в хранилище
+// (например, залит напрямую в бакет). Обработка не запускается: актив сразу ready.
 func (s *Server) handleAdminCreateAsset(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		Title       string `json:"title"`
 		Description string `json:"description"`
 		StoragePath string `json:"storage_path"`
 		OwnerID     string `json:"owner_id"`
+		Visibility  string `json:"visibility"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -33,17 +26,44 @@ func (s *Server) handleAdminCreateAsset(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ownerUUID, _ := uuid.Parse(payload.OwnerID)
+	ownerUUID, err := uuid.Parse(payload.OwnerID)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid owner_id")
+		return
+	}
+	if payload.Title == "" {
+		s.respondError(w, http.StatusBadRequest, "title is required")
+		return
+	}
+	if payload.Visibility == "" {
+		payload.Visibility = repository.VisibilityPrivate
+	}
+	if !repository.ValidVisibility(payload.Visibility) {
+		s.respondError(w, http.StatusBadRequest, "visibility must be private, unlisted or public")
+		return
+	}
+
+	key, err := storage.Key(payload.StoragePath)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid storage_path")
+		return
+	}
+	if _, err := s.video.Storage().Stat(r.Context(), key); err != nil {
+		s.respondError(w, http.StatusBadRequest, "storage_path: file not found in storage")
+		return
+	}
 
 	asset := &repository.MediaAsset{
 		OwnerID:     ownerUUID,
 		Title:       payload.Title,
 		Description: payload.Description,
-		StoragePath: payload.StoragePath,
+		StoragePath: key,
 		Status:      "ready",
+		Visibility:  payload.Visibility,
 	}
 
 	if err := s.media.SaveAsset(r.Context(), asset); err != nil {
+		s.logger.Error("Failed to save asset", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "could not save asset")
 		return
 	}
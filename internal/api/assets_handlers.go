@@ -0,0 +1,335 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+// viewer определяет, кто смотрит: из контекста AuthMiddleware или, на публичных роутах,
+// из необязательного Bearer-токена. Без токена — анонимный зритель.
+func (s *Server) viewer(r *http.Request) repository.Viewer {
+	if uid, ok := types.GetUserID(r.Context()); ok {
+		role, _ := r.Context().Value(types.UserRoleKey).(string)
+		return repository.Viewer{UserID: uid, Role: role}
+	}
+
+	claims := s.bearerClaims(r)
+	if claims == nil {
+		return repository.Viewer{}
+	}
+	uid, err := claims.UserID()
+	if err != nil {
+		return repository.Viewer{}
+	}
+	return repository.Viewer{UserID: uid, Role: claims.Role}
+}
+
+// handleListAssets возвращает страницу активов, видимых пользователю: свои, публичные и расшаренные ему.
+// Администраторы и модераторы видят все.
+// Параметры: ?q=поиск&owner_id=&status=ready&content_type=video/*&from=2026-01-01&to=...&cursor=&limit=50
+func (s *Server) handleListAssets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := repository.AssetFilter{
+		Status:      q.Get("status"),
+		ContentType: q.Get("content_type"),
+		Query:       q.Get("q"),
+		Cursor:      q.Get("cursor"),
+	}
+
+	if v := q.Get("owner_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid owner_id")
+			return
+		}
+		filter.OwnerID = id
+	}
+	var err error
+	if filter.From, err = parseTimeParam(q.Get("from")); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid from: use RFC 3339 or YYYY-MM-DD")
+		return
+	}
+	if filter.To, err = parseTimeParam(q.Get("to")); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid to: use RFC 3339 or YYYY-MM-DD")
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	viewer := s.viewer(r)
+	page, err := s.media.ListAssets(r.Context(), viewer, filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		s.respondError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to list assets", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch assets")
+		return
+	}
+	// Кому расшарен чужой актив — не дело зрителя
+	for i := range page.Items {
+		if !viewer.CanManage(&page.Items[i]) {
+			page.Items[i].SharedWith = nil
+		}
+	}
+	s.respond(w, http.StatusOK, page)
+}
+
+// parseTimeParam разбирает дату из query: RFC 3339 или просто день (YYYY-MM-DD, полночь UTC)
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// assetAccessRequest — тело PUT /assets/{id}/access
+type assetAccessRequest struct {
+	Visibility string      `json:"visibility"`
+	SharedWith []uuid.UUID `json:"shared_with"`
+}
+
+// handleSetAssetAccess меняет видимость актива и список доступа. Только владелец или администратор.
+func (s *Server) handleSetAssetAccess(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var req assetAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !repository.ValidVisibility(req.Visibility) {
+		s.respondError(w, http.StatusBadRequest, "visibility must be private, unlisted or public")
+		return
+	}
+
+	asset, viewer, ok := s.manageableAsset(w, r, id)
+	if !ok {
+		return
+	}
+
+	err = s.media.SetAccess(r.Context(), id, req.Visibility, req.SharedWith)
+	if errors.Is(err, repository.ErrUnknownUser) {
+		s.respondError(w, http.StatusBadRequest, "shared_with contains unknown user")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to update asset access", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to update access")
+		return
+	}
+
+	s.logger.Info("🔐 Asset access changed",
+		zap.String("asset_id", id.String()),
+		zap.String("visibility", req.Visibility),
+		zap.Int("shared_with", len(req.SharedWith)),
+		zap.String("by", viewer.UserID.String()))
+
+	asset.Visibility = req.Visibility
+	asset.SharedWith = req.SharedWith
+	if asset.SharedWith == nil {
+		asset.SharedWith = []uuid.UUID{}
+	}
+	s.respond(w, http.StatusOK, asset)
+}
+
+// manageableAsset загружает актив, который текущий пользователь вправе менять (владелец или администратор).
+// Чужой невидимый актив — 404, видимый, но чужой — 403. При ошибке сам отвечает клиенту.
+func (s *Server) manageableAsset(w http.ResponseWriter, r *http.Request, id uuid.UUID) (*repository.MediaAsset, repository.Viewer, bool) {
+	viewer := s.viewer(r)
+	asset, err := s.media.GetVisibleAsset(r.Context(), id, viewer)
+	if errors.Is(err, repository.ErrAssetNotFound) {
+		s.respondError(w, http.StatusNotFound, "Video not found")
+		return nil, viewer, false
+	}
+	if err != nil {
+		s.logger.Error("Failed to fetch asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch asset")
+		return nil, viewer, false
+	}
+	if !viewer.CanManage(asset) {
+		s.respondError(w, http.StatusForbidden, "Изменять видео может только владелец")
+		return nil, viewer, false
+	}
+	return asset, viewer, true
+}
+
+// assetUpdateRequest — тело PATCH /assets/{id}; отсутствующие поля не меняются
+type assetUpdateRequest struct {
+	Title       *string                `json:"title"`
+	Description *string                `json:"description"`
+	Metadata    map[string]interface{} `json:"metadata"` // Сохраняется в metadata.custom, системные ключи не трогает
+}
+
+// handleUpdateAsset меняет название, описание и пользовательские поля (metadata.custom)
+func (s *Server) handleUpdateAsset(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var req assetUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Title != nil && strings.TrimSpace(*req.Title) == "" {
+		s.respondError(w, http.StatusBadRequest, "title must not be empty")
+		return
+	}
+
+	if _, _, ok := s.manageableAsset(w, r, id); !ok {
+		return
+	}
+
+	asset, err := s.media.UpdateAsset(r.Context(), id, repository.AssetPatch{
+		Title:       req.Title,
+		Description: req.Description,
+		Custom:      req.Metadata,
+	})
+	if errors.Is(err, repository.ErrAssetNotFound) {
+		s.respondError(w, http.StatusNotFound, "Video not found")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to update asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to update asset")
+		return
+	}
+	s.respond(w, http.StatusOK, asset)
+}
+
+// handleReplaceAssetFile заменяет исходный видеофайл (multipart, поле "video").
+// Старые манифесты и задачи снимаются, новая версия заново проходит обработку.
+func (s *Server) handleReplaceAssetFile(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	asset, viewer, ok := s.manageableAsset(w, r, id)
+	if !ok {
+		return
+	}
+	// В квоту владельца идет только прирост размера; замену администратором чужого файла не ограничиваем
+	ownQuota := viewer.UserID == asset.OwnerID
+	if ownQuota && !s.checkQuota(w, r, viewer.UserID, viewer.Role, max(r.ContentLength-multipartOverhead, 0)-assetSize(asset)) {
+		return
+	}
+
+	video, ok := s.receiveVideo(w, r)
+	if !ok {
+		return
+	}
+	defer func() { _ = os.Remove(video.Path) }()
+	if ownQuota && !s.checkQuota(w, r, viewer.UserID, viewer.Role, video.Header.Size-assetSize(asset)) {
+		return
+	}
+
+	ctx := r.Context()
+	src, err := s.storeSource(ctx, video.Path, newUpload{
+		OwnerID:     asset.OwnerID,
+		FileName:    video.Header.Filename,
+		ContentType: video.Header.Header.Get("Content-Type"),
+		Size:        video.Header.Size,
+		Checksum:    video.Checksum,
+	})
+	if s.respondRejectedUpload(w, err) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("Replace: failed to store file", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "Ошибка записи в хранилище")
+		return
+	}
+
+	oldKey, err := s.media.ReplaceSource(ctx, id, src.Key, src.Checksum, src.Duration, src.Metadata)
+	s.releaseSourceHold(ctx, src)
+	if err != nil {
+		s.releaseStoredKey(ctx, src.Key)
+		if errors.Is(err, repository.ErrAssetNotFound) {
+			s.respondError(w, http.StatusNotFound, "Video not found")
+			return
+		}
+		s.logger.Error("Replace: failed to update asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to update asset")
+		return
+	}
+	// Задачи старой версии больше не нужны: их файл сейчас исчезнет
+	if _, err := s.jobs.CancelAssetJobs(ctx, id); err != nil {
+		s.logger.Warn("Replace: failed to cancel old jobs", zap.String("asset_id", id.String()), zap.Error(err))
+	}
+	if oldKey != src.Key {
+		s.releaseStoredKey(ctx, oldKey)
+	}
+
+	updated, err := s.media.GetAssetByID(ctx, id)
+	if err != nil {
+		s.logger.Error("Replace: failed to reload asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch asset")
+		return
+	}
+	s.enqueueProcessing(ctx, updated)
+
+	s.logger.Info("🔁 Asset file replaced",
+		zap.String("asset_id", id.String()),
+		zap.String("old_key", oldKey),
+		zap.String("new_key", src.Key),
+		zap.String("by", viewer.UserID.String()))
+	s.respond(w, http.StatusOK, updated)
+}
+
+// handleDeleteAsset переносит актив в корзину. Файлы и манифесты остаются до очистки
+// (trash.retention), до тех пор админ может восстановить актив.
+func (s *Server) handleDeleteAsset(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	_, viewer, ok := s.manageableAsset(w, r, id)
+	if !ok {
+		return
+	}
+
+	if _, err := s.media.TrashAsset(r.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrAssetNotFound) {
+			s.respondError(w, http.StatusNotFound, "Video not found")
+			return
+		}
+		s.logger.Error("Failed to delete asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to delete asset")
+		return
+	}
+
+	s.logger.Info("🗑️ Asset moved to trash",
+		zap.String("asset_id", id.String()),
+		zap.String("by", viewer.UserID.String()))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// События безопасности (поле event в логгере audit)
+const (
+	auditRefreshReuse = "refresh_token_reuse" // Повтор замененного refresh-токена: семейство отозвано
+)
+
+// audit пишет событие безопасности в логгер "audit": его отбирают по имени и отправляют в SIEM.
+// Кроме fields всегда пишутся пользователь, IP и User-Agent запроса.
+func (s *Server) audit(r *http.Request, event string, userID uuid.UUID, fields ...zap.Field) {
+	s.logger.Named("audit").Warn("🚨 Security event", append([]zap.Field{
+		zap.String("event", event),
+		zap.String("user_id", userID.String()),
+		zap.String("remote_addr", clientIP(r)),
+		zap.String("user_agent", r.UserAgent()),
+	}, fields...)...)
+}
@@ -1,40 +1,125 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/session"
+	"go.uber.org/zap"
 )
 
-// ParseToken инкапсулирует логику валидации JWT с проверкой HMAC.
-// Этот метод можно вызывать из любого места сервера.
-func (s *Server) ParseToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// HMAC Validation: проверяем, что алгоритм именно HS256
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.jwtSecret), nil
-	})
+// Типы токенов (claim typ). Access принимает только AuthMiddleware, refresh — только /refresh.
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+// ErrTokenType — токен валиден, но другого типа (refresh вместо access и наоборот)
+var ErrTokenType = errors.New("auth: wrong token type")
+
+// Claims — содержимое наших JWT
+type Claims struct {
+	jwt.RegisteredClaims
+	Name   string `json:"name,omitempty"`  // Для фронтенда
+	Role   string `json:"role"`            // RBAC (Role-Based Access Control), где доступ определяется значением поля role
+	Admin  bool   `json:"admin,omitempty"` // Для фронтенда; права проверяются только по Role
+	Type   string `json:"typ"`             // TokenAccess или TokenRefresh
+	Family string `json:"fam,omitempty"`   // Семейство refresh-токенов (session.Store), только у refresh
+}
+
+// UserID — ID пользователя из sub
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// ParseToken проверяет подпись (ключ выбирается по kid, см. keys.Set.Keyfunc), срок действия,
+// iss/aud (auth.issuer, auth.audience) и тип токена. Этот метод можно вызывать из любого места сервера.
+func (s *Server) ParseToken(tokenString, tokenType string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(s.jwtKeys.Methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if s.jwtIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.jwtIssuer))
+	}
+	if s.jwtAudience != "" {
+		opts = append(opts, jwt.WithAudience(s.jwtAudience))
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.jwtKeys.Keyfunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrTokenType, claims.Type, tokenType)
+	}
+	return claims, nil
 }
 
-// GenerateToken создает подписанный JWT токен для пользователя.
+// GenerateToken создает подписанный JWT токен типа tokenType для пользователя.
 // ttl — время жизни токена (например, 15 минут для Access или 7 дней для Refresh).
-func (s *Server) GenerateToken(userID uuid.UUID, username string, role string, ttl time.Duration) (string, error) {
-	claims := jwt.MapClaims{
-		"sub":   userID.String(),            // Идентификатор пользователя
-		"name":  username,                   // Добавляем для фронтенда
-		"role":  role,                       //  RBAC (Role-Based Access Control), где доступ определяется значением поля role.
-		"admin": true,                       // Флаг прав доступа
-		"exp":   time.Now().Add(ttl).Unix(), // Время истечения
-		"iat":   time.Now().Unix(),          // Время выпуска
-	}
-	
-	// Создаем токен с методом подписи HMAC HS256
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Подписываем токен нашим секретом из конфига (s.jwtSecret)
-	return token.SignedString([]byte(s.jwtSecret))
+func (s *Server) GenerateToken(userID uuid.UUID, username, role, tokenType string, ttl time.Duration) (string, error) {
+	claims := s.newClaims(userID, tokenType, ttl)
+	claims.Name = username
+	claims.Role = role
+	claims.Admin = role == repository.RoleAdmin
+
+	// Подписываем активным ключом (EdDSA/RS256 с kid) или, если ключей нет, секретом HS256
+	return s.jwtKeys.Sign(claims)
+}
+
+// GenerateRefreshToken создает refresh-токен семейства familyID и возвращает его вместе с ID (jti),
+// под которым токен учитывается в session.Store. Логин и роль в refresh не пишутся: /refresh берет их из БД.
+func (s *Server) GenerateRefreshToken(userID uuid.UUID, familyID string, ttl time.Duration) (string, string, error) {
+	claims := s.newClaims(userID, TokenRefresh, ttl)
+	claims.Family = familyID
+
+	token, err := s.jwtKeys.Sign(claims)
+	return token, claims.ID, err
+}
+
+func (s *Server) newClaims(userID uuid.UUID, tokenType string, ttl time.Duration) Claims {
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(), // jti: уникален даже для токенов, выпущенных в одну секунду
+			Subject:   userID.String(),  // Идентификатор пользователя
+			Issuer:    s.jwtIssuer,      // Пусто — не пишется и не проверяется
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Type: tokenType,
+	}
+	if s.jwtAudience != "" {
+		claims.Audience = jwt.ClaimStrings{s.jwtAudience}
+	}
+	return claims
+}
+
+// handleJWKS публикует открытые ключи проверки токенов (RFC 7517) — без обертки APIResponse,
+// в том виде, который ждут JWT-библиотеки других сервисов. Общий секрет не публикуется.
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(s.jwtKeys.JWKS()); err != nil {
+		s.logger.Error("failed to encode JWKS", zap.Error(err))
+	}
+}
+
+// newSessionStore создает хранилище семейств refresh-токенов (auth.refresh_token_ttl, auth.refresh_reuse_grace)
+func (s *Server) newSessionStore() *session.Store {
+	refreshTTL := viper.GetDuration("auth.refresh_token_ttl")
+	if refreshTTL == 0 {
+		refreshTTL = 168 * time.Hour
+	}
+	return session.New(s.rdb, refreshTTL, viper.GetDuration("auth.refresh_reuse_grace"))
 }
@@ -1,16 +1,24 @@
 package api
 
 import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xela07ax/universal-backend-streaming/internal/keys"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestGenerateAndParseToken(t *testing.T) {
-	s := &Server{jwtSecret: "test-secret-2026"}
+	s := &Server{jwtKeys: keys.NewHMAC("test-secret-2026"), jwtIssuer: "hydro", jwtAudience: "hydro-api"}
 
 	// Подготовка тестовых данных 2026
 	testID := uuid.New()
@@ -19,28 +27,230 @@ func TestGenerateAndParseToken(t *testing.T) {
 	ttl := 1 * time.Hour
 
 	// 1. Тест успешной генерации и парсинга
-	// Теперь передаем 4 аргумента: ID, name, role, ttl
-	tokenString, err := s.GenerateToken(testID, username, role, ttl)
+	tokenString, err := s.GenerateToken(testID, username, role, TokenAccess, ttl)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
 
-	token, err := s.ParseToken(tokenString)
-	assert.NoError(t, err)
-	assert.True(t, token.Valid)
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	assert.True(t, ok)
+	claims, err := s.ParseToken(tokenString, TokenAccess)
+	require.NoError(t, err)
 
 	// Проверяем данные внутри токена
-	// sub — это UUID пользователя
-	assert.Equal(t, testID.String(), claims["sub"])
-	// name — имя пользователя
-	assert.Equal(t, username, claims["name"])
-	// role — роль пользователя
-	assert.Equal(t, role, claims["role"])
+	assert.Equal(t, testID.String(), claims.Subject)
+	assert.Equal(t, username, claims.Name)
+	assert.Equal(t, role, claims.Role)
+	assert.True(t, claims.Admin)
+	assert.Equal(t, "hydro", claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{"hydro-api"}, claims.Audience)
+	assert.NotEmpty(t, claims.ID)
 
 	// 2. Тест с неверным секретом
-	wrongServer := &Server{jwtSecret: "wrong-secret"}
-	_, err = wrongServer.ParseToken(tokenString)
+	wrongServer := &Server{jwtKeys: keys.NewHMAC("wrong-secret"), jwtIssuer: "hydro", jwtAudience: "hydro-api"}
+	_, err = wrongServer.ParseToken(tokenString, TokenAccess)
 	assert.Error(t, err, "Должна быть ошибка валидации подписи")
 }
+
+func TestGenerateToken_AdminOnlyForAdmins(t *testing.T) {
+	s := &Server{jwtKeys: keys.NewHMAC("test-secret-2026")}
+
+	for _, role := range []string{"user", "streamer", "moderator"} {
+		tokenString, err := s.GenerateToken(uuid.New(), "bob", role, TokenAccess, time.Hour)
+		require.NoError(t, err)
+		claims, err := s.ParseToken(tokenString, TokenAccess)
+		require.NoError(t, err)
+		assert.False(t, claims.Admin, role)
+	}
+}
+
+func TestParseToken_TypesAreSeparated(t *testing.T) {
+	s := &Server{jwtKeys: keys.NewHMAC("test-secret-2026"), jwtIssuer: "hydro", jwtAudience: "hydro-api"}
+
+	refresh, err := s.GenerateToken(uuid.New(), "bob", "user", TokenRefresh, time.Hour)
+	require.NoError(t, err)
+	access, err := s.GenerateToken(uuid.New(), "bob", "user", TokenAccess, time.Hour)
+	require.NoError(t, err)
+
+	_, err = s.ParseToken(refresh, TokenAccess)
+	assert.ErrorIs(t, err, ErrTokenType, "refresh не годится как access")
+	_, err = s.ParseToken(access, TokenRefresh)
+	assert.ErrorIs(t, err, ErrTokenType, "access не годится как refresh")
+
+	_, err = s.ParseToken(refresh, TokenRefresh)
+	assert.NoError(t, err)
+}
+
+func TestParseToken_IssuerAndAudience(t *testing.T) {
+	s := &Server{jwtKeys: keys.NewHMAC("test-secret-2026"), jwtIssuer: "hydro", jwtAudience: "hydro-api"}
+
+	other := &Server{jwtKeys: keys.NewHMAC("test-secret-2026"), jwtIssuer: "other", jwtAudience: "hydro-api"}
+	tokenString, err := other.GenerateToken(uuid.New(), "bob", "user", TokenAccess, time.Hour)
+	require.NoError(t, err)
+	_, err = s.ParseToken(tokenString, TokenAccess)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+	other = &Server{jwtKeys: keys.NewHMAC("test-secret-2026"), jwtIssuer: "hydro", jwtAudience: "billing"}
+	tokenString, err = other.GenerateToken(uuid.New(), "bob", "user", TokenAccess, time.Hour)
+	require.NoError(t, err)
+	_, err = s.ParseToken(tokenString, TokenAccess)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+
+	// Токены без типа (выпущенные до typed claims) не принимаются
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": uuid.NewString(), "role": "admin", "iss": "hydro", "aud": "hydro-api",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	legacyString, err := legacy.SignedString([]byte("test-secret-2026"))
+	require.NoError(t, err)
+	_, err = s.ParseToken(legacyString, TokenAccess)
+	assert.ErrorIs(t, err, ErrTokenType)
+}
+
+func TestParseToken_RejectsExpiredAndUnsigned(t *testing.T) {
+	s := &Server{jwtKeys: keys.NewHMAC("test-secret-2026")}
+
+	expired, err := s.GenerateToken(uuid.New(), "bob", "user", TokenAccess, -time.Minute)
+	require.NoError(t, err)
+	_, err = s.ParseToken(expired, TokenAccess)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{Role: "admin", Type: TokenAccess,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}})
+	noneString, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = s.ParseToken(noneString, TokenAccess)
+	assert.Error(t, err)
+}
+
+func TestParseToken_KeyRotation(t *testing.T) {
+	oldKey, err := keys.Generate(keys.AlgEdDSA)
+	require.NoError(t, err)
+	newKey, err := keys.Generate(keys.AlgRS256)
+	require.NoError(t, err)
+
+	before := &Server{jwtKeys: keys.NewSet(oldKey)}
+	oldToken, err := before.GenerateToken(uuid.New(), "bob", "user", TokenAccess, time.Hour)
+	require.NoError(t, err)
+
+	// После ротации подписываем новым ключом, старый только проверяет (закрытой части нет)
+	retired := &keys.Key{ID: oldKey.ID, Alg: oldKey.Alg, Public: oldKey.Public}
+	after := &Server{jwtKeys: keys.NewSet(newKey, retired)}
+	newToken, err := after.GenerateToken(uuid.New(), "bob", "user", TokenAccess, time.Hour)
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID, parsed.Header["kid"])
+	assert.Equal(t, keys.AlgRS256, parsed.Method.Alg())
+
+	_, err = after.ParseToken(oldToken, TokenAccess)
+	assert.NoError(t, err, "токены прежнего ключа живут до истечения")
+	_, err = after.ParseToken(newToken, TokenAccess)
+	assert.NoError(t, err)
+
+	// Ключ удален из набора — его токены больше не принимаются
+	_, err = (&Server{jwtKeys: keys.NewSet(newKey)}).ParseToken(oldToken, TokenAccess)
+	assert.Error(t, err)
+	other, err := keys.Generate(keys.AlgRS256)
+	require.NoError(t, err)
+	_, err = (&Server{jwtKeys: keys.NewSet(other)}).ParseToken(newToken, TokenAccess)
+	assert.ErrorIs(t, err, keys.ErrUnknownKey)
+
+	// Без auth.jwt_secret HS256-токены без kid не принимаются
+	hmacToken, err := (&Server{jwtKeys: keys.NewHMAC("test-secret-2026")}).GenerateToken(uuid.New(), "bob", "admin", TokenAccess, time.Hour)
+	require.NoError(t, err)
+	_, err = after.ParseToken(hmacToken, TokenAccess)
+	assert.Error(t, err)
+}
+
+func TestParseToken_RejectsAlgorithmConfusion(t *testing.T) {
+	k, err := keys.Generate(keys.AlgEdDSA)
+	require.NoError(t, err)
+	s := &Server{jwtKeys: keys.NewSet(k)}
+
+	// HS256 с kid ключа EdDSA и открытым ключом в роли секрета
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{Role: "admin", Type: TokenAccess,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}})
+	forged.Header["kid"] = k.ID
+	forgedString, err := forged.SignedString([]byte(k.Public.(ed25519.PublicKey)))
+	require.NoError(t, err)
+
+	_, err = s.ParseToken(forgedString, TokenAccess)
+	assert.Error(t, err)
+}
+
+func TestHandleJWKS(t *testing.T) {
+	k, err := keys.Generate(keys.AlgEdDSA)
+	require.NoError(t, err)
+	s := &Server{logger: zap.NewNop(), jwtKeys: keys.NewSet(k)}
+
+	rec := httptest.NewRecorder()
+	s.handleJWKS(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body keys.JWKS
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Len(t, body.Keys, 1)
+	assert.Equal(t, k.ID, body.Keys[0].Kid)
+	assert.Equal(t, "OKP", body.Keys[0].Kty)
+	assert.Equal(t, keys.AlgEdDSA, body.Keys[0].Alg)
+	assert.NotContains(t, rec.Body.String(), "\"d\"", "закрытая часть не публикуется")
+}
+
+func TestGenerateRefreshToken_Family(t *testing.T) {
+	s := &Server{jwtKeys: keys.NewHMAC("test-secret-2026")}
+	userID := uuid.New()
+
+	token, tokenID, err := s.GenerateRefreshToken(userID, "family-1", time.Hour)
+	require.NoError(t, err)
+
+	claims, err := s.ParseToken(token, TokenRefresh)
+	require.NoError(t, err)
+	assert.Equal(t, "family-1", claims.Family)
+	assert.Equal(t, tokenID, claims.ID)
+	assert.Equal(t, userID.String(), claims.Subject)
+	assert.Empty(t, claims.Role, "роль в refresh не пишется: /refresh берет ее из БД")
+
+	_, err = s.ParseToken(token, TokenAccess)
+	assert.ErrorIs(t, err, ErrTokenType)
+}
+
+func TestHandleRefresh_RejectsTokensWithoutFamily(t *testing.T) {
+	s := &Server{logger: zap.NewNop(), jwtKeys: keys.NewHMAC("test-secret-2026")}
+
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "hydro_refresh_token", Value: token})
+		rec := httptest.NewRecorder()
+		s.handleRefresh(rec, req)
+		return rec.Code
+	}
+
+	// Refresh без семейства (выпущенный до семейств) и access-токен в куке
+	legacy, err := s.GenerateToken(uuid.New(), "bob", "user", TokenRefresh, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, call(legacy))
+
+	access, err := s.GenerateToken(uuid.New(), "bob", "user", TokenAccess, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, call(access))
+}
+
+func TestAudit(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	s := &Server{logger: zap.New(core)}
+	userID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/refresh", nil)
+	req.RemoteAddr = "203.0.113.7:4242"
+	req.Header.Set("User-Agent", "curl/8")
+	s.audit(req, auditRefreshReuse, userID, zap.String("family", "family-1"))
+
+	entries := logs.FilterLoggerName("audit").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, zap.WarnLevel, entries[0].Level)
+	assert.Equal(t, auditRefreshReuse, fields["event"])
+	assert.Equal(t, userID.String(), fields["user_id"])
+	assert.Equal(t, "203.0.113.7", fields["remote_addr"])
+	assert.Equal(t, "curl/8", fields["user_agent"])
+	assert.Equal(t, "family-1", fields["family"])
+}
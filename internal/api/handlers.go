@@ -2,19 +2,26 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/spf13/viper"
 	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/session"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"github.com/xela07ax/universal-backend-streaming/internal/streaming"
 	"github.com/xela07ax/universal-backend-streaming/internal/types"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
@@ -28,54 +35,149 @@ func (s *Server) handleGetVideoURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	asset, err := s.media.GetAssetByID(r.Context(), id)
-	if err != nil {
+	// Приватные видео — только владельцу, списку доступа, админам и модераторам
+	asset, err := s.media.GetVisibleAsset(r.Context(), id, s.viewer(r))
+	if errors.Is(err, repository.ErrAssetNotFound) {
 		s.respondError(w, http.StatusNotFound, "Video not found")
 		return
 	}
+	if err != nil {
+		s.logger.Error("Failed to fetch asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "Failed to fetch video")
+		return
+	}
 
-	streamingURL := s.video.BuildURL(asset.StoragePath)
+	// Ссылки подписаны и истекают (storage.url_ttl); с video.bind_urls_to_user — только для владельца JWT
+	grant := streaming.URLGrant{AssetID: asset.ID.String()}
+	if viper.GetBool("video.bind_urls_to_user") {
+		grant.UserID = s.bearerSubject(r)
+	}
 
-	// ВАЖНО: структура ответа должна совпадать с тем, что ищет фронтенд
-	s.respond(w, http.StatusOK, map[string]string{
-		"url":   streamingURL,
-		"title": asset.Title,
+	streamingURL, err := s.video.BuildURL(r.Context(), asset.StoragePath, grant)
+	if err != nil {
+		s.logger.Error("Failed to build video URL", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "Failed to build video URL")
+		return
+	}
+
+	// Адаптивные манифесты (HLS/DASH), если упаковщик уже обработал видео
+	endpoints, err := s.endpoints.GetByAssetID(r.Context(), id)
+	if err != nil {
+		s.logger.Warn("Failed to fetch streaming endpoints", zap.String("asset_id", id.String()), zap.Error(err))
+	}
+	list := make([]videoEndpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		manifestGrant := grant
+		manifestGrant.Dir = true // Сегменты и плейлисты вариантов лежат рядом с манифестом
+		u, err := s.video.BuildURL(r.Context(), e.ManifestPath, manifestGrant)
+		if err != nil {
+			s.logger.Warn("Failed to build manifest URL", zap.String("path", e.ManifestPath), zap.Error(err))
+			continue
+		}
+		list = append(list, videoEndpoint{
+			Protocol:   e.Protocol,
+			Resolution: e.Resolution,
+			URL:        u,
+		})
+	}
+
+	// ВАЖНО: структура ответа должна совпадать с тем, что ищет фронтенд.
+	// "url" — прогрессивный MP4 (фолбэк для старых плееров), "endpoints" — адаптивная раздача.
+	s.respond(w, http.StatusOK, map[string]interface{}{
+		"url":        streamingURL,
+		"title":      asset.Title,
+		"visibility": asset.Visibility,
+		"endpoints":  list,
 	})
 }
 
+// videoEndpoint — манифест в ответе /video/{id}
+type videoEndpoint struct {
+	Protocol   string `json:"protocol"`
+	Resolution string `json:"resolution"`
+	URL        string `json:"url"`
+}
+
 // handleAdminUploadAsset принимает видеофайл и метаданные
 func (s *Server) handleAdminUploadAsset(w http.ResponseWriter, r *http.Request) {
-	// 1. Извлекаем данные из контекста (ID и Роль)
+	// 1. Извлекаем данные из контекста (ID и Роль). Право на загрузку проверил RoleMiddleware.
 	userID, ok := types.GetUserID(r.Context())
 	if !ok {
 		s.respondError(w, http.StatusUnauthorized, "Не удалось идентифицировать пользователя")
 		return
 	}
 	role := types.GetUserRole(r.Context())
-	// ПРОВЕРКА РОЛИ: только admin может продолжать
-	if role != "admin" {
-		s.logger.Warn("🚫 Unauthorized upload attempt",
-			zap.String("user_id", userID.String()),
-			zap.String("role", role), // Теперь тут будет "user" или пусто, но не null
-		)
-		s.respondError(w, http.StatusForbidden, "У вас нет прав для загрузки видео")
+
+	// 2. Квота — до того, как принят первый байт. Content-Length включает поля формы,
+	// поэтому на них дается запас, а точный размер файла проверяется после приема.
+	if !s.checkQuota(w, r, userID, role, max(r.ContentLength-multipartOverhead, 0)) {
 		return
 	}
 
-	// 2. Лимит на чтение (505MB)
-	r.Body = http.MaxBytesReader(w, r.Body, 505<<20)
+	// 3. Файл во временную папку: в хранилище попадет только проверенное видео
+	video, ok := s.receiveVideo(w, r)
+	if !ok {
+		return
+	}
+	// После успеха файл уже перенесен в хранилище, и Remove ничего не найдет
+	defer func() { _ = os.Remove(video.Path) }()
+	if !s.checkQuota(w, r, userID, role, video.Header.Size) {
+		return
+	}
+
+	// 4. Метаданные (пустой title — имя файла)
+	visibility := r.FormValue("visibility")
+	if visibility != "" && !repository.ValidVisibility(visibility) {
+		s.respondError(w, http.StatusBadRequest, "visibility must be private, unlisted or public")
+		return
+	}
+
+	// 5. Проверка, перенос в хранилище и запись в БД
+	asset, err := s.createAssetFromFile(r.Context(), video.Path, newUpload{
+		OwnerID:     userID, // Используем динамический ID из токена
+		Title:       r.FormValue("title"),
+		Visibility:  visibility,
+		FileName:    video.Header.Filename,
+		ContentType: video.Header.Header.Get("Content-Type"),
+		Size:        video.Header.Size,
+		Checksum:    video.Checksum,
+	})
+	if s.respondRejectedUpload(w, err) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("Upload: failed to store asset", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "Ошибка записи в хранилище")
+		return
+	}
+
+	s.logger.Info("Video uploaded successfully", zap.String("user_id", userID.String()))
+	s.respond(w, http.StatusCreated, asset)
+}
+
+// receivedVideo — принятое поле "video" во временном файле
+type receivedVideo struct {
+	Path     string
+	Header   *multipart.FileHeader
+	Checksum string // SHA-256 (hex), посчитан по ходу записи на диск
+}
+
+// receiveVideo принимает поле "video" multipart-формы (не больше uploads.max_size) и сохраняет его
+// во временный файл в storage.work_dir/uploads. При ошибке сам отвечает клиенту и возвращает ok = false.
+// Удалить временный файл — забота вызывающего.
+func (s *Server) receiveVideo(w http.ResponseWriter, r *http.Request) (*receivedVideo, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, viper.GetInt64("uploads.max_size"))
 
-	// 3. Парсим форму
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		s.logger.Error("Upload: parse form error", zap.Error(err))
 		s.respondError(w, http.StatusRequestEntityTooLarge, "Файл слишком большой")
-		return
+		return nil, false
 	}
 
 	file, header, err := r.FormFile("video")
 	if err != nil {
 		s.respondError(w, http.StatusBadRequest, "Поле 'video' не найдено")
-		return
+		return nil, false
 	}
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
@@ -83,90 +185,192 @@ func (s *Server) handleAdminUploadAsset(w http.ResponseWriter, r *http.Request)
 		}
 	}()
 
-	// 4. Подготовка путей
-	title := r.FormValue("title")
-	if title == "" {
-		title = header.Filename
-	}
-
-	ext := filepath.Ext(header.Filename)
-	fileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	uploadDir := filepath.Join("web", "dist", "uploads")
-
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+	workDir := filepath.Join(viper.GetString("storage.work_dir"), "uploads")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
 		s.logger.Error("Upload: mkdir error", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Ошибка хранилища")
-		return
+		return nil, false
 	}
-
-	storagePath := filepath.Join("uploads", fileName)
-	fullPath := filepath.Join("web", "dist", storagePath)
-
-	// 5. Сохранение файла с механизмом отката
-	dst, err := os.Create(fullPath)
+	// Имя клиента в путь не попадает: тип файла определит проверка содержимого
+	dst, err := os.CreateTemp(workDir, "upload-*")
 	if err != nil {
 		s.logger.Error("Upload: create file error", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Ошибка создания файла")
-		return
+		return nil, false
 	}
 
-	var success bool
-	defer func() {
-		// 1. Закрываем файл и проверяем ошибку
-		if err := dst.Close(); err != nil {
-			s.logger.Error("❌ Upload: failed to close destination file", zap.Error(err))
-			// Если закрытие не удалось, мы не можем считать операцию успешной
-			success = false
-		}
-
-		// 2. Если в процессе возникла ошибка или закрытие файла упало — удаляем мусор
-		if !success {
-			s.logger.Warn("Rolling back: deleting file", zap.String("path", fullPath))
-			if err := os.Remove(fullPath); err != nil {
-				// Требует внимания администратора.
-				s.logger.Warn("⚠️ Failed to remove orphaned file",
-					zap.String("path", fullPath),
-					zap.Error(err),
-				)
-			}
-		}
-	}()
-
-	if _, err := io.Copy(dst, file); err != nil {
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, h), file); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
 		s.logger.Error("Upload: copy error", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Ошибка записи")
-		return
+		return nil, false
 	}
 
 	// Явно закрываем файл, чтобы освободить дескриптор для ОС
 	if err := dst.Close(); err != nil {
+		_ = os.Remove(dst.Name())
 		s.logger.Error("❌ Upload: failed to close file", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Ошибка при сохранении файла")
-		return
+		return nil, false
 	}
+	return &receivedVideo{Path: dst.Name(), Header: header, Checksum: hex.EncodeToString(h.Sum(nil))}, true
+}
 
-	// 6. Запись в БД
-	asset := &repository.MediaAsset{
-		ID:          uuid.New(),
-		OwnerID:     userID, // Используем динамический ID из токена
-		Title:       title,
-		StoragePath: filepath.ToSlash(storagePath),
-		Status:      "ready",
-		Metadata: map[string]interface{}{
-			"size": header.Size,
-			"type": header.Header.Get("Content-Type"),
-		},
+// errNotMedia — загруженный файл не является видео, которое мы умеем обрабатывать
+var errNotMedia = errors.New("upload: not a media file")
+
+// newUpload описывает принятый файл (multipart или tus)
+type newUpload struct {
+	OwnerID     uuid.UUID
+	Title       string
+	Description string
+	Visibility  string // Пусто или неизвестное значение — private
+	FileName    string // Исходное имя файла у клиента
+	ContentType string // Заявленный клиентом; в метаданные попадает тип по сигнатуре
+	Size        int64
+	Checksum    string // SHA-256 содержимого (hex) — по нему ищутся дубликаты
+	Trusted     bool   // Одобрено админом из карантина: allowlist и заявленный тип не проверяются
+}
+
+// storedSource — исходный файл, проверенный и перенесенный в хранилище
+type storedSource struct {
+	Key      string
+	Checksum string
+	Held     bool // Файл общий: взята ссылка AcquireBlob, ее возвращает releaseSourceHold
+	Duration int  // Секунды
+	Metadata map[string]interface{}
+}
+
+// storeSource проверяет содержимое локального файла (inspectUpload) и переносит файл в хранилище
+// под новым ключом по его содержимому (storage.BlobKey) с каноническим расширением формата. Если такой
+// файл уже хранится, копия не создается — актив будет ссылаться на существующий, а до записи актива
+// файл удерживается ссылкой (Held): после записи вызывающий обязан вызвать releaseSourceHold.
+// Отвергнутые файлы уходят в карантин (uploadRejection, errors.Is(err, errNotMedia)).
+func (s *Server) storeSource(ctx context.Context, localPath string, u newUpload) (*storedSource, error) {
+	u.FileName = normalizeFileName(u.FileName)
+	format, info, err := s.inspectUpload(localPath, u)
+	if err != nil {
+		var rejection *uploadRejection
+		if errors.As(err, &rejection) {
+			s.quarantineUpload(ctx, localPath, u, rejection)
+		}
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{"container": format.Name}
+	src := &storedSource{Checksum: u.Checksum}
+	// WebM/MKV не разбираем сами: длительность и дорожки определит обработка (ffprobe)
+	if info != nil {
+		metadata = info.Metadata()
+		metadata["duration"] = info.Duration
+		src.Duration = int(math.Round(info.Duration))
+	}
+	metadata["size"] = u.Size
+	metadata["type"] = format.MIME
+	src.Metadata = metadata
+
+	// Такое содержимое уже загружали — делим файл
+	blob, err := s.media.AcquireBlob(ctx, u.Checksum)
+	if err != nil && !errors.Is(err, repository.ErrBlobNotFound) {
+		s.logger.Warn("Upload: dedup lookup failed, storing a copy", zap.Error(err))
+	}
+	if err == nil {
+		src.Key, src.Held = blob.StoragePath, true
+		if stat, err := s.video.Storage().Stat(ctx, blob.StoragePath); err == nil && stat.Size == u.Size {
+			s.logger.Info("♻️ Upload deduplicated",
+				zap.String("key", blob.StoragePath),
+				zap.String("checksum", u.Checksum),
+				zap.Int("refs", blob.RefCount))
+			// Как и после PutFile, локального файла больше нет
+			if err := os.Remove(localPath); err != nil {
+				s.logger.Warn("Upload: failed to remove duplicate", zap.String("file", localPath), zap.Error(err))
+			}
+			return src, nil
+		}
+		// Файл пропал или не совпал по размеру — храним свою копию
+		s.releaseSourceHold(ctx, src)
+	}
+
+	src.Key = storage.BlobKey(u.Checksum, format.Ext)
+	if err := storage.PutFile(ctx, s.video.Storage(), src.Key, localPath); err != nil {
+		return nil, err
 	}
+	return src, nil
+}
 
-	if err := s.media.SaveAsset(r.Context(), asset); err != nil {
-		s.logger.Error("Upload: DB save error", zap.Error(err))
-		s.respondError(w, http.StatusInternalServerError, "Ошибка записи в базу")
+// releaseSourceHold возвращает ссылку на общий файл, взятую storeSource. Вызывается после записи
+// актива (его ссылку уже учел триггер) и до releaseStoredKey при откате.
+func (s *Server) releaseSourceHold(ctx context.Context, src *storedSource) {
+	if !src.Held {
 		return
 	}
+	src.Held = false
+	if err := s.media.DropBlobRef(context.WithoutCancel(ctx), src.Key); err != nil {
+		s.logger.Warn("⚠️ Failed to release shared file", zap.String("key", src.Key), zap.Error(err))
+	}
+}
 
-	success = true // Флаг для defer: файл удалять не нужно
-	s.logger.Info("Video uploaded successfully", zap.String("user_id", userID.String()))
-	s.respond(w, http.StatusCreated, asset)
+// releaseStoredKey вызывается, когда запись больше не ссылается на файл. Файл удаляется,
+// только если на него не ссылаются и другие активы (одинаковые загрузки делят один файл).
+func (s *Server) releaseStoredKey(ctx context.Context, key string) {
+	ctx = context.WithoutCancel(ctx)
+	unused, err := s.media.ReleaseBlob(ctx, key)
+	if err != nil {
+		s.logger.Warn("⚠️ Failed to release file", zap.String("key", key), zap.Error(err))
+		return
+	}
+	if !unused {
+		return
+	}
+	if err := s.video.Storage().Delete(ctx, key); err != nil {
+		s.logger.Warn("⚠️ Failed to remove orphaned file",
+			zap.String("key", key),
+			zap.Error(err),
+		)
+	}
+}
+
+// createAssetFromFile превращает локальный файл в MediaAsset: проверяет содержимое, переносит файл
+// в хранилище, сохраняет запись и ставит задачи обработки. При ошибке хранилище и БД остаются чистыми,
+// а локальный файл — на месте (отвергнутый — в карантине). Пустой Title — имя файла.
+func (s *Server) createAssetFromFile(ctx context.Context, localPath string, u newUpload) (*repository.MediaAsset, error) {
+	u.FileName = normalizeFileName(u.FileName)
+	if u.Title == "" {
+		u.Title = u.FileName
+	}
+	src, err := s.storeSource(ctx, localPath, u)
+	if err != nil {
+		return nil, err
+	}
+
+	asset := &repository.MediaAsset{
+		ID:          uuid.New(),
+		OwnerID:     u.OwnerID,
+		Title:       u.Title,
+		Description: u.Description,
+		StoragePath: src.Key,
+		Checksum:    src.Checksum,
+		Status:      "processing", // В ready/failed переведет воркер после обработки
+		Duration:    src.Duration,
+		Metadata:    src.Metadata,
+		Visibility:  repository.VisibilityPrivate,
+	}
+	if repository.ValidVisibility(u.Visibility) {
+		asset.Visibility = u.Visibility
+	}
+
+	err = s.media.SaveAsset(ctx, asset)
+	s.releaseSourceHold(ctx, src)
+	if err != nil {
+		// Откат: файл без записи в БД никому не нужен (если его не делит другой актив)
+		s.releaseStoredKey(ctx, src.Key)
+		return nil, fmt.Errorf("failed to save asset: %w", err)
+	}
+
+	s.enqueueProcessing(ctx, asset)
+	return asset, nil
 }
 
 // handleHealth проверяет работоспособность сервера и критических зависимостей (БД).
@@ -217,6 +421,11 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
+	if user.Disabled() {
+		s.logger.Warn("Login failed: account disabled", zap.String("user", req.Username))
+		s.respondError(w, http.StatusForbidden, "Account disabled")
+		return
+	}
 
 	// 3. Подготовка TTL (сначала определяем, потом используем)
 	accessTTL := viper.GetDuration("auth.access_token_ttl")
@@ -229,25 +438,25 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 4. Генерируем токены с полным набором данных
-	// Теперь передаем: ID, Username, Role и TTL
-	accessToken, err := s.GenerateToken(user.ID, user.Username, user.Role, accessTTL)
+	// Теперь передаем: ID, Username, Role, тип токена и TTL
+	accessToken, err := s.GenerateToken(user.ID, user.Username, user.Role, TokenAccess, accessTTL)
 	if err != nil {
 		s.logger.Error("Token access generation failed", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
-	refreshToken, err := s.GenerateToken(user.ID, user.Username, user.Role, refreshTTL)
+	// Refresh открывает новое семейство: все его преемники наследуют familyID
+	familyID := uuid.NewString()
+	refreshToken, tokenID, err := s.GenerateRefreshToken(user.ID, familyID, refreshTTL)
 	if err != nil {
 		s.logger.Error("Token refresh generation failed", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
-	// 5. Сохраняем сессию в Redis (связываем рефреш-токен с ID пользователя)
-	ctx := r.Context()
-	err = s.rdb.Set(ctx, "session:"+refreshToken, user.ID.String(), refreshTTL).Err()
-	if err != nil {
+	// 5. Сохраняем сессию в Redis: семейство -> владелец и jti текущего refresh-токена (сам JWT не храним)
+	if err := s.sessions.Start(r.Context(), familyID, user.ID, tokenID); err != nil {
 		s.logger.Error("Redis save error", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Failed to save session")
 		return
@@ -294,35 +503,32 @@ func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 	refreshToken := cookie.Value
 
-	// 2. Валидация токена
-	token, err := s.ParseToken(refreshToken)
-	if err != nil || !token.Valid {
-		s.logger.Warn("Refresh failed: invalid token signature", zap.Error(err))
+	// 2. Валидация токена: только refresh, access-токен в куке не принимаем
+	claims, err := s.ParseToken(refreshToken, TokenRefresh)
+	if err != nil {
+		s.logger.Warn("Refresh failed: invalid token", zap.Error(err))
 		s.respondError(w, http.StatusUnauthorized, "Invalid refresh token")
 		return
 	}
 
-	// 3. Извлекаем данные из Claims (нам нужны ID, Username и Role)
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	// 3. Из Claims нужны ID и семейство: логин и роль берем из БД
+	userIDStr := claims.Subject
+	userID, err := claims.UserID()
+	if err != nil || claims.Family == "" {
 		s.respondError(w, http.StatusUnauthorized, "Invalid token claims")
 		return
 	}
-
-	userIDStr, _ := claims["sub"].(string)
-	username, _ := claims["name"].(string)
-	role, _ := claims["role"].(string)
-	userID, _ := uuid.Parse(userIDStr)
-
-	// 4. ПРОВЕРКА В REDIS: Существует ли эта сессия?
 	ctx := r.Context()
-	// В Redis мы храним связь токен -> userID
-	storedID, err := s.rdb.Get(ctx, "session:"+refreshToken).Result()
-	if err != nil || storedID != userIDStr {
-		s.logger.Warn("Refresh failed: session revoked or mismatch", zap.String("userID", userIDStr))
+
+	// 4. Роль и логин — текущие из БД: смена роли и отключение действуют с первого обновления токена
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil || user.Disabled() {
+		s.logger.Warn("Refresh failed: user is gone or disabled", zap.String("userID", userIDStr), zap.Error(err))
+		_ = s.sessions.Revoke(ctx, claims.Family)
 		s.respondError(w, http.StatusUnauthorized, "Session expired or revoked")
 		return
 	}
+	username, role := user.Username, user.Role
 
 	// 5. Подготовка TTL
 	accessTTL := viper.GetDuration("auth.access_token_ttl")
@@ -334,22 +540,36 @@ func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		refreshTTL = 168 * time.Hour
 	}
 
-	// 6. ГЕНЕРАЦИЯ НОВОЙ ПАРЫ (с актуальными данными)
-	newAccessToken, err := s.GenerateToken(userID, username, role, accessTTL)
+	// 6. ГЕНЕРАЦИЯ НОВОЙ ПАРЫ (с актуальными данными) в том же семействе
+	newAccessToken, err := s.GenerateToken(userID, username, role, TokenAccess, accessTTL)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, "Internal error")
 		return
 	}
-	newRefreshToken, err := s.GenerateToken(userID, username, role, refreshTTL)
+	newRefreshToken, newTokenID, err := s.GenerateRefreshToken(userID, claims.Family, refreshTTL)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
-	// 7. РОТАЦИЯ В REDIS (Удаляем старый, пишем новый)
-	s.rdb.Del(ctx, "session:"+refreshToken)
-	err = s.rdb.Set(ctx, "session:"+newRefreshToken, userIDStr, refreshTTL).Err()
-	if err != nil {
+	// 7. РОТАЦИЯ В REDIS: принимается только текущий токен семейства. Повтор уже замененного
+	// означает кражу — семейство отзывается целиком.
+	switch err := s.sessions.Rotate(ctx, claims.Family, userID, claims.ID, newTokenID); {
+	case errors.Is(err, session.ErrReused):
+		s.audit(r, auditRefreshReuse, userID, zap.String("family", claims.Family), zap.String("jti", claims.ID))
+		s.respondError(w, http.StatusUnauthorized, "Session revoked")
+		return
+	case errors.Is(err, session.ErrRaced):
+		// Соседняя вкладка обновила токен мгновением раньше: новая кука уже у браузера
+		s.logger.Debug("Refresh raced", zap.String("userID", userIDStr), zap.String("family", claims.Family))
+		s.respondError(w, http.StatusConflict, "Session already refreshed")
+		return
+	case errors.Is(err, session.ErrNotFound):
+		s.logger.Warn("Refresh failed: session revoked or expired", zap.String("userID", userIDStr))
+		s.respondError(w, http.StatusUnauthorized, "Session expired or revoked")
+		return
+	case err != nil:
+		s.logger.Error("Redis rotate error", zap.Error(err))
 		s.respondError(w, http.StatusInternalServerError, "Failed to rotate session")
 		return
 	}
@@ -376,12 +596,14 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	// 1. Пытаемся достать Refresh-токен из куки
 	cookie, err := r.Cookie("hydro_refresh_token")
 	if err == nil {
-		refreshToken := cookie.Value
-		// 2. УДАЛЯЕМ ИЗ REDIS: Теперь этот токен больше никогда не сработает
-		ctx := r.Context()
-		s.rdb.Del(ctx, "session:"+refreshToken)
-
-		s.logger.Info("Session revoked in Redis", zap.String("token_tail", refreshToken[len(refreshToken)-8:]))
+		// 2. ОТЗЫВАЕМ СЕМЕЙСТВО В REDIS: ни этот токен, ни его преемники больше не сработают.
+		// У просроченного токена семейство уже истекло вместе с ним.
+		if claims, err := s.ParseToken(cookie.Value, TokenRefresh); err == nil && claims.Family != "" {
+			if err := s.sessions.Revoke(r.Context(), claims.Family); err != nil {
+				s.logger.Error("Redis revoke error", zap.Error(err))
+			}
+			s.logger.Info("Session revoked in Redis", zap.String("family", claims.Family))
+		}
 	}
 
 	// 3. ОБНУЛЯЕМ КУКУ В БРАУЗЕРЕ (ставим MaxAge: -1)
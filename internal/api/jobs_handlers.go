@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/worker"
+	"go.uber.org/zap"
+)
+
+// processingJobs — задачи, которые ставятся на каждую загрузку
+var processingJobs = []string{repository.JobTypePackage, repository.JobTypeThumbnail}
+
+// enqueueProcessing ставит задачи обработки загруженного файла. Если очередь недоступна,
+// актив сразу становится ready: исходный MP4 уже можно смотреть, а обработку перезапустит админ.
+func (s *Server) enqueueProcessing(ctx context.Context, asset *repository.MediaAsset) {
+	for _, jobType := range processingJobs {
+		job := &repository.Job{
+			Type:        jobType,
+			AssetID:     asset.ID,
+			Payload:     map[string]interface{}{"storage_key": asset.StoragePath},
+			MaxAttempts: viper.GetInt("worker.max_attempts"),
+		}
+		if err := s.jobs.Enqueue(ctx, job); err != nil {
+			s.logger.Error("❌ Failed to enqueue processing job",
+				zap.String("asset_id", asset.ID.String()),
+				zap.String("type", jobType),
+				zap.Error(err))
+			s.setAssetStatus(ctx, asset.ID, worker.AssetReady)
+			asset.Status = worker.AssetReady
+			return
+		}
+	}
+}
+
+// handleAdminListJobs возвращает очередь задач: ?status=dead&asset_id=...&limit=50
+func (s *Server) handleAdminListJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := repository.JobFilter{Status: q.Get("status")}
+
+	if v := q.Get("asset_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid asset_id")
+			return
+		}
+		filter.AssetID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	jobs, err := s.jobs.List(r.Context(), filter)
+	if err != nil {
+		s.logger.Error("Failed to list jobs", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch jobs")
+		return
+	}
+	s.respond(w, http.StatusOK, jobs)
+}
+
+// handleAdminRetryJob возвращает задачу из dead/cancelled в очередь, актив снова становится processing
+func (s *Server) handleAdminRetryJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.transitionJob(w, r, "retry", s.jobs.Retry)
+	if !ok {
+		return
+	}
+	s.setAssetStatus(r.Context(), job.AssetID, worker.AssetProcessing)
+	s.respond(w, http.StatusOK, job)
+}
+
+// handleAdminCancelJob снимает задачу из очереди. Если это была последняя незавершенная задача,
+// актив выходит из processing.
+func (s *Server) handleAdminCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.transitionJob(w, r, "cancel", s.jobs.Cancel)
+	if !ok {
+		return
+	}
+	active, dead, err := s.jobs.AssetJobStats(r.Context(), job.AssetID)
+	if err != nil {
+		s.logger.Warn("Failed to count asset jobs", zap.String("asset_id", job.AssetID.String()), zap.Error(err))
+	} else if status := worker.AssetStatusFor(active, dead); status != "" {
+		s.setAssetStatus(r.Context(), job.AssetID, status)
+	}
+	s.respond(w, http.StatusOK, job)
+}
+
+// transitionJob — общая часть retry/cancel: разбор ID и коды ответа. false — ответ с ошибкой уже отправлен.
+func (s *Server) transitionJob(
+	w http.ResponseWriter,
+	r *http.Request,
+	action string,
+	fn func(ctx context.Context, id uuid.UUID) (*repository.Job, error),
+) (*repository.Job, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return nil, false
+	}
+
+	job, err := fn(r.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrJobNotFound):
+		s.respondError(w, http.StatusNotFound, "Job not found")
+		return nil, false
+	case errors.Is(err, repository.ErrJobState):
+		s.respondError(w, http.StatusConflict, err.Error())
+		return nil, false
+	case err != nil:
+		s.logger.Error("Job transition failed", zap.String("action", action), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to update job")
+		return nil, false
+	}
+
+	s.logger.Info("🛠️ Job updated by admin",
+		zap.String("job_id", job.ID.String()),
+		zap.String("action", action),
+		zap.String("status", job.Status))
+	return job, true
+}
+
+func (s *Server) setAssetStatus(ctx context.Context, assetID uuid.UUID, status string) {
+	if err := s.media.UpdateStatus(ctx, assetID, status); err != nil {
+		s.logger.Warn("Failed to update asset status",
+			zap.String("asset_id", assetID.String()),
+			zap.String("status", status),
+			zap.Error(err))
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -10,11 +12,13 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
 	"github.com/xela07ax/universal-backend-streaming/internal/types"
 	"go.uber.org/zap"
 )
 
-// AuthMiddleware middleware для защиты админских эндпоинтов
+// AuthMiddleware пускает только с валидным JWT и кладет ID и роль пользователя в контекст.
+// Ограничения по ролям — в RoleMiddleware, по владельцу — в обработчиках.
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 1. Извлекаем заголовок
@@ -27,19 +31,19 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 		// 2. Максимально быстрая очистка префикса
 		tokenString := strings.TrimPrefix(tokenHeader, "Bearer ")
 
-		// 2. Парсинг и валидация
-		token, err := s.ParseToken(tokenString)
+		// 2. Парсинг и валидация: только access-токены, refresh сюда не подходит
+		claims, err := s.ParseToken(tokenString, TokenAccess)
 		if err != nil {
-			// Логируем реальную причину ошибки (expired, bad signature и т.д.)
+			// Логируем реальную причину ошибки (expired, bad signature, wrong type и т.д.)
 			// 1. Детальная инфа (ошибка, кусок токена) только для разработчика в Debug
 			s.logger.Debug("🔒 JWT Validation Details",
 				zap.Error(err),
-				zap.String("token_snippet", tokenString[:10]+"..."),
+				zap.String("token_snippet", tokenSnippet(tokenString)),
 			)
 
 			// 2. В Warn пишем только факт, если это действительно важно (например, неверная подпись)
 			// Если токен просто истек (Expired), это обычно не логируют.
-			if !strings.Contains(err.Error(), "expired") {
+			if !errors.Is(err, jwt.ErrTokenExpired) {
 				s.logger.Warn("⚠️  Unauthorized access attempt", zap.String("remote_addr", r.RemoteAddr))
 			}
 
@@ -47,33 +51,16 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// 3. Извлекаем Claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			s.respondError(w, http.StatusUnauthorized, "Ошибка структуры токена")
-			return
-		}
-
-		// 4. Проверка прав администратора
-		// Извлекаем роль из claims
-		role, ok := claims["role"].(string)
-		if !ok || role != "admin" {
-			// Warn может засорять систему логирования
-			s.logger.Info("🚫 Access Restricted: Invalid Role",
-				zap.Any("uid", claims["sub"]),
-				zap.String("role_found", role),
-			)
-			s.respondError(w, http.StatusForbidden, "Доступ запрещен: требуются права администратора")
-			return
-		}
-
-		// 5. Работа с UserID (поле "sub")
-		sub, ok := claims["sub"].(string)
-		if !ok {
-			s.respondError(w, http.StatusUnauthorized, "ID пользователя не найден в токене")
+		// 3. Роль. Права по ролям проверяет RoleMiddleware, здесь только аутентификация
+		role := claims.Role
+		if role == "" {
+			s.logger.Info("🚫 Access Restricted: Token without role", zap.String("uid", claims.Subject))
+			s.respondError(w, http.StatusForbidden, "Доступ запрещен: в токене нет роли")
 			return
 		}
 
+		// 4. Работа с UserID (поле "sub")
+		sub := claims.Subject
 		userID, err := uuid.Parse(sub)
 		if err != nil {
 			s.logger.Error("❌ UUID Parse Error from Token", zap.String("sub", sub), zap.Error(err))
@@ -81,7 +68,7 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// 6. Передаем ID через типизированный контекст
+		// 5. Передаем ID через типизированный контекст
 		ctx := context.WithValue(r.Context(), types.UserIDKey, userID)
 		ctx = context.WithValue(ctx, types.UserRoleKey, role)
 
@@ -92,6 +79,60 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// StreamAuthMiddleware — AuthMiddleware для WHIP: кроме JWT принимает ключ трансляции (Bearer hsk_...),
+// который вставляют в OBS вместо короткоживущего токена. Роль берется текущая, из users.
+// Каждое использование ключа пишется в лог и в stream_keys (время, IP).
+func (s *Server) StreamAuthMiddleware(next http.Handler) http.Handler {
+	jwtAuth := s.AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !strings.HasPrefix(token, streamKeyPrefix) {
+			jwtAuth.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		key, role, err := s.streamKeys.Authenticate(r.Context(), hashStreamKey(token), ip)
+		if errors.Is(err, repository.ErrStreamKeyInvalid) {
+			s.logger.Warn("⚠️  Invalid stream key", zap.String("remote_addr", ip))
+			s.respondError(w, http.StatusUnauthorized, "Невалидный ключ трансляции")
+			return
+		}
+		if err != nil {
+			s.logger.Error("Failed to check stream key", zap.Error(err))
+			s.respondError(w, http.StatusInternalServerError, "failed to check stream key")
+			return
+		}
+
+		s.logger.Info("🔑 Stream key used",
+			zap.String("key_id", key.ID.String()),
+			zap.String("user_id", key.UserID.String()),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("ip", ip))
+
+		ctx := context.WithValue(r.Context(), types.UserIDKey, key.UserID)
+		ctx = context.WithValue(ctx, types.UserRoleKey, role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP — адрес клиента без порта (RemoteAddr уже подменен middleware.RealIP)
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// tokenSnippet — начало токена для отладочного лога; короткий мусор в заголовке не должен ронять обработчик
+func tokenSnippet(token string) string {
+	if len(token) > 10 {
+		token = token[:10]
+	}
+	return token + "..."
+}
+
 func (s *Server) RoleMiddleware(allowedRoles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/probe"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+// quarantinePath — путь к файлу записи карантина
+func quarantinePath(q *repository.QuarantinedUpload) string {
+	return filepath.Join(viper.GetString("uploads.quarantine_dir"), filepath.Base(q.FilePath))
+}
+
+// quarantineExpiryBatch — сколько просроченных записей карантина удаляется за один запрос
+const quarantineExpiryBatch = 100
+
+// ExpireQuarantine удаляет записи и файлы, пролежавшие в карантине дольше uploads.quarantine_retention
+// (0 — хранить до решения админа). Место в квоте владельца освобождается вместе с записью.
+// Возвращает число удаленных записей.
+func (s *Server) ExpireQuarantine(ctx context.Context) (int, error) {
+	retention := viper.GetDuration("uploads.quarantine_retention")
+	if retention <= 0 {
+		return 0, nil
+	}
+	before := time.Now().Add(-retention)
+
+	removed := 0
+	for {
+		items, err := s.quarantine.TakeExpired(ctx, before, quarantineExpiryBatch)
+		if err != nil {
+			return removed, err
+		}
+		for i := range items {
+			if err := os.Remove(quarantinePath(&items[i])); err != nil && !errors.Is(err, os.ErrNotExist) {
+				s.logger.Warn("⚠️ Failed to remove quarantined file", zap.String("quarantine_id", items[i].ID.String()), zap.Error(err))
+			}
+		}
+		removed += len(items)
+		if len(items) < quarantineExpiryBatch {
+			return removed, nil
+		}
+	}
+}
+
+// SweepQuarantine вызывает ExpireQuarantine раз в uploads.sweep_interval, пока не отменен ctx
+func (s *Server) SweepQuarantine(ctx context.Context) {
+	interval := viper.GetDuration("uploads.sweep_interval")
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		removed, err := s.ExpireQuarantine(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			s.logger.Error("Quarantine: expiry failed", zap.Error(err))
+		case removed > 0:
+			s.logger.Info("🧹 Expired quarantined uploads removed", zap.Int("uploads", removed))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// quarantinedUpload достает запись карантина по {id}. При ошибке сам отвечает клиенту.
+func (s *Server) quarantinedUpload(w http.ResponseWriter, r *http.Request) (*repository.QuarantinedUpload, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return nil, false
+	}
+	q, err := s.quarantine.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrQuarantineNotFound) {
+		s.respondError(w, http.StatusNotFound, "Upload is not in quarantine")
+		return nil, false
+	}
+	if err != nil {
+		s.logger.Error("Failed to fetch quarantined upload", zap.String("quarantine_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch quarantined upload")
+		return nil, false
+	}
+	return q, true
+}
+
+// handleAdminListQuarantine возвращает отвергнутые загрузки: ?limit=100
+func (s *Server) handleAdminListQuarantine(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	items, err := s.quarantine.List(r.Context(), limit)
+	if err != nil {
+		s.logger.Error("Failed to list quarantine", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch quarantine")
+		return
+	}
+	s.respond(w, http.StatusOK, items)
+}
+
+// handleAdminDownloadQuarantined отдает файл на проверку — только как вложение, без исполнения в браузере
+func (s *Server) handleAdminDownloadQuarantined(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.quarantinedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	f, err := os.Open(quarantinePath(q))
+	if errors.Is(err, os.ErrNotExist) {
+		s.respondError(w, http.StatusNotFound, "Quarantined file is missing")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to open quarantined file", zap.String("quarantine_id", q.ID.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to open file")
+		return
+	}
+	defer func() { _ = f.Close() }()
+	stat, err := f.Stat()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to open file")
+		return
+	}
+
+	name := q.FileName
+	if name == "" {
+		name = q.FilePath
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	setNoExecHeaders(w)
+	http.ServeContent(w, r, "", stat.ModTime(), f)
+}
+
+// handleAdminApproveQuarantined публикует файл из карантина как обычную загрузку владельца.
+// Опубликовать можно только видео (detected_format — один из контейнеров); allowlist форматов не действует.
+func (s *Server) handleAdminApproveQuarantined(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.quarantinedUpload(w, r)
+	if !ok {
+		return
+	}
+	format, ok := probe.MediaFormat(q.DetectedFormat)
+	if !ok {
+		s.respondError(w, http.StatusUnprocessableEntity, "Файл не является видео, опубликовать его нельзя")
+		return
+	}
+
+	// Забираем запись: второй одобряющий получит 404
+	ctx, id := r.Context(), q.ID
+	q, err := s.quarantine.Take(ctx, id)
+	if errors.Is(err, repository.ErrQuarantineNotFound) {
+		s.respondError(w, http.StatusNotFound, "Upload is not in quarantine")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to take quarantined upload", zap.String("quarantine_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to approve upload")
+		return
+	}
+
+	asset, err := s.createAssetFromFile(ctx, quarantinePath(q), newUpload{
+		OwnerID:     q.OwnerID,
+		Title:       q.Upload["title"],
+		Description: q.Upload["description"],
+		Visibility:  q.Upload["visibility"],
+		FileName:    q.FileName,
+		ContentType: format.MIME,
+		Size:        q.Size,
+		Checksum:    q.Checksum,
+		Trusted:     true,
+	})
+	// Файл не прошел даже проверку "это видео" — он снова в карантине под новой записью
+	if s.respondRejectedUpload(w, err) {
+		return
+	}
+	if err != nil {
+		// Возвращаем запись: файл остался на месте
+		if restoreErr := s.quarantine.Create(ctx, q); restoreErr != nil {
+			s.logger.Error("Failed to restore quarantine record", zap.String("quarantine_id", q.ID.String()), zap.Error(restoreErr))
+		}
+		s.logger.Error("Failed to publish quarantined upload", zap.String("quarantine_id", q.ID.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "Ошибка записи в хранилище")
+		return
+	}
+
+	admin, _ := types.GetUserID(ctx)
+	s.logger.Info("✅ Quarantined upload approved",
+		zap.String("quarantine_id", q.ID.String()),
+		zap.String("asset_id", asset.ID.String()),
+		zap.String("by", admin.String()))
+	s.respond(w, http.StatusCreated, asset)
+}
+
+// handleAdminDeleteQuarantined удаляет файл из карантина навсегда
+func (s *Server) handleAdminDeleteQuarantined(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	q, err := s.quarantine.Take(r.Context(), id)
+	if errors.Is(err, repository.ErrQuarantineNotFound) {
+		s.respondError(w, http.StatusNotFound, "Upload is not in quarantine")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to delete quarantined upload", zap.String("quarantine_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to delete upload")
+		return
+	}
+	if err := os.Remove(quarantinePath(q)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Warn("⚠️ Failed to remove quarantined file", zap.String("quarantine_id", id.String()), zap.Error(err))
+	}
+
+	admin, _ := types.GetUserID(r.Context())
+	s.logger.Info("🗑️ Quarantined upload deleted", zap.String("quarantine_id", id.String()), zap.String("by", admin.String()))
+	w.WriteHeader(http.StatusNoContent)
+}
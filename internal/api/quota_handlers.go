@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/quota"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+// multipartOverhead — запас на границы и текстовые поля multipart-формы сверх размера файла
+const multipartOverhead = 64 << 10
+
+// quotaConfig читает секцию quotas
+func (s *Server) quotaConfig() quota.Config {
+	roles := map[string]int64{}
+	if err := viper.UnmarshalKey("quotas.roles", &roles); err != nil {
+		s.logger.Warn("⚠️ Invalid quotas.roles, role quotas ignored", zap.Error(err))
+	}
+	return quota.Config{
+		Enabled: viper.GetBool("quotas.enabled"),
+		Default: viper.GetInt64("quotas.default_bytes"),
+		Roles:   roles,
+	}
+}
+
+// checkQuota проверяет, что пользователю хватит места на size байт.
+// При нехватке отвечает 413 с подробностями (code "quota_exceeded") и возвращает false.
+func (s *Server) checkQuota(w http.ResponseWriter, r *http.Request, userID uuid.UUID, role string, size int64) bool {
+	_, err := s.quota.Check(r.Context(), userID, role, size)
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		s.logger.Warn("🚫 Upload rejected: quota exceeded",
+			zap.String("user_id", userID.String()),
+			zap.Int64("requested", size),
+			zap.Int64("used", exceeded.Bytes),
+			zap.Int64("limit", exceeded.Limit))
+		s.respondErrorDetails(w, http.StatusRequestEntityTooLarge, "Квота хранилища исчерпана", "quota_exceeded", exceeded)
+		return false
+	}
+	if err != nil {
+		s.logger.Error("Failed to check quota", zap.String("user_id", userID.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to check quota")
+		return false
+	}
+	return true
+}
+
+// recordingQuota проверяет, что запись эфира помещается в квоту владельца (роль — из его профиля)
+func (s *Server) recordingQuota(ctx context.Context, ownerID uuid.UUID, size int64) error {
+	role, err := s.users.GetRole(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	_, err = s.quota.Check(ctx, ownerID, role, size)
+	return err
+}
+
+// assetSize возвращает metadata.size актива (0, если не записан)
+func assetSize(a *repository.MediaAsset) int64 {
+	switch v := a.Metadata["size"].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+// authorizeTusUpload не дает создать возобновляемую загрузку, которая не поместится в квоту
+func (s *Server) authorizeTusUpload(w http.ResponseWriter, r *http.Request, length int64) bool {
+	userID, _ := types.GetUserID(r.Context())
+	return s.checkQuota(w, r, userID, types.GetUserRole(r.Context()), length)
+}
+
+// handleMyUsage возвращает занятое место и квоту текущего пользователя
+func (s *Server) handleMyUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := types.GetUserID(r.Context())
+	if !ok {
+		s.respondError(w, http.StatusUnauthorized, "Не удалось идентифицировать пользователя")
+		return
+	}
+
+	usage, err := s.quota.Usage(r.Context(), userID, types.GetUserRole(r.Context()))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to compute usage", zap.String("user_id", userID.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to compute usage")
+		return
+	}
+	s.respond(w, http.StatusOK, usage)
+}
+
+// quotaRequest — тело PUT /admin/users/{id}/quota. null — вернуть квоту роли, 0 — без ограничений.
+type quotaRequest struct {
+	QuotaBytes *int64 `json:"quota_bytes"`
+}
+
+// handleAdminSetQuota задает пользователю персональную квоту
+func (s *Server) handleAdminSetQuota(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var req quotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.QuotaBytes != nil && *req.QuotaBytes < 0 {
+		s.respondError(w, http.StatusBadRequest, "quota_bytes must not be negative")
+		return
+	}
+
+	err = s.users.SetQuota(r.Context(), id, req.QuotaBytes)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to set quota", zap.String("user_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to set quota")
+		return
+	}
+
+	admin, _ := types.GetUserID(r.Context())
+	fields := []zap.Field{zap.String("user_id", id.String()), zap.String("by", admin.String())}
+	if req.QuotaBytes != nil {
+		fields = append(fields, zap.Int64("quota_bytes", *req.QuotaBytes))
+	}
+	s.logger.Info("📏 User quota changed", fields...)
+	s.respond(w, http.StatusOK, req)
+}
@@ -11,6 +11,8 @@ type APIResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`    // Машиночитаемая причина ошибки ("quota_exceeded")
+	Details interface{} `json:"details,omitempty"` // Подробности ошибки для клиента
 }
 
 func (s *Server) respond(w http.ResponseWriter, code int, data interface{}) {
@@ -32,12 +34,19 @@ func (s *Server) respond(w http.ResponseWriter, code int, data interface{}) {
 }
 
 func (s *Server) respondError(w http.ResponseWriter, code int, message string) {
+	s.respondErrorDetails(w, code, message, "", nil)
+}
+
+// respondErrorDetails отвечает ошибкой с машиночитаемым кодом и подробностями
+func (s *Server) respondErrorDetails(w http.ResponseWriter, code int, message, errCode string, details interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 
 	err := json.NewEncoder(w).Encode(APIResponse{
 		Success: false,
 		Error:   message,
+		Code:    errCode,
+		Details: details,
 	})
 
 	if err != nil {
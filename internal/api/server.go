@@ -26,9 +26,15 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/hls"
 	"github.com/xela07ax/universal-backend-streaming/internal/ingest"
+	"github.com/xela07ax/universal-backend-streaming/internal/keys"
+	"github.com/xela07ax/universal-backend-streaming/internal/purger"
+	"github.com/xela07ax/universal-backend-streaming/internal/quota"
 	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/session"
 	"github.com/xela07ax/universal-backend-streaming/internal/streaming"
+	"github.com/xela07ax/universal-backend-streaming/internal/tus"
 	"go.uber.org/zap"
 )
 
@@ -41,25 +47,44 @@ type Server struct {
 	db         *pgxpool.Pool
 	rdb        *redis.Client
 	media      *repository.MediaRepository
+	endpoints  *repository.EndpointRepository
 	users      *repository.UserRepository
+	jobs       *repository.JobRepository
+	quarantine *repository.QuarantineRepository // Отвергнутые загрузки, ждущие решения админа
+	streamKeys *repository.StreamKeyRepository  // Ключи трансляции для WHIP
+	sessions   *session.Store                   // Семейства refresh-токенов в Redis
 	video      *streaming.VideoProvider
+	purger     *purger.Purger // Немедленная очистка корзины из админки; по расписанию чистит `hydro serve`/`hydro purge`
+	quota      *quota.Service
+	uploads    *tus.Handler // Возобновляемые загрузки; брошенные .part чистит SweepUploads
 	// ... ваши репозитории (media и т.д.)
-	// Секрет для JWT берем из конфига через Viper
-	jwtSecret string
+	// Ключи подписи JWT: auth.keys_dir и/или auth.jwt_secret
+	jwtKeys     *keys.Set
+	jwtIssuer   string // auth.issuer: iss выпускаемых и принимаемых токенов
+	jwtAudience string // auth.audience: aud выпускаемых и принимаемых токенов
 }
 
 // NewServer собирает сервер и настраивает все зависимости.
-func NewServer(db *pgxpool.Pool, rdb *redis.Client, vp *streaming.VideoProvider, log *zap.Logger, secret string) (*Server, error) {
+func NewServer(db *pgxpool.Pool, rdb *redis.Client, vp *streaming.VideoProvider, log *zap.Logger, jwtKeys *keys.Set) (*Server, error) {
 	s := &Server{
-		router:    chi.NewRouter(),
-		logger:    log,
-		db:        db,
-		rdb:       rdb,
-		video:     vp,
-		jwtSecret: secret,
-		users:     repository.NewUserRepository(db),
-		media:     repository.NewMediaRepository(db),
+		router:      chi.NewRouter(),
+		logger:      log,
+		db:          db,
+		rdb:         rdb,
+		video:       vp,
+		jwtKeys:     jwtKeys,
+		jwtIssuer:   viper.GetString("auth.issuer"),
+		jwtAudience: viper.GetString("auth.audience"),
+		users:       repository.NewUserRepository(db),
+		media:       repository.NewMediaRepository(db),
+		endpoints:   repository.NewEndpointRepository(db),
+		jobs:        repository.NewJobRepository(db),
+		quarantine:  repository.NewQuarantineRepository(db),
+		streamKeys:  repository.NewStreamKeyRepository(db),
 	}
+	s.purger = purger.New(purger.Config{}, s.media, vp.Storage(), log)
+	s.quota = quota.New(s.quotaConfig(), s.media, s.users)
+	s.sessions = s.newSessionStore()
 
 	s.setupRoutes()
 	return s, nil
@@ -67,11 +92,6 @@ func NewServer(db *pgxpool.Pool, rdb *redis.Client, vp *streaming.VideoProvider,
 
 // Start запускает HTTP сервер.
 func (s *Server) Start(addr string) error {
-	// Создаем папку для хранения, если её нет
-	if err := os.MkdirAll(s.video.GetBasePath(), 0755); err != nil {
-		s.logger.Error("Failed to create storage directory", zap.Error(err))
-	}
-
 	s.httpServer = &http.Server{
 		Addr:    "0.0.0.0:8080",
 		Handler: s.router,
@@ -104,6 +124,33 @@ func (s *Server) setupRoutes() {
 	}
 	sm := ingest.NewSessionManager(s.logger)
 
+	// Запись эфиров в VOD (ingest.record_enabled)
+	if viper.GetBool("ingest.record_enabled") {
+		rtc.EnableRecording(ingest.RecordingConfig{
+			WorkDir:    viper.GetString("storage.work_dir"),
+			Storage:    s.video.Storage(),
+			Assets:     s.media,
+			FFmpegPath: viper.GetString("vod.ffmpeg_path"),
+			Quota:      s.recordingQuota,
+			Enqueue:    s.enqueueProcessing,
+		})
+		s.logger.Info("⏺️ Live recording enabled", zap.String("work_dir", viper.GetString("storage.work_dir")))
+	}
+
+	// Живая LL-HLS раздача для устройств без WebRTC (ingest.hls_enabled)
+	var liveHLS *hls.Manager
+	if viper.GetBool("ingest.hls_enabled") {
+		liveHLS = hls.NewManager(hls.DefaultConfig(), s.logger)
+		rtc.EnableHLS(liveHLS)
+	}
+
+	// Возобновляемые загрузки (tus 1.0)
+	uploads, err := s.newTusHandler()
+	if err != nil {
+		s.logger.Fatal("Failed to initialize tus uploads", zap.Error(err))
+	}
+	s.uploads = uploads
+
 	// 1. Глобальные Middleware
 	s.router.Use(middleware.RequestID)
 	s.router.Use(middleware.RealIP)
@@ -111,10 +158,18 @@ func (s *Server) setupRoutes() {
 	s.router.Use(middleware.Recoverer)
 	s.router.Use(s.setupCORS().Handler)
 
-	// 1.1. РАЗДАЧА ВИДЕО (из корня проекта)
-	// Запрос: /api/v1/storage/123.mp4 -> Файл: ./uploads/123.mp4
-	videoStorage := http.Dir("./uploads")
-	s.router.Handle("/api/v1/storage/*", http.StripPrefix("/api/v1/storage/", http.FileServer(videoStorage)))
+	// 1.0. Открытые ключи JWT для других сервисов
+	s.router.Get("/.well-known/jwks.json", s.handleJWKS)
+
+	// 1.1. РАЗДАЧА ВИДЕО (через storage.Backend, только по подписанным ссылкам)
+	// Запрос: /api/v1/storage/t/<token>/123.mp4 -> Объект хранилища с ключом 123.mp4
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.StorageAuthMiddleware)
+		r.Get(streaming.SignedRoute+"{token}/*", s.handleStorage)
+		r.Head(streaming.SignedRoute+"{token}/*", s.handleStorage)
+		r.Get(streaming.StorageRoute+"*", s.handleStorage)
+		r.Head(streaming.StorageRoute+"*", s.handleStorage)
+	})
 
 	// 2. API РОУТЫ
 	s.router.Route("/api/v1", func(r chi.Router) {
@@ -124,27 +179,80 @@ func (s *Server) setupRoutes() {
 			r.Get("/health", s.handleHealth)
 			r.Post("/login", s.handleLogin)
 			r.Post("/refresh", s.handleRefresh)
+			r.Post("/refresh/logout", s.handleLogout) // Под путем куки refresh: только сюда браузер ее отправляет
 
 			// Видео и Стриминг
 			r.Get("/video/{id}", s.handleGetVideoURL)
 			r.Get("/streams", rtc.HandleListStreams(sm, s.logger))
 			r.Post("/whep", rtc.HandleWHEP(sm, s.logger))
+			r.Patch("/whep/{id}", rtc.HandleWHEPPatch(sm, s.logger))
+			r.Delete("/whep/{id}", rtc.HandleWHEPDelete(sm, s.logger))
+			if liveHLS != nil {
+				r.Get("/live/{id}/{file}", liveHLS.HandleLive())
+			}
 		})
 
 		// --- ЗОНА ПОЛЬЗОВАТЕЛЯ (JWT) ---
 		r.Group(func(r chi.Router) {
 			r.Use(s.AuthMiddleware)
-			r.Get("/assets", s.handleAdminListAssets)
-			r.Post("/logout", s.handleLogout)
+			r.Get("/assets", s.handleListAssets)
+			r.Patch("/assets/{id}", s.handleUpdateAsset)
+			r.Put("/assets/{id}", s.handleReplaceAssetFile)
+			r.Delete("/assets/{id}", s.handleDeleteAsset)
+			r.Put("/assets/{id}/access", s.handleSetAssetAccess)
+			r.Get("/me", s.handleMe)
+			r.Patch("/me", s.handleUpdateMe)
+			r.Get("/me/usage", s.handleMyUsage)
+			r.Post("/logout", s.handleLogout) // Устарело: кука refresh сюда не приходит, см. /refresh/logout
 		})
 
 		// --- ЗОНА КРЕАТОРОВ (JWT + Role) ---
 		r.Group(func(r chi.Router) {
 			r.Use(s.AuthMiddleware)
-			r.Use(s.RoleMiddleware("streamer", "admin"))
+			r.Use(s.RoleMiddleware(repository.RoleStreamer, repository.RoleAdmin))
 
-			r.Post("/whip", rtc.HandleWHIP(sm, s.logger))
 			r.Post("/upload", s.handleAdminUploadAsset)
+			r.Route("/uploads", uploads.Routes)
+			r.Get("/stream-keys", s.handleListStreamKeys)
+			r.Post("/stream-keys", s.handleCreateStreamKey)
+			r.Post("/stream-keys/{id}/rotate", s.handleRotateStreamKey)
+			r.Delete("/stream-keys/{id}", s.handleRevokeStreamKey)
+		})
+
+		// --- ИНГЕСТ (JWT или ключ трансляции + Role) ---
+		r.Group(func(r chi.Router) {
+			r.Use(s.StreamAuthMiddleware)
+			r.Use(s.RoleMiddleware(repository.RoleStreamer, repository.RoleAdmin))
+
+			r.Post("/whip", rtc.HandleWHIP(sm, s.logger))
+			r.Patch("/ingest/whip/{id}", rtc.HandleWHIPPatch(sm, s.logger))
+			r.Delete("/ingest/whip/{id}", rtc.HandleWHIPDelete(sm, s.logger))
+		})
+
+		// --- ЗОНА АДМИНИСТРАТОРА (JWT + admin) ---
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(s.AuthMiddleware)
+			r.Use(s.RoleMiddleware("admin"))
+
+			r.Post("/assets", s.handleAdminCreateAsset)
+			r.Get("/users", s.handleAdminListUsers)
+			r.Post("/users", s.handleAdminCreateUser)
+			r.Get("/users/{id}", s.handleAdminGetUser)
+			r.Delete("/users/{id}", s.handleAdminDeleteUser)
+			r.Put("/users/{id}/role", s.handleAdminSetRole)
+			r.Post("/users/{id}/disable", s.handleAdminDisableUser)
+			r.Post("/users/{id}/enable", s.handleAdminEnableUser)
+			r.Put("/users/{id}/quota", s.handleAdminSetQuota)
+			r.Get("/trash", s.handleAdminListTrash)
+			r.Post("/trash/{id}/restore", s.handleAdminRestoreAsset)
+			r.Delete("/trash/{id}", s.handleAdminPurgeAsset)
+			r.Get("/jobs", s.handleAdminListJobs)
+			r.Post("/jobs/{id}/retry", s.handleAdminRetryJob)
+			r.Post("/jobs/{id}/cancel", s.handleAdminCancelJob)
+			r.Get("/quarantine", s.handleAdminListQuarantine)
+			r.Get("/quarantine/{id}/file", s.handleAdminDownloadQuarantined)
+			r.Post("/quarantine/{id}/approve", s.handleAdminApproveQuarantined)
+			r.Delete("/quarantine/{id}", s.handleAdminDeleteQuarantined)
 		})
 	})
 
@@ -194,8 +302,8 @@ func (s *Server) setupCORS() *cors.Cors {
 			return true
 		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Range"},
-		ExposedHeaders:   []string{"Link", "Content-Length", "Content-Range", "Accept-Ranges"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Range", "If-Match", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Defer-Length"},
+		ExposedHeaders:   []string{"Link", "Content-Length", "Content-Range", "Accept-Ranges", "Location", "ETag", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "Upload-Metadata", "X-Asset-ID"},
 		AllowCredentials: true,
 		MaxAge:           300,
 		Debug:            viper.GetBool("server.debug"),
@@ -263,7 +371,7 @@ func (s *Server) printStartupReport(addr string) {
 		zap.String("storage", s.video.GetBasePath()), // Реальный адрес Redis
 		zap.String("video_host", s.video.GetHost()),
 		zap.Int("video_port", s.video.GetPort()),
-		zap.String("storage", s.video.GetBasePath()),
+		zap.String("storage_driver", viper.GetString("storage.driver")),
 	)
 
 	if viper.GetBool("database.debug") {
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+// streamKeyPrefix отличает ключ трансляции от JWT в заголовке Authorization
+const streamKeyPrefix = "hsk_"
+
+// maxStreamKeyLabel — предел длины метки ключа (в символах)
+const maxStreamKeyLabel = 100
+
+// newStreamKey создает ключ: hsk_ + 256 случайных бит. Возвращает сам ключ, видимое начало и хеш для БД.
+func newStreamKey() (key, prefix, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	key = streamKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:len(streamKeyPrefix)+8], hashStreamKey(key), nil
+}
+
+// hashStreamKey — SHA-256 ключа (hex), под которым он хранится
+func hashStreamKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// streamKeyRequest — тело POST /stream-keys
+type streamKeyRequest struct {
+	Label     string     `json:"label"`
+	ExpiresAt *time.Time `json:"expires_at"` // null — бессрочный
+}
+
+// issuedStreamKey — ключ вместе с секретом; секрет отдается только в этом ответе
+type issuedStreamKey struct {
+	repository.StreamKey
+	Key string `json:"key"`
+}
+
+// handleListStreamKeys возвращает ключи текущего пользователя (без секретов)
+func (s *Server) handleListStreamKeys(w http.ResponseWriter, r *http.Request) {
+	userID, _ := types.GetUserID(r.Context())
+
+	keys, err := s.streamKeys.ListByUser(r.Context(), userID)
+	if err != nil {
+		s.logger.Error("Failed to list stream keys", zap.String("user_id", userID.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch stream keys")
+		return
+	}
+	s.respond(w, http.StatusOK, keys)
+}
+
+// handleCreateStreamKey выпускает ключ трансляции для OBS/энкодера
+func (s *Server) handleCreateStreamKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := types.GetUserID(r.Context())
+
+	var req streamKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if utf8.RuneCountInString(req.Label) > maxStreamKeyLabel {
+		s.respondError(w, http.StatusBadRequest, "label is too long")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		s.respondError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	key, prefix, hash, err := newStreamKey()
+	if err != nil {
+		s.logger.Error("Failed to generate stream key", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to create stream key")
+		return
+	}
+	issued := issuedStreamKey{
+		StreamKey: repository.StreamKey{UserID: userID, Label: req.Label, Prefix: prefix, ExpiresAt: req.ExpiresAt},
+		Key:       key,
+	}
+	if err := s.streamKeys.Create(r.Context(), &issued.StreamKey, hash); err != nil {
+		s.logger.Error("Failed to create stream key", zap.String("user_id", userID.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to create stream key")
+		return
+	}
+
+	s.logger.Info("🔑 Stream key created",
+		zap.String("key_id", issued.ID.String()),
+		zap.String("user_id", userID.String()),
+		zap.String("prefix", prefix))
+	s.respond(w, http.StatusCreated, issued)
+}
+
+// handleRotateStreamKey выдает ключу новый секрет; старый перестает работать сразу
+func (s *Server) handleRotateStreamKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := types.GetUserID(r.Context())
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	key, prefix, hash, err := newStreamKey()
+	if err != nil {
+		s.logger.Error("Failed to generate stream key", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to rotate stream key")
+		return
+	}
+	rotated, err := s.streamKeys.Rotate(r.Context(), id, userID, prefix, hash)
+	if errors.Is(err, repository.ErrStreamKeyNotFound) {
+		s.respondError(w, http.StatusNotFound, "Stream key not found")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to rotate stream key", zap.String("key_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to rotate stream key")
+		return
+	}
+
+	s.logger.Info("🔄 Stream key rotated",
+		zap.String("key_id", id.String()),
+		zap.String("user_id", userID.String()),
+		zap.String("prefix", prefix))
+	s.respond(w, http.StatusOK, issuedStreamKey{StreamKey: *rotated, Key: key})
+}
+
+// handleRevokeStreamKey отзывает ключ
+func (s *Server) handleRevokeStreamKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := types.GetUserID(r.Context())
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	err = s.streamKeys.Revoke(r.Context(), id, userID)
+	if errors.Is(err, repository.ErrStreamKeyNotFound) {
+		s.respondError(w, http.StatusNotFound, "Stream key not found")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to revoke stream key", zap.String("key_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to revoke stream key")
+		return
+	}
+
+	s.logger.Info("🚫 Stream key revoked", zap.String("key_id", id.String()), zap.String("user_id", userID.String()))
+	w.WriteHeader(http.StatusNoContent)
+}
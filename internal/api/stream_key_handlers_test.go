@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xela07ax/universal-backend-streaming/internal/keys"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+func TestNewStreamKey(t *testing.T) {
+	key, prefix, hash, err := newStreamKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, streamKeyPrefix))
+	assert.Len(t, key, len(streamKeyPrefix)+43)
+	assert.True(t, strings.HasPrefix(key, prefix))
+	assert.Equal(t, hashStreamKey(key), hash)
+	assert.Len(t, hash, 64)
+
+	other, _, _, err := newStreamKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestStreamAuthMiddleware(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	s := &Server{logger: zap.NewNop(), jwtKeys: keys.NewHMAC("test-secret"), streamKeys: repository.NewStreamKeyRepository(mock)}
+
+	var gotUser uuid.UUID
+	var gotRole string
+	handler := s.StreamAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = types.GetUserID(r.Context())
+		gotRole = types.GetUserRole(r.Context())
+		w.WriteHeader(http.StatusCreated)
+	}))
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/whip", nil)
+		req.RemoteAddr = "203.0.113.7:51234"
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	key, _, hash, err := newStreamKey()
+	assert.NoError(t, err)
+	userID, now := uuid.New(), time.Now()
+	mock.ExpectQuery(`UPDATE stream_keys`).
+		WithArgs(hash, "203.0.113.7").
+		WillReturnRows(pgxmock.NewRows(append(streamKeyTestColumns, "role")).
+			AddRow(uuid.New(), userID, "OBS", key[:12], nil, nil, nil, &now, "203.0.113.7", int64(1), now, "streamer"))
+	assert.Equal(t, http.StatusCreated, call(key))
+	assert.Equal(t, userID, gotUser)
+	assert.Equal(t, "streamer", gotRole)
+
+	// Отозванный ключ
+	mock.ExpectQuery(`UPDATE stream_keys`).
+		WithArgs(hashStreamKey("hsk_revoked"), "203.0.113.7").
+		WillReturnError(pgx.ErrNoRows)
+	assert.Equal(t, http.StatusUnauthorized, call("hsk_revoked"))
+
+	// Обычный JWT по-прежнему работает
+	jwtUser := uuid.New()
+	token, err := s.GenerateToken(jwtUser, "admin", "admin", TokenAccess, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, call(token))
+	assert.Equal(t, jwtUser, gotUser)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+var streamKeyTestColumns = []string{"id", "user_id", "label", "prefix", "expires_at", "revoked_at",
+	"rotated_at", "last_used_at", "last_used_ip", "use_count", "created_at"}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"go.uber.org/zap"
+)
+
+// handleAdminListTrash возвращает корзину: ?limit=100
+func (s *Server) handleAdminListTrash(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	assets, err := s.media.ListTrash(r.Context(), limit)
+	if err != nil {
+		s.logger.Error("Failed to list trash", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch trash")
+		return
+	}
+	s.respond(w, http.StatusOK, assets)
+}
+
+// handleAdminRestoreAsset достает актив из корзины
+func (s *Server) handleAdminRestoreAsset(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	asset, err := s.media.RestoreAsset(r.Context(), id)
+	if errors.Is(err, repository.ErrAssetNotFound) {
+		s.respondError(w, http.StatusNotFound, "Asset is not in trash")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to restore asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to restore asset")
+		return
+	}
+
+	s.logger.Info("♻️ Asset restored from trash", zap.String("asset_id", id.String()))
+	s.respond(w, http.StatusOK, asset)
+}
+
+// handleAdminPurgeAsset удаляет актив из корзины навсегда, не дожидаясь trash.retention
+func (s *Server) handleAdminPurgeAsset(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	res, err := s.purger.Purge(r.Context(), id)
+	if errors.Is(err, repository.ErrAssetNotFound) {
+		s.respondError(w, http.StatusNotFound, "Asset is not in trash")
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to purge asset", zap.String("asset_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to purge asset")
+		return
+	}
+	s.respond(w, http.StatusOK, res)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/quota"
+	"github.com/xela07ax/universal-backend-streaming/internal/tus"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+)
+
+// newTusHandler собирает обработчик возобновляемых загрузок (состояние — в Redis)
+func (s *Server) newTusHandler() (*tus.Handler, error) {
+	store := tus.NewRedisStore(s.rdb, viper.GetDuration("uploads.lock_timeout"))
+	return tus.NewHandler(tus.Config{
+		Dir:        viper.GetString("uploads.tus_dir"),
+		BasePath:   "/api/v1/uploads",
+		MaxSize:    viper.GetInt64("uploads.max_size"),
+		Expiration: viper.GetDuration("uploads.expiration"),
+		Authorize:  s.authorizeTusUpload,
+	}, store, s.completeTusUpload, s.logger)
+}
+
+// SweepUploads удаляет .part брошенных загрузок раз в uploads.sweep_interval, пока не отменен ctx
+func (s *Server) SweepUploads(ctx context.Context) {
+	s.uploads.RunSweeper(ctx, viper.GetDuration("uploads.sweep_interval"))
+}
+
+// completeTusUpload превращает полностью загруженный .part в MediaAsset — так же, как multipart-загрузка
+func (s *Server) completeTusUpload(ctx context.Context, u *tus.Upload, partPath string) (string, error) {
+	ownerID, err := uuid.Parse(u.OwnerID)
+	if err != nil {
+		return "", fmt.Errorf("invalid owner id: %w", err)
+	}
+
+	// Квота проверена при создании, но параллельные загрузки могли занять место раньше
+	if _, err := s.quota.Check(ctx, ownerID, types.GetUserRole(ctx), u.Length); err != nil {
+		if errors.Is(err, quota.ErrExceeded) {
+			return "", fmt.Errorf("%w: Квота хранилища исчерпана", tus.ErrTooLarge)
+		}
+		return "", err
+	}
+
+	asset, err := s.createAssetFromFile(ctx, partPath, newUpload{
+		OwnerID:     ownerID,
+		Title:       u.Metadata["title"],
+		Description: u.Metadata["description"],
+		Visibility:  u.Metadata["visibility"],
+		FileName:    u.Metadata["filename"],
+		ContentType: u.Metadata["filetype"],
+		Size:        u.Length,
+		Checksum:    u.Checksum,
+	})
+	var rejection *uploadRejection
+	if errors.As(err, &rejection) {
+		return "", fmt.Errorf("%w: Файл не принят (%s) и передан на проверку администратору", tus.ErrRejected, rejection.Reason)
+	}
+	if err != nil {
+		return "", err
+	}
+	return asset.ID.String(), nil
+}
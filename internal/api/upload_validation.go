@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/xela07ax/universal-backend-streaming/internal/probe"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"go.uber.org/zap"
+)
+
+// maxFileNameLen — предел длины имени файла (в символах), которое сохраняем и показываем
+const maxFileNameLen = 255
+
+// videoExtensions — расширения, под которыми клиенты присылают видео. Содержимое все равно
+// определяется по сигнатуре, а в хранилище файл ляжет с каноническим расширением.
+var videoExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".qt": true, ".webm": true, ".mkv": true,
+}
+
+// uploadRejection — загрузка не прошла проверку содержимого; errors.Is(err, errNotMedia) == true.
+// Сериализуется в details ответа 415.
+type uploadRejection struct {
+	Reason       string     `json:"reason"`
+	Format       string     `json:"detected_format"`
+	QuarantineID *uuid.UUID `json:"quarantine_id,omitempty"` // nil, если в карантин файл переместить не удалось
+}
+
+func (e *uploadRejection) Error() string { return fmt.Sprintf("%v: %s", errNotMedia, e.Reason) }
+
+func (e *uploadRejection) Unwrap() error { return errNotMedia }
+
+// normalizeFileName оставляет от присланного имени только безопасное для показа базовое имя:
+// без каталогов, управляющих и невидимых символов (вроде U+202E, которым "exe.mp4" прячут
+// за "mp4.exe") и ведущих точек. Пустая строка — имени нет.
+func normalizeFileName(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(strings.TrimLeft(name, ". /"))
+	if r := []rune(name); len(r) > maxFileNameLen {
+		name = string(r[:maxFileNameLen])
+	}
+	return name
+}
+
+// allowedUploadFormats — контейнеры, которые принимаются от пользователей (uploads.allowed_formats)
+func allowedUploadFormats() []string {
+	return viper.GetStringSlice("uploads.allowed_formats")
+}
+
+// suspiciousDeclaration сообщает, почему заявленные клиентом имя и тип не похожи на видео (пусто — похожи)
+func suspiciousDeclaration(u newUpload) string {
+	if ext := strings.ToLower(path.Ext(u.FileName)); ext != "" && !videoExtensions[ext] {
+		return "suspicious file extension " + ext
+	}
+	if u.ContentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(u.ContentType)
+	if err != nil {
+		return "invalid content type"
+	}
+	if !strings.HasPrefix(mediaType, "video/") && mediaType != "application/octet-stream" {
+		return "suspicious content type " + mediaType
+	}
+	return ""
+}
+
+// inspectUpload проверяет содержимое по сигнатуре, а не по имени и Content-Type клиента:
+// контейнер должен быть в uploads.allowed_formats, заявленный тип — похож на видео,
+// а MP4/MOV — разбираться. Отказ — *uploadRejection. Info есть только для MP4/MOV.
+func (s *Server) inspectUpload(localPath string, u newUpload) (probe.Format, *probe.Info, error) {
+	format, err := probe.SniffFile(localPath)
+	if err != nil {
+		return format, nil, err
+	}
+	reject := func(reason string) error {
+		return &uploadRejection{Reason: reason, Format: format.Name}
+	}
+
+	switch {
+	case format.Dangerous:
+		return format, nil, reject("dangerous content: " + format.Name)
+	case !format.Media():
+		return format, nil, reject("not a video: " + format.Name)
+	}
+	// Файл из карантина админ уже посмотрел: остается только убедиться, что это видео
+	if !u.Trusted {
+		if !slices.Contains(allowedUploadFormats(), format.Name) {
+			return format, nil, reject("format is not allowed: " + format.Name)
+		}
+		if reason := suspiciousDeclaration(u); reason != "" {
+			return format, nil, reject(reason)
+		}
+	}
+
+	if format.Name != probe.FormatMP4 && format.Name != probe.FormatMOV {
+		return format, nil, nil
+	}
+	info, err := probe.File(localPath)
+	if err != nil {
+		if u.Trusted {
+			return format, nil, nil
+		}
+		return format, nil, reject("corrupted container: " + err.Error())
+	}
+	return format, info, nil
+}
+
+// quarantineUpload переносит отвергнутый файл в uploads.quarantine_dir (вне хранилища — оттуда
+// ничего не раздается) и записывает его в quarantined_uploads. При успехе проставляет rejection.QuarantineID.
+// Если перенести не удалось, файл остается на месте, и его удалит вызывающий.
+func (s *Server) quarantineUpload(ctx context.Context, localPath string, u newUpload, rejection *uploadRejection) {
+	ctx = context.WithoutCancel(ctx)
+	q := &repository.QuarantinedUpload{
+		ID:             uuid.New(),
+		OwnerID:        u.OwnerID,
+		FileName:       u.FileName,
+		DeclaredType:   u.ContentType,
+		DetectedFormat: rejection.Format,
+		Reason:         rejection.Reason,
+		Size:           u.Size,
+		Checksum:       u.Checksum,
+		Upload:         map[string]string{},
+	}
+	q.FilePath = q.ID.String() + ".bin"
+	for k, v := range map[string]string{"title": u.Title, "description": u.Description, "visibility": u.Visibility} {
+		if v != "" {
+			q.Upload[k] = v
+		}
+	}
+
+	dir := viper.GetString("uploads.quarantine_dir")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		s.logger.Error("❌ Quarantine: mkdir failed", zap.String("dir", dir), zap.Error(err))
+		return
+	}
+	dst := filepath.Join(dir, q.FilePath)
+	if err := moveLocalFile(localPath, dst); err != nil {
+		s.logger.Error("❌ Quarantine: failed to move file", zap.String("file", localPath), zap.Error(err))
+		return
+	}
+	if err := s.quarantine.Create(ctx, q); err != nil {
+		// Файл без записи никто не увидит — не копим его
+		_ = os.Remove(dst)
+		s.logger.Error("❌ Quarantine: failed to record upload", zap.Error(err))
+		return
+	}
+
+	rejection.QuarantineID = &q.ID
+	s.logger.Warn("☣️ Upload quarantined",
+		zap.String("quarantine_id", q.ID.String()),
+		zap.String("owner_id", u.OwnerID.String()),
+		zap.String("file", u.FileName),
+		zap.String("declared_type", u.ContentType),
+		zap.String("detected_format", rejection.Format),
+		zap.String("reason", rejection.Reason))
+}
+
+// respondRejectedUpload отвечает 415, если err — отказ проверки содержимого, и возвращает true
+func (s *Server) respondRejectedUpload(w http.ResponseWriter, err error) bool {
+	var rejection *uploadRejection
+	if !errors.As(err, &rejection) {
+		return false
+	}
+	s.respondErrorDetails(w, http.StatusUnsupportedMediaType,
+		"Файл не принят: допустимы только видео "+strings.Join(allowedUploadFormats(), ", ")+". Он передан на проверку администратору",
+		"upload_rejected", rejection)
+	return true
+}
+
+// moveLocalFile переносит файл; между файловыми системами — копированием
+func moveLocalFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
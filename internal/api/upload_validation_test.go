@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeFileName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"clip.mp4", "clip.mp4"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\Видео\отпуск.mov`, "отпуск.mov"},
+		{".htaccess", "htaccess"},
+		{"evil\u202Eexe.mp4", "evilexe.mp4"},
+		{"line\nbreak.mp4", "linebreak.mp4"},
+		{"bad\xffutf8.mp4", "badutf8.mp4"},
+		{"", ""},
+		{"/", ""},
+		{strings.Repeat("я", 300), strings.Repeat("я", maxFileNameLen)},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, normalizeFileName(tt.in), tt.in)
+	}
+}
+
+func TestSuspiciousDeclaration(t *testing.T) {
+	assert.Empty(t, suspiciousDeclaration(newUpload{FileName: "clip.MP4", ContentType: "video/mp4"}))
+	assert.Empty(t, suspiciousDeclaration(newUpload{FileName: "clip", ContentType: "application/octet-stream"}))
+	assert.Empty(t, suspiciousDeclaration(newUpload{}))
+	assert.Contains(t, suspiciousDeclaration(newUpload{FileName: "clip.html", ContentType: "video/mp4"}), ".html")
+	assert.Contains(t, suspiciousDeclaration(newUpload{FileName: "clip.mp4", ContentType: "text/html"}), "text/html")
+	assert.NotEmpty(t, suspiciousDeclaration(newUpload{FileName: "clip.mp4", ContentType: "video/"}))
+}
+
+func TestInspectUpload(t *testing.T) {
+	viper.Set("uploads.allowed_formats", []string{"mp4", "webm"})
+	defer viper.Set("uploads.allowed_formats", nil)
+	s := &Server{}
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(p, data, 0600))
+		return p
+	}
+	webm := []byte{0x1a, 0x45, 0xdf, 0xa3, 0x87, 0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'}
+	mkv := []byte{0x1a, 0x45, 0xdf, 0xa3, 0x8b, 0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'}
+
+	format, info, err := s.inspectUpload(write("a", webm), newUpload{FileName: "a.webm", ContentType: "video/webm"})
+	assert.NoError(t, err)
+	assert.Equal(t, ".webm", format.Ext)
+	assert.Nil(t, info)
+
+	rejected := func(path string, u newUpload, reason string) {
+		_, _, err := s.inspectUpload(path, u)
+		var rejection *uploadRejection
+		if assert.ErrorAs(t, err, &rejection) {
+			assert.Contains(t, rejection.Reason, reason)
+		}
+		assert.True(t, errors.Is(err, errNotMedia))
+	}
+	rejected(write("b", []byte("<html><script>alert(1)</script>")), newUpload{FileName: "b.mp4"}, "dangerous")
+	rejected(write("c", []byte("plain text")), newUpload{FileName: "c.mp4"}, "not a video")
+	rejected(write("d", mkv), newUpload{FileName: "d.mkv"}, "not allowed")
+	rejected(write("e", webm), newUpload{FileName: "e.svg"}, "extension")
+	// MP4-сигнатура без moov — поврежденный контейнер
+	rejected(write("f", []byte("\x00\x00\x00\x10ftypisom\x00\x00\x00\x00")), newUpload{FileName: "f.mp4"}, "corrupted")
+
+	// Одобренный админом файл: allowlist и заявленный тип не важны, но это должно быть видео
+	_, _, err = s.inspectUpload(write("g", mkv), newUpload{FileName: "g.svg", Trusted: true})
+	assert.NoError(t, err)
+	rejected(write("h", []byte("MZ")), newUpload{Trusted: true}, "dangerous")
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// respondUserError отвечает на ошибку UserRepository
+func (s *Server) respondUserError(w http.ResponseWriter, err error, id uuid.UUID, action string) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		s.respondError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, repository.ErrUserExists):
+		s.respondError(w, http.StatusConflict, "Username or email already taken")
+	case errors.Is(err, repository.ErrUserHasAssets):
+		s.respondError(w, http.StatusConflict, "User owns videos: disable the account instead")
+	case errors.Is(err, repository.ErrWeakPassword):
+		s.respondError(w, http.StatusBadRequest, "password is too short")
+	default:
+		s.logger.Error("Failed to "+action, zap.String("user_id", id.String()), zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to "+action)
+	}
+}
+
+// targetUser разбирает {id} и не дает админу отключить, разжаловать или удалить самого себя:
+// иначе можно остаться без единого администратора. При ошибке сам отвечает клиенту.
+func (s *Server) targetUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return uuid.Nil, false
+	}
+	if admin, _ := types.GetUserID(r.Context()); admin == id {
+		s.respondError(w, http.StatusConflict, "Нельзя изменить собственную учетную запись администратора")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// handleMe возвращает профиль текущего пользователя
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	userID, _ := types.GetUserID(r.Context())
+
+	user, err := s.users.GetByID(r.Context(), userID)
+	if err != nil {
+		s.respondUserError(w, err, userID, "fetch user")
+		return
+	}
+	s.respond(w, http.StatusOK, user)
+}
+
+// updateMeRequest — тело PATCH /me. Для смены пароля нужен текущий.
+type updateMeRequest struct {
+	Username        *string `json:"username"`
+	Email           *string `json:"email"`
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+// handleUpdateMe меняет логин, email или пароль текущего пользователя. Роль здесь не меняется.
+func (s *Server) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, _ := types.GetUserID(r.Context())
+
+	var req updateMeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := s.users.GetByID(r.Context(), userID)
+	if err != nil {
+		s.respondUserError(w, err, userID, "fetch user")
+		return
+	}
+	username, email := user.Username, user.Email
+	if req.Username != nil {
+		username = *req.Username
+	}
+	if req.Email != nil {
+		email = *req.Email
+	}
+	if problem := repository.CheckUser(username, email, user.Role); problem != "" {
+		s.respondError(w, http.StatusBadRequest, problem)
+		return
+	}
+
+	patch := repository.UserPatch{Username: req.Username, Email: req.Email}
+	if req.Password != nil {
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)) != nil {
+			s.respondError(w, http.StatusForbidden, "current_password is wrong")
+			return
+		}
+		hash, err := repository.HashPassword(*req.Password)
+		if err != nil {
+			s.respondUserError(w, err, userID, "update user")
+			return
+		}
+		patch.PasswordHash = &hash
+	}
+
+	updated, err := s.users.Update(r.Context(), userID, patch)
+	if err != nil {
+		s.respondUserError(w, err, userID, "update user")
+		return
+	}
+	if req.Password != nil {
+		s.logger.Info("🔐 Password changed", zap.String("user_id", userID.String()))
+		// Старый пароль мог утечь: все входы, включая текущий, придется повторить
+		s.revokeSessions(r.Context(), userID)
+	}
+	s.respond(w, http.StatusOK, updated)
+}
+
+// handleAdminListUsers возвращает пользователей: ?role=streamer&limit=100
+func (s *Server) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	f := repository.UserFilter{Role: r.URL.Query().Get("role")}
+	if f.Role != "" && !repository.ValidRole(f.Role) {
+		s.respondError(w, http.StatusBadRequest, "Unknown role")
+		return
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	users, err := s.users.List(r.Context(), f)
+	if err != nil {
+		s.logger.Error("Failed to list users", zap.Error(err))
+		s.respondError(w, http.StatusInternalServerError, "failed to fetch users")
+		return
+	}
+	s.respond(w, http.StatusOK, users)
+}
+
+// createUserRequest — тело POST /admin/users
+type createUserRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"` // Пусто — user
+}
+
+// handleAdminCreateUser заводит пользователя
+func (s *Server) handleAdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Role == "" {
+		req.Role = repository.RoleUser
+	}
+	if problem := repository.CheckUser(req.Username, req.Email, req.Role); problem != "" {
+		s.respondError(w, http.StatusBadRequest, problem)
+		return
+	}
+	hash, err := repository.HashPassword(req.Password)
+	if err != nil {
+		s.respondUserError(w, err, uuid.Nil, "create user")
+		return
+	}
+
+	user := &repository.User{Username: req.Username, Email: req.Email, PasswordHash: hash, Role: req.Role}
+	if err := s.users.Create(r.Context(), user); err != nil {
+		s.respondUserError(w, err, uuid.Nil, "create user")
+		return
+	}
+
+	admin, _ := types.GetUserID(r.Context())
+	s.logger.Info("👤 User created",
+		zap.String("user_id", user.ID.String()),
+		zap.String("role", user.Role),
+		zap.String("by", admin.String()))
+	s.respond(w, http.StatusCreated, user)
+}
+
+// handleAdminGetUser возвращает пользователя по ID
+func (s *Server) handleAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	user, err := s.users.GetByID(r.Context(), id)
+	if err != nil {
+		s.respondUserError(w, err, id, "fetch user")
+		return
+	}
+	s.respond(w, http.StatusOK, user)
+}
+
+// roleRequest — тело PUT /admin/users/{id}/role
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+// handleAdminSetRole меняет роль. В выданных access-токенах роль прежняя до их обновления.
+func (s *Server) handleAdminSetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !repository.ValidRole(req.Role) {
+		s.respondError(w, http.StatusBadRequest, "Unknown role")
+		return
+	}
+
+	user, err := s.users.Update(r.Context(), id, repository.UserPatch{Role: &req.Role})
+	if err != nil {
+		s.respondUserError(w, err, id, "update user")
+		return
+	}
+
+	admin, _ := types.GetUserID(r.Context())
+	s.logger.Info("🎭 User role changed",
+		zap.String("user_id", id.String()),
+		zap.String("role", req.Role),
+		zap.String("by", admin.String()))
+	s.respond(w, http.StatusOK, user)
+}
+
+// handleAdminDisableUser отключает пользователя: вход, обновление токена и ключи трансляции перестают работать
+func (s *Server) handleAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, true)
+}
+
+// handleAdminEnableUser включает пользователя обратно
+func (s *Server) handleAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, false)
+}
+
+func (s *Server) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := s.users.SetDisabled(r.Context(), id, disabled)
+	if err != nil {
+		s.respondUserError(w, err, id, "update user")
+		return
+	}
+
+	admin, _ := types.GetUserID(r.Context())
+	s.logger.Info("🚦 User status changed",
+		zap.String("user_id", id.String()),
+		zap.Bool("disabled", disabled),
+		zap.String("by", admin.String()))
+	if disabled {
+		s.revokeSessions(r.Context(), id)
+	}
+	s.respond(w, http.StatusOK, user)
+}
+
+// revokeSessions отзывает refresh-семейства пользователя. Ошибка Redis только логируется:
+// изменение в базе уже сохранено, и откатывать его из-за сессий не нужно.
+func (s *Server) revokeSessions(ctx context.Context, userID uuid.UUID) {
+	n, err := s.sessions.RevokeUser(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to revoke user sessions", zap.String("user_id", userID.String()), zap.Error(err))
+		return
+	}
+	s.logger.Info("🔒 User sessions revoked", zap.String("user_id", userID.String()), zap.Int("families", n))
+}
+
+// handleAdminDeleteUser удаляет пользователя без видео
+func (s *Server) handleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.users.Delete(r.Context(), id); err != nil {
+		s.respondUserError(w, err, id, "delete user")
+		return
+	}
+
+	admin, _ := types.GetUserID(r.Context())
+	s.logger.Info("🗑️ User deleted", zap.String("user_id", id.String()), zap.String("by", admin.String()))
+	w.WriteHeader(http.StatusNoContent)
+}
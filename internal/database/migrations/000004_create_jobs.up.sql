@@ -0,0 +1,38 @@
+-- Очередь фоновых задач обработки медиа (package, thumbnail)
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    -- Тип задачи: 'package', 'thumbnail'
+    type VARCHAR(50) NOT NULL,
+
+    -- Актив, который обрабатывает задача
+    asset_id UUID NOT NULL,
+
+    -- Параметры задачи (путь к исходнику и т.д.)
+    payload JSONB DEFAULT '{}',
+
+    -- Статус: 'pending', 'running', 'done', 'dead' (исчерпаны попытки), 'cancelled'
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    last_error TEXT,
+
+    -- Не раньше этого момента задачу можно брать в работу (backoff между попытками)
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Когда воркер взял задачу; зависшие 'running' забираются повторно по таймауту
+    locked_at TIMESTAMP WITH TIME ZONE,
+    locked_by VARCHAR(100),
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_job_asset
+    FOREIGN KEY(asset_id)
+    REFERENCES media_assets(id)
+    ON DELETE CASCADE
+    );
+
+-- Выборка следующей задачи: WHERE status = 'pending' AND run_at <= NOW()
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at ON jobs(status, run_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_asset ON jobs(asset_id);
@@ -0,0 +1,30 @@
+-- Видимость актива: 'private' (владелец и список доступа), 'unlisted' (по ссылке, без списков), 'public'
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'private';
+
+-- Уже загруженные видео были доступны всем по UUID — сохраняем это, но убираем их из чужих списков
+UPDATE media_assets SET visibility = 'unlisted';
+
+ALTER TABLE media_assets ADD CONSTRAINT chk_media_visibility
+    CHECK (visibility IN ('private', 'unlisted', 'public'));
+
+-- Явный список доступа: пользователи, которым владелец открыл актив
+CREATE TABLE IF NOT EXISTS asset_shares (
+    asset_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (asset_id, user_id),
+
+    CONSTRAINT fk_share_asset
+    FOREIGN KEY(asset_id)
+    REFERENCES media_assets(id)
+    ON DELETE CASCADE,
+
+    CONSTRAINT fk_share_user
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+    );
+
+-- "Что мне расшарили": WHERE user_id = $1
+CREATE INDEX IF NOT EXISTS idx_asset_shares_user ON asset_shares(user_id);
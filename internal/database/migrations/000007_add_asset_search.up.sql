@@ -0,0 +1,16 @@
+-- Полнотекстовый поиск по названию и описанию. Конфигурация 'simple' не зависит от языка:
+-- названия бывают и на русском, и на английском, а стемминг одного языка портит другой.
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_media_assets_search ON media_assets USING GIN (search_vector);
+
+-- Keyset-пагинация: ORDER BY created_at DESC, id DESC и WHERE (created_at, id) < (...)
+CREATE INDEX IF NOT EXISTS idx_media_assets_created_id ON media_assets (created_at DESC, id DESC);
+
+-- Курсор опирается на created_at, поэтому пустых дат быть не должно
+UPDATE media_assets SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE media_assets ALTER COLUMN created_at SET NOT NULL;
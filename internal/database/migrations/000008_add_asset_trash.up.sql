@@ -0,0 +1,5 @@
+-- Корзина: удаленный актив скрыт из всех выборок, но его можно восстановить до окончательной очистки
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Очистка по сроку хранения и список корзины: WHERE deleted_at IS NOT NULL ORDER BY deleted_at
+CREATE INDEX IF NOT EXISTS idx_media_assets_deleted ON media_assets (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Персональная квота в байтах. NULL — квота роли из hydro.yaml (quotas.roles), 0 — без ограничений.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS quota_bytes BIGINT;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_quota_bytes_check;
+ALTER TABLE users ADD CONSTRAINT users_quota_bytes_check CHECK (quota_bytes IS NULL OR quota_bytes >= 0);
@@ -0,0 +1,62 @@
+-- SHA-256 исходника (hex). У загруженных до дедупликации — NULL.
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS checksum CHAR(64);
+
+-- Файлы исходников и число активов, которые на них ссылаются (включая корзину).
+-- Одинаковые загрузки делят один файл; он удаляется, когда уходит последняя ссылка.
+CREATE TABLE IF NOT EXISTS blobs (
+    storage_path TEXT PRIMARY KEY,
+    checksum CHAR(64),
+    size BIGINT,
+    ref_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_blobs_checksum ON blobs (checksum) WHERE checksum IS NOT NULL;
+
+-- Счетчик ведет база: любой INSERT/DELETE/смена storage_path (в том числе каскадом) его поправит
+CREATE OR REPLACE FUNCTION blob_ref_add() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO blobs (storage_path, checksum, size, ref_count)
+    VALUES (NEW.storage_path, NEW.checksum,
+            CASE WHEN jsonb_typeof(NEW.metadata->'size') = 'number' THEN (NEW.metadata->>'size')::numeric::bigint END,
+            1)
+    ON CONFLICT (storage_path) DO UPDATE
+        SET ref_count = blobs.ref_count + 1,
+            checksum = COALESCE(blobs.checksum, EXCLUDED.checksum),
+            size = COALESCE(blobs.size, EXCLUDED.size);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION blob_ref_drop() RETURNS trigger AS $$
+BEGIN
+    UPDATE blobs SET ref_count = ref_count - 1 WHERE storage_path = OLD.storage_path;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_media_assets_blob_insert ON media_assets;
+CREATE TRIGGER trg_media_assets_blob_insert
+    AFTER INSERT ON media_assets
+    FOR EACH ROW EXECUTE FUNCTION blob_ref_add();
+
+DROP TRIGGER IF EXISTS trg_media_assets_blob_delete ON media_assets;
+CREATE TRIGGER trg_media_assets_blob_delete
+    AFTER DELETE ON media_assets
+    FOR EACH ROW EXECUTE FUNCTION blob_ref_drop();
+
+DROP TRIGGER IF EXISTS trg_media_assets_blob_move_out ON media_assets;
+CREATE TRIGGER trg_media_assets_blob_move_out
+    AFTER UPDATE OF storage_path ON media_assets
+    FOR EACH ROW WHEN (OLD.storage_path IS DISTINCT FROM NEW.storage_path)
+    EXECUTE FUNCTION blob_ref_drop();
+
+DROP TRIGGER IF EXISTS trg_media_assets_blob_move_in ON media_assets;
+CREATE TRIGGER trg_media_assets_blob_move_in
+    AFTER UPDATE OF storage_path ON media_assets
+    FOR EACH ROW WHEN (OLD.storage_path IS DISTINCT FROM NEW.storage_path)
+    EXECUTE FUNCTION blob_ref_add();
+
+-- Существующие файлы: считаем ссылки один раз
+INSERT INTO blobs (storage_path, ref_count)
+SELECT storage_path, COUNT(*) FROM media_assets GROUP BY storage_path
+ON CONFLICT (storage_path) DO UPDATE SET ref_count = EXCLUDED.ref_count;
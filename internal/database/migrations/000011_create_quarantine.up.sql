@@ -0,0 +1,23 @@
+-- Загрузки, не прошедшие проверку содержимого. Сами файлы лежат в uploads.quarantine_dir —
+-- вне хранилища, поэтому через /api/v1/storage они недоступны. Админ либо публикует файл, либо удаляет.
+CREATE TABLE IF NOT EXISTS quarantined_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- Имя файла в uploads.quarantine_dir
+    file_path TEXT NOT NULL,
+    -- Что прислал клиент (имя уже нормализовано) и что на самом деле внутри
+    file_name TEXT NOT NULL DEFAULT '',
+    declared_type TEXT NOT NULL DEFAULT '',
+    detected_format TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum CHAR(64),
+
+    -- Метаданные загрузки (title, description, visibility) — для публикации после проверки
+    upload JSONB NOT NULL DEFAULT '{}',
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantined_uploads_created ON quarantined_uploads(created_at DESC);
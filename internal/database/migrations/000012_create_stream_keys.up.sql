@@ -0,0 +1,24 @@
+-- Долгоживущие ключи трансляции для OBS и энкодеров (Bearer в WHIP вместо JWT).
+-- Сам ключ не хранится — только SHA-256: ключ случайный (256 бит), медленный хеш не нужен.
+CREATE TABLE IF NOT EXISTS stream_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    label TEXT NOT NULL DEFAULT '',
+    -- Начало ключа ("hsk_AbCd1234"), чтобы пользователь узнал его в списке
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+
+    -- NULL — бессрочный
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    rotated_at TIMESTAMP WITH TIME ZONE,
+
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip TEXT,
+    use_count BIGINT NOT NULL DEFAULT 0,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_keys_user ON stream_keys(user_id);
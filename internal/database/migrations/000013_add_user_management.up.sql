@@ -0,0 +1,10 @@
+-- Отключенный пользователь не может войти, обновить токен и вести трансляции; данные остаются.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP WITH TIME ZONE;
+
+-- Роли, которые понимает сервер (repository.ValidRole). NOT VALID: старые строки не проверяются,
+-- но любая новая запись или смена роли — да.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('admin', 'moderator', 'user', 'streamer')) NOT VALID;
+UPDATE users SET role = 'user' WHERE role IS NULL;
+ALTER TABLE users ALTER COLUMN role SET NOT NULL;
@@ -0,0 +1,339 @@
+/*
+Package fsck сверяет записи media_assets с содержимым хранилища.
+
+Находит три вида расхождений:
+  - сироты — объекты, на которые не ссылается ни один актив (недокаченные или не удаленные при откате загрузки);
+  - пропавшие файлы — актив ссылается на storage_path, которого в хранилище нет;
+  - несовпадение размера — объект есть, но его размер отличается от metadata.size.
+
+Своими считаются исходник (storage_path), аудиодорожка записи эфира (metadata.audio_path),
+превью (thumbnails/<id>.jpg или metadata.thumbnail) и все под vod/<id>/. Активы из корзины
+тоже держат свои файлы — их удаляет purger.
+*/
+package fsck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/packager"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"github.com/xela07ax/universal-backend-streaming/internal/worker"
+	"go.uber.org/zap"
+)
+
+// LostFoundPrefix — куда переносятся сироты в режиме карантина. Сам он не проверяется.
+const LostFoundPrefix = "lost+found/"
+
+// Что делать с сиротами
+const (
+	OrphansReport     = "report"     // Только показать
+	OrphansQuarantine = "quarantine" // Перенести в lost+found/
+	OrphansDelete     = "delete"     // Удалить
+)
+
+// Действия, попадающие в отчет
+const (
+	ActionQuarantined  = "quarantined"
+	ActionDeleted      = "deleted"
+	ActionMarkedFailed = "marked_failed"
+)
+
+// Store — контракт репозитория активов. Реализуется *repository.MediaRepository.
+type Store interface {
+	StorageRefs(ctx context.Context) ([]repository.StorageRef, error)
+	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+}
+
+// Config — параметры проверки
+type Config struct {
+	Orphans    string        // OrphansReport, OrphansQuarantine или OrphansDelete
+	MarkFailed bool          // Переводить активы с пропавшим или битым файлом в failed
+	MinAge     time.Duration // Объекты моложе не считаются сиротами: загрузка могла еще не записать актив
+}
+
+// Object — объект хранилища без владельца
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Action  string    `json:"action,omitempty"`
+}
+
+// Broken — актив, чей файл пропал или не совпадает по размеру
+type Broken struct {
+	AssetID  uuid.UUID `json:"asset_id"`
+	Key      string    `json:"key"`
+	Status   string    `json:"status"`
+	Trashed  bool      `json:"trashed,omitempty"`
+	Expected int64     `json:"expected_size,omitempty"`
+	Actual   int64     `json:"actual_size,omitempty"`
+	Action   string    `json:"action,omitempty"`
+}
+
+// Report — итог проверки
+type Report struct {
+	CheckedAt      time.Time `json:"checked_at"`
+	Assets         int       `json:"assets"`
+	Objects        int       `json:"objects"`
+	Bytes          int64     `json:"bytes"`
+	Recent         int       `json:"recent_skipped"` // Объекты моложе MinAge
+	Orphans        []Object  `json:"orphans"`
+	OrphanBytes    int64     `json:"orphan_bytes"`
+	Missing        []Broken  `json:"missing"`
+	SizeMismatches []Broken  `json:"size_mismatches"`
+	Errors         []string  `json:"errors,omitempty"`
+}
+
+// Clean сообщает, что расхождений не найдено
+func (r *Report) Clean() bool {
+	return len(r.Orphans) == 0 && len(r.Missing) == 0 && len(r.SizeMismatches) == 0 && len(r.Errors) == 0
+}
+
+// Checker сверяет базу с хранилищем
+type Checker struct {
+	cfg     Config
+	store   Store
+	storage storage.Backend
+	logger  *zap.Logger
+	now     func() time.Time
+}
+
+// New создает Checker
+func New(cfg Config, store Store, backend storage.Backend, logger *zap.Logger) *Checker {
+	if cfg.Orphans == "" {
+		cfg.Orphans = OrphansReport
+	}
+	return &Checker{cfg: cfg, store: store, storage: backend, logger: logger, now: time.Now}
+}
+
+// ValidOrphansMode проверяет значение Config.Orphans
+func ValidOrphansMode(mode string) bool {
+	switch mode {
+	case OrphansReport, OrphansQuarantine, OrphansDelete:
+		return true
+	}
+	return false
+}
+
+// Run проверяет хранилище и, если задано в Config, исправляет найденное
+func (c *Checker) Run(ctx context.Context) (*Report, error) {
+	if !ValidOrphansMode(c.cfg.Orphans) {
+		return nil, fmt.Errorf("fsck: unknown orphans mode %q", c.cfg.Orphans)
+	}
+
+	report := &Report{CheckedAt: c.now().UTC(), Orphans: []Object{}, Missing: []Broken{}, SizeMismatches: []Broken{}}
+
+	// Сначала список объектов, потом записи: файл, загруженный между ними, окажется «своим», а не сиротой
+	objects, err := c.storage.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("fsck: failed to list storage: %w", err)
+	}
+	refs, err := c.store.StorageRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Assets = len(refs)
+
+	byKey := make(map[string]storage.ObjectInfo, len(objects))
+	for _, obj := range objects {
+		byKey[obj.Key] = obj
+	}
+
+	owned := make(map[string]bool, len(refs)*3)
+	assets := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		assets[ref.AssetID.String()] = true
+		owned[packager.ThumbnailKey(ref.AssetID)] = true
+		for _, p := range []string{ref.StoragePath, ref.AudioPath, ref.Thumbnail} {
+			if key, err := storage.Key(p); err == nil {
+				owned[key] = true
+			}
+		}
+	}
+
+	c.checkAssets(ctx, report, refs, byKey)
+	c.checkObjects(ctx, report, objects, owned, assets)
+	return report, nil
+}
+
+// checkAssets ищет пропавшие файлы и несовпадения размера
+func (c *Checker) checkAssets(ctx context.Context, report *Report, refs []repository.StorageRef, byKey map[string]storage.ObjectInfo) {
+	for _, ref := range refs {
+		b := Broken{AssetID: ref.AssetID, Key: ref.StoragePath, Status: ref.Status, Trashed: ref.Trashed}
+
+		key, err := storage.Key(ref.StoragePath)
+		obj, found := byKey[key]
+		if err != nil || !found {
+			b.Action = c.markFailed(ctx, report, ref)
+			report.Missing = append(report.Missing, b)
+			continue
+		}
+		if ref.Size < 0 {
+			continue
+		}
+
+		// У записи эфира metadata.size — сумма видео и аудио
+		actual := obj.Size
+		if audioKey, err := storage.Key(ref.AudioPath); err == nil {
+			actual += byKey[audioKey].Size
+		}
+		if actual != ref.Size {
+			b.Key = key
+			b.Expected, b.Actual = ref.Size, actual
+			b.Action = c.markFailed(ctx, report, ref)
+			report.SizeMismatches = append(report.SizeMismatches, b)
+		}
+	}
+}
+
+// markFailed переводит сломанный актив в failed, если это включено. Возвращает действие для отчета.
+func (c *Checker) markFailed(ctx context.Context, report *Report, ref repository.StorageRef) string {
+	if !c.cfg.MarkFailed || ref.Trashed || ref.Status == worker.AssetFailed {
+		return ""
+	}
+	if err := c.store.UpdateStatus(ctx, ref.AssetID, worker.AssetFailed); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("mark %s failed: %v", ref.AssetID, err))
+		return ""
+	}
+	c.logger.Warn("⚠️ Fsck: asset marked failed", zap.String("asset_id", ref.AssetID.String()), zap.String("key", ref.StoragePath))
+	return ActionMarkedFailed
+}
+
+// checkObjects ищет сирот и, если задано, убирает их
+func (c *Checker) checkObjects(ctx context.Context, report *Report, objects []storage.ObjectInfo, owned, assets map[string]bool) {
+	cutoff := c.now().Add(-c.cfg.MinAge)
+
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Key, LostFoundPrefix) {
+			continue
+		}
+		report.Objects++
+		report.Bytes += obj.Size
+
+		if owned[obj.Key] || assets[vodAssetID(obj.Key)] {
+			continue
+		}
+		if obj.ModTime.After(cutoff) {
+			report.Recent++
+			continue
+		}
+
+		orphan := Object{Key: obj.Key, Size: obj.Size, ModTime: obj.ModTime.UTC()}
+		if err := c.removeOrphan(ctx, obj.Key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s %s: %v", c.cfg.Orphans, obj.Key, err))
+		} else {
+			orphan.Action = orphanAction(c.cfg.Orphans)
+		}
+		report.Orphans = append(report.Orphans, orphan)
+		report.OrphanBytes += obj.Size
+	}
+
+	sort.Slice(report.Orphans, func(i, j int) bool { return report.Orphans[i].Key < report.Orphans[j].Key })
+}
+
+// vodAssetID возвращает id актива из ключа "vod/<id>/..." или пустую строку
+func vodAssetID(key string) string {
+	rest, ok := strings.CutPrefix(key, "vod/")
+	if !ok {
+		return ""
+	}
+	id, _, ok := strings.Cut(rest, "/")
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+func (c *Checker) removeOrphan(ctx context.Context, key string) error {
+	switch c.cfg.Orphans {
+	case OrphansQuarantine:
+		if err := c.quarantine(ctx, key); err != nil {
+			return err
+		}
+		c.logger.Info("📦 Fsck: orphan quarantined", zap.String("key", key), zap.String("to", LostFoundPrefix+key))
+	case OrphansDelete:
+		if err := c.storage.Delete(ctx, key); err != nil {
+			return err
+		}
+		c.logger.Info("🗑️ Fsck: orphan deleted", zap.String("key", key))
+	}
+	return nil
+}
+
+// quarantine копирует объект в lost+found/ и удаляет оригинал
+func (c *Checker) quarantine(ctx context.Context, key string) error {
+	obj, info, err := c.storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = c.storage.Put(ctx, LostFoundPrefix+key, obj, info.Size, info.ContentType)
+	_ = obj.Close()
+	if err != nil {
+		return err
+	}
+	if err := c.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func orphanAction(mode string) string {
+	switch mode {
+	case OrphansQuarantine:
+		return ActionQuarantined
+	case OrphansDelete:
+		return ActionDeleted
+	}
+	return ""
+}
+
+// WriteText печатает отчет для человека
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Checked at:\t%s\n", r.CheckedAt.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Assets:\t%d\n", r.Assets)
+	fmt.Fprintf(tw, "Objects:\t%d (%d bytes)\n", r.Objects, r.Bytes)
+	if r.Recent > 0 {
+		fmt.Fprintf(tw, "Skipped as recent:\t%d\n", r.Recent)
+	}
+
+	fmt.Fprintf(tw, "\nOrphans: %d (%d bytes)\n", len(r.Orphans), r.OrphanBytes)
+	for _, o := range r.Orphans {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\n", o.Key, o.Size, o.ModTime.Format(time.RFC3339), o.Action)
+	}
+
+	fmt.Fprintf(tw, "\nMissing files: %d\n", len(r.Missing))
+	for _, b := range r.Missing {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", b.AssetID, b.Key, brokenState(b), b.Action)
+	}
+
+	fmt.Fprintf(tw, "\nSize mismatches: %d\n", len(r.SizeMismatches))
+	for _, b := range r.SizeMismatches {
+		fmt.Fprintf(tw, "  %s\t%s\texpected %d, actual %d\t%s\t%s\n", b.AssetID, b.Key, b.Expected, b.Actual, brokenState(b), b.Action)
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(tw, "\nErrors: %d\n", len(r.Errors))
+		for _, e := range r.Errors {
+			fmt.Fprintf(tw, "  %s\n", e)
+		}
+	}
+	return tw.Flush()
+}
+
+func brokenState(b Broken) string {
+	if b.Trashed {
+		return b.Status + " (trash)"
+	}
+	return b.Status
+}
@@ -0,0 +1,116 @@
+package fsck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
+)
+
+// memStore — записи активов в памяти
+type memStore struct {
+	refs   []repository.StorageRef
+	status map[uuid.UUID]string
+}
+
+func (m *memStore) StorageRefs(context.Context) ([]repository.StorageRef, error) {
+	return m.refs, nil
+}
+
+func (m *memStore) UpdateStatus(_ context.Context, id uuid.UUID, status string) error {
+	m.status[id] = status
+	return nil
+}
+
+func TestChecker_Run(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	backend, err := storage.NewLocal(storage.LocalConfig{Root: root})
+	assert.NoError(t, err)
+
+	put := func(key, data string, age time.Duration) {
+		assert.NoError(t, backend.Put(ctx, key, strings.NewReader(data), int64(len(data)), ""))
+		p, _ := backend.Path(key)
+		mtime := time.Now().Add(-age)
+		assert.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+
+	ok, recording, gone, truncated, trashed := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	put("1.mp4", "video", 48*time.Hour)
+	put("thumbnails/"+ok.String()+".jpg", "jpg", 48*time.Hour)
+	put("vod/"+ok.String()+"/master.m3u8", "#EXTM3U", 48*time.Hour)
+	put("recordings/v.webm", "video", 48*time.Hour)
+	put("recordings/a.ogg", "aud", 48*time.Hour)
+	put("3.mp4", "vid", 48*time.Hour)
+	put("4.mp4", "trash", 48*time.Hour)
+	put("orphan.mp4", "lost", 48*time.Hour)
+	put("vod/"+uuid.NewString()+"/seg_1.m4s", "segment", 48*time.Hour)
+	put("uploading.mp4", "in flight", time.Minute)
+	put(LostFoundPrefix+"old.mp4", "old", 48*time.Hour)
+
+	store := &memStore{status: map[uuid.UUID]string{}, refs: []repository.StorageRef{
+		{AssetID: ok, StoragePath: "uploads/1.mp4", Status: "ready", Size: 5},
+		{AssetID: recording, StoragePath: "recordings/v.webm", AudioPath: "recordings/a.ogg", Status: "ready", Size: 8},
+		{AssetID: gone, StoragePath: "2.mp4", Status: "ready", Size: -1},
+		{AssetID: truncated, StoragePath: "3.mp4", Status: "processing", Size: 100},
+		{AssetID: trashed, StoragePath: "4.mp4", Status: "ready", Size: -1, Trashed: true},
+	}}
+
+	// Только отчет: ничего не трогаем
+	report, err := New(Config{MinAge: time.Hour}, store, backend, zap.NewNop()).Run(ctx)
+	assert.NoError(t, err)
+	assert.False(t, report.Clean())
+	assert.Equal(t, 5, report.Assets)
+	assert.Equal(t, 1, report.Recent, "свежий файл мог еще не дождаться записи")
+	if assert.Len(t, report.Orphans, 2) {
+		assert.Equal(t, "orphan.mp4", report.Orphans[0].Key)
+		assert.Empty(t, report.Orphans[0].Action)
+		assert.True(t, strings.HasPrefix(report.Orphans[1].Key, "vod/"), "VOD удаленного актива")
+	}
+	assert.Equal(t, int64(11), report.OrphanBytes)
+	if assert.Len(t, report.Missing, 1) {
+		assert.Equal(t, gone, report.Missing[0].AssetID)
+	}
+	if assert.Len(t, report.SizeMismatches, 1) {
+		assert.Equal(t, truncated, report.SizeMismatches[0].AssetID)
+		assert.Equal(t, int64(3), report.SizeMismatches[0].Actual)
+	}
+	assert.Empty(t, store.status)
+
+	var text bytes.Buffer
+	assert.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "Orphans: 2 (11 bytes)")
+	assert.Contains(t, text.String(), gone.String())
+
+	raw, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"size_mismatches":[{"asset_id":"`+truncated.String())
+
+	// Карантин и пометка сломанных
+	report, err = New(Config{Orphans: OrphansQuarantine, MarkFailed: true, MinAge: time.Hour}, store, backend, zap.NewNop()).Run(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ActionQuarantined, report.Orphans[0].Action)
+	assert.Equal(t, ActionMarkedFailed, report.Missing[0].Action)
+	assert.Equal(t, map[uuid.UUID]string{gone: "failed", truncated: "failed"}, store.status)
+	assert.NoFileExists(t, filepath.Join(root, "orphan.mp4"))
+	assert.FileExists(t, filepath.Join(root, "lost+found", "orphan.mp4"))
+
+	// Удаление: сирот больше нет, карантин не проверяется
+	report, err = New(Config{Orphans: OrphansDelete, MinAge: time.Hour}, store, backend, zap.NewNop()).Run(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Orphans)
+	assert.FileExists(t, filepath.Join(root, "uploading.mp4"))
+
+	_, err = New(Config{Orphans: "shred"}, store, backend, zap.NewNop()).Run(ctx)
+	assert.Error(t, err)
+}
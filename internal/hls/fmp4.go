@@ -0,0 +1,226 @@
+package hls
+
+import (
+	"encoding/binary"
+)
+
+// Минимальный писатель fragmented MP4 (CMAF): init-сегмент (ftyp+moov) и фрагменты (moof+mdat).
+// Поддерживаются только H264 (avc1/avcC) и Opus (Opus/dOps) — то, что приходит из WHIP.
+
+// Флаги сэмплов в trun (ISO/IEC 14496-12, 8.8.3.1)
+const (
+	sampleFlagsKeyframe    = 0x02000000 // sample_depends_on=2 (не зависит от других)
+	sampleFlagsNonKeyframe = 0x01010000 // sample_depends_on=1, sample_is_non_sync_sample=1
+)
+
+// unityMatrix — единичная матрица трансформации для mvhd/tkhd
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+// trackInfo описывает трек в init-сегменте
+type trackInfo struct {
+	id        uint32
+	kind      TrackKind
+	timescale uint32
+
+	// Видео (H264)
+	sps, pps      []byte
+	width, height uint16
+
+	// Аудио (Opus)
+	channels uint16
+}
+
+// sample — один кадр (access unit) или аудио-пакет, готовый к записи во фрагмент
+type sample struct {
+	dts      uint64 // время декодирования в timescale трека
+	duration uint32
+	data     []byte
+	keyframe bool
+}
+
+// box собирает ISO BMFF бокс: 4 байта размера + тип + содержимое
+func box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := make([]byte, 0, size)
+	b = binary.BigEndian.AppendUint32(b, uint32(size))
+	b = append(b, typ...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// fullBox — бокс с полями version и flags
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, payload...)...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+func matrix() []byte {
+	b := make([]byte, 0, 36)
+	for _, v := range unityMatrix {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// buildInitSegment собирает init.mp4 для набора треков
+func buildInitSegment(tracks []*trackInfo) []byte {
+	ftyp := box("ftyp", []byte("iso5"), u32(512), []byte("iso5iso6mp41cmfc"))
+
+	var nextTrackID uint32 = 1
+	traks := make([][]byte, 0, len(tracks))
+	trexs := make([][]byte, 0, len(tracks))
+	for _, t := range tracks {
+		traks = append(traks, buildTrak(t))
+		trexs = append(trexs, fullBox("trex", 0, 0, u32(t.id), u32(1), u32(0), u32(0), u32(0)))
+		if t.id >= nextTrackID {
+			nextTrackID = t.id + 1
+		}
+	}
+
+	mvhd := fullBox("mvhd", 0, 0,
+		u32(0), u32(0), // creation/modification time
+		u32(1000), u32(0), // timescale, duration
+		u32(0x00010000), u16(0x0100), make([]byte, 10), // rate, volume, reserved
+		matrix(), make([]byte, 24), // matrix, pre_defined
+		u32(nextTrackID),
+	)
+
+	moovPayload := append([][]byte{mvhd}, traks...)
+	moovPayload = append(moovPayload, box("mvex", trexs...))
+
+	return append(ftyp, box("moov", moovPayload...)...)
+}
+
+func buildTrak(t *trackInfo) []byte {
+	var volume uint16
+	if t.kind == TrackAudio {
+		volume = 0x0100
+	}
+
+	tkhd := fullBox("tkhd", 0, 0x000003, // enabled | in_movie
+		u32(0), u32(0), u32(t.id), u32(0), u32(0), // times, track_ID, reserved, duration
+		make([]byte, 8), u16(0), u16(0), u16(volume), u16(0), // reserved, layer, alternate_group, volume, reserved
+		matrix(), u32(uint32(t.width)<<16), u32(uint32(t.height)<<16),
+	)
+
+	mdhd := fullBox("mdhd", 0, 0, u32(0), u32(0), u32(t.timescale), u32(0), u16(0x55C4), u16(0)) // language "und"
+
+	handler, name, mediaHeader := "vide", "VideoHandler", fullBox("vmhd", 0, 1, make([]byte, 8))
+	if t.kind == TrackAudio {
+		handler, name, mediaHeader = "soun", "SoundHandler", fullBox("smhd", 0, 0, make([]byte, 4))
+	}
+	hdlr := fullBox("hdlr", 0, 0, u32(0), []byte(handler), make([]byte, 12), []byte(name), []byte{0})
+
+	dinf := box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1)))
+
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), sampleEntry(t)),
+		fullBox("stts", 0, 0, u32(0)),
+		fullBox("stsc", 0, 0, u32(0)),
+		fullBox("stsz", 0, 0, u32(0), u32(0)),
+		fullBox("stco", 0, 0, u32(0)),
+	)
+
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", mediaHeader, dinf, stbl)))
+}
+
+func sampleEntry(t *trackInfo) []byte {
+	if t.kind == TrackAudio {
+		dOps := box("dOps",
+			[]byte{0, byte(t.channels)},   // Version, OutputChannelCount
+			u16(312),                      // PreSkip (стандартное значение libopus)
+			u32(48000), u16(0), []byte{0}, // InputSampleRate, OutputGain, ChannelMappingFamily
+		)
+		return box("Opus",
+			make([]byte, 6), u16(1), // reserved, data_reference_index
+			make([]byte, 8), u16(t.channels), u16(16), u16(0), u16(0), // reserved, channelcount, samplesize, pre_defined, reserved
+			u32(48000<<16), dOps,
+		)
+	}
+
+	// profile, compat, level — байты 1..3 SPS; короткий SPS не должен ронять сервер
+	var pcl [3]byte
+	if len(t.sps) >= minParamSetSize {
+		copy(pcl[:], t.sps[1:4])
+	}
+	avcC := box("avcC",
+		[]byte{1, pcl[0], pcl[1], pcl[2], 0xFF, 0xE1}, // version, profile, compat, level, lengthSize=4, 1 SPS
+		u16(uint16(len(t.sps))), t.sps,
+		[]byte{1}, u16(uint16(len(t.pps))), t.pps,
+	)
+	return box("avc1",
+		make([]byte, 6), u16(1), // reserved, data_reference_index
+		u16(0), u16(0), make([]byte, 12), // pre_defined, reserved, pre_defined
+		u16(t.width), u16(t.height),
+		u32(0x00480000), u32(0x00480000), u32(0), u16(1), // 72 dpi, reserved, frame_count
+		make([]byte, 32), u16(0x0018), u16(0xFFFF), // compressorname, depth, pre_defined=-1
+		avcC,
+	)
+}
+
+// fragmentTrack — сэмплы одного трека, попадающие во фрагмент
+type fragmentTrack struct {
+	id      uint32
+	samples []sample
+}
+
+// buildFragment собирает moof+mdat с сэмплами всех переданных треков
+func buildFragment(seq uint32, tracks []fragmentTrack) []byte {
+	// Размер moof не зависит от значений data_offset, поэтому сначала
+	// собираем с нулевыми смещениями, затем — с настоящими.
+	offsets := make([]int32, len(tracks))
+	moof := buildMoof(seq, tracks, offsets)
+
+	offset := int32(len(moof) + 8) // + заголовок mdat
+	var mdatSize int
+	for i, t := range tracks {
+		offsets[i] = offset
+		for _, s := range t.samples {
+			offset += int32(len(s.data))
+			mdatSize += len(s.data)
+		}
+	}
+	moof = buildMoof(seq, tracks, offsets)
+
+	mdat := make([]byte, 0, mdatSize)
+	for _, t := range tracks {
+		for _, s := range t.samples {
+			mdat = append(mdat, s.data...)
+		}
+	}
+	return append(moof, box("mdat", mdat)...)
+}
+
+func buildMoof(seq uint32, tracks []fragmentTrack, offsets []int32) []byte {
+	payload := [][]byte{fullBox("mfhd", 0, 0, u32(seq))}
+
+	for i, t := range tracks {
+		tfhd := fullBox("tfhd", 0, 0x020000, u32(t.id)) // default-base-is-moof
+		tfdt := fullBox("tfdt", 1, 0, u64(t.samples[0].dts))
+
+		entries := make([]byte, 0, len(t.samples)*12)
+		for _, s := range t.samples {
+			flags := uint32(sampleFlagsNonKeyframe)
+			if s.keyframe {
+				flags = sampleFlagsKeyframe
+			}
+			entries = binary.BigEndian.AppendUint32(entries, s.duration)
+			entries = binary.BigEndian.AppendUint32(entries, uint32(len(s.data)))
+			entries = binary.BigEndian.AppendUint32(entries, flags)
+		}
+		// data-offset | sample-duration | sample-size | sample-flags
+		trun := fullBox("trun", 0, 0x000701, u32(uint32(len(t.samples))), u32(uint32(offsets[i])), entries)
+
+		payload = append(payload, box("traf", tfhd, tfdt, trun))
+	}
+	return box("moof", payload...)
+}
@@ -0,0 +1,273 @@
+package hls
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+// Типы NAL-юнитов H264, которые важны упаковщику
+const (
+	naluTypeIDR = 5
+	naluTypeSPS = 7
+	naluTypePPS = 8
+	naluTypeAUD = 9
+)
+
+// minParamSetSize — минимальная длина SPS/PPS: заголовок NAL + profile_idc, constraint flags, level_idc
+const minParamSetSize = 4
+
+var errShortSPS = errors.New("h264: sps too short")
+
+// accessUnit — собранный кадр H264 в AVC-формате (NAL с 4-байтной длиной)
+type accessUnit struct {
+	timestamp uint32
+	data      []byte
+	keyframe  bool
+}
+
+// h264Depacketizer собирает RTP-пакеты (RFC 6184: single NAL, STAP-A, FU-A) в кадры.
+// SPS/PPS вынимаются из потока и хранятся отдельно — они уходят в avcC init-сегмента.
+type h264Depacketizer struct {
+	packet codecs.H264Packet
+
+	current    []byte
+	currentTS  uint32
+	hasCurrent bool
+	keyframe   bool
+
+	sps, pps []byte
+}
+
+func newH264Depacketizer() *h264Depacketizer {
+	return &h264Depacketizer{packet: codecs.H264Packet{IsAVC: true}}
+}
+
+// push принимает RTP-пакет и возвращает кадр, если он завершен (marker bit или смена timestamp)
+func (d *h264Depacketizer) push(pkt *rtp.Packet) *accessUnit {
+	var done *accessUnit
+	if d.hasCurrent && pkt.Timestamp != d.currentTS {
+		// Пакет с marker bit потерялся — закрываем кадр по смене timestamp
+		done = d.flush()
+	}
+
+	payload, err := d.packet.Unmarshal(pkt.Payload)
+	if err != nil {
+		return done
+	}
+
+	if !d.hasCurrent {
+		d.hasCurrent = true
+		d.currentTS = pkt.Timestamp
+	}
+	d.appendNALUs(payload)
+
+	if pkt.Marker {
+		if done != nil {
+			// Оба кадра завершены одним пакетом: предыдущий отдаем сейчас, текущий — на следующем вызове
+			return done
+		}
+		return d.flush()
+	}
+	return done
+}
+
+// appendNALUs разбирает AVC-буфер (длина + NAL) и раскладывает NAL по назначению
+func (d *h264Depacketizer) appendNALUs(buf []byte) {
+	for len(buf) >= 4 {
+		size := int(binary.BigEndian.Uint32(buf))
+		if size == 0 || len(buf) < 4+size {
+			return
+		}
+		nalu := buf[4 : 4+size]
+		buf = buf[4+size:]
+
+		switch nalu[0] & 0x1F {
+		case naluTypeSPS, naluTypePPS:
+			// Обрезанные SPS/PPS не берем: из SPS читаются профиль и уровень для avcC
+			if len(nalu) < minParamSetSize {
+				continue
+			}
+			if nalu[0]&0x1F == naluTypeSPS {
+				d.sps = append([]byte(nil), nalu...)
+			} else {
+				d.pps = append([]byte(nil), nalu...)
+			}
+			continue
+		case naluTypeAUD:
+			continue
+		case naluTypeIDR:
+			d.keyframe = true
+		}
+		d.current = binary.BigEndian.AppendUint32(d.current, uint32(size))
+		d.current = append(d.current, nalu...)
+	}
+}
+
+func (d *h264Depacketizer) flush() *accessUnit {
+	au := &accessUnit{timestamp: d.currentTS, data: d.current, keyframe: d.keyframe}
+	d.current = nil
+	d.hasCurrent = false
+	d.keyframe = false
+	if len(au.data) == 0 {
+		return nil
+	}
+	return au
+}
+
+// bitReader читает RBSP по битам (включая Exp-Golomb коды)
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (b *bitReader) bit() uint32 {
+	if b.pos >= len(b.data)*8 {
+		b.pos++
+		return 0
+	}
+	v := (b.data[b.pos/8] >> (7 - uint(b.pos%8))) & 1
+	b.pos++
+	return uint32(v)
+}
+
+func (b *bitReader) bits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | b.bit()
+	}
+	return v
+}
+
+func (b *bitReader) ue() uint32 {
+	zeros := 0
+	for b.bit() == 0 && zeros < 32 {
+		zeros++
+	}
+	return (1<<zeros - 1) + b.bits(zeros)
+}
+
+func (b *bitReader) se() int32 {
+	v := b.ue()
+	if v&1 == 1 {
+		return int32((v + 1) / 2)
+	}
+	return -int32(v / 2)
+}
+
+func (b *bitReader) overrun() bool {
+	return b.pos > len(b.data)*8
+}
+
+// unescapeRBSP убирает emulation prevention bytes (00 00 03 -> 00 00)
+func unescapeRBSP(nalu []byte) []byte {
+	out := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, c := range nalu {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// parseSPSResolution извлекает ширину и высоту кадра из SPS (ITU-T H.264, 7.3.2.1.1)
+func parseSPSResolution(sps []byte) (uint16, uint16, error) {
+	if len(sps) < 4 {
+		return 0, 0, errShortSPS
+	}
+	r := &bitReader{data: unescapeRBSP(sps[1:])}
+
+	profile := r.bits(8)
+	r.bits(16) // constraint flags + level_idc
+	r.ue()     // seq_parameter_set_id
+
+	chromaFormat := uint32(1)
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = r.ue()
+		if chromaFormat == 3 {
+			r.bit() // separate_colour_plane_flag
+		}
+		r.ue()            // bit_depth_luma_minus8
+		r.ue()            // bit_depth_chroma_minus8
+		r.bit()           // qpprime_y_zero_transform_bypass_flag
+		if r.bit() == 1 { // seq_scaling_matrix_present_flag
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bit() == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := int32(8), int32(8)
+				for j := 0; j < size; j++ {
+					if next != 0 {
+						next = (last + r.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bit() // delta_pic_order_always_zero_flag
+		r.se()  // offset_for_non_ref_pic
+		r.se()  // offset_for_top_to_bottom_field
+		cycle := r.ue()
+		for i := uint32(0); i < cycle && !r.overrun(); i++ {
+			r.se()
+		}
+	}
+	r.ue()  // max_num_ref_frames
+	r.bit() // gaps_in_frame_num_value_allowed_flag
+
+	widthMbs := r.ue() + 1
+	heightMapUnits := r.ue() + 1
+	frameMbsOnly := r.bit()
+	if frameMbsOnly == 0 {
+		r.bit() // mb_adaptive_frame_field_flag
+	}
+	r.bit() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if r.bit() == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	if r.overrun() {
+		return 0, 0, errShortSPS
+	}
+
+	cropUnitX, cropUnitY := uint32(1), 2-frameMbsOnly
+	if chromaFormat == 1 || chromaFormat == 2 {
+		cropUnitX = 2
+	}
+	if chromaFormat == 1 {
+		cropUnitY *= 2
+	}
+
+	width := widthMbs*16 - (cropLeft+cropRight)*cropUnitX
+	height := (2-frameMbsOnly)*heightMapUnits*16 - (cropTop+cropBottom)*cropUnitY
+	return uint16(width), uint16(height), nil
+}
@@ -0,0 +1,170 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Manager хранит упаковщики всех живых трансляций
+type Manager struct {
+	cfg     Config
+	logger  *zap.Logger
+	mu      sync.RWMutex
+	streams map[string]*Stream
+}
+
+// NewManager создает реестр живых HLS-потоков
+func NewManager(cfg Config, logger *zap.Logger) *Manager {
+	return &Manager{
+		cfg:     cfg,
+		logger:  logger,
+		streams: make(map[string]*Stream),
+	}
+}
+
+// Create регистрирует упаковщик для новой трансляции. После Stream.Close() он еще linger
+// отдает последний плейлист (с EXT-X-ENDLIST) и хвост окна, затем сам уходит из реестра.
+func (m *Manager) Create(streamID string) *Stream {
+	s := newStream(streamID, m.cfg, m.logger)
+	s.onClose = func() {
+		time.AfterFunc(m.cfg.linger(), func() {
+			m.mu.Lock()
+			if m.streams[streamID] == s {
+				delete(m.streams, streamID)
+			}
+			m.mu.Unlock()
+		})
+	}
+
+	m.mu.Lock()
+	m.streams[streamID] = s
+	m.mu.Unlock()
+	return s
+}
+
+// Get возвращает упаковщик трансляции
+func (m *Manager) Get(streamID string) (*Stream, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.streams[streamID]
+	return s, ok
+}
+
+// HandleLive отдает плейлист, init-сегмент, сегменты и части: /live/{id}/{file}
+func (m *Manager) HandleLive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stream, ok := m.Get(chi.URLParam(r, "id"))
+		if !ok {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+
+		file := chi.URLParam(r, "file")
+		var (
+			data        []byte
+			err         error
+			contentType = "video/mp4"
+		)
+
+		switch {
+		case file == "playlist.m3u8":
+			if err := m.blockingReload(r, stream); err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			data, err = stream.Playlist()
+			contentType = "application/vnd.apple.mpegurl"
+			w.Header().Set("Cache-Control", "no-cache")
+		case file == "init.mp4":
+			data, err = stream.InitSegment()
+		default:
+			err = ErrNotFound
+			if msn, ok := parseSegmentName(file); ok {
+				data, err = stream.Segment(msn)
+			} else if msn, index, ok := parsePartName(file); ok {
+				data, err = stream.Part(msn, index)
+			}
+			contentType = "video/iso.segment"
+		}
+
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, ErrNotReady) {
+				// Эфир идет, но первый ключевой кадр еще не пришел
+				status = http.StatusServiceUnavailable
+				w.Header().Set("Retry-After", "1")
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	}
+}
+
+// blockingReload реализует _HLS_msn/_HLS_part: ответ задерживается до появления запрошенной части
+func (m *Manager) blockingReload(r *http.Request, stream *Stream) error {
+	q := r.URL.Query()
+	if q.Get("_HLS_msn") == "" {
+		return nil
+	}
+	msn, err := strconv.ParseUint(q.Get("_HLS_msn"), 10, 64)
+	if err != nil {
+		return err
+	}
+	index := -1
+	if p := q.Get("_HLS_part"); p != "" {
+		if index, err = strconv.Atoi(p); err != nil {
+			return err
+		}
+	}
+	if index < 0 {
+		// Ждем завершения сегмента msn = появления первой части msn+1
+		msn, index = msn+1, 0
+	}
+
+	// Спецификация: сервер ждет не дольше трех target duration
+	ctx, cancel := context.WithTimeout(r.Context(), 3*m.cfg.TargetDuration)
+	defer cancel()
+	_ = stream.WaitFor(ctx, msn, index)
+	return nil
+}
+
+// parseSegmentName разбирает "seg{msn}.m4s"
+func parseSegmentName(file string) (uint64, bool) {
+	if !strings.HasPrefix(file, "seg") || !strings.HasSuffix(file, ".m4s") {
+		return 0, false
+	}
+	msn, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(file, "seg"), ".m4s"), 10, 64)
+	return msn, err == nil
+}
+
+// parsePartName разбирает "part{msn}.{index}.m4s"
+func parsePartName(file string) (uint64, int, bool) {
+	if !strings.HasPrefix(file, "part") || !strings.HasSuffix(file, ".m4s") {
+		return 0, 0, false
+	}
+	msnStr, indexStr, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(file, "part"), ".m4s"), ".")
+	if !ok {
+		return 0, 0, false
+	}
+	msn, err := strconv.ParseUint(msnStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	return msn, index, true
+}
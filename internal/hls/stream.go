@@ -0,0 +1,527 @@
+/*
+Package hls реализует живую HLS-раздачу (LL-HLS) поверх WebRTC-ингеста.
+
+RTP из WHIP депакетизируется (H264 -> AVC access units, Opus -> пакеты как есть)
+и режется на CMAF-части (partial segments) и сегменты fragmented MP4.
+Все хранится в памяти в скользящем окне: для живого эфира диск не нужен.
+*/
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"go.uber.org/zap"
+)
+
+// TrackKind — вид трека внутри fMP4
+type TrackKind int
+
+const (
+	TrackVideo TrackKind = iota
+	TrackAudio
+)
+
+const (
+	videoTrackID = 1
+	audioTrackID = 2
+
+	// durationEpsilon гасит ошибку округления при суммировании длительностей в секундах
+	durationEpsilon = 0.001
+
+	// audioOnlyStartDelay — сколько после первого пакета ждать видеотрек, если состав треков не объявлен
+	audioOnlyStartDelay = time.Second
+	// videoWaitTimeout — сколько после первого пакета ждать объявленный, но не пришедший видеотрек
+	videoWaitTimeout = 5 * time.Second
+)
+
+var (
+	ErrUnsupportedCodec = errors.New("hls: unsupported codec")
+	ErrNotReady         = errors.New("hls: stream is not ready yet")
+	ErrNotFound         = errors.New("hls: segment not found")
+)
+
+// Config задает параметры нарезки
+type Config struct {
+	TargetDuration time.Duration // Целевая длительность сегмента (режется по ключевому кадру)
+	PartDuration   time.Duration // Длительность LL-HLS части
+	WindowSize     int           // Сколько завершенных сегментов держать в плейлисте
+}
+
+// DefaultConfig — разумные значения для LL-HLS
+func DefaultConfig() Config {
+	return Config{
+		TargetDuration: 2 * time.Second,
+		PartDuration:   500 * time.Millisecond,
+		WindowSize:     6,
+	}
+}
+
+// linger — сколько закрытый поток остается в реестре: плеер, отстающий на все окно,
+// должен успеть докачать сегменты и увидеть EXT-X-ENDLIST, а не 404
+func (c Config) linger() time.Duration {
+	return time.Duration(c.WindowSize+3) * c.TargetDuration
+}
+
+// PlaylistURL возвращает путь к живому плейлисту трансляции
+func PlaylistURL(streamID string) string {
+	return fmt.Sprintf("/api/v1/live/%s/playlist.m3u8", streamID)
+}
+
+// part — LL-HLS часть (один moof+mdat)
+type part struct {
+	data        []byte
+	duration    float64
+	independent bool
+}
+
+// segment — набор частей; полный сегмент = конкатенация частей
+type segment struct {
+	msn      uint64
+	parts    []*part
+	duration float64
+	complete bool
+}
+
+func (s *segment) bytes() []byte {
+	var b []byte
+	for _, p := range s.parts {
+		b = append(b, p.data...)
+	}
+	return b
+}
+
+// mediaTrack — состояние одного входящего трека
+type mediaTrack struct {
+	info   trackInfo
+	depack *h264Depacketizer // только для видео
+
+	started bool
+	lastTS  uint32
+	dts     uint64
+
+	pending *sample  // ждет следующий сэмпл, чтобы узнать свою длительность
+	queue   []sample // готовые сэмплы текущей части
+}
+
+// queuedDuration — длительность очереди в секундах
+func (t *mediaTrack) queuedDuration() float64 {
+	var d uint64
+	for _, s := range t.queue {
+		d += uint64(s.duration)
+	}
+	return float64(d) / float64(t.info.timescale)
+}
+
+// Stream — упаковщик одной живой трансляции
+type Stream struct {
+	id      string
+	cfg     Config
+	logger  *zap.Logger
+	onClose func()
+
+	mu          sync.Mutex
+	expected    map[TrackKind]bool // объявленные публикующим клиентом треки (nil — неизвестно, см. Expect)
+	firstPacket time.Time          // приход первого RTP-пакета: от него ждем видеотрек
+	epoch       time.Time          // момент первого сэмпла в эфире (t=0 для всех треков)
+	tracks      map[TrackKind]*mediaTrack
+	initSeg     []byte
+	segments    []*segment
+	fragSeq     uint32
+	maxSegDur   float64
+	updated     chan struct{} // закрывается и пересоздается при появлении новой части
+	closed      bool
+}
+
+func newStream(id string, cfg Config, logger *zap.Logger) *Stream {
+	return &Stream{
+		id:      id,
+		cfg:     cfg,
+		logger:  logger,
+		tracks:  make(map[TrackKind]*mediaTrack),
+		updated: make(chan struct{}),
+	}
+}
+
+// AddTrack регистрирует входящий трек. Поддерживаются H264 (видео) и Opus (аудио).
+// Треки, добавленные после старта нарезки, игнорируются: init-сегмент уже отдан плеерам.
+func (s *Stream) AddTrack(kind TrackKind, mimeType string, clockRate uint32, channels uint16) error {
+	mime := strings.ToLower(mimeType)
+	if (kind == TrackVideo && mime != "video/h264") || (kind == TrackAudio && mime != "audio/opus") {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCodec, mimeType)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.initSeg != nil {
+		return fmt.Errorf("hls: track %s arrived after packaging started", mimeType)
+	}
+
+	t := &mediaTrack{info: trackInfo{kind: kind, timescale: clockRate}}
+	if kind == TrackVideo {
+		t.info.id = videoTrackID
+		t.depack = newH264Depacketizer()
+	} else {
+		t.info.id = audioTrackID
+		t.info.channels = channels
+		if t.info.channels == 0 {
+			t.info.channels = 2
+		}
+	}
+	s.tracks[kind] = t
+	return nil
+}
+
+// Expect задает треки, объявленные публикующим клиентом (трансиверы offer).
+// Без видео аудио-only эфир начинается сразу, с видео — аудио ждет видеотрек.
+func (s *Stream) Expect(kinds ...TrackKind) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expected = make(map[TrackKind]bool, len(kinds))
+	for _, kind := range kinds {
+		s.expected[kind] = true
+	}
+}
+
+// WriteRTP принимает пакет входящего трека
+func (s *Stream) WriteRTP(kind TrackKind, pkt *rtp.Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tracks[kind]
+	if !ok || s.closed {
+		return
+	}
+	if s.firstPacket.IsZero() {
+		s.firstPacket = time.Now()
+	}
+
+	if kind == TrackVideo {
+		au := t.depack.push(pkt)
+		if au == nil {
+			return
+		}
+		if s.initSeg == nil && !s.start(au.keyframe) {
+			return
+		}
+		s.pushSample(t, au.timestamp, au.data, au.keyframe)
+		return
+	}
+
+	if s.initSeg == nil && !s.start(false) {
+		return
+	}
+	s.pushSample(t, pkt.Timestamp, append([]byte(nil), pkt.Payload...), true)
+}
+
+// start строит init-сегмент, когда для этого достаточно данных.
+// С видео начинаем только с ключевого кадра и известных SPS/PPS.
+func (s *Stream) start(keyframe bool) bool {
+	if v, ok := s.tracks[TrackVideo]; ok {
+		if !keyframe || v.depack.sps == nil || v.depack.pps == nil {
+			return false
+		}
+		v.info.sps, v.info.pps = v.depack.sps, v.depack.pps
+		w, h, err := parseSPSResolution(v.info.sps)
+		if err != nil {
+			s.logger.Warn("HLS: failed to parse SPS resolution", zap.String("stream_id", s.id), zap.Error(err))
+		}
+		v.info.width, v.info.height = w, h
+	} else if time.Since(s.firstPacket) < s.videoWait() {
+		// Даем видеотреку шанс появиться
+		return false
+	}
+
+	infos := make([]*trackInfo, 0, 2)
+	for _, kind := range []TrackKind{TrackVideo, TrackAudio} {
+		if t, ok := s.tracks[kind]; ok {
+			infos = append(infos, &t.info)
+		}
+	}
+	s.initSeg = buildInitSegment(infos)
+	s.epoch = time.Now()
+	s.segments = []*segment{{msn: 0}}
+
+	s.logger.Info("📺 HLS: Packaging started", zap.String("stream_id", s.id), zap.Int("tracks", len(infos)))
+	return true
+}
+
+// videoWait — сколько аудио ждет видеотрек: объявлен — до videoWaitTimeout, не объявлен — нисколько,
+// состав неизвестен — audioOnlyStartDelay
+func (s *Stream) videoWait() time.Duration {
+	switch {
+	case s.expected == nil:
+		return audioOnlyStartDelay
+	case s.expected[TrackVideo]:
+		return videoWaitTimeout
+	default:
+		return 0
+	}
+}
+
+// pushSample переводит RTP timestamp в DTS трека и ставит предыдущий сэмпл в очередь части
+func (s *Stream) pushSample(t *mediaTrack, ts uint32, data []byte, keyframe bool) {
+	if !t.started {
+		// Первый сэмпл трека выравниваем по часам эфира, чтобы аудио и видео были синхронны
+		t.started = true
+		t.dts = uint64(time.Since(s.epoch).Seconds() * float64(t.info.timescale))
+	} else {
+		// Знаковая разница корректно переживает переполнение 32-битного timestamp
+		if delta := int32(ts - t.lastTS); delta > 0 {
+			t.dts += uint64(delta)
+		}
+	}
+	t.lastTS = ts
+
+	next := &sample{dts: t.dts, data: data, keyframe: keyframe}
+	prev := t.pending
+	t.pending = next
+	if prev == nil {
+		return
+	}
+	prev.duration = uint32(next.dts - prev.dts)
+	if prev.duration == 0 {
+		prev.duration = defaultSampleDuration(t.info)
+	}
+
+	if s.isDriver(t) {
+		s.cut(t, prev)
+	}
+	t.queue = append(t.queue, *prev)
+}
+
+// isDriver — трек, по которому режутся части и сегменты (видео, а без него — аудио)
+func (s *Stream) isDriver(t *mediaTrack) bool {
+	if _, hasVideo := s.tracks[TrackVideo]; hasVideo {
+		return t.info.kind == TrackVideo
+	}
+	return true
+}
+
+// cut решает, нужно ли закрыть часть и/или сегмент перед добавлением сэмпла ведущего трека
+func (s *Stream) cut(driver *mediaTrack, next *sample) {
+	current := s.segments[len(s.segments)-1]
+	queued := driver.queuedDuration()
+
+	// Новый сегмент начинается только с ключевого кадра
+	if next.keyframe && current.duration+queued+durationEpsilon >= s.cfg.TargetDuration.Seconds() {
+		s.flushPart(driver)
+		s.closeSegment()
+		return
+	}
+
+	nextDur := float64(next.duration) / float64(driver.info.timescale)
+	if len(driver.queue) > 0 && queued+nextDur > s.cfg.PartDuration.Seconds()+durationEpsilon {
+		s.flushPart(driver)
+	}
+}
+
+// flushPart упаковывает очереди всех треков в один moof+mdat и публикует часть
+func (s *Stream) flushPart(driver *mediaTrack) {
+	if len(driver.queue) == 0 {
+		return
+	}
+
+	frags := make([]fragmentTrack, 0, 2)
+	for _, kind := range []TrackKind{TrackVideo, TrackAudio} {
+		t, ok := s.tracks[kind]
+		if !ok || len(t.queue) == 0 {
+			continue
+		}
+		frags = append(frags, fragmentTrack{id: t.info.id, samples: t.queue})
+	}
+
+	s.fragSeq++
+	p := &part{
+		data:        buildFragment(s.fragSeq, frags),
+		duration:    driver.queuedDuration(),
+		independent: driver.queue[0].keyframe,
+	}
+	for _, t := range s.tracks {
+		t.queue = nil
+	}
+
+	current := s.segments[len(s.segments)-1]
+	current.parts = append(current.parts, p)
+	current.duration += p.duration
+	s.notify()
+}
+
+// closeSegment завершает текущий сегмент, открывает новый и сдвигает окно
+func (s *Stream) closeSegment() {
+	current := s.segments[len(s.segments)-1]
+	if len(current.parts) == 0 {
+		return
+	}
+	current.complete = true
+	s.maxSegDur = math.Max(s.maxSegDur, current.duration)
+
+	s.segments = append(s.segments, &segment{msn: current.msn + 1})
+	if complete := len(s.segments) - 1; complete > s.cfg.WindowSize {
+		s.segments = s.segments[complete-s.cfg.WindowSize:]
+	}
+	s.notify()
+}
+
+func (s *Stream) notify() {
+	close(s.updated)
+	s.updated = make(chan struct{})
+}
+
+// Close останавливает упаковщик и будит ожидающие плейлисты
+func (s *Stream) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	// Дописываем хвост эфира, чтобы последний сегмент попал в плейлист
+	if s.initSeg != nil {
+		for _, t := range s.tracks {
+			if s.isDriver(t) {
+				s.flushPart(t)
+				s.closeSegment()
+				break
+			}
+		}
+	}
+	s.closed = true
+	s.notify()
+	s.mu.Unlock()
+
+	if s.onClose != nil {
+		s.onClose()
+	}
+}
+
+// InitSegment возвращает init.mp4
+func (s *Stream) InitSegment() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.initSeg == nil {
+		return nil, ErrNotReady
+	}
+	return s.initSeg, nil
+}
+
+// Segment возвращает полный сегмент по media sequence number
+func (s *Stream) Segment(msn uint64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg := s.findSegment(msn)
+	if seg == nil || !seg.complete {
+		return nil, ErrNotFound
+	}
+	return seg.bytes(), nil
+}
+
+// Part возвращает LL-HLS часть сегмента
+func (s *Stream) Part(msn uint64, index int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg := s.findSegment(msn)
+	if seg == nil || index < 0 || index >= len(seg.parts) {
+		return nil, ErrNotFound
+	}
+	return seg.parts[index].data, nil
+}
+
+func (s *Stream) findSegment(msn uint64) *segment {
+	for _, seg := range s.segments {
+		if seg.msn == msn {
+			return seg
+		}
+	}
+	return nil
+}
+
+// WaitFor блокирует до появления части index сегмента msn (блокирующая перезагрузка плейлиста LL-HLS).
+// index < 0 означает ожидание завершения всего сегмента.
+func (s *Stream) WaitFor(ctx context.Context, msn uint64, index int) error {
+	for {
+		s.mu.Lock()
+		ready := s.closed || s.hasPart(msn, index)
+		updated := s.updated
+		s.mu.Unlock()
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updated:
+		}
+	}
+}
+
+func (s *Stream) hasPart(msn uint64, index int) bool {
+	if len(s.segments) == 0 {
+		return false
+	}
+	last := s.segments[len(s.segments)-1]
+	if msn < last.msn {
+		return true
+	}
+	if msn > last.msn {
+		return false
+	}
+	return index >= 0 && index < len(last.parts)
+}
+
+// Playlist формирует медиаплейлист LL-HLS
+func (s *Stream) Playlist() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.initSeg == nil || len(s.segments) == 0 || (len(s.segments) == 1 && len(s.segments[0].parts) == 0) {
+		return nil, ErrNotReady
+	}
+
+	partTarget := s.cfg.PartDuration.Seconds()
+	target := int(math.Ceil(math.Max(s.maxSegDur, s.cfg.TargetDuration.Seconds())))
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:9\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", target)
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", partTarget*3)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", s.segments[0].msn)
+	b.WriteString("#EXT-X-MAP:URI=\"init.mp4\"\n")
+
+	// Части перечисляем только для последних сегментов (спецификация: не старше 3 target duration)
+	partsFrom := len(s.segments) - 3
+	for i, seg := range s.segments {
+		if i >= partsFrom {
+			for j, p := range seg.parts {
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"part%d.%d.m4s\"", p.duration, seg.msn, j)
+				if p.independent {
+					b.WriteString(",INDEPENDENT=YES")
+				}
+				b.WriteString("\n")
+			}
+		}
+		if seg.complete {
+			fmt.Fprintf(&b, "#EXTINF:%.3f,\nseg%d.m4s\n", seg.duration, seg.msn)
+		}
+	}
+
+	if s.closed {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// defaultSampleDuration — длительность сэмпла, если timestamp не изменился (30 fps / 20 мс Opus)
+func defaultSampleDuration(info trackInfo) uint32 {
+	if info.kind == TrackAudio {
+		return info.timescale / 50
+	}
+	return info.timescale / 30
+}
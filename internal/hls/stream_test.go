@@ -0,0 +1,195 @@
+package hls
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParseSPSResolution(t *testing.T) {
+	tests := []struct {
+		name          string
+		sps           string
+		width, height uint16
+	}{
+		{"High 720p (cropping)", "6764001facd9405005bb0110000003001000000303c0f1831960", 1280, 720},
+		{"Baseline 480p", "6742c01e8c8d40501e90", 640, 480},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sps, _ := hex.DecodeString(tt.sps)
+			w, h, err := parseSPSResolution(sps)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.width, w)
+			assert.Equal(t, tt.height, h)
+		})
+	}
+
+	_, _, err := parseSPSResolution([]byte{0x67})
+	assert.ErrorIs(t, err, errShortSPS)
+}
+
+func TestStreamPackaging(t *testing.T) {
+	sps, _ := hex.DecodeString("6742c01e8c8d40501e90")
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+
+	cfg := Config{TargetDuration: time.Second, PartDuration: 300 * time.Millisecond, WindowSize: 3}
+	s := NewManager(cfg, zap.NewNop()).Create("test")
+	assert.NoError(t, s.AddTrack(TrackVideo, "video/H264", 90000, 0))
+	assert.ErrorIs(t, s.AddTrack(TrackAudio, "audio/PCMU", 8000, 1), ErrUnsupportedCodec)
+
+	// До первого ключевого кадра отдавать нечего
+	_, err := s.Playlist()
+	assert.ErrorIs(t, err, ErrNotReady)
+
+	var seq uint16
+	write := func(ts uint32, nalu []byte, marker bool) {
+		seq++
+		s.WriteRTP(TrackVideo, &rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: seq, Timestamp: ts, Marker: marker},
+			Payload: nalu,
+		})
+	}
+
+	// 3 секунды 30 fps, ключевой кадр каждую секунду
+	for i := 0; i < 90; i++ {
+		ts := uint32(i * 3000)
+		if i%30 == 0 {
+			write(ts, sps, false)
+			write(ts, pps, false)
+			write(ts, []byte{0x65, 0x88, 0x84, 0x00}, true)
+		} else {
+			write(ts, []byte{0x41, 0x9a, 0x02, 0x00}, true)
+		}
+	}
+
+	initSeg, err := s.InitSegment()
+	assert.NoError(t, err)
+	assert.Equal(t, "ftyp", string(initSeg[4:8]))
+	assert.Contains(t, string(initSeg), "avcC")
+
+	playlist, err := s.Playlist()
+	assert.NoError(t, err)
+	text := string(playlist)
+	assert.Contains(t, text, "#EXT-X-MAP:URI=\"init.mp4\"")
+	assert.Contains(t, text, "#EXT-X-PART-INF:PART-TARGET=0.300")
+	assert.Contains(t, text, "seg0.m4s")
+	assert.Contains(t, text, "seg1.m4s")
+	assert.Contains(t, text, "part2.0.m4s\",INDEPENDENT=YES")
+
+	// Сегмент начинается с moof и равен конкатенации своих частей
+	seg, err := s.Segment(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "moof", string(seg[4:8]))
+	first, err := s.Part(0, 0)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(seg), string(first)))
+
+	_, err = s.Segment(42)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	s.Close()
+	playlist, err = s.Playlist()
+	assert.NoError(t, err)
+	assert.Contains(t, string(playlist), "#EXT-X-ENDLIST")
+}
+
+func TestStreamWaitsForAnnouncedVideo(t *testing.T) {
+	sps, _ := hex.DecodeString("6742c01e8c8d40501e90")
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+	m := NewManager(DefaultConfig(), zap.NewNop())
+
+	// Аудио пришло раньше видео: упаковка ждет объявленный видеотрек, а не стартует без него
+	s := m.Create("audio-first")
+	s.Expect(TrackVideo, TrackAudio)
+	assert.NoError(t, s.AddTrack(TrackAudio, "audio/opus", 48000, 2))
+	for i := 0; i < 10; i++ {
+		s.WriteRTP(TrackAudio, &rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * 960)}, Payload: []byte{0xfc}})
+	}
+	_, err := s.InitSegment()
+	assert.ErrorIs(t, err, ErrNotReady)
+
+	// И после audioOnlyStartDelay с первого пакета: видео объявлено, значит придет
+	s.mu.Lock()
+	s.firstPacket = s.firstPacket.Add(-2 * audioOnlyStartDelay)
+	s.mu.Unlock()
+	s.WriteRTP(TrackAudio, &rtp.Packet{Header: rtp.Header{SequenceNumber: 10, Timestamp: 9600}, Payload: []byte{0xfc}})
+	_, err = s.InitSegment()
+	assert.ErrorIs(t, err, ErrNotReady)
+
+	assert.NoError(t, s.AddTrack(TrackVideo, "video/H264", 90000, 0))
+	for i, nalu := range [][]byte{sps, pps, {0x65, 0x88, 0x84, 0x00}} {
+		s.WriteRTP(TrackVideo, &rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i), Marker: i == 2}, Payload: nalu})
+	}
+	initSeg, err := s.InitSegment()
+	assert.NoError(t, err)
+	assert.Contains(t, string(initSeg), "avcC")
+	assert.Contains(t, string(initSeg), "Opus")
+
+	// Публикующий клиент объявил только аудио — ждать нечего
+	audio := m.Create("audio-only")
+	audio.Expect(TrackAudio)
+	assert.NoError(t, audio.AddTrack(TrackAudio, "audio/opus", 48000, 2))
+	audio.WriteRTP(TrackAudio, &rtp.Packet{Payload: []byte{0xfc}})
+	initSeg, err = audio.InitSegment()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(initSeg), "avcC")
+}
+
+func TestClosedStreamLingers(t *testing.T) {
+	cfg := Config{TargetDuration: 10 * time.Millisecond, PartDuration: 5 * time.Millisecond, WindowSize: 2}
+	m := NewManager(cfg, zap.NewNop())
+	m.Create("test").Close()
+
+	// Сразу после конца эфира плейлист с ENDLIST еще доступен
+	_, ok := m.Get("test")
+	assert.True(t, ok)
+	assert.Eventually(t, func() bool {
+		_, ok := m.Get("test")
+		return !ok
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestParsePartName(t *testing.T) {
+	msn, index, ok := parsePartName("part12.3.m4s")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(12), msn)
+	assert.Equal(t, 3, index)
+
+	_, _, ok = parsePartName("part12.m4s")
+	assert.False(t, ok)
+
+	msn, ok = parseSegmentName("seg7.m4s")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(7), msn)
+}
+
+func TestTruncatedSPS(t *testing.T) {
+	// SPS из 1–3 байт отбрасывается депакетайзером
+	d := newH264Depacketizer()
+	for _, nalu := range [][]byte{{0x67}, {0x67, 0x42}, {0x67, 0x42, 0xc0}, {0x68, 0xce}} {
+		d.appendNALUs(append([]byte{0, 0, 0, byte(len(nalu))}, nalu...))
+	}
+	assert.Nil(t, d.sps)
+	assert.Nil(t, d.pps)
+
+	// Поток с обрезанным SPS не ломает упаковку: без валидного SPS init-сегмент не строится
+	s := NewManager(DefaultConfig(), zap.NewNop()).Create("truncated")
+	assert.NoError(t, s.AddTrack(TrackVideo, "video/H264", 90000, 0))
+	assert.NotPanics(t, func() {
+		s.WriteRTP(TrackVideo, &rtp.Packet{Header: rtp.Header{SequenceNumber: 1, Timestamp: 0}, Payload: []byte{0x67, 0x42}})
+		s.WriteRTP(TrackVideo, &rtp.Packet{Header: rtp.Header{SequenceNumber: 2, Timestamp: 0}, Payload: []byte{0x68, 0xce, 0x3c, 0x80}})
+		s.WriteRTP(TrackVideo, &rtp.Packet{Header: rtp.Header{SequenceNumber: 3, Timestamp: 0, Marker: true}, Payload: []byte{0x65, 0x88, 0x84, 0x00}})
+	})
+	_, err := s.InitSegment()
+	assert.ErrorIs(t, err, ErrNotReady)
+
+	// sampleEntry не читает за границей короткого SPS
+	assert.NotPanics(t, func() { sampleEntry(&trackInfo{kind: TrackVideo, sps: []byte{0x67}, pps: []byte{0x68}}) })
+}
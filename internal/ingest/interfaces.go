@@ -9,9 +9,13 @@ import (
 // Streamer — возможности для тех, кто публикует контент
 type Streamer interface {
 	HandleWHIP(sm *SessionManager, logger *zap.Logger) http.HandlerFunc
+	HandleWHIPDelete(sm *SessionManager, logger *zap.Logger) http.HandlerFunc
+	HandleWHIPPatch(sm *SessionManager, logger *zap.Logger) http.HandlerFunc
 }
 
 // Player — возможности для тех, кто потребляет контент
 type Player interface {
 	HandleWHEP(sm *SessionManager, logger *zap.Logger) http.HandlerFunc
+	HandleWHEPDelete(sm *SessionManager, logger *zap.Logger) http.HandlerFunc
+	HandleWHEPPatch(sm *SessionManager, logger *zap.Logger) http.HandlerFunc
 }
@@ -0,0 +1,455 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
+)
+
+// recordingsDir — подпапка хранилища (и рабочей папки) для записей эфиров
+const recordingsDir = "recordings"
+
+// AssetStore — минимальный контракт репозитория, нужный рекордеру для регистрации VOD.
+// Реализуется *repository.MediaRepository.
+type AssetStore interface {
+	SaveAsset(ctx context.Context, asset *repository.MediaAsset) error
+}
+
+// RecordingConfig включает запись эфиров на диск (см. RTCEngine.EnableRecording)
+type RecordingConfig struct {
+	WorkDir    string          // Локальная папка, куда пишется идущий эфир (storage.work_dir)
+	Storage    storage.Backend // Куда переносится запись после эфира
+	Assets     AssetStore
+	FFmpegPath string // Сведение дорожек в один файл (vod.ffmpeg_path)
+
+	// Quota проверяет, что владельцу хватит места еще на size байт записи. Ошибка — запись
+	// не сохраняется, файлы удаляются. Если не задан, квота не проверяется.
+	Quota func(ctx context.Context, ownerID uuid.UUID, size int64) error
+
+	// Enqueue ставит задачи обработки сохраненной записи (упаковка, превью).
+	// Если не задан, запись сразу становится ready.
+	Enqueue func(ctx context.Context, asset *repository.MediaAsset)
+}
+
+// recordedTrack — один контейнер на диске для одного входящего трека
+type recordedTrack struct {
+	writer    media.Writer
+	fileName  string
+	codec     string
+	clockRate uint32
+
+	// Счетчики кадров видео: Annex-B не хранит времени, частоту кадров ffmpeg получает от нас
+	frames int
+	ticks  uint64 // Сколько тактов clockRate прошло от первого кадра до последнего
+	lastTS uint32
+}
+
+// frameRate — средняя частота кадров записанного видео
+func (t *recordedTrack) frameRate() float64 {
+	if t.frames < 2 || t.ticks == 0 || t.clockRate == 0 {
+		return defaultFrameRate
+	}
+	return float64(t.frames-1) * float64(t.clockRate) / float64(t.ticks)
+}
+
+// defaultFrameRate — если по записи частоту кадров не посчитать
+const defaultFrameRate = 30
+
+// Recorder пишет входящий RTP трансляции в файлы-контейнеры:
+// H264 -> Annex-B (.h264), VP8/VP9/AV1 -> IVF, Opus -> Ogg.
+// По завершении эфира сводит дорожки в один файл (H264 -> MP4, остальное -> WebM)
+// и регистрирует его как MediaAsset владельца трансляции.
+type Recorder struct {
+	cfg       RecordingConfig
+	streamID  string
+	userID    string
+	startedAt time.Time
+	logger    *zap.Logger
+
+	mu     sync.Mutex
+	tracks map[webrtc.RTPCodecType]*recordedTrack
+	closed bool
+}
+
+// NewRecorder создает рекордер для трансляции и готовит папку для записей
+func NewRecorder(cfg RecordingConfig, streamID, userID string, logger *zap.Logger) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Join(cfg.WorkDir, recordingsDir), 0755); err != nil {
+		return nil, fmt.Errorf("recorder: failed to create recordings dir: %w", err)
+	}
+
+	return &Recorder{
+		cfg:       cfg,
+		streamID:  streamID,
+		userID:    userID,
+		startedAt: time.Now(),
+		logger:    logger,
+		tracks:    make(map[webrtc.RTPCodecType]*recordedTrack),
+	}, nil
+}
+
+// AddTrack открывает файл-контейнер под согласованный кодек входящего трека
+func (r *Recorder) AddTrack(track *webrtc.TrackRemote) error {
+	codec := track.Codec()
+	mime := strings.ToLower(codec.MimeType)
+	base := fmt.Sprintf("%s_%d", r.streamID, r.startedAt.Unix())
+
+	var (
+		writer   media.Writer
+		fileName string
+		err      error
+	)
+	switch mime {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		fileName = base + ".h264"
+		writer, err = h264writer.New(r.fullPath(fileName))
+	case strings.ToLower(webrtc.MimeTypeVP8), strings.ToLower(webrtc.MimeTypeVP9), strings.ToLower(webrtc.MimeTypeAV1):
+		fileName = base + ".ivf"
+		writer, err = ivfwriter.New(r.fullPath(fileName), ivfwriter.WithCodec(codec.MimeType))
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		fileName = base + ".ogg"
+		writer, err = oggwriter.New(r.fullPath(fileName), codec.ClockRate, codec.Channels)
+	default:
+		return fmt.Errorf("recorder: unsupported codec %s", codec.MimeType)
+	}
+	if err != nil {
+		return fmt.Errorf("recorder: failed to open %s: %w", fileName, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		_ = writer.Close()
+		return fmt.Errorf("recorder: already finished")
+	}
+	r.tracks[track.Kind()] = &recordedTrack{writer: writer, fileName: fileName, codec: codec.MimeType, clockRate: codec.ClockRate}
+
+	r.logger.Info("⏺️ Recording started",
+		zap.String("stream_id", r.streamID),
+		zap.String("kind", track.Kind().String()),
+		zap.String("file", fileName))
+	return nil
+}
+
+// WriteRTP дописывает пакет в контейнер соответствующего трека
+func (r *Recorder) WriteRTP(kind webrtc.RTPCodecType, packet *rtp.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tracks[kind]
+	if !ok || r.closed {
+		return
+	}
+	if err := t.writer.WriteRTP(packet); err != nil {
+		// Недописанный контейнер не открыть: удаляем его, запись продолжается без этой дорожки
+		r.logger.Warn("Recorder: write failed, track recording stopped",
+			zap.String("stream_id", r.streamID),
+			zap.String("kind", kind.String()),
+			zap.Error(err))
+		_ = t.writer.Close()
+		_ = os.Remove(r.fullPath(t.fileName))
+		delete(r.tracks, kind)
+		return
+	}
+
+	if kind == webrtc.RTPCodecTypeVideo {
+		switch {
+		case t.frames == 0:
+			t.frames, t.lastTS = 1, packet.Timestamp
+		case packet.Timestamp != t.lastTS:
+			t.ticks += uint64(packet.Timestamp - t.lastTS)
+			t.frames, t.lastTS = t.frames+1, packet.Timestamp
+		}
+	}
+}
+
+// Finish закрывает файлы, сводит дорожки в один файл и регистрирует его как MediaAsset.
+// Как и загрузка, запись учитывается в квоте владельца (RecordingConfig.Quota) и хранится
+// по контрольной сумме (storage.BlobKey). Сведенная запись сохраняется в статусе processing
+// и уходит на упаковку (RecordingConfig.Enqueue). Если свести не удалось, в хранилище
+// переносятся исходные дорожки, а ассет помечается failed.
+func (r *Recorder) Finish(ctx context.Context) (*repository.MediaAsset, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, nil
+	}
+	r.closed = true
+	tracks := r.tracks
+	r.mu.Unlock()
+
+	duration := int(time.Since(r.startedAt).Seconds())
+	metadata := map[string]interface{}{
+		"source":    "live",
+		"stream_id": r.streamID,
+		"duration":  duration,
+	}
+
+	var video, audio *recordedTrack
+	for kind, t := range tracks {
+		if err := t.writer.Close(); err != nil {
+			r.logger.Warn("Recorder: close failed", zap.String("file", t.fileName), zap.Error(err))
+		}
+		if info, err := os.Stat(r.fullPath(t.fileName)); err != nil || info.Size() == 0 {
+			// Пустой файл (трек так и не прислал данных) не регистрируем
+			_ = os.Remove(r.fullPath(t.fileName))
+			continue
+		}
+		switch kind {
+		case webrtc.RTPCodecTypeVideo:
+			video = t
+			metadata["video_codec"] = t.codec
+		case webrtc.RTPCodecTypeAudio:
+			audio = t
+			metadata["audio_codec"] = t.codec
+		}
+	}
+
+	if video == nil && audio == nil {
+		r.logger.Info("Recorder: nothing recorded, asset skipped", zap.String("stream_id", r.streamID))
+		return nil, nil
+	}
+
+	ownerID, err := uuid.Parse(r.userID)
+	if err != nil {
+		return nil, fmt.Errorf("recorder: invalid owner id %q: %w", r.userID, err)
+	}
+
+	status := "ready"
+	var primary, side string // side — отдельная аудиодорожка, если свести не удалось
+	switch {
+	case video == nil:
+		// Только звук: Ogg/Opus браузер играет сам, упаковывать нечего
+		primary = audio.fileName
+	default:
+		muxed, err := r.mux(ctx, video, audio)
+		if err != nil {
+			r.logger.Error("Recorder: failed to mux recording, raw tracks kept",
+				zap.String("stream_id", r.streamID), zap.Error(err))
+			status = "failed"
+			primary = video.fileName
+			if audio != nil {
+				side = audio.fileName
+			}
+			break
+		}
+		for _, t := range []*recordedTrack{video, audio} {
+			if t != nil {
+				_ = os.Remove(r.fullPath(t.fileName))
+			}
+		}
+		primary = muxed
+		if r.cfg.Enqueue != nil {
+			status = "processing"
+		}
+	}
+
+	size, err := r.checkQuota(ctx, ownerID, primary, side)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := fileChecksum(r.fullPath(primary))
+	if err != nil {
+		return nil, fmt.Errorf("recorder: %w", err)
+	}
+	metadata["size"] = size
+	metadata["type"] = containerContentType(primary)
+
+	key := storage.BlobKey(checksum, filepath.Ext(primary))
+	if err := r.store(ctx, primary, key); err != nil {
+		return nil, err
+	}
+	if side != "" {
+		if err := r.store(ctx, side, r.storagePath(side)); err != nil {
+			r.removeStored(key)
+			return nil, err
+		}
+		metadata["audio_path"] = r.storagePath(side)
+	}
+
+	asset := &repository.MediaAsset{
+		ID:          uuid.New(),
+		OwnerID:     ownerID,
+		Title:       fmt.Sprintf("Live %s", r.startedAt.Format("2006-01-02 15:04")),
+		StoragePath: key,
+		Checksum:    checksum,
+		Status:      status,
+		Duration:    duration,
+		Metadata:    metadata,
+	}
+	if err := r.cfg.Assets.SaveAsset(ctx, asset); err != nil {
+		// Ключ новый и ничей: без записи в БД файлы никому не нужны
+		r.removeStored(key)
+		if side != "" {
+			r.removeStored(r.storagePath(side))
+		}
+		return nil, fmt.Errorf("recorder: failed to save asset: %w", err)
+	}
+	if status == "processing" {
+		r.cfg.Enqueue(ctx, asset)
+	}
+
+	r.logger.Info("💾 Recording saved as VOD asset",
+		zap.String("stream_id", r.streamID),
+		zap.String("asset_id", asset.ID.String()),
+		zap.String("status", asset.Status),
+		zap.Int64("bytes", size))
+	return asset, nil
+}
+
+// checkQuota проверяет, что файлы записи помещаются в квоту владельца, и возвращает размер основного.
+// Запись, которая не помещается, удаляется.
+func (r *Recorder) checkQuota(ctx context.Context, ownerID uuid.UUID, primary, side string) (int64, error) {
+	info, err := os.Stat(r.fullPath(primary))
+	if err != nil {
+		return 0, fmt.Errorf("recorder: %w", err)
+	}
+	total := info.Size()
+	if side != "" {
+		if sideInfo, err := os.Stat(r.fullPath(side)); err == nil {
+			total += sideInfo.Size()
+		}
+	}
+	if r.cfg.Quota == nil {
+		return info.Size(), nil
+	}
+	if err := r.cfg.Quota(ctx, ownerID, total); err != nil {
+		for _, name := range []string{primary, side} {
+			if name != "" {
+				_ = os.Remove(r.fullPath(name))
+			}
+		}
+		return 0, fmt.Errorf("recorder: recording of %d bytes is not saved: %w", total, err)
+	}
+	return info.Size(), nil
+}
+
+// mux сводит дорожки в один файл без перекодирования: H264 -> MP4, VP8/VP9/AV1 -> WebM.
+// Возвращает имя файла в папке записей.
+func (r *Recorder) mux(ctx context.Context, video, audio *recordedTrack) (string, error) {
+	ffmpeg := r.cfg.FFmpegPath
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+
+	base := strings.TrimSuffix(video.fileName, filepath.Ext(video.fileName))
+	args := []string{"-hide_banner", "-y"}
+	var out string
+	if filepath.Ext(video.fileName) == ".h264" {
+		out = base + ".mp4"
+		args = append(args, "-framerate", strconv.FormatFloat(video.frameRate(), 'f', 3, 64))
+	} else {
+		out = base + ".webm"
+	}
+	args = append(args, "-i", r.fullPath(video.fileName))
+	if audio != nil {
+		args = append(args, "-i", r.fullPath(audio.fileName))
+	}
+	args = append(args, "-map", "0:v")
+	if audio != nil {
+		args = append(args, "-map", "1:a")
+	}
+	args = append(args, "-c", "copy")
+	if filepath.Ext(out) == ".mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, r.fullPath(out))
+
+	if output, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput(); err != nil {
+		_ = os.Remove(r.fullPath(out))
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return "", fmt.Errorf("recorder: ffmpeg failed: %w: %s", err, lines[len(lines)-1])
+	}
+	return out, nil
+}
+
+// store переносит файл записи в хранилище под ключом key
+func (r *Recorder) store(ctx context.Context, fileName, key string) error {
+	if err := storage.PutFile(ctx, r.cfg.Storage, key, r.fullPath(fileName)); err != nil {
+		return fmt.Errorf("recorder: failed to store %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// removeStored удаляет перенесенный файл, если зарегистрировать запись не удалось
+func (r *Recorder) removeStored(key string) {
+	if err := r.cfg.Storage.Delete(context.Background(), key); err != nil {
+		r.logger.Warn("Recorder: failed to remove stored file", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// Discard останавливает запись без регистрации ассета и удаляет уже записанные файлы
+// (трансляция так и не состоялась, например, не прошло согласование SDP)
+func (r *Recorder) Discard() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	for _, t := range r.tracks {
+		_ = t.writer.Close()
+		_ = os.Remove(r.fullPath(t.fileName))
+	}
+}
+
+func (r *Recorder) fullPath(fileName string) string {
+	return filepath.Join(r.cfg.WorkDir, recordingsDir, fileName)
+}
+
+// storagePath строит ключ хранилища для файла записи
+func (r *Recorder) storagePath(fileName string) string {
+	return path.Join(recordingsDir, fileName)
+}
+
+// fileChecksum считает SHA-256 файла (hex)
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// containerContentType возвращает MIME-тип контейнера по расширению файла записи
+func containerContentType(fileName string) string {
+	switch filepath.Ext(fileName) {
+	case ".h264":
+		return "video/h264"
+	case ".ivf":
+		return "video/x-ivf"
+	case ".ogg":
+		return "audio/ogg"
+	case ".mp4":
+		return "video/mp4"
+	case ".webm":
+		return "video/webm"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,178 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
+)
+
+type memAssets struct {
+	saved []*repository.MediaAsset
+}
+
+func (m *memAssets) SaveAsset(_ context.Context, asset *repository.MediaAsset) error {
+	m.saved = append(m.saved, asset)
+	return nil
+}
+
+// fakeFFmpeg — скрипт вместо ffmpeg: пишет "muxed" в выходной файл (последний аргумент) или падает
+func fakeFFmpeg(t *testing.T, fail bool) string {
+	script := "#!/bin/sh\nfor last; do :; done\nprintf muxed > \"$last\"\n"
+	if fail {
+		script = "#!/bin/sh\necho 'Invalid data found when processing input' >&2\nexit 1\n"
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	return path
+}
+
+type recorderEnv struct {
+	rec     *Recorder
+	backend *storage.Local
+	assets  *memAssets
+	queued  []*repository.MediaAsset
+}
+
+func newRecorderEnv(t *testing.T, ffmpeg string, quota func(context.Context, uuid.UUID, int64) error) *recorderEnv {
+	backend, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir()})
+	require.NoError(t, err)
+	env := &recorderEnv{backend: backend, assets: &memAssets{}}
+	env.rec, err = NewRecorder(RecordingConfig{
+		WorkDir:    t.TempDir(),
+		Storage:    backend,
+		Assets:     env.assets,
+		FFmpegPath: ffmpeg,
+		Quota:      quota,
+		Enqueue:    func(_ context.Context, a *repository.MediaAsset) { env.queued = append(env.queued, a) },
+	}, "stream", uuid.NewString(), zap.NewNop())
+	require.NoError(t, err)
+	return env
+}
+
+// record пишет в рекордер кадр H264 (SPS, PPS, IDR) и, если audio, пакет Opus
+func (e *recorderEnv) record(t *testing.T, audio bool) {
+	video, err := h264writer.New(e.rec.fullPath("stream.h264"))
+	require.NoError(t, err)
+	e.rec.tracks[webrtc.RTPCodecTypeVideo] = &recordedTrack{writer: video, fileName: "stream.h264", codec: webrtc.MimeTypeH264, clockRate: 90000}
+	for i, nalu := range [][]byte{{0x67, 0x42, 0xc0, 0x1e}, {0x68, 0xce, 0x3c, 0x80}, {0x65, 0x88, 0x84, 0x00}} {
+		e.rec.WriteRTP(webrtc.RTPCodecTypeVideo, &rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i), Marker: i == 2}, Payload: nalu})
+	}
+	if !audio {
+		return
+	}
+	ogg, err := oggwriter.New(e.rec.fullPath("stream.ogg"), 48000, 2)
+	require.NoError(t, err)
+	e.rec.tracks[webrtc.RTPCodecTypeAudio] = &recordedTrack{writer: ogg, fileName: "stream.ogg", codec: webrtc.MimeTypeOpus, clockRate: 48000}
+	e.rec.WriteRTP(webrtc.RTPCodecTypeAudio, &rtp.Packet{Header: rtp.Header{SequenceNumber: 1, Timestamp: 960}, Payload: []byte{0xfc, 0xff, 0xfe}})
+}
+
+func TestRecorder_FinishMuxesAndRegisters(t *testing.T) {
+	env := newRecorderEnv(t, fakeFFmpeg(t, false), nil)
+	env.record(t, true)
+
+	asset, err := env.rec.Finish(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, asset)
+
+	// Сведенный файл хранится по контрольной сумме и уходит на обработку
+	sum := sha256.Sum256([]byte("muxed"))
+	checksum := hex.EncodeToString(sum[:])
+	assert.Equal(t, checksum, asset.Checksum)
+	got, ok := storage.BlobChecksum(asset.StoragePath)
+	assert.True(t, ok)
+	assert.Equal(t, checksum, got)
+	assert.Equal(t, ".mp4", filepath.Ext(asset.StoragePath))
+	assert.Equal(t, "processing", asset.Status)
+	assert.Equal(t, int64(len("muxed")), asset.Metadata["size"])
+	assert.Equal(t, webrtc.MimeTypeOpus, asset.Metadata["audio_codec"])
+	assert.Equal(t, []*repository.MediaAsset{asset}, env.assets.saved)
+	assert.Equal(t, []*repository.MediaAsset{asset}, env.queued)
+
+	info, err := env.backend.Stat(context.Background(), asset.StoragePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("muxed")), info.Size)
+
+	// В рабочей папке ничего не осталось: дорожки сведены, результат перенесен
+	left, err := os.ReadDir(filepath.Join(env.rec.cfg.WorkDir, recordingsDir))
+	require.NoError(t, err)
+	assert.Empty(t, left)
+
+	// Повторный Finish ничего не регистрирует
+	again, err := env.rec.Finish(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, again)
+	assert.Len(t, env.assets.saved, 1)
+}
+
+func TestRecorder_FinishKeepsRawTracksWhenMuxFails(t *testing.T) {
+	env := newRecorderEnv(t, fakeFFmpeg(t, true), nil)
+	env.record(t, true)
+
+	asset, err := env.rec.Finish(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, asset)
+
+	assert.Equal(t, "failed", asset.Status)
+	assert.Empty(t, env.queued)
+	assert.Equal(t, ".h264", filepath.Ext(asset.StoragePath))
+	assert.Len(t, asset.Checksum, 64)
+
+	// Звук не потерян: отдельная дорожка лежит в хранилище и записана в metadata.audio_path
+	audioPath, _ := asset.Metadata["audio_path"].(string)
+	assert.Equal(t, "recordings/stream.ogg", audioPath)
+	_, err = env.backend.Stat(context.Background(), audioPath)
+	assert.NoError(t, err)
+}
+
+func TestRecorder_FinishRespectsQuota(t *testing.T) {
+	errFull := errors.New("quota exceeded")
+	var requested int64
+	env := newRecorderEnv(t, fakeFFmpeg(t, false), func(_ context.Context, _ uuid.UUID, size int64) error {
+		requested = size
+		return errFull
+	})
+	env.record(t, false)
+
+	asset, err := env.rec.Finish(context.Background())
+	assert.ErrorIs(t, err, errFull)
+	assert.Nil(t, asset)
+	assert.Equal(t, int64(len("muxed")), requested)
+	assert.Empty(t, env.assets.saved)
+
+	// Запись, не поместившаяся в квоту, не остается ни на диске, ни в хранилище
+	left, err := os.ReadDir(filepath.Join(env.rec.cfg.WorkDir, recordingsDir))
+	require.NoError(t, err)
+	assert.Empty(t, left)
+	stored, err := os.ReadDir(env.backend.Root())
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+}
+
+func TestRecorder_DiscardRemovesFiles(t *testing.T) {
+	env := newRecorderEnv(t, fakeFFmpeg(t, false), nil)
+	env.record(t, true)
+
+	env.rec.Discard()
+
+	left, err := os.ReadDir(filepath.Join(env.rec.cfg.WorkDir, recordingsDir))
+	require.NoError(t, err)
+	assert.Empty(t, left)
+	asset, err := env.rec.Finish(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, asset)
+}
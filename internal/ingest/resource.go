@@ -0,0 +1,313 @@
+package ingest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+// Жизненный цикл WHIP/WHEP ресурса (RFC 9725 / draft-ietf-wish-whep):
+// DELETE завершает сессию, PATCH с application/trickle-ice-sdpfrag досылает ICE-кандидаты
+// или (с If-Match: "*") выполняет ICE restart.
+
+const sdpFragContentType = "application/trickle-ice-sdpfrag"
+
+var errSDPFragEmpty = errors.New("sdpfrag: no ice credentials or candidates")
+
+// iceResource — общая часть WHIP-сессии и WHEP-зрителя: ETag текущей ICE-сессии.
+// mu сериализует PATCH-запросы, чтобы два ICE restart не пересекались.
+type iceResource struct {
+	mu   sync.Mutex
+	etag string
+}
+
+// newETag генерирует новый (строгий) entity-tag для ICE-сессии
+func newETag() string {
+	return `"` + uuid.New().String() + `"`
+}
+
+// ETag возвращает entity-tag текущей ICE-сессии
+func (r *iceResource) ETag() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.etag
+}
+
+// sdpFragment — разобранное тело application/trickle-ice-sdpfrag
+type sdpFragment struct {
+	Ufrag      string
+	Pwd        string
+	Candidates []webrtc.ICECandidateInit
+}
+
+// parseSDPFragment разбирает SDP-фрагмент (RFC 8840): ice-ufrag/ice-pwd и кандидаты с привязкой к a=mid.
+func parseSDPFragment(body string) (*sdpFragment, error) {
+	frag := &sdpFragment{}
+	var mid *string
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			frag.Ufrag = strings.TrimPrefix(line, "a=ice-ufrag:")
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			frag.Pwd = strings.TrimPrefix(line, "a=ice-pwd:")
+		case strings.HasPrefix(line, "m="):
+			// Новая медиа-секция: mid будет задан ниже через a=mid
+			mid = nil
+		case strings.HasPrefix(line, "a=mid:"):
+			value := strings.TrimPrefix(line, "a=mid:")
+			mid = &value
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidate := webrtc.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a=")}
+			if mid != nil {
+				m := *mid
+				candidate.SDPMid = &m
+			}
+			frag.Candidates = append(frag.Candidates, candidate)
+		}
+	}
+
+	if frag.Ufrag == "" && frag.Pwd == "" && len(frag.Candidates) == 0 {
+		return nil, errSDPFragEmpty
+	}
+	return frag, nil
+}
+
+// buildSDPFragment собирает SDP-фрагмент из локального описания: креды ICE, m-секции с mid и кандидаты.
+func buildSDPFragment(sdp string) string {
+	var b strings.Builder
+	var ufrag, pwd bool
+	var media []string
+
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "a=ice-ufrag:") && !ufrag:
+			ufrag = true
+			b.WriteString(line + "\r\n")
+		case strings.HasPrefix(line, "a=ice-pwd:") && !pwd:
+			pwd = true
+			b.WriteString(line + "\r\n")
+		case strings.HasPrefix(line, "m="),
+			strings.HasPrefix(line, "a=mid:"),
+			strings.HasPrefix(line, "a=candidate:"),
+			line == "a=end-of-candidates":
+			media = append(media, line)
+		}
+	}
+
+	for _, line := range media {
+		b.WriteString(line + "\r\n")
+	}
+	return b.String()
+}
+
+// replaceICECredentials подменяет ice-ufrag/ice-pwd в SDP (нужно для ICE restart на стороне ответчика)
+func replaceICECredentials(sdp, ufrag, pwd string) string {
+	lines := strings.Split(sdp, "\r\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			lines[i] = "a=ice-ufrag:" + ufrag
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			lines[i] = "a=ice-pwd:" + pwd
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// remoteICECredentials извлекает ice-ufrag/ice-pwd из текущего удаленного описания
+func remoteICECredentials(pc *webrtc.PeerConnection) (string, string) {
+	desc := pc.RemoteDescription()
+	if desc == nil {
+		return "", ""
+	}
+	frag, err := parseSDPFragment(desc.SDP)
+	if err != nil {
+		return "", ""
+	}
+	return frag.Ufrag, frag.Pwd
+}
+
+// patchICE обрабатывает PATCH на ресурс: trickle ICE (204) или ICE restart (200 + новый ETag).
+func patchICE(w http.ResponseWriter, r *http.Request, pc *webrtc.PeerConnection, res *iceResource, logger *zap.Logger) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), sdpFragContentType) {
+		http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	frag, err := parseSDPFragment(string(body))
+	if err != nil {
+		http.Error(w, "Invalid SDP fragment", http.StatusBadRequest)
+		return
+	}
+
+	res.mu.Lock()
+	defer res.mu.Unlock()
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && ifMatch != "*" && ifMatch != res.etag {
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	ufrag, pwd := remoteICECredentials(pc)
+	restart := frag.Ufrag != "" && (frag.Ufrag != ufrag || (frag.Pwd != "" && frag.Pwd != pwd))
+
+	if !restart {
+		// Обычный trickle: просто добавляем кандидатов
+		for _, c := range frag.Candidates {
+			if err := pc.AddICECandidate(c); err != nil {
+				logger.Warn("ICE: failed to add remote candidate", zap.String("candidate", c.Candidate), zap.Error(err))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// ICE restart разрешен только с If-Match: "*"
+	if ifMatch != "*" {
+		logger.Warn("ICE: credentials changed without If-Match: \"*\", restart rejected")
+		http.Error(w, "ICE credentials mismatch", http.StatusUnprocessableEntity)
+		return
+	}
+
+	answer, err := restartICE(pc, frag)
+	if err != nil {
+		logger.Error("ICE: restart failed", zap.Error(err))
+		http.Error(w, "ICE restart failed", http.StatusInternalServerError)
+		return
+	}
+
+	res.etag = newETag()
+	w.Header().Set("Content-Type", sdpFragContentType)
+	w.Header().Set("ETag", res.etag)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(buildSDPFragment(answer)))
+
+	logger.Info("🔁 ICE restart completed")
+}
+
+// restartICE повторно применяет удаленный offer с новыми кредами ICE и возвращает новый локальный SDP.
+func restartICE(pc *webrtc.PeerConnection, frag *sdpFragment) (string, error) {
+	current := pc.RemoteDescription()
+	if current == nil {
+		return "", errors.New("ice restart: no remote description")
+	}
+
+	offer := webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  replaceICECredentials(current.SDP, frag.Ufrag, frag.Pwd),
+	}
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		return "", err
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+
+	gatherFinished := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	<-gatherFinished
+
+	for _, c := range frag.Candidates {
+		if err := pc.AddICECandidate(c); err != nil {
+			return "", err
+		}
+	}
+
+	return pc.LocalDescription().SDP, nil
+}
+
+// canManageSession проверяет, что запрос пришел от владельца трансляции или администратора
+func canManageSession(r *http.Request, s *Session) bool {
+	if role, _ := r.Context().Value(types.UserRoleKey).(string); role == "admin" {
+		return true
+	}
+	uid, ok := r.Context().Value(types.UserIDKey).(uuid.UUID)
+	return ok && uid.String() == s.UserID
+}
+
+// HandleWHIPDelete завершает трансляцию по ресурсу из заголовка Location
+func (e *RTCEngine) HandleWHIPDelete(sm *SessionManager, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamID := chi.URLParam(r, "id")
+		session, ok := sm.Get(streamID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if !canManageSession(r, session) {
+			logger.Warn("WHIP: foreign session delete attempt", zap.String("id", streamID))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		sm.Remove(streamID)
+		w.WriteHeader(http.StatusOK)
+		logger.Info("🛑 WHIP: Session terminated by publisher", zap.String("id", streamID))
+	}
+}
+
+// HandleWHIPPatch принимает trickle ICE кандидаты и ICE restart от публикующего клиента
+func (e *RTCEngine) HandleWHIPPatch(sm *SessionManager, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		streamID := chi.URLParam(r, "id")
+		session, ok := sm.Get(streamID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if !canManageSession(r, session) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		patchICE(w, r, session.PeerConnection, &session.iceResource, logger.With(zap.String("id", streamID)))
+	}
+}
+
+// HandleWHEPDelete отключает зрителя по ресурсу из заголовка Location
+func (e *RTCEngine) HandleWHEPDelete(sm *SessionManager, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		viewerID := chi.URLParam(r, "id")
+		if !sm.RemoveViewer(viewerID) {
+			http.Error(w, "Viewer session not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		logger.Info("👋 WHEP: Viewer disconnected", zap.String("viewer_id", viewerID))
+	}
+}
+
+// HandleWHEPPatch принимает trickle ICE кандидаты и ICE restart от плеера
+func (e *RTCEngine) HandleWHEPPatch(sm *SessionManager, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		viewerID := chi.URLParam(r, "id")
+		viewer, ok := sm.GetViewer(viewerID)
+		if !ok {
+			http.Error(w, "Viewer session not found", http.StatusNotFound)
+			return
+		}
+
+		patchICE(w, r, viewer.PeerConnection, &viewer.iceResource, logger.With(zap.String("viewer_id", viewerID)))
+	}
+}
@@ -0,0 +1,45 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSDPFragment(t *testing.T) {
+	body := "a=ice-ufrag:EsAw\r\n" +
+		"a=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"a=mid:0\r\n" +
+		"a=candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0 ufrag EsAw\r\n" +
+		"a=end-of-candidates\r\n"
+
+	frag, err := parseSDPFragment(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "EsAw", frag.Ufrag)
+	assert.Equal(t, "P2uYro0UCOQ4zxjKXaWCBui1", frag.Pwd)
+	assert.Len(t, frag.Candidates, 1)
+
+	// Кандидат должен быть без префикса "a=" и привязан к mid своей m-секции
+	assert.Equal(t, "candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0 ufrag EsAw", frag.Candidates[0].Candidate)
+	assert.Equal(t, "0", *frag.Candidates[0].SDPMid)
+
+	// Пустой фрагмент — ошибка
+	_, err = parseSDPFragment("v=0\r\n")
+	assert.ErrorIs(t, err, errSDPFragEmpty)
+}
+
+func TestReplaceICECredentials(t *testing.T) {
+	sdp := "v=0\r\na=ice-ufrag:old\r\na=ice-pwd:oldpwd\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=ice-ufrag:old\r\n"
+
+	out := replaceICECredentials(sdp, "new", "newpwd")
+	assert.NotContains(t, out, "old")
+	assert.Contains(t, out, "a=ice-ufrag:new\r\n")
+	assert.Contains(t, out, "a=ice-pwd:newpwd\r\n")
+
+	// Обратный разбор из собранного фрагмента
+	frag, err := parseSDPFragment(buildSDPFragment(out))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", frag.Ufrag)
+	assert.Equal(t, "newpwd", frag.Pwd)
+}
@@ -5,11 +5,28 @@ import (
 
 	"github.com/pion/ice/v4"
 	"github.com/pion/webrtc/v4"
+	"github.com/xela07ax/universal-backend-streaming/internal/hls"
 	"go.uber.org/zap"
 )
 
 type RTCEngine struct {
 	api *webrtc.API
+
+	// recording — если задан, каждая WHIP-трансляция пишется на диск (см. Recorder)
+	recording *RecordingConfig
+
+	// hls — если задан, каждая WHIP-трансляция параллельно упаковывается в LL-HLS
+	hls *hls.Manager
+}
+
+// EnableHLS включает живую HLS-раздачу для новых WHIP-трансляций
+func (e *RTCEngine) EnableHLS(m *hls.Manager) {
+	e.hls = m
+}
+
+// EnableRecording включает запись всех новых WHIP-трансляций в хранилище
+func (e *RTCEngine) EnableRecording(cfg RecordingConfig) {
+	e.recording = &cfg
 }
 
 func NewRTCEngine(logger *zap.Logger) (*RTCEngine, error) {
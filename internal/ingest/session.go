@@ -1,18 +1,177 @@
 package ingest
 
 import (
+	"context"
 	"sync"
+	"time"
 
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
+	"github.com/xela07ax/universal-backend-streaming/internal/hls"
 	"go.uber.org/zap"
 )
 
+// keyframeRequestInterval — минимальный интервал между PLI, отправляемыми публикующему клиенту.
+// Без ограничения массовый заход зрителей заставил бы энкодер слать ключевые кадры непрерывно.
+const keyframeRequestInterval = 500 * time.Millisecond
+
+// peerConnection — то, что менеджеру сессий нужно от *webrtc.PeerConnection (в тестах — фейк)
+type peerConnection interface {
+	WriteRTCP(pkts []rtcp.Packet) error
+	Close() error
+}
+
 // Session представляет одну активную трансляцию
 type Session struct {
 	PeerConnection *webrtc.PeerConnection
 	StreamID       string
 	UserID         string
+	StartedAt      time.Time
 	VideoTrack     *webrtc.TrackLocalStaticRTP // Хранение видеотрека для раздачи
+	AudioTrack     *webrtc.TrackLocalStaticRTP // Хранение аудиотрека для раздачи (Opus от OBS)
+
+	// peer — тот же PeerConnection: через него сессия закрывается и шлет RTCP
+	peer peerConnection
+
+	// tracksMu защищает VideoTrack/AudioTrack, expected и tracksChanged: треки появляются в OnTrack
+	// уже после регистрации сессии
+	tracksMu sync.RWMutex
+	// expected — виды медиа, которые публикующий клиент объявил в offer (см. expectTracks)
+	expected map[webrtc.RTPCodecType]bool
+	// tracksChanged закрывается и пересоздается при появлении каждого трека (см. WaitTracks)
+	tracksChanged chan struct{}
+
+	// viewers — WHEP-зрители этой трансляции (ключ — ID ресурса зрителя)
+	viewers   map[string]*Viewer
+	viewersMu sync.RWMutex
+
+	// videoSSRC — SSRC входящего видеотрека (адресат PLI), lastKeyframeReq — время последнего PLI
+	// по часам now
+	videoSSRC       webrtc.SSRC
+	lastKeyframeReq time.Time
+	keyframeMu      sync.Mutex
+	now             func() time.Time
+
+	// recorder — запись эфира на диск (nil, если запись выключена)
+	recorder *Recorder
+	// hls — живая HLS-раздача (nil, если выключена)
+	hls *hls.Stream
+	// sinks — все потребители входящего RTP (recorder, hls); заполняется до старта PeerConnection
+	sinks []trackSink
+
+	iceResource
+}
+
+// Viewer представляет одного WHEP-зрителя, подключенного к трансляции
+type Viewer struct {
+	ID             string
+	StreamID       string
+	PeerConnection *webrtc.PeerConnection
+	peer           peerConnection
+
+	iceResource
+}
+
+// SetTrack сохраняет локальный трек для раздачи в слот, соответствующий типу медиа.
+func (s *Session) SetTrack(kind webrtc.RTPCodecType, track *webrtc.TrackLocalStaticRTP) {
+	s.tracksMu.Lock()
+	defer s.tracksMu.Unlock()
+	switch kind {
+	case webrtc.RTPCodecTypeAudio:
+		s.AudioTrack = track
+	case webrtc.RTPCodecTypeVideo:
+		s.VideoTrack = track
+	}
+	if s.tracksChanged != nil {
+		close(s.tracksChanged)
+		s.tracksChanged = nil
+	}
+}
+
+// expectTracks запоминает виды медиа, которые публикующий клиент будет присылать
+// (принимающие трансиверы после SetRemoteDescription), и передает их HLS-упаковщику
+func (s *Session) expectTracks(transceivers []*webrtc.RTPTransceiver) {
+	s.tracksMu.Lock()
+	defer s.tracksMu.Unlock()
+	s.expected = make(map[webrtc.RTPCodecType]bool)
+	var kinds []hls.TrackKind
+	for _, t := range transceivers {
+		if d := t.Direction(); d == webrtc.RTPTransceiverDirectionRecvonly || d == webrtc.RTPTransceiverDirectionSendrecv {
+			s.expected[t.Kind()] = true
+			kinds = append(kinds, hlsKind(t.Kind()))
+		}
+	}
+	if s.hls != nil {
+		s.hls.Expect(kinds...)
+	}
+}
+
+// WaitTracks ждет, пока придут все объявленные в offer треки, и возвращает готовые к раздаче.
+// Зрителю нельзя отдать answer с одним видео: аудио, пришедшее позже, в его SDP уже не попадет.
+// По истечении ctx возвращает то, что есть.
+func (s *Session) WaitTracks(ctx context.Context) []*webrtc.TrackLocalStaticRTP {
+	for {
+		s.tracksMu.Lock()
+		complete := len(s.expected) > 0
+		for kind := range s.expected {
+			if (kind == webrtc.RTPCodecTypeVideo && s.VideoTrack == nil) || (kind == webrtc.RTPCodecTypeAudio && s.AudioTrack == nil) {
+				complete = false
+			}
+		}
+		if s.tracksChanged == nil {
+			s.tracksChanged = make(chan struct{})
+		}
+		changed := s.tracksChanged
+		s.tracksMu.Unlock()
+
+		if complete {
+			return s.LocalTracks()
+		}
+		select {
+		case <-ctx.Done():
+			return s.LocalTracks()
+		case <-changed:
+		}
+	}
+}
+
+// setVideoSSRC запоминает SSRC входящего видео, чтобы адресовать ему запросы ключевого кадра
+func (s *Session) setVideoSSRC(ssrc webrtc.SSRC) {
+	s.keyframeMu.Lock()
+	defer s.keyframeMu.Unlock()
+	s.videoSSRC = ssrc
+}
+
+// RequestKeyframe отправляет публикующему клиенту PLI по SSRC входящего видео.
+// Запросы чаще keyframeRequestInterval схлопываются; возвращает true, если PLI был отправлен.
+func (s *Session) RequestKeyframe() (bool, error) {
+	s.keyframeMu.Lock()
+	defer s.keyframeMu.Unlock()
+
+	now := s.now()
+	if s.videoSSRC == 0 || now.Sub(s.lastKeyframeReq) < keyframeRequestInterval {
+		return false, nil
+	}
+	s.lastKeyframeReq = now
+
+	err := s.peer.WriteRTCP([]rtcp.Packet{
+		&rtcp.PictureLossIndication{MediaSSRC: uint32(s.videoSSRC)},
+	})
+	return err == nil, err
+}
+
+// LocalTracks возвращает все готовые к раздаче треки (видео первым, затем аудио).
+func (s *Session) LocalTracks() []*webrtc.TrackLocalStaticRTP {
+	s.tracksMu.RLock()
+	defer s.tracksMu.RUnlock()
+	tracks := make([]*webrtc.TrackLocalStaticRTP, 0, 2)
+	if s.VideoTrack != nil {
+		tracks = append(tracks, s.VideoTrack)
+	}
+	if s.AudioTrack != nil {
+		tracks = append(tracks, s.AudioTrack)
+	}
+	return tracks
 }
 
 // SessionManager хранит все текущие стримы в памяти
@@ -22,12 +181,55 @@ type SessionManager struct {
 	logger   *zap.Logger
 }
 
+// ViewerCount возвращает число подключенных WHEP-зрителей
+func (s *Session) ViewerCount() int {
+	s.viewersMu.RLock()
+	defer s.viewersMu.RUnlock()
+	return len(s.viewers)
+}
+
+// closeViewers отключает всех зрителей трансляции (вызывается при остановке публикации)
+func (s *Session) closeViewers() int {
+	s.viewersMu.Lock()
+	viewers := s.viewers
+	s.viewers = nil
+	s.viewersMu.Unlock()
+
+	for _, v := range viewers {
+		_ = v.peer.Close()
+	}
+	return len(viewers)
+}
+
+// codecs возвращает MIME-типы видео и аудио кодеков (пустая строка, если трек еще не пришел)
+func (s *Session) codecs() (string, string) {
+	s.tracksMu.RLock()
+	defer s.tracksMu.RUnlock()
+	var video, audio string
+	if s.VideoTrack != nil {
+		video = s.VideoTrack.Codec().MimeType
+	}
+	if s.AudioTrack != nil {
+		audio = s.AudioTrack.Codec().MimeType
+	}
+	return video, audio
+}
+
 // StreamInfo — структура для ответа API
 type StreamInfo struct {
-	StreamID string `json:"stream_id"`
-	UserID   string `json:"user_id"`
+	StreamID   string    `json:"stream_id"`
+	UserID     string    `json:"user_id"`
+	Viewers    int       `json:"viewers"`
+	StartedAt  time.Time `json:"started_at"`
+	VideoCodec string    `json:"video_codec,omitempty"`
+	AudioCodec string    `json:"audio_codec,omitempty"`
+	WHEPURL    string    `json:"whep_url"`
+	HLSURL     string    `json:"hls_url,omitempty"`
 }
 
+// recordingFinishTimeout ограничивает сведение и перенос записи эфира в хранилище
+const recordingFinishTimeout = 10 * time.Minute
+
 func NewSessionManager(logger *zap.Logger) *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*Session),
@@ -42,13 +244,95 @@ func (m *SessionManager) Add(id string, s *Session) {
 	m.logger.Info("🎬 New streaming session started", zap.String("id", id))
 }
 
+// AddViewer регистрирует WHEP-зрителя под публикующей сессией
+func (m *SessionManager) AddViewer(v *Viewer) bool {
+	s, ok := m.Get(v.StreamID)
+	if !ok {
+		return false
+	}
+
+	s.viewersMu.Lock()
+	if s.viewers == nil {
+		s.viewers = make(map[string]*Viewer)
+	}
+	s.viewers[v.ID] = v
+	s.viewersMu.Unlock()
+
+	m.logger.Info("👀 Viewer attached", zap.String("stream_id", v.StreamID), zap.String("viewer_id", v.ID))
+	return true
+}
+
+// GetViewer ищет зрителя по ID ресурса среди всех активных трансляций
+func (m *SessionManager) GetViewer(id string) (*Viewer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.sessions {
+		s.viewersMu.RLock()
+		v, ok := s.viewers[id]
+		s.viewersMu.RUnlock()
+		if ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// RemoveViewer закрывает PeerConnection зрителя и убирает его из трансляции
+func (m *SessionManager) RemoveViewer(id string) bool {
+	v, ok := m.GetViewer(id)
+	if !ok {
+		return false
+	}
+
+	if s, ok := m.Get(v.StreamID); ok {
+		s.viewersMu.Lock()
+		delete(s.viewers, id)
+		s.viewersMu.Unlock()
+	}
+	_ = v.peer.Close()
+	m.logger.Info("👋 Viewer detached", zap.String("stream_id", v.StreamID), zap.String("viewer_id", id))
+	return true
+}
+
+// Get возвращает активную сессию по ID стрима
+func (m *SessionManager) Get(id string) (*Session, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// Remove завершает трансляцию: закрывает PeerConnection публикации и отключает всех ее зрителей.
+// Закрытие выполняется вне m.mu, так как колбэки Pion зрителей сами обращаются к менеджеру.
 func (m *SessionManager) Remove(id string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	if s, ok := m.sessions[id]; ok {
-		_ = s.PeerConnection.Close()
+	s, ok := m.sessions[id]
+	if ok {
 		delete(m.sessions, id)
-		m.logger.Info("⏹️ Streaming session closed", zap.String("id", id))
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	_ = s.peer.Close()
+	viewers := s.closeViewers()
+	m.logger.Info("⏹️ Streaming session closed", zap.String("id", id), zap.Int("viewers_closed", viewers))
+
+	if s.hls != nil {
+		s.hls.Close()
+	}
+
+	if s.recorder != nil {
+		// Сведение и перенос в хранилище длинной записи занимают время: колбэки Pion не ждут
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), recordingFinishTimeout)
+			defer cancel()
+			if _, err := s.recorder.Finish(ctx); err != nil {
+				m.logger.Error("Recording finalize failed", zap.String("id", id), zap.Error(err))
+			}
+		}()
 	}
 }
 
@@ -59,10 +343,20 @@ func (m *SessionManager) GetActiveStreams() []StreamInfo {
 
 	streams := make([]StreamInfo, 0, len(m.sessions))
 	for id, s := range m.sessions {
-		// Убираем проверку s.VideoTrack != nil для теста
+		videoCodec, audioCodec := s.codecs()
+		var hlsURL string
+		if s.hls != nil {
+			hlsURL = hls.PlaylistURL(id)
+		}
 		streams = append(streams, StreamInfo{
-			StreamID: id,
-			UserID:   s.UserID,
+			StreamID:   id,
+			UserID:     s.UserID,
+			Viewers:    s.ViewerCount(),
+			StartedAt:  s.StartedAt,
+			VideoCodec: videoCodec,
+			AudioCodec: audioCodec,
+			WHEPURL:    "/api/v1/whep?stream_id=" + id,
+			HLSURL:     hlsURL,
 		})
 	}
 	return streams
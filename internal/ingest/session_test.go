@@ -0,0 +1,151 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSession_WaitTracks(t *testing.T) {
+	newTrack := func(mime string) *webrtc.TrackLocalStaticRTP {
+		track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: mime}, "track", "hydro-stream")
+		require.NoError(t, err)
+		return track
+	}
+
+	s := &Session{expected: map[webrtc.RTPCodecType]bool{
+		webrtc.RTPCodecTypeVideo: true,
+		webrtc.RTPCodecTypeAudio: true,
+	}}
+	s.SetTrack(webrtc.RTPCodecTypeVideo, newTrack(webrtc.MimeTypeH264))
+
+	// Аудио объявлено, но еще не пришло: ждем его, а не отдаем зрителю одно видео
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.SetTrack(webrtc.RTPCodecTypeAudio, newTrack(webrtc.MimeTypeOpus))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Len(t, s.WaitTracks(ctx), 2)
+
+	// Трек так и не пришел — по истечении ожидания отдаем то, что есть
+	s = &Session{expected: map[webrtc.RTPCodecType]bool{
+		webrtc.RTPCodecTypeVideo: true,
+		webrtc.RTPCodecTypeAudio: true,
+	}}
+	s.SetTrack(webrtc.RTPCodecTypeVideo, newTrack(webrtc.MimeTypeH264))
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Len(t, s.WaitTracks(ctx), 1)
+}
+
+// fakePeer записывает отправленный RTCP и закрытие вместо настоящего PeerConnection
+type fakePeer struct {
+	mu     sync.Mutex
+	sent   []rtcp.Packet
+	closed bool
+	err    error
+}
+
+func (p *fakePeer) WriteRTCP(pkts []rtcp.Packet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.sent = append(p.sent, pkts...)
+	return nil
+}
+
+func (p *fakePeer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *fakePeer) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func TestSessionManager_Viewers(t *testing.T) {
+	sm := NewSessionManager(zap.NewNop())
+	publisher := &fakePeer{}
+	sm.Add("s1", &Session{StreamID: "s1", peer: publisher})
+
+	first, second := &fakePeer{}, &fakePeer{}
+	assert.False(t, sm.AddViewer(&Viewer{ID: "v0", StreamID: "missing", peer: &fakePeer{}}))
+	assert.True(t, sm.AddViewer(&Viewer{ID: "v1", StreamID: "s1", peer: first}))
+	assert.True(t, sm.AddViewer(&Viewer{ID: "v2", StreamID: "s1", peer: second}))
+
+	s, ok := sm.Get("s1")
+	require.True(t, ok)
+	assert.Equal(t, 2, s.ViewerCount())
+	if streams := sm.GetActiveStreams(); assert.Len(t, streams, 1) {
+		assert.Equal(t, 2, streams[0].Viewers)
+	}
+
+	// Ушедший зритель закрыт и больше не находится
+	assert.True(t, sm.RemoveViewer("v1"))
+	assert.True(t, first.isClosed())
+	assert.False(t, sm.RemoveViewer("v1"))
+	assert.Equal(t, 1, s.ViewerCount())
+
+	// Остановка публикации отключает оставшихся зрителей
+	sm.Remove("s1")
+	assert.True(t, publisher.isClosed())
+	assert.True(t, second.isClosed())
+	_, ok = sm.GetViewer("v2")
+	assert.False(t, ok)
+	assert.Zero(t, s.ViewerCount())
+	assert.Empty(t, sm.GetActiveStreams())
+}
+
+func TestSession_RequestKeyframe(t *testing.T) {
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	peer := &fakePeer{}
+	s := &Session{peer: peer, now: func() time.Time { return clock }}
+
+	// Видео еще не пришло — просить ключевой кадр не у кого
+	sent, err := s.RequestKeyframe()
+	assert.NoError(t, err)
+	assert.False(t, sent)
+	assert.Empty(t, peer.sent)
+
+	s.setVideoSSRC(1234)
+	sent, err = s.RequestKeyframe()
+	assert.NoError(t, err)
+	assert.True(t, sent)
+	assert.Equal(t, []rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: 1234}}, peer.sent)
+
+	// PLI и FIR от зрителей внутри интервала схлопываются в уже отправленный запрос
+	clock = clock.Add(keyframeRequestInterval - time.Millisecond)
+	relayRTCP([]rtcp.Packet{
+		&rtcp.PictureLossIndication{MediaSSRC: 1},
+		&rtcp.FullIntraRequest{MediaSSRC: 1},
+		&rtcp.ReceiverReport{},
+	}, s, "s1", zap.NewNop())
+	assert.Len(t, peer.sent, 1)
+
+	// По истечении интервала новый FIR доходит до публикующего клиента
+	clock = clock.Add(time.Millisecond)
+	relayRTCP([]rtcp.Packet{&rtcp.FullIntraRequest{MediaSSRC: 1}, &rtcp.PictureLossIndication{MediaSSRC: 1}}, s, "s1", zap.NewNop())
+	assert.Len(t, peer.sent, 2)
+
+	// Ошибка отправки возвращается вызывающему
+	peer.err = errors.New("transport closed")
+	clock = clock.Add(keyframeRequestInterval)
+	sent, err = s.RequestKeyframe()
+	assert.EqualError(t, err, "transport closed")
+	assert.False(t, sent)
+}
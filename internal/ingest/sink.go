@@ -0,0 +1,34 @@
+package ingest
+
+import (
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/xela07ax/universal-backend-streaming/internal/hls"
+)
+
+// trackSink — потребитель входящего RTP трансляции помимо WHEP-зрителей (запись, HLS)
+type trackSink interface {
+	AddTrack(track *webrtc.TrackRemote) error
+	WriteRTP(kind webrtc.RTPCodecType, packet *rtp.Packet)
+}
+
+// hlsSink адаптирует hls.Stream к trackSink
+type hlsSink struct {
+	stream *hls.Stream
+}
+
+func hlsKind(kind webrtc.RTPCodecType) hls.TrackKind {
+	if kind == webrtc.RTPCodecTypeAudio {
+		return hls.TrackAudio
+	}
+	return hls.TrackVideo
+}
+
+func (h hlsSink) AddTrack(track *webrtc.TrackRemote) error {
+	codec := track.Codec()
+	return h.stream.AddTrack(hlsKind(track.Kind()), codec.MimeType, codec.ClockRate, codec.Channels)
+}
+
+func (h hlsSink) WriteRTP(kind webrtc.RTPCodecType, packet *rtp.Packet) {
+	h.stream.WriteRTP(hlsKind(kind), packet)
+}
@@ -1,14 +1,22 @@
 package ingest
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
 	"go.uber.org/zap"
 )
 
+// trackWaitTimeout — сколько WHEP-запрос ждет треки только что начатой трансляции.
+// Если какой-то так и не пришел, зритель получает то, что есть.
+const trackWaitTimeout = 5 * time.Second
+
 func (e *RTCEngine) HandleWHEP(sm *SessionManager, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 1. Получаем ID стрима (пробуем Query и URL Param для гибкости)
@@ -17,12 +25,19 @@ func (e *RTCEngine) HandleWHEP(sm *SessionManager, logger *zap.Logger) http.Hand
 			streamID = chi.URLParam(r, "id")
 		}
 
-		sm.mu.RLock()
-		session, ok := sm.sessions[streamID]
-		sm.mu.RUnlock()
+		session, ok := sm.Get(streamID)
 		logger.Info("🔍 WHEP: Searching for stream", zap.String("requested_id", streamID))
-		if !ok || session.VideoTrack == nil {
-			logger.Warn("WHEP: Stream not found or no track", zap.String("id", streamID))
+		if !ok {
+			logger.Warn("WHEP: Stream not found", zap.String("id", streamID))
+			http.Error(w, "Stream not found or not ready", http.StatusNotFound)
+			return
+		}
+		// Ждем все треки трансляции: добавить аудио в уже отданный answer без ренеготиации нельзя
+		waitCtx, cancel := context.WithTimeout(r.Context(), trackWaitTimeout)
+		tracks := session.WaitTracks(waitCtx)
+		cancel()
+		if len(tracks) == 0 {
+			logger.Warn("WHEP: Stream has no tracks yet", zap.String("id", streamID))
 			http.Error(w, "Stream not found or not ready", http.StatusNotFound)
 			return
 		}
@@ -42,22 +57,19 @@ func (e *RTCEngine) HandleWHEP(sm *SessionManager, logger *zap.Logger) http.Hand
 			return
 		}
 
-		// 4. ДОБАВЛЯЕМ ТРЕК СТРИМЕРА ЗРИТЕЛЮ
-		rtpSender, err := pc.AddTrack(session.VideoTrack)
-		if err != nil {
-			logger.Error("WHEP: Failed to add track", zap.Error(err))
-			return
-		}
-
-		// Читаем RTCP (важно для работы обратной связи по качеству)
-		go func() {
-			buf := make([]byte, 1500)
-			for {
-				if _, _, err := rtpSender.Read(buf); err != nil {
-					return
-				}
+		// 4. ДОБАВЛЯЕМ ТРЕКИ СТРИМЕРА ЗРИТЕЛЮ (видео + аудио, если есть)
+		for _, track := range tracks {
+			rtpSender, err := pc.AddTrack(track)
+			if err != nil {
+				logger.Error("WHEP: Failed to add track", zap.String("kind", track.Kind().String()), zap.Error(err))
+				_ = pc.Close()
+				return
 			}
-		}()
+
+			// Читаем RTCP: PLI/FIR от плеера пересылаем публикующему клиенту,
+			// остальное (RR, NACK) обрабатывают интерсепторы Pion
+			go relayKeyframeRequests(rtpSender, session, streamID, logger)
+		}
 
 		// 5. Устанавливаем Remote Description
 		err = pc.SetRemoteDescription(webrtc.SessionDescription{
@@ -66,6 +78,8 @@ func (e *RTCEngine) HandleWHEP(sm *SessionManager, logger *zap.Logger) http.Hand
 		})
 		if err != nil {
 			logger.Error("WHEP: SetRemote err", zap.Error(err))
+			_ = pc.Close()
+			http.Error(w, "Invalid SDP", http.StatusBadRequest)
 			return
 		}
 
@@ -73,6 +87,8 @@ func (e *RTCEngine) HandleWHEP(sm *SessionManager, logger *zap.Logger) http.Hand
 		answer, err := pc.CreateAnswer(nil)
 		if err != nil {
 			logger.Error("WHEP: CreateAnswer err", zap.Error(err))
+			_ = pc.Close()
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
@@ -82,19 +98,78 @@ func (e *RTCEngine) HandleWHEP(sm *SessionManager, logger *zap.Logger) http.Hand
 
 		err = pc.SetLocalDescription(answer)
 		if err != nil {
+			logger.Error("WHEP: SetLocal err", zap.Error(err))
+			_ = pc.Close()
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
 		<-gatherFinished // Ждем завершения сбора
 
-		// 8. Отдаем финальный Answer со всеми кандидатами
+		// 8. Регистрируем зрителя как ресурс (для DELETE/PATCH по Location)
+		viewer := &Viewer{
+			ID:             uuid.New().String(),
+			StreamID:       streamID,
+			PeerConnection: pc,
+			peer:           pc,
+			iceResource:    iceResource{etag: newETag()},
+		}
+		if !sm.AddViewer(viewer) {
+			// Трансляция завершилась, пока шел обмен SDP
+			_ = pc.Close()
+			http.Error(w, "Stream not found or not ready", http.StatusNotFound)
+			return
+		}
+
+		// Зритель ушел (закрыл вкладку, пропала сеть) — освобождаем ресурсы без явного DELETE
+		pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+			// Новый зритель подключился — просим ключевой кадр, чтобы картинка появилась сразу
+			if state == webrtc.PeerConnectionStateConnected {
+				if _, err := session.RequestKeyframe(); err != nil {
+					logger.Warn("WHEP: Keyframe request failed", zap.String("stream_id", streamID), zap.Error(err))
+				}
+			}
+			if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+				sm.RemoveViewer(viewer.ID)
+			}
+		})
+
+		// 9. Отдаем финальный Answer со всеми кандидатами
 		w.Header().Set("Content-Type", "application/sdp")
+		w.Header().Set("Location", "/api/v1/whep/"+viewer.ID)
+		w.Header().Set("ETag", viewer.ETag())
 		w.Header().Set("Access-Control-Allow-Origin", "*") // Для работы плеера
 		w.WriteHeader(http.StatusCreated)
 
 		// Отправляем текущий LocalDescription (он уже содержит кандидатов)
 		_, _ = w.Write([]byte(pc.LocalDescription().SDP))
 
-		logger.Info("✅ WHEP: Viewer connected", zap.String("stream_id", streamID))
+		logger.Info("✅ WHEP: Viewer connected", zap.String("stream_id", streamID), zap.String("viewer_id", viewer.ID))
+	}
+}
+
+// relayKeyframeRequests читает RTCP зрителя и пересылает PLI/FIR публикующему клиенту (с rate limit).
+func relayKeyframeRequests(sender *webrtc.RTPSender, session *Session, streamID string, logger *zap.Logger) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		relayRTCP(packets, session, streamID, logger)
+	}
+}
+
+// relayRTCP пересылает PLI/FIR из пачки RTCP зрителя; остальные пакеты игнорируются
+func relayRTCP(packets []rtcp.Packet, session *Session, streamID string, logger *zap.Logger) {
+	for _, pkt := range packets {
+		switch pkt.(type) {
+		case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+			sent, err := session.RequestKeyframe()
+			if err != nil {
+				logger.Warn("WHEP: PLI relay failed", zap.String("stream_id", streamID), zap.Error(err))
+			} else if sent {
+				logger.Debug("🔑 WHEP: Keyframe requested by viewer", zap.String("stream_id", streamID))
+			}
+		}
 	}
 }
@@ -3,6 +3,7 @@ package ingest
 import (
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
@@ -29,53 +30,91 @@ func (e *RTCEngine) HandleWHIP(sm *SessionManager, logger *zap.Logger) http.Hand
 			return
 		}
 
-		// 3. ПРЕДВАРИТЕЛЬНАЯ ИНИЦИАЛИЗАЦИЯ ТРЕКА (Решение 404 ошибки)
-		// Создаем дефолтные параметры для H264 (стандарт OBS)
-		// Это позволяет WHEP-зрителю подключиться мгновенно
-		capability := webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}
-		localTrack, err := webrtc.NewTrackLocalStaticRTP(capability, "video", "hydro-stream")
-		if err != nil {
-			logger.Error("WHIP: Failed to pre-create local track", zap.Error(err))
-			return
-		}
-
-		// 4. Создаем сессию и СРАЗУ кладем туда трек
+		// 3. Создаем сессию. Локальные треки появятся в OnTrack,
+		// когда станет известен реально согласованный кодек (H264/VP8 для видео, Opus для аудио)
 		streamID := uuid.New().String()
 		currentSession := &Session{
-			StreamID:   streamID,
-			UserID:     uid.String(),
-			VideoTrack: localTrack, // Теперь трек доступен СРАЗУ
+			StreamID:    streamID,
+			UserID:      uid.String(),
+			StartedAt:   time.Now(),
+			now:         time.Now,
+			iceResource: iceResource{etag: newETag()},
 		}
 
-		// 5. Создаем PeerConnection
+		// 4. Создаем PeerConnection
 		pc, err := e.api.NewPeerConnection(webrtc.Configuration{})
 		if err != nil {
 			logger.Error("WHIP: PC creation failed", zap.Error(err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		currentSession.PeerConnection = pc
+		currentSession.PeerConnection, currentSession.peer = pc, pc
+
+		// abort сворачивает несостоявшуюся трансляцию: сессия еще не в sm, поэтому
+		// PeerConnection, HLS-поток и файлы записи закрываем здесь, а не в sm.Remove
+		abort := func(status int) {
+			_ = pc.Close()
+			if currentSession.hls != nil {
+				currentSession.hls.Close()
+			}
+			if currentSession.recorder != nil {
+				currentSession.recorder.Discard()
+			}
+			http.Error(w, http.StatusText(status), status)
+		}
 
-		// 6. Обработка входящего потока (Fan-out)
+		// Опциональная запись эфира (VOD после окончания трансляции)
+		if e.recording != nil {
+			rec, err := NewRecorder(*e.recording, streamID, uid.String(), logger)
+			if err != nil {
+				logger.Error("WHIP: Recorder init failed, streaming without recording", zap.Error(err))
+			} else {
+				currentSession.recorder = rec
+				currentSession.sinks = append(currentSession.sinks, rec)
+			}
+		}
+
+		// Опциональная живая HLS-раздача
+		if e.hls != nil {
+			currentSession.hls = e.hls.Create(streamID)
+			currentSession.sinks = append(currentSession.sinks, hlsSink{stream: currentSession.hls})
+		}
+
+		// 5. Обработка входящего потока (Fan-out): отдельный локальный трек на каждый вид медиа
 		pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 			logger.Info("📡 Ingest: Media flow started",
 				zap.String("id", streamID),
-				zap.String("kind", track.Kind().String()))
-
-			// Пересылаем пакеты из входящего трека в наш заранее созданный localTrack
-			for {
-				packet, _, err := track.ReadRTP()
-				if err != nil {
-					logger.Warn("⏹️ Ingest: Track closed", zap.String("id", streamID))
-					return
-				}
-				// Пишем пакеты в локальный трек, который уже смотрят зрители
-				if err := localTrack.WriteRTP(packet); err != nil {
-					return
+				zap.String("kind", track.Kind().String()),
+				zap.String("codec", track.Codec().MimeType))
+
+			// Создаем локальный трек с тем же кодеком, что прислал OBS
+			localTrack, err := webrtc.NewTrackLocalStaticRTP(track.Codec().RTPCodecCapability, track.Kind().String(), "hydro-stream")
+			if err != nil {
+				logger.Error("WHIP: Failed to create local track",
+					zap.String("id", streamID),
+					zap.String("kind", track.Kind().String()),
+					zap.Error(err))
+				return
+			}
+			currentSession.SetTrack(track.Kind(), localTrack)
+			if track.Kind() == webrtc.RTPCodecTypeVideo {
+				currentSession.setVideoSSRC(track.SSRC())
+			}
+
+			for _, sink := range currentSession.sinks {
+				if err := sink.AddTrack(track); err != nil {
+					logger.Warn("WHIP: Track skipped by sink", zap.String("id", streamID), zap.Error(err))
 				}
 			}
+			if len(currentSession.sinks) > 0 && track.Kind() == webrtc.RTPCodecTypeVideo {
+				// Запись и HLS начинаются с ключевого кадра — не ждем естественный GOP
+				_, _ = currentSession.RequestKeyframe()
+			}
+
+			forwardTrack(track, localTrack, currentSession.sinks, streamID, logger)
 		})
 
-		// 7. Мониторинг состояния
+		// 6. Мониторинг состояния
 		pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 			logger.Info("📶 RTC State Change", zap.String("id", streamID), zap.String("state", state.String()))
 			// При failed/closed сессия удалится из списка активных
@@ -84,32 +123,57 @@ func (e *RTCEngine) HandleWHIP(sm *SessionManager, logger *zap.Logger) http.Hand
 			}
 		})
 
-		// 8. SDP Handshake
+		// 7. SDP Handshake
 		if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(offerSDP)}); err != nil {
 			logger.Error("WHIP: SetRemoteDescription failed", zap.Error(err))
+			abort(http.StatusBadRequest)
 			return
 		}
+		currentSession.expectTracks(pc.GetTransceivers())
 
 		answer, err := pc.CreateAnswer(nil)
 		if err != nil {
 			logger.Error("WHIP: CreateAnswer failed", zap.Error(err))
+			abort(http.StatusBadRequest)
 			return
 		}
 
 		if err := pc.SetLocalDescription(answer); err != nil {
 			logger.Error("WHIP: SetLocalDescription failed", zap.Error(err))
+			abort(http.StatusInternalServerError)
 			return
 		}
 
-		// 9. Финальная регистрация сессии
+		// 8. Финальная регистрация сессии
 		sm.Add(streamID, currentSession)
 
-		// 10. Ответ OBS по стандарту RFC
+		// 9. Ответ OBS по стандарту RFC
 		w.Header().Set("Content-Type", "application/sdp")
 		w.Header().Set("Location", "/api/v1/ingest/whip/"+streamID)
+		w.Header().Set("ETag", currentSession.ETag())
 		w.WriteHeader(http.StatusCreated)
 		_, _ = w.Write([]byte(answer.SDP))
 
 		logger.Debug("🚀 WHIP Session Initialized", zap.String("id", streamID))
 	}
 }
+
+// forwardTrack пересылает RTP-пакеты из входящего трека в локальный трек, который смотрят зрители.
+// Тот же пакет уходит во все подключенные sinks (запись, HLS).
+func forwardTrack(remote *webrtc.TrackRemote, local *webrtc.TrackLocalStaticRTP, sinks []trackSink, streamID string, logger *zap.Logger) {
+	for {
+		packet, _, err := remote.ReadRTP()
+		if err != nil {
+			logger.Warn("⏹️ Ingest: Track closed",
+				zap.String("id", streamID),
+				zap.String("kind", remote.Kind().String()))
+			return
+		}
+		for _, sink := range sinks {
+			sink.WriteRTP(remote.Kind(), packet)
+		}
+		if err := local.WriteRTP(packet); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,434 @@
+/*
+Package keys хранит ключи подписи JWT.
+
+Токены подписываются асимметричным ключом (EdDSA или RS256) с kid в заголовке, а проверяются
+любым ключом из набора: после ротации старые токены живут до истечения. Открытые ключи
+публикуются в JWKS (/.well-known/jwks.json), чтобы другие сервисы могли проверять токены Hydro.
+
+Набор лежит в каталоге auth.keys_dir:
+
+	<kid>.key — закрытый ключ (PKCS#8 PEM), только у активного ключа
+	<kid>.pub — открытый ключ (PKIX PEM), у всех ключей, которыми еще проверяют
+	active    — kid ключа, которым подписываем
+
+Каталогом управляет `hydro keys generate|rotate`. Общий секрет auth.jwt_secret (HS256) остается
+для разработки. Когда в каталоге есть активный ключ, токены без kid принимаются только до
+auth.accept_legacy_hs256_until — срок перехода задается явно.
+*/
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Алгоритмы подписи (alg в заголовке JWT)
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+	AlgHS256 = "HS256" // Общий секрет auth.jwt_secret, в JWKS не публикуется
+)
+
+// rsaBits — размер RSA-ключа для RS256
+const rsaBits = 3072
+
+// activeFile — файл с kid активного ключа
+const activeFile = "active"
+
+var (
+	// ErrNoSigningKey — нет ни активного ключа, ни auth.jwt_secret
+	ErrNoSigningKey = errors.New("keys: no signing key: run `hydro keys generate` or set auth.jwt_secret")
+	// ErrUnknownKey — kid из заголовка нет в наборе (ключ удален после ротации или чужой)
+	ErrUnknownKey = errors.New("keys: unknown key id")
+	// ErrKeyExists — в каталоге уже есть активный ключ (generate), нужен rotate
+	ErrKeyExists = errors.New("keys: active key already exists: use `hydro keys rotate`")
+)
+
+// Key — ключ подписи. Private есть только у активного ключа.
+type Key struct {
+	ID        string
+	Alg       string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	CreatedAt time.Time // Для открытых ключей после ротации — время вывода из подписи
+}
+
+// Set — набор ключей: один для подписи, все — для проверки. После загрузки не меняется.
+type Set struct {
+	signing     *Key
+	verify      map[string]*Key
+	secret      []byte
+	secretUntil time.Time // При активном ключе секрет проверяет токены только до этого момента
+}
+
+// NewHMAC — набор только с общим секретом (HS256). Для разработки и тестов.
+func NewHMAC(secret string) *Set {
+	return &Set{verify: map[string]*Key{}, secret: []byte(secret)}
+}
+
+// NewSet собирает набор из ключей в памяти: signing подписывает, verify дополнительно проверяют
+func NewSet(signing *Key, verify ...*Key) *Set {
+	s := &Set{signing: signing, verify: map[string]*Key{}}
+	for _, k := range append([]*Key{signing}, verify...) {
+		if k != nil {
+			s.verify[k.ID] = k
+		}
+	}
+	return s
+}
+
+// Load читает набор из dir. Пустой или отсутствующий каталог — не ошибка: тогда подписываем секретом.
+// Непустой secret включает HS256 для токенов без kid. Если в dir есть активный ключ, HS256
+// принимается только до legacyUntil (нулевое время — сразу перестает).
+func Load(dir, secret string, legacyUntil time.Time) (*Set, error) {
+	s := &Set{verify: map[string]*Key{}, secret: []byte(secret), secretUntil: legacyUntil}
+	if dir == "" {
+		return s, s.check()
+	}
+
+	pubs, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return nil, fmt.Errorf("keys: failed to list %s: %w", dir, err)
+	}
+	for _, path := range pubs {
+		k, err := readPublic(path)
+		if err != nil {
+			return nil, err
+		}
+		s.verify[k.ID] = k
+	}
+
+	active, err := os.ReadFile(filepath.Join(dir, activeFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, s.check()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keys: failed to read active key id: %w", err)
+	}
+	kid := strings.TrimSpace(string(active))
+	signing, err := readPrivate(filepath.Join(dir, kid+".key"))
+	if err != nil {
+		return nil, err
+	}
+	s.signing = signing
+	s.verify[signing.ID] = signing
+	return s, nil
+}
+
+func (s *Set) check() error {
+	if s.signing == nil && len(s.secret) == 0 {
+		return ErrNoSigningKey
+	}
+	return nil
+}
+
+// hmacAccepted — принимаются ли токены без kid, подписанные секретом. Без активного ключа — всегда
+// (секрет и подписывает), с ключом — только до secretUntil.
+func (s *Set) hmacAccepted() bool {
+	if len(s.secret) == 0 {
+		return false
+	}
+	return s.signing == nil || time.Now().Before(s.secretUntil)
+}
+
+// Signing возвращает активный ключ (nil — подписываем секретом)
+func (s *Set) Signing() *Key { return s.signing }
+
+// Keys возвращает ключи проверки, отсортированные по kid
+func (s *Set) Keys() []*Key {
+	list := make([]*Key, 0, len(s.verify))
+	for _, k := range s.verify {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Sign подписывает claims активным ключом (с kid) или, если его нет, секретом
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	if s.signing != nil {
+		token := jwt.NewWithClaims(jwt.GetSigningMethod(s.signing.Alg), claims)
+		token.Header["kid"] = s.signing.ID
+		return token.SignedString(s.signing.Private)
+	}
+	if len(s.secret) == 0 {
+		return "", ErrNoSigningKey
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+// Methods — алгоритмы, которые принимает Keyfunc (для jwt.WithValidMethods)
+func (s *Set) Methods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, k := range s.Keys() {
+		if !seen[k.Alg] {
+			seen[k.Alg] = true
+			methods = append(methods, k.Alg)
+		}
+	}
+	if s.hmacAccepted() {
+		methods = append(methods, AlgHS256)
+	}
+	return methods
+}
+
+// Keyfunc выбирает ключ проверки по kid. Алгоритм токена обязан совпадать с алгоритмом ключа:
+// иначе открытый ключ мог бы сойти за HMAC-секрет.
+func (s *Set) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if !s.hmacAccepted() || token.Method.Alg() != AlgHS256 {
+			return nil, fmt.Errorf("%w: token has no kid", ErrUnknownKey)
+		}
+		return s.secret, nil
+	}
+
+	k, ok := s.verify[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != k.Alg {
+		return nil, fmt.Errorf("keys: key %q is %s, token is signed with %s", kid, k.Alg, token.Method.Alg())
+	}
+	return k.Public, nil
+}
+
+// JWK — открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"` // OKP
+	X   string `json:"x,omitempty"`   // OKP
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+}
+
+// JWKS — тело /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи набора. Общий секрет не публикуется.
+func (s *Set) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range s.Keys() {
+		jwk := JWK{Use: "sig", Alg: k.Alg, Kid: k.ID}
+		switch pub := k.Public.(type) {
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", b64(pub)
+		case *rsa.PublicKey:
+			jwk.Kty, jwk.N, jwk.E = "RSA", b64(pub.N.Bytes()), b64(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// Generate создает новый ключ алгоритма alg (EdDSA или RS256)
+func Generate(alg string) (*Key, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	default:
+		return nil, fmt.Errorf("keys: unsupported algorithm %q: use %s or %s", alg, AlgEdDSA, AlgRS256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keys: failed to generate %s key: %w", alg, err)
+	}
+	return newKey(alg, priv, priv.Public(), time.Now())
+}
+
+// newKey проставляет kid: отпечаток открытого ключа, поэтому он одинаков на всех узлах
+func newKey(alg string, priv crypto.Signer, pub crypto.PublicKey, created time.Time) (*Key, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("keys: failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return &Key{ID: b64(sum[:12]), Alg: alg, Private: priv, Public: pub, CreatedAt: created}, nil
+}
+
+// Init создает в dir первый ключ и делает его активным. Если активный ключ уже есть — ErrKeyExists.
+func Init(dir, alg string) (*Key, error) {
+	if _, err := os.Stat(filepath.Join(dir, activeFile)); err == nil {
+		return nil, ErrKeyExists
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("keys: failed to create %s: %w", dir, err)
+	}
+	k, err := Generate(alg)
+	if err != nil {
+		return nil, err
+	}
+	return k, activate(dir, k)
+}
+
+// Rotate создает новый активный ключ. Прежний остается только открытым (закрытый удаляется)
+// и проверяет выданные им токены еще retireAfter — обычно это auth.refresh_token_ttl.
+// Открытые ключи, выведенные из подписи раньше, удаляются. Возвращает новый ключ и удаленные kid.
+func Rotate(dir, alg string, retireAfter time.Duration) (*Key, []string, error) {
+	active, err := os.ReadFile(filepath.Join(dir, activeFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("keys: no active key in %s (run `hydro keys generate`): %w", dir, err)
+	}
+	prev := strings.TrimSpace(string(active))
+
+	k, err := Generate(alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := activate(dir, k); err != nil {
+		return nil, nil, err
+	}
+
+	// Время вывода из подписи — mtime открытого ключа: от него отсчитывается retireAfter
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(dir, prev+".pub"), now, now); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return k, nil, fmt.Errorf("keys: failed to retire %s: %w", prev, err)
+	}
+	if err := os.Remove(filepath.Join(dir, prev+".key")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return k, nil, fmt.Errorf("keys: failed to remove private key %s: %w", prev, err)
+	}
+
+	pubs, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return k, nil, fmt.Errorf("keys: failed to list %s: %w", dir, err)
+	}
+	var removed []string
+	for _, path := range pubs {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pub")
+		info, err := os.Stat(path)
+		if err != nil || kid == k.ID || now.Sub(info.ModTime()) < retireAfter {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return k, removed, fmt.Errorf("keys: failed to remove %s: %w", path, err)
+		}
+		removed = append(removed, kid)
+	}
+	return k, removed, nil
+}
+
+// activate записывает ключ и переключает на него active. active пишется последним и через rename,
+// чтобы сервер не увидел kid без файла ключа.
+func activate(dir string, k *Key) error {
+	privDER, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return fmt.Errorf("keys: failed to encode private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(k.Public)
+	if err != nil {
+		return fmt.Errorf("keys: failed to encode public key: %w", err)
+	}
+	if err := writePEM(filepath.Join(dir, k.ID+".key"), "PRIVATE KEY", privDER, 0o600); err != nil {
+		return err
+	}
+	if err := writePEM(filepath.Join(dir, k.ID+".pub"), "PUBLIC KEY", pubDER, 0o644); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, activeFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(k.ID+"\n"), 0o644); err != nil {
+		return fmt.Errorf("keys: failed to write active key id: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, activeFile)); err != nil {
+		return fmt.Errorf("keys: failed to switch active key: %w", err)
+	}
+	return nil
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("keys: failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func readPrivate(path string) (*Key, error) {
+	der, info, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("keys: %s: %w", path, err)
+	}
+	var alg string
+	switch parsed.(type) {
+	case ed25519.PrivateKey:
+		alg = AlgEdDSA
+	case *rsa.PrivateKey:
+		alg = AlgRS256
+	default:
+		return nil, fmt.Errorf("keys: %s: unsupported key type %T", path, parsed)
+	}
+	priv := parsed.(crypto.Signer)
+	return newKey(alg, priv, priv.Public(), info.ModTime())
+}
+
+func readPublic(path string) (*Key, error) {
+	der, info, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("keys: %s: %w", path, err)
+	}
+	var alg string
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		alg = AlgEdDSA
+	case *rsa.PublicKey:
+		alg = AlgRS256
+	default:
+		return nil, fmt.Errorf("keys: %s: unsupported key type %T", path, pub)
+	}
+	return newKey(alg, nil, pub, info.ModTime())
+}
+
+func readPEM(path, blockType string) ([]byte, os.FileInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keys: failed to read %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keys: failed to stat %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, nil, fmt.Errorf("keys: %s: expected PEM %q", path, blockType)
+	}
+	return block.Bytes, info, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
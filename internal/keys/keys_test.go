@@ -0,0 +1,118 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitLoadRotate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+
+	first, err := Init(dir, AlgEdDSA)
+	require.NoError(t, err)
+	_, err = Init(dir, AlgEdDSA)
+	assert.ErrorIs(t, err, ErrKeyExists)
+
+	info, err := os.Stat(filepath.Join(dir, first.ID+".key"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	set, err := Load(dir, "", time.Time{})
+	require.NoError(t, err)
+	require.NotNil(t, set.Signing())
+	assert.Equal(t, first.ID, set.Signing().ID)
+	assert.Equal(t, []string{AlgEdDSA}, set.Methods())
+
+	oldToken, err := set.Sign(jwt.MapClaims{"sub": "bob"})
+	require.NoError(t, err)
+
+	// Ротация: прежний ключ теряет закрытую часть, но проверяет свои токены
+	second, removed, err := Rotate(dir, AlgRS256, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+	_, err = os.Stat(filepath.Join(dir, first.ID+".key"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	set, err = Load(dir, "", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, set.Signing().ID)
+	assert.Len(t, set.Keys(), 2)
+	_, err = jwt.Parse(oldToken, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	assert.NoError(t, err)
+	assert.Len(t, set.JWKS().Keys, 2)
+
+	// Следующая ротация после retireAfter удаляет первый ключ
+	third, removed, err := Rotate(dir, AlgEdDSA, 0)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, removed)
+
+	set, err = Load(dir, "", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, third.ID, set.Signing().ID)
+	assert.Len(t, set.Keys(), 1)
+	_, err = jwt.Parse(oldToken, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	assert.Error(t, err)
+}
+
+func TestLoad_SecretFallback(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing"), "", time.Time{})
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	set, err := Load(filepath.Join(t.TempDir(), "missing"), "dev-secret", time.Time{})
+	require.NoError(t, err)
+	assert.Nil(t, set.Signing())
+	assert.Equal(t, []string{AlgHS256}, set.Methods())
+	assert.Empty(t, set.JWKS().Keys, "общий секрет не публикуется")
+
+	token, err := set.Sign(jwt.MapClaims{"sub": "bob"})
+	require.NoError(t, err)
+	_, err = jwt.Parse(token, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	assert.NoError(t, err)
+}
+
+func TestLoad_SecretWithActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Init(dir, AlgEdDSA)
+	require.NoError(t, err)
+	legacy, err := NewHMAC("old-secret").Sign(jwt.MapClaims{"sub": "bob"})
+	require.NoError(t, err)
+
+	// Есть активный ключ — секрет без явного срока перехода токены не проверяет
+	set, err := Load(dir, "old-secret", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{AlgEdDSA}, set.Methods())
+	_, err = jwt.Parse(legacy, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	assert.Error(t, err)
+
+	set, err = Load(dir, "old-secret", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	_, err = jwt.Parse(legacy, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	assert.Error(t, err, "срок перехода истек")
+
+	// До auth.accept_legacy_hs256_until старые токены принимаются, новые подписываются ключом
+	set, err = Load(dir, "old-secret", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = jwt.Parse(legacy, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	assert.NoError(t, err)
+	token, err := set.Sign(jwt.MapClaims{"sub": "bob"})
+	require.NoError(t, err)
+	parsed, err := jwt.Parse(token, set.Keyfunc, jwt.WithValidMethods(set.Methods()))
+	require.NoError(t, err)
+	assert.Equal(t, AlgEdDSA, parsed.Method.Alg())
+}
+
+func TestRotate_WithoutActiveKey(t *testing.T) {
+	_, _, err := Rotate(t.TempDir(), AlgEdDSA, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestGenerate_UnsupportedAlg(t *testing.T) {
+	_, err := Generate("HS512")
+	assert.Error(t, err)
+}
@@ -0,0 +1,379 @@
+/*
+Package packager готовит загруженные видео к адаптивной раздаче (VOD).
+
+Исходный файл перекодируется ffmpeg в лестницу качеств (renditions) и режется на
+fMP4/CMAF сегменты. Сегменты общие для обоих протоколов: DASH-муксер ffmpeg пишет
+manifest.mpd и, с флагом hls_playlist, master.m3u8 с плейлистами вариантов.
+Готовые манифесты регистрируются в таблице streaming_endpoints.
+*/
+package packager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Подпапки хранилища для упакованных VOD и превью
+const (
+	vodDir        = "vod"
+	thumbnailsDir = "thumbnails"
+)
+
+// thumbnailWidth — ширина превью; высота считается по пропорциям
+const thumbnailWidth = 640
+
+// Имена манифестов внутри папки актива
+const (
+	dashManifest = "manifest.mpd"
+	hlsMaster    = "master.m3u8"
+)
+
+// ErrNoVideo возвращается для файлов без видеодорожки
+var ErrNoVideo = errors.New("packager: input has no video stream")
+
+// Rendition — одна ступень лестницы качеств
+type Rendition struct {
+	Name         string `mapstructure:"name"`          // "720p"
+	Height       int    `mapstructure:"height"`        // Высота кадра, ширина считается по пропорциям
+	VideoBitrate string `mapstructure:"video_bitrate"` // Битрейт в формате ffmpeg ("2800k")
+	AudioBitrate string `mapstructure:"audio_bitrate"`
+}
+
+// DefaultRenditions — лестница по умолчанию; ступени выше исходника отбрасываются
+var DefaultRenditions = []Rendition{
+	{Name: "1080p", Height: 1080, VideoBitrate: "5000k", AudioBitrate: "192k"},
+	{Name: "720p", Height: 720, VideoBitrate: "2800k", AudioBitrate: "128k"},
+	{Name: "480p", Height: 480, VideoBitrate: "1400k", AudioBitrate: "128k"},
+	{Name: "360p", Height: 360, VideoBitrate: "800k", AudioBitrate: "96k"},
+}
+
+// Config описывает окружение упаковщика
+type Config struct {
+	FFmpegPath      string
+	FFprobePath     string
+	Storage         storage.Backend // Куда публикуется результат
+	WorkDir         string          // Локальная папка для вывода ffmpeg (storage.work_dir)
+	SegmentDuration time.Duration   // Длительность сегмента, все варианты режутся по одним границам
+	Renditions      []Rendition
+}
+
+// EndpointStore — контракт репозитория манифестов. Реализуется *repository.EndpointRepository.
+type EndpointStore interface {
+	ReplaceEndpoints(ctx context.Context, assetID uuid.UUID, source string, endpoints []repository.StreamingEndpoint) error
+}
+
+// Packager упаковывает загруженные видео в HLS и DASH
+type Packager struct {
+	cfg       Config
+	endpoints EndpointStore
+	logger    *zap.Logger
+}
+
+// New создает упаковщик, подставляя значения по умолчанию для пустых полей конфига
+func New(cfg Config, endpoints EndpointStore, logger *zap.Logger) *Packager {
+	if cfg.FFmpegPath == "" {
+		cfg.FFmpegPath = "ffmpeg"
+	}
+	if cfg.FFprobePath == "" {
+		cfg.FFprobePath = "ffprobe"
+	}
+	if cfg.SegmentDuration <= 0 {
+		cfg.SegmentDuration = 4 * time.Second
+	}
+	if len(cfg.Renditions) == 0 {
+		cfg.Renditions = DefaultRenditions
+	}
+	return &Packager{cfg: cfg, endpoints: endpoints, logger: logger}
+}
+
+// Available проверяет, что ffmpeg и ffprobe установлены
+func (p *Packager) Available() error {
+	for _, bin := range []string{p.cfg.FFmpegPath, p.cfg.FFprobePath} {
+		if _, err := exec.LookPath(bin); err != nil {
+			return fmt.Errorf("packager: %s not found: %w", bin, err)
+		}
+	}
+	return nil
+}
+
+// Package упаковывает файл актива и регистрирует манифесты в streaming_endpoints.
+// source — ключ исходника в хранилище: если файл актива за время упаковки заменили,
+// манифесты не регистрируются (repository.ErrSourceChanged). Повторный вызов перезаписывает предыдущий результат.
+func (p *Packager) Package(ctx context.Context, assetID uuid.UUID, source, inputPath string) ([]repository.StreamingEndpoint, error) {
+	started := time.Now()
+
+	src, err := p.probe(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if !src.hasVideo {
+		return nil, ErrNoVideo
+	}
+	ladder := selectRenditions(p.cfg.Renditions, src.height)
+
+	// ffmpeg пишет в рабочую папку; в хранилище результат уходит только целиком
+	tmpDir := filepath.Join(p.cfg.WorkDir, vodDir, assetID.String())
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, fmt.Errorf("packager: failed to clean work dir: %w", err)
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, fmt.Errorf("packager: failed to create work dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	args := buildArgs(inputPath, tmpDir, ladder, src.hasAudio, p.cfg.SegmentDuration)
+	if err := p.run(ctx, p.cfg.FFmpegPath, args); err != nil {
+		return nil, err
+	}
+
+	if err := storage.PutDir(ctx, p.cfg.Storage, path.Join(vodDir, assetID.String()), tmpDir); err != nil {
+		return nil, fmt.Errorf("packager: failed to publish output: %w", err)
+	}
+
+	endpoints := endpointsFor(assetID, ladder)
+	if err := p.endpoints.ReplaceEndpoints(ctx, assetID, source, endpoints); err != nil {
+		return nil, err
+	}
+
+	p.logger.Info("📦 VOD packaged",
+		zap.String("asset_id", assetID.String()),
+		zap.Int("renditions", len(ladder)),
+		zap.Duration("took", time.Since(started)))
+	return endpoints, nil
+}
+
+// Thumbnail снимает кадр-превью (JPEG) с offset от начала видео, публикует его и возвращает ключ хранилища.
+// Если видео короче offset, берется первый кадр.
+func (p *Packager) Thumbnail(ctx context.Context, assetID uuid.UUID, inputPath string, offset time.Duration) (string, error) {
+	dir := filepath.Join(p.cfg.WorkDir, thumbnailsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("packager: failed to create thumbnails dir: %w", err)
+	}
+
+	key := ThumbnailKey(assetID)
+	fullPath := filepath.Join(dir, path.Base(key))
+	_ = os.Remove(fullPath) // Кадр от прошлой попытки не должен выдать себя за новый
+
+	args := []string{
+		"-hide_banner", "-y",
+		"-ss", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64),
+		"-i", inputPath,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", thumbnailWidth),
+		"-q:v", "3",
+		fullPath,
+	}
+	if err := p.run(ctx, p.cfg.FFmpegPath, args); err != nil {
+		return "", err
+	}
+
+	// При -ss за концом файла ffmpeg завершается успешно, но кадр не пишет
+	if _, err := os.Stat(fullPath); err != nil {
+		if offset > 0 {
+			return p.Thumbnail(ctx, assetID, inputPath, 0)
+		}
+		return "", fmt.Errorf("packager: thumbnail was not produced: %w", err)
+	}
+
+	if err := storage.PutFile(ctx, p.cfg.Storage, key, fullPath); err != nil {
+		return "", fmt.Errorf("packager: failed to publish thumbnail: %w", err)
+	}
+	return key, nil
+}
+
+// sourceInfo — то немногое об исходнике, что нужно для выбора лестницы
+type sourceInfo struct {
+	height   int
+	hasVideo bool
+	hasAudio bool
+}
+
+func (p *Packager) probe(ctx context.Context, inputPath string) (*sourceInfo, error) {
+	cmd := exec.CommandContext(ctx, p.cfg.FFprobePath,
+		"-v", "error",
+		"-show_entries", "stream=codec_type,height",
+		"-of", "json",
+		inputPath,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("packager: ffprobe failed: %w", err)
+	}
+	return parseProbe(out)
+}
+
+func parseProbe(out []byte) (*sourceInfo, error) {
+	var result struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("packager: invalid ffprobe output: %w", err)
+	}
+
+	info := &sourceInfo{}
+	for _, s := range result.Streams {
+		switch s.CodecType {
+		case "video":
+			if !info.hasVideo {
+				info.hasVideo = true
+				info.height = s.Height
+			}
+		case "audio":
+			info.hasAudio = true
+		}
+	}
+	return info, nil
+}
+
+func (p *Packager) run(ctx context.Context, bin string, args []string) error {
+	cmd := exec.CommandContext(ctx, bin, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("packager: %s failed: %w: %s", filepath.Base(bin), err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// selectRenditions отбрасывает ступени выше исходника (апскейл только тратит битрейт).
+// Если исходник ниже всех ступеней, отдаем одну ступень в его родном разрешении.
+func selectRenditions(ladder []Rendition, sourceHeight int) []Rendition {
+	if sourceHeight <= 0 {
+		return ladder
+	}
+
+	var selected []Rendition
+	for _, r := range ladder {
+		if r.Height <= sourceHeight {
+			selected = append(selected, r)
+		}
+	}
+	if len(selected) > 0 {
+		return selected
+	}
+
+	lowest := ladder[len(ladder)-1]
+	return []Rendition{{
+		Name:         fmt.Sprintf("%dp", sourceHeight),
+		Height:       sourceHeight,
+		VideoBitrate: lowest.VideoBitrate,
+		AudioBitrate: lowest.AudioBitrate,
+	}}
+}
+
+// buildArgs собирает командную строку ffmpeg: split -> scale на каждую ступень,
+// общая аудиодорожка, DASH + HLS плейлисты поверх одних fMP4 сегментов.
+func buildArgs(inputPath, outDir string, ladder []Rendition, hasAudio bool, segment time.Duration) []string {
+	seg := strconv.FormatFloat(segment.Seconds(), 'f', -1, 64)
+
+	filters := make([]string, 0, len(ladder)+1)
+	split := fmt.Sprintf("[0:v]split=%d", len(ladder))
+	for i := range ladder {
+		split += fmt.Sprintf("[v%d]", i)
+	}
+	filters = append(filters, split)
+	for i, r := range ladder {
+		filters = append(filters, fmt.Sprintf("[v%d]scale=-2:%d[v%dout]", i, r.Height, i))
+	}
+
+	args := []string{
+		"-hide_banner", "-y",
+		"-i", inputPath,
+		"-filter_complex", strings.Join(filters, ";"),
+	}
+	for i, r := range ladder {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), r.VideoBitrate,
+		)
+	}
+
+	// Ключевые кадры на границах сегментов — иначе варианты нельзя переключать бесшовно
+	args = append(args,
+		"-preset", "veryfast",
+		"-profile:v", "main",
+		"-pix_fmt", "yuv420p",
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%s)", seg),
+	)
+
+	adaptationSets := "id=0,streams=v"
+	if hasAudio {
+		args = append(args,
+			"-map", "0:a:0",
+			"-c:a", "aac",
+			"-b:a", ladder[0].AudioBitrate,
+			"-ac", "2",
+		)
+		adaptationSets += " id=1,streams=a"
+	}
+
+	return append(args,
+		"-f", "dash",
+		"-seg_duration", seg,
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", adaptationSets,
+		"-hls_playlist", "1",
+		"-hls_master_name", hlsMaster,
+		filepath.Join(outDir, dashManifest),
+	)
+}
+
+// endpointsFor описывает манифесты, которые пишет ffmpeg: мастер-манифесты обоих протоколов
+// и по HLS-плейлисту на ступень (media_{index}.m3u8 в порядке -map)
+func endpointsFor(assetID uuid.UUID, ladder []Rendition) []repository.StreamingEndpoint {
+	endpoints := []repository.StreamingEndpoint{
+		{Protocol: repository.ProtocolHLS, ManifestPath: storagePath(assetID, hlsMaster), Resolution: "adaptive"},
+		{Protocol: repository.ProtocolDASH, ManifestPath: storagePath(assetID, dashManifest), Resolution: "adaptive"},
+	}
+	for i, r := range ladder {
+		endpoints = append(endpoints, repository.StreamingEndpoint{
+			Protocol:     repository.ProtocolHLS,
+			ManifestPath: storagePath(assetID, fmt.Sprintf("media_%d.m3u8", i)),
+			Resolution:   r.Name,
+		})
+	}
+	return endpoints
+}
+
+// AssetPrefix возвращает папку хранилища с упакованными файлами актива ("vod/<id>/")
+func AssetPrefix(assetID uuid.UUID) string {
+	return path.Join(vodDir, assetID.String()) + "/"
+}
+
+// ThumbnailKey возвращает ключ превью актива ("thumbnails/<id>.jpg")
+func ThumbnailKey(assetID uuid.UUID) string {
+	return path.Join(thumbnailsDir, assetID.String()+".jpg")
+}
+
+// storagePath строит ключ хранилища файла внутри папки актива ("vod/<id>/master.m3u8")
+func storagePath(assetID uuid.UUID, fileName string) string {
+	return path.Join(vodDir, assetID.String(), fileName)
+}
+
+// lastLine возвращает последнюю непустую строку вывода ffmpeg — обычно в ней причина ошибки
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,79 @@
+package packager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+)
+
+func TestSelectRenditions(t *testing.T) {
+	tests := []struct {
+		name   string
+		height int
+		want   []string
+	}{
+		{"Full HD source", 1080, []string{"1080p", "720p", "480p", "360p"}},
+		{"720p source drops 1080p", 720, []string{"720p", "480p", "360p"}},
+		{"Tiny source keeps native height", 240, []string{"240p"}},
+		{"Unknown height keeps full ladder", 0, []string{"1080p", "720p", "480p", "360p"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, r := range selectRenditions(DefaultRenditions, tt.height) {
+				names = append(names, r.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	ladder := DefaultRenditions[1:3]
+
+	args := strings.Join(buildArgs("in.mp4", "out", ladder, true, 4*time.Second), " ")
+	assert.Contains(t, args, "[0:v]split=2[v0][v1];[v0]scale=-2:720[v0out];[v1]scale=-2:480[v1out]")
+	assert.Contains(t, args, "-b:v:1 1400k")
+	assert.Contains(t, args, "-map 0:a:0")
+	assert.Contains(t, args, "expr:gte(t,n_forced*4)")
+	assert.Contains(t, args, "id=0,streams=v id=1,streams=a")
+	assert.Contains(t, args, "-hls_playlist 1 -hls_master_name master.m3u8")
+	assert.True(t, strings.HasSuffix(args, "manifest.mpd"))
+
+	// Без аудио дорожка не мапится, иначе ffmpeg упадет
+	args = strings.Join(buildArgs("in.mp4", "out", ladder, false, 4*time.Second), " ")
+	assert.NotContains(t, args, "0:a:0")
+	assert.NotContains(t, args, "streams=a")
+}
+
+func TestEndpointsFor(t *testing.T) {
+	id := uuid.New()
+	endpoints := endpointsFor(id, DefaultRenditions[:2])
+
+	assert.Len(t, endpoints, 4)
+	assert.Equal(t, repository.ProtocolHLS, endpoints[0].Protocol)
+	assert.Equal(t, "vod/"+id.String()+"/master.m3u8", endpoints[0].ManifestPath)
+	assert.Equal(t, repository.ProtocolDASH, endpoints[1].Protocol)
+	assert.Equal(t, "vod/"+id.String()+"/media_1.m3u8", endpoints[3].ManifestPath)
+	assert.Equal(t, "720p", endpoints[3].Resolution)
+}
+
+func TestParseProbe(t *testing.T) {
+	info, err := parseProbe([]byte(`{"streams":[{"codec_type":"video","height":720},{"codec_type":"audio"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 720, info.height)
+	assert.True(t, info.hasVideo)
+	assert.True(t, info.hasAudio)
+
+	info, err = parseProbe([]byte(`{"streams":[{"codec_type":"audio"}]}`))
+	assert.NoError(t, err)
+	assert.False(t, info.hasVideo)
+
+	_, err = parseProbe([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,371 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Разбор содержимого moov (ISO/IEC 14496-12). Все функции работают с уже прочитанным буфером
+// и проверяют границы: битый файл должен давать ошибку, а не панику.
+
+// eachChild обходит дочерние боксы буфера
+func eachChild(buf []byte, fn func(typ string, payload []byte) error) error {
+	for len(buf) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(buf))
+		typ := string(buf[4:8])
+		headerLen := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(buf))
+		case 1:
+			if len(buf) < 16 {
+				return fmt.Errorf("%w: truncated %s box", ErrNotMedia, typ)
+			}
+			size = binary.BigEndian.Uint64(buf[8:16])
+			headerLen = 16
+		}
+		if size < headerLen || size > uint64(len(buf)) {
+			return fmt.Errorf("%w: invalid %s box size", ErrNotMedia, typ)
+		}
+
+		if err := fn(typ, buf[headerLen:size]); err != nil {
+			return err
+		}
+		buf = buf[size:]
+	}
+	return nil
+}
+
+// findChild возвращает содержимое первого дочернего бокса typ
+func findChild(buf []byte, typ string) []byte {
+	var found []byte
+	_ = eachChild(buf, func(t string, payload []byte) error {
+		if found == nil && t == typ {
+			found = payload
+		}
+		return nil
+	})
+	return found
+}
+
+// findPath спускается по цепочке боксов: findPath(trak, "mdia", "minf", "stbl")
+func findPath(buf []byte, path ...string) []byte {
+	for _, typ := range path {
+		if buf = findChild(buf, typ); buf == nil {
+			return nil
+		}
+	}
+	return buf
+}
+
+func u16(b []byte, off int) (int, bool) {
+	if off+2 > len(b) {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(b[off:])), true
+}
+
+func u32(b []byte, off int) (uint32, bool) {
+	if off+4 > len(b) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[off:]), true
+}
+
+func u64(b []byte, off int) (uint64, bool) {
+	if off+8 > len(b) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(b[off:]), true
+}
+
+// parseTimeBox читает timescale и duration из mvhd/mdhd (версии 0 и 1)
+func parseTimeBox(b []byte) (timescale uint32, duration uint64) {
+	if len(b) < 4 {
+		return 0, 0
+	}
+	if b[0] == 1 {
+		timescale, _ = u32(b, 20)
+		duration, _ = u64(b, 24)
+	} else {
+		timescale, _ = u32(b, 12)
+		d, _ := u32(b, 16)
+		duration = uint64(d)
+	}
+	// Все единицы в duration — признак "неизвестно"
+	if duration == 0xFFFFFFFF || duration == 0xFFFFFFFFFFFFFFFF {
+		duration = 0
+	}
+	return timescale, duration
+}
+
+func seconds(duration uint64, timescale uint32) float64 {
+	if timescale == 0 {
+		return 0
+	}
+	return float64(duration) / float64(timescale)
+}
+
+func parseMoov(moov []byte, info *Info) error {
+	var movieTimescale uint32
+	var movieDuration uint64
+
+	err := eachChild(moov, func(typ string, payload []byte) error {
+		switch typ {
+		case "mvhd":
+			movieTimescale, movieDuration = parseTimeBox(payload)
+		case "trak":
+			if t := parseTrak(payload); t != nil {
+				info.Tracks = append(info.Tracks, *t)
+			}
+		case "mvex":
+			// Фрагментированный MP4: общая длительность лежит в mehd
+			if mehd := findChild(payload, "mehd"); len(mehd) > 0 && movieDuration == 0 {
+				if mehd[0] == 1 {
+					movieDuration, _ = u64(mehd, 4)
+				} else {
+					d, _ := u32(mehd, 4)
+					movieDuration = uint64(d)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	info.Duration = seconds(movieDuration, movieTimescale)
+	for _, t := range info.Tracks {
+		if t.Duration > info.Duration {
+			info.Duration = t.Duration
+		}
+	}
+	return nil
+}
+
+func parseTrak(trak []byte) *Track {
+	mdia := findChild(trak, "mdia")
+	hdlr := findChild(mdia, "hdlr")
+	if len(hdlr) < 12 {
+		return nil
+	}
+
+	t := &Track{}
+	switch string(hdlr[8:12]) {
+	case "vide":
+		t.Kind = KindVideo
+	case "soun":
+		t.Kind = KindAudio
+	default:
+		return nil // Субтитры, таймкоды, хинт-дорожки нас не интересуют
+	}
+
+	timescale, duration := parseTimeBox(findChild(mdia, "mdhd"))
+	t.Duration = seconds(duration, timescale)
+
+	stbl := findPath(mdia, "minf", "stbl")
+	parseSampleEntry(findChild(stbl, "stsd"), t)
+
+	if t.Kind == KindVideo {
+		if t.Width == 0 || t.Height == 0 {
+			t.Width, t.Height = trackDimensions(findChild(trak, "tkhd"))
+		}
+		if samples := sampleCount(findChild(stbl, "stts")); samples > 0 && t.Duration > 0 {
+			t.FrameRate = float64(samples) / t.Duration
+		}
+	}
+	if t.Kind == KindAudio && t.SampleRate == 0 {
+		t.SampleRate = int(timescale)
+	}
+	return t
+}
+
+// trackDimensions читает размеры кадра из tkhd (фиксированная точка 16.16)
+func trackDimensions(tkhd []byte) (int, int) {
+	off := 76
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		off = 88
+	}
+	w, _ := u32(tkhd, off)
+	h, _ := u32(tkhd, off+4)
+	return int(w >> 16), int(h >> 16)
+}
+
+// sampleCount суммирует число сэмплов из stts
+func sampleCount(stts []byte) uint64 {
+	entries, ok := u32(stts, 4)
+	if !ok {
+		return 0
+	}
+	var total uint64
+	for i := 0; i < int(entries); i++ {
+		count, ok := u32(stts, 8+i*8)
+		if !ok {
+			break
+		}
+		total += uint64(count)
+	}
+	return total
+}
+
+// parseSampleEntry разбирает первую запись stsd: кодек и его параметры
+func parseSampleEntry(stsd []byte, t *Track) {
+	if len(stsd) < 8 {
+		return
+	}
+	_ = eachChild(stsd[8:], func(format string, entry []byte) error {
+		if t.Codec != "" {
+			return nil
+		}
+		t.Codec = strings.TrimSpace(format)
+
+		if t.Kind == KindVideo {
+			parseVisualEntry(format, entry, t)
+		} else {
+			parseAudioEntry(format, entry, t)
+		}
+		return nil
+	})
+}
+
+// visualEntryLen — размер полей VisualSampleEntry до вложенных боксов (avcC, hvcC...)
+const visualEntryLen = 78
+
+func parseVisualEntry(format string, entry []byte, t *Track) {
+	t.Width, _ = u16(entry, 24)
+	t.Height, _ = u16(entry, 26)
+	if len(entry) <= visualEntryLen {
+		return
+	}
+
+	switch format {
+	case "avc1", "avc3":
+		// avcC: configurationVersion, AVCProfileIndication, profile_compatibility, AVCLevelIndication
+		if avcC := findChild(entry[visualEntryLen:], "avcC"); len(avcC) >= 4 {
+			t.Codec = fmt.Sprintf("%s.%02x%02x%02x", format, avcC[1], avcC[2], avcC[3])
+		}
+	}
+}
+
+func parseAudioEntry(format string, entry []byte, t *Track) {
+	t.Channels, _ = u16(entry, 16)
+	rate, _ := u32(entry, 24)
+	t.SampleRate = int(rate >> 16)
+
+	// QuickTime sound description v1/v2 длиннее: вложенные боксы начинаются дальше
+	childrenAt := 28
+	switch version, _ := u16(entry, 8); version {
+	case 1:
+		childrenAt = 44
+	case 2:
+		childrenAt = 64
+		if bits, ok := u64(entry, 32); ok {
+			t.SampleRate = int(math.Float64frombits(bits))
+		}
+		if ch, ok := u32(entry, 40); ok {
+			t.Channels = int(ch)
+		}
+	}
+	if format == "Opus" {
+		t.Codec = "opus"
+	}
+	if format != "mp4a" || len(entry) <= childrenAt {
+		return
+	}
+
+	children := entry[childrenAt:]
+	esds := findChild(children, "esds")
+	if esds == nil {
+		// В MOV esds бывает вложен в wave
+		esds = findPath(children, "wave", "esds")
+	}
+	if codec := mp4aCodec(esds); codec != "" {
+		t.Codec = codec
+	}
+}
+
+// Теги дескрипторов MPEG-4 Systems (ISO/IEC 14496-1) внутри esds
+const (
+	tagESDescriptor     = 0x03
+	tagDecoderConfig    = 0x04
+	tagDecSpecificInfo  = 0x05
+	objectTypeAudioAAC  = 0x40
+	audioObjectEscape   = 31
+	esFlagStreamDepends = 0x80
+	esFlagURL           = 0x40
+	esFlagOCRStream     = 0x20
+)
+
+// mp4aCodec строит строку кодека RFC 6381 ("mp4a.40.2" для AAC-LC) из esds
+func mp4aCodec(esds []byte) string {
+	if len(esds) < 4 {
+		return ""
+	}
+	es := descriptor(esds[4:], tagESDescriptor)
+	if len(es) < 3 {
+		return ""
+	}
+
+	flags := es[2]
+	off := 3
+	if flags&esFlagStreamDepends != 0 {
+		off += 2
+	}
+	if flags&esFlagURL != 0 && off < len(es) {
+		off += 1 + int(es[off])
+	}
+	if flags&esFlagOCRStream != 0 {
+		off += 2
+	}
+	if off >= len(es) {
+		return ""
+	}
+
+	dcd := descriptor(es[off:], tagDecoderConfig)
+	if len(dcd) < 13 {
+		return ""
+	}
+	objectType := dcd[0]
+	if objectType != objectTypeAudioAAC {
+		return fmt.Sprintf("mp4a.%02x", objectType)
+	}
+
+	// Для AAC уточняем audio object type из AudioSpecificConfig (5 бит, 31 — расширенный)
+	dsi := descriptor(dcd[13:], tagDecSpecificInfo)
+	if len(dsi) == 0 {
+		return "mp4a.40"
+	}
+	aot := int(dsi[0] >> 3)
+	if aot == audioObjectEscape && len(dsi) >= 2 {
+		aot = 32 + int(dsi[0]&0x07)<<3 | int(dsi[1]>>5)
+	}
+	return fmt.Sprintf("mp4a.40.%d", aot)
+}
+
+// descriptor ищет дескриптор tag в последовательности и возвращает его содержимое
+func descriptor(buf []byte, tag byte) []byte {
+	for len(buf) >= 2 {
+		t := buf[0]
+		// Длина кодируется 1-4 байтами по 7 бит, старший бит — "есть продолжение"
+		size, i := 0, 1
+		for ; i < len(buf) && i <= 4; i++ {
+			size = size<<7 | int(buf[i]&0x7F)
+			if buf[i]&0x80 == 0 {
+				break
+			}
+		}
+		start := i + 1
+		if start+size > len(buf) {
+			return nil
+		}
+		if t == tag {
+			return buf[start : start+size]
+		}
+		buf = buf[start+size:]
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+/*
+Package probe извлекает технические параметры из MP4/MOV без внешних утилит.
+
+Читается только структура боксов ISO BMFF (ftyp, moov и его потомки) — сами сэмплы
+в mdat не трогаются, поэтому разбор многогигабайтного файла занимает миллисекунды.
+
+Sniff определяет тип загруженного файла по сигнатуре (MP4, MOV, WebM, MKV) и отличает
+содержимое, которое браузер мог бы исполнить (HTML, SVG, скрипты, исполняемые файлы).
+*/
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// maxMoovSize — предел размера moov, который читаем в память (защита от битых/вредных файлов)
+const maxMoovSize = 64 << 20
+
+var (
+	// ErrNotMedia — файл не является контейнером MP4/MOV (или поврежден до неузнаваемости)
+	ErrNotMedia = errors.New("probe: not an MP4/MOV media file")
+	// ErrNoTracks — контейнер корректный, но в нем нет ни видео, ни аудио
+	ErrNoTracks = errors.New("probe: no audio or video tracks")
+)
+
+// Виды дорожек
+const (
+	KindVideo = "video"
+	KindAudio = "audio"
+)
+
+// Track — параметры одной дорожки
+type Track struct {
+	Kind     string  // video или audio
+	Codec    string  // Строка кодека в формате RFC 6381 ("avc1.64001f", "mp4a.40.2") или fourcc
+	Duration float64 // Секунды
+
+	// Видео
+	Width     int
+	Height    int
+	FrameRate float64
+
+	// Аудио
+	Channels   int
+	SampleRate int
+}
+
+// Info — результат разбора файла
+type Info struct {
+	Container string  // "mp4" или "mov"
+	Brand     string  // major_brand из ftyp
+	Duration  float64 // Секунды
+	Size      int64   // Байты
+	Bitrate   int64   // Средний битрейт, бит/с
+	Tracks    []Track
+}
+
+// Video возвращает первую видеодорожку или nil
+func (i *Info) Video() *Track { return i.track(KindVideo) }
+
+// Audio возвращает первую аудиодорожку или nil
+func (i *Info) Audio() *Track { return i.track(KindAudio) }
+
+func (i *Info) track(kind string) *Track {
+	for n := range i.Tracks {
+		if i.Tracks[n].Kind == kind {
+			return &i.Tracks[n]
+		}
+	}
+	return nil
+}
+
+// Metadata раскладывает результат в формат media_assets.metadata
+func (i *Info) Metadata() map[string]interface{} {
+	m := map[string]interface{}{
+		"container": i.Container,
+		"bitrate":   i.Bitrate,
+	}
+	if v := i.Video(); v != nil {
+		m["video_codec"] = v.Codec
+		m["width"] = v.Width
+		m["height"] = v.Height
+		if v.FrameRate > 0 {
+			m["fps"] = math.Round(v.FrameRate*100) / 100
+		}
+	}
+	if a := i.Audio(); a != nil {
+		m["audio_codec"] = a.Codec
+		m["audio_channels"] = a.Channels
+		m["audio_sample_rate"] = a.SampleRate
+	}
+	return m
+}
+
+// File разбирает файл по пути
+func File(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("probe: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("probe: %w", err)
+	}
+	return Probe(f, stat.Size())
+}
+
+// Probe разбирает MP4/MOV из r размером size байт
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Size: size, Container: "mp4"}
+
+	var (
+		moov      []byte
+		offset    int64
+		firstBox  = true
+		sawHeader bool
+	)
+	for offset < size {
+		hdr, err := readBoxHeader(r, offset, size)
+		if err != nil {
+			if firstBox {
+				return nil, ErrNotMedia
+			}
+			break // Хвост файла обрезан — берем то, что успели найти
+		}
+
+		// Файл должен начинаться с известного бокса, иначе это не MP4 (например, переименованный zip)
+		if firstBox && !topLevelBoxes[hdr.typ] {
+			return nil, ErrNotMedia
+		}
+		firstBox = false
+
+		switch hdr.typ {
+		case "ftyp":
+			sawHeader = true
+			payload, err := readPayload(r, hdr, 64)
+			if err == nil && len(payload) >= 4 {
+				info.Brand = string(payload[:4])
+				if info.Brand == "qt  " {
+					info.Container = "mov"
+				}
+			}
+		case "moov":
+			sawHeader = true
+			if hdr.payloadSize() > maxMoovSize {
+				return nil, fmt.Errorf("%w: moov box too large", ErrNotMedia)
+			}
+			if moov, err = readPayload(r, hdr, maxMoovSize); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrNotMedia, err)
+			}
+		}
+		offset += hdr.size
+	}
+
+	if !sawHeader || moov == nil {
+		return nil, ErrNotMedia
+	}
+	if err := parseMoov(moov, info); err != nil {
+		return nil, err
+	}
+	if len(info.Tracks) == 0 {
+		return nil, ErrNoTracks
+	}
+
+	if info.Duration > 0 {
+		info.Bitrate = int64(float64(size*8) / info.Duration)
+	}
+	return info, nil
+}
+
+// topLevelBoxes — боксы, с которых может начинаться MP4/MOV
+var topLevelBoxes = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true, "skip": true, "wide": true, "pnot": true,
+}
+
+// boxHeader — заголовок бокса: абсолютное смещение, полный размер и длина заголовка
+type boxHeader struct {
+	typ       string
+	offset    int64
+	size      int64
+	headerLen int64
+}
+
+func (h boxHeader) payloadSize() int64 { return h.size - h.headerLen }
+
+func readBoxHeader(r io.ReaderAt, offset, fileSize int64) (boxHeader, error) {
+	var buf [16]byte
+	if _, err := r.ReadAt(buf[:8], offset); err != nil {
+		return boxHeader{}, err
+	}
+	h := boxHeader{
+		typ:       string(buf[4:8]),
+		offset:    offset,
+		size:      int64(binary.BigEndian.Uint32(buf[:4])),
+		headerLen: 8,
+	}
+
+	switch h.size {
+	case 0: // Бокс до конца файла
+		h.size = fileSize - offset
+	case 1: // 64-битный размер
+		if _, err := r.ReadAt(buf[8:16], offset+8); err != nil {
+			return boxHeader{}, err
+		}
+		h.size = int64(binary.BigEndian.Uint64(buf[8:16]))
+		h.headerLen = 16
+	}
+
+	if h.size < h.headerLen || offset+h.size > fileSize {
+		return boxHeader{}, errors.New("invalid box size")
+	}
+	return h, nil
+}
+
+func readPayload(r io.ReaderAt, h boxHeader, limit int64) ([]byte, error) {
+	n := h.payloadSize()
+	if n > limit {
+		n = limit
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, h.offset+h.headerLen); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
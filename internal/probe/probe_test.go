@@ -0,0 +1,132 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, typ...), body...)
+}
+
+func be16(v int) []byte    { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// timeBox собирает mvhd/mdhd версии 0
+func timeBox(typ string, timescale, duration uint32) []byte {
+	return box(typ, make([]byte, 12), be32(timescale), be32(duration), make([]byte, 80))
+}
+
+func hdlr(handler string) []byte {
+	return box("hdlr", make([]byte, 8), []byte(handler), make([]byte, 13))
+}
+
+func stts(count, delta uint32) []byte {
+	return box("stts", make([]byte, 4), be32(1), be32(count), be32(delta))
+}
+
+func trak(handler string, timescale, duration uint32, entry []byte, extra ...[]byte) []byte {
+	stbl := box("stbl", append([][]byte{box("stsd", make([]byte, 4), be32(1), entry)}, extra...)...)
+	return box("trak",
+		box("mdia", timeBox("mdhd", timescale, duration), hdlr(handler), box("minf", stbl)))
+}
+
+// testMP4 — 10 секунд 1280x720@30 H264 High + AAC-LC стерео 48 кГц
+func testMP4(mdatSize int) []byte {
+	avc1 := box("avc1",
+		make([]byte, 24), be16(1280), be16(720), make([]byte, 50),
+		box("avcC", []byte{1, 0x64, 0x00, 0x1f, 0xff}),
+	)
+	esds := box("esds", make([]byte, 4),
+		[]byte{0x03, 25, 0, 1, 0},                      // ES_Descriptor, ES_ID=1, flags=0
+		[]byte{0x04, 17, 0x40, 0x15}, make([]byte, 11), // DecoderConfig: AAC, audio stream
+		[]byte{0x05, 2, 0x11, 0x90}, // AudioSpecificConfig: AOT=2 (LC), 48 кГц
+		[]byte{0x06, 1, 0x02},
+	)
+	mp4a := box("mp4a", make([]byte, 16), be16(2), be16(16), make([]byte, 4), be32(48000<<16), esds)
+
+	moov := box("moov",
+		timeBox("mvhd", 1000, 10000),
+		trak("vide", 90000, 900000, avc1, stts(300, 3000)),
+		trak("soun", 48000, 480000, mp4a),
+	)
+	ftyp := box("ftyp", []byte("isom"), be32(512), []byte("isomiso2avc1mp41"))
+	return bytes.Join([][]byte{ftyp, box("mdat", make([]byte, mdatSize)), moov}, nil)
+}
+
+func TestProbe(t *testing.T) {
+	data := testMP4(1 << 16)
+	info, err := Probe(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "mp4", info.Container)
+	assert.Equal(t, "isom", info.Brand)
+	assert.InDelta(t, 10.0, info.Duration, 0.001)
+	assert.Equal(t, int64(len(data)*8/10), info.Bitrate)
+
+	video := info.Video()
+	if assert.NotNil(t, video) {
+		assert.Equal(t, "avc1.64001f", video.Codec)
+		assert.Equal(t, 1280, video.Width)
+		assert.Equal(t, 720, video.Height)
+		assert.InDelta(t, 30.0, video.FrameRate, 0.001)
+	}
+
+	audio := info.Audio()
+	if assert.NotNil(t, audio) {
+		assert.Equal(t, "mp4a.40.2", audio.Codec)
+		assert.Equal(t, 2, audio.Channels)
+		assert.Equal(t, 48000, audio.SampleRate)
+	}
+
+	meta := info.Metadata()
+	assert.Equal(t, 720, meta["height"])
+	assert.Equal(t, 30.0, meta["fps"])
+	assert.Equal(t, "mp4a.40.2", meta["audio_codec"])
+}
+
+func TestProbe_NotMedia(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Text file renamed to mp4", []byte("Hello, this is definitely not a video file")},
+		{"ZIP archive", append([]byte("PK\x03\x04"), make([]byte, 64)...)},
+		{"ftyp without moov", box("ftyp", []byte("isom"), be32(0))},
+		{"Truncated box", append(box("ftyp", []byte("isom"), be32(0)), 0, 0, 0x10, 0, 'm', 'o', 'o', 'v')},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)))
+			assert.ErrorIs(t, err, ErrNotMedia)
+		})
+	}
+
+	// Корректный контейнер без аудио/видео дорожек
+	data := bytes.Join([][]byte{
+		box("ftyp", []byte("isom"), be32(0)),
+		box("moov", timeBox("mvhd", 1000, 1000), trak("text", 1000, 1000, box("tx3g"))),
+	}, nil)
+	_, err := Probe(bytes.NewReader(data), int64(len(data)))
+	assert.ErrorIs(t, err, ErrNoTracks)
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.mov")
+	assert.NoError(t, os.WriteFile(path, testMP4(1024), 0644))
+
+	info, err := File(path)
+	assert.NoError(t, err)
+	assert.Len(t, info.Tracks, 2)
+
+	_, err = File(filepath.Join(t.TempDir(), "missing.mp4"))
+	assert.Error(t, err)
+}
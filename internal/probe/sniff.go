@@ -0,0 +1,144 @@
+package probe
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// sniffLen — сколько первых байт файла смотрит Sniff
+const sniffLen = 4096
+
+// Контейнеры, которые распознает Sniff
+const (
+	FormatMP4  = "mp4"
+	FormatMOV  = "mov"
+	FormatWebM = "webm"
+	FormatMKV  = "mkv"
+)
+
+// Format — тип файла по сигнатуре (magic bytes), независимо от имени и заявленного Content-Type
+type Format struct {
+	Name      string // mp4, mov, webm, mkv; для прочих файлов — что это ("html", "executable", "zip", "unknown")
+	Ext       string // Каноническое расширение для хранилища (".mp4"); пусто, если это не видео
+	MIME      string // Тип, с которым файл отдается; пусто, если это не видео
+	Dangerous bool   // HTML, SVG, скрипт или исполняемый файл — такое нельзя отдавать ни под каким видом
+}
+
+// Media сообщает, что файл — видеоконтейнер
+func (f Format) Media() bool { return f.Ext != "" }
+
+var mediaFormats = map[string]Format{
+	FormatMP4:  {Name: FormatMP4, Ext: ".mp4", MIME: "video/mp4"},
+	FormatMOV:  {Name: FormatMOV, Ext: ".mov", MIME: "video/quicktime"},
+	FormatWebM: {Name: FormatWebM, Ext: ".webm", MIME: "video/webm"},
+	FormatMKV:  {Name: FormatMKV, Ext: ".mkv", MIME: "video/x-matroska"},
+}
+
+// MediaFormat возвращает описание видеоконтейнера по имени (mp4, mov, webm, mkv)
+func MediaFormat(name string) (Format, bool) {
+	f, ok := mediaFormats[name]
+	return f, ok
+}
+
+// textSignatures — начало документов, которые браузер может исполнить (после пробелов, без учета регистра)
+var textSignatures = []struct {
+	prefix string
+	name   string
+}{
+	{"<!doctype html", "html"},
+	{"<html", "html"},
+	{"<head", "html"},
+	{"<body", "html"},
+	{"<script", "html"},
+	{"<iframe", "html"},
+	{"<svg", "svg"},
+	{"<?xml", "xml"},
+	{"#!", "script"},
+}
+
+// binarySignatures — прочие форматы, которые точно не видео
+var binarySignatures = []struct {
+	magic     string
+	name      string
+	dangerous bool
+}{
+	{"MZ", "executable", true},
+	{"\x7fELF", "executable", true},
+	{"\xcf\xfa\xed\xfe", "executable", true}, // Mach-O
+	{"%PDF", "pdf", true},
+	{"PK\x03\x04", "zip", false},
+	{"\x89PNG", "png", false},
+	{"\xff\xd8\xff", "jpeg", false},
+	{"GIF8", "gif", false},
+}
+
+// SniffFile определяет тип файла по его первым байтам
+func SniffFile(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Format{}, err
+	}
+	defer func() { _ = f.Close() }()
+	return Sniff(f), nil
+}
+
+// Sniff определяет тип по первым байтам r
+func Sniff(r io.ReaderAt) Format {
+	head := make([]byte, sniffLen)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+
+	if len(head) >= 8 && topLevelBoxes[string(head[4:8])] {
+		// ISO BMFF: бренд "qt  " в ftyp — QuickTime; старые MOV начинаются сразу с moov/mdat/wide
+		if string(head[4:8]) == "ftyp" && len(head) >= 12 && string(head[8:12]) != "qt  " {
+			return mediaFormats[FormatMP4]
+		}
+		return mediaFormats[FormatMOV]
+	}
+	if bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}) {
+		switch ebmlDocType(head) {
+		case "webm":
+			return mediaFormats[FormatWebM]
+		case "matroska":
+			return mediaFormats[FormatMKV]
+		}
+		return Format{Name: "ebml"}
+	}
+
+	for _, sig := range binarySignatures {
+		if bytes.HasPrefix(head, []byte(sig.magic)) {
+			return Format{Name: sig.name, Dangerous: sig.dangerous}
+		}
+	}
+	text := bytes.ToLower(bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n"))
+	for _, sig := range textSignatures {
+		if bytes.HasPrefix(text, []byte(sig.prefix)) {
+			return Format{Name: sig.name, Dangerous: true}
+		}
+	}
+	// HTML может прятаться и дальше начала файла: браузеры со sniffing находят его и там
+	if bytes.Contains(text, []byte("<script")) || bytes.Contains(text, []byte("<html")) {
+		return Format{Name: "html", Dangerous: true}
+	}
+	return Format{Name: "unknown"}
+}
+
+// ebmlDocType достает DocType (элемент 0x4282) из заголовка EBML: "webm" или "matroska"
+func ebmlDocType(head []byte) string {
+	i := bytes.Index(head, []byte{0x42, 0x82})
+	if i < 0 || i+3 > len(head) {
+		return ""
+	}
+	// Размер — EBML varint; DocType короткий, поэтому хватает однобайтовой формы (0x80 | len)
+	size := head[i+2]
+	if size&0x80 == 0 {
+		return ""
+	}
+	n := int(size & 0x7f)
+	start := i + 3
+	if start+n > len(head) {
+		return ""
+	}
+	return string(head[start : start+n])
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ebml собирает заголовок EBML с DocType
+func ebml(docType string) []byte {
+	header := append([]byte{0x42, 0x86, 0x81, 0x01, 0x42, 0x82, byte(0x80 | len(docType))}, docType...)
+	return append([]byte{0x1a, 0x45, 0xdf, 0xa3, byte(0x80 | len(header))}, header...)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		format    string
+		media     bool
+		dangerous bool
+	}{
+		{"MP4", testMP4(16), FormatMP4, true, false},
+		{"QuickTime brand", box("ftyp", []byte("qt  "), be32(0)), FormatMOV, true, false},
+		{"Legacy MOV without ftyp", box("moov", timeBox("mvhd", 1000, 1000)), FormatMOV, true, false},
+		{"WebM", ebml("webm"), FormatWebM, true, false},
+		{"Matroska", ebml("matroska"), FormatMKV, true, false},
+		{"Unknown EBML", ebml("other"), "ebml", false, false},
+		{"HTML", []byte("\xef\xbb\xbf  <!DOCTYPE html><html></html>"), "html", false, true},
+		{"Script in the middle", []byte("hello\n<script>alert(1)</script>"), "html", false, true},
+		{"SVG", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "svg", false, true},
+		{"Shell script", []byte("#!/bin/sh\nrm -rf /"), "script", false, true},
+		{"PE executable", append([]byte("MZ"), make([]byte, 64)...), "executable", false, true},
+		{"ELF", []byte("\x7fELF\x02\x01"), "executable", false, true},
+		{"ZIP", []byte("PK\x03\x04"), "zip", false, false},
+		{"Empty", nil, "unknown", false, false},
+		{"Text", []byte("just some text"), "unknown", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Sniff(bytes.NewReader(tt.data))
+			assert.Equal(t, tt.format, f.Name)
+			assert.Equal(t, tt.media, f.Media())
+			assert.Equal(t, tt.dangerous, f.Dangerous)
+		})
+	}
+}
+
+func TestSniffFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.bin")
+	assert.NoError(t, os.WriteFile(path, ebml("webm"), 0644))
+
+	f, err := SniffFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, ".webm", f.Ext)
+	assert.Equal(t, "video/webm", f.MIME)
+
+	_, err = SniffFile(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	mkv, ok := MediaFormat(FormatMKV)
+	assert.True(t, ok)
+	assert.Equal(t, "video/x-matroska", mkv.MIME)
+	_, ok = MediaFormat("avi")
+	assert.False(t, ok)
+}
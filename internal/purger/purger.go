@@ -0,0 +1,218 @@
+/*
+Package purger окончательно удаляет активы из корзины.
+
+Удаление через API только помечает актив (media_assets.deleted_at), и его можно восстановить.
+По истечении срока хранения (trash.retention) Purger удаляет запись (манифесты и задачи уходят
+каскадом) и все файлы актива в хранилище: исходник, упакованные VOD и превью.
+*/
+package purger
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/packager"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Store — контракт репозитория активов. Реализуется *repository.MediaRepository.
+type Store interface {
+	ExpiredTrash(ctx context.Context, before time.Time, limit int) ([]repository.MediaAsset, error)
+	PurgeAsset(ctx context.Context, id uuid.UUID) (*repository.MediaAsset, error)
+	// ReleaseBlob сообщает, что на исходник больше никто не ссылается и его можно удалить
+	ReleaseBlob(ctx context.Context, storagePath string) (bool, error)
+}
+
+// Config — параметры очистки
+type Config struct {
+	Retention time.Duration // Сколько актив лежит в корзине до удаления
+	Interval  time.Duration // Как часто Run проверяет корзину
+	BatchSize int           // Сколько активов удаляется за один проход
+	DryRun    bool          // Только посчитать, ничего не удалять
+}
+
+// Result — итог очистки
+type Result struct {
+	Assets int   `json:"assets"`
+	Files  int   `json:"files"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// Purger удаляет просроченные активы из корзины
+type Purger struct {
+	cfg     Config
+	store   Store
+	storage storage.Backend
+	logger  *zap.Logger
+	now     func() time.Time
+}
+
+// New создает Purger
+func New(cfg Config, store Store, backend storage.Backend, logger *zap.Logger) *Purger {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &Purger{cfg: cfg, store: store, storage: backend, logger: logger, now: time.Now}
+}
+
+// Run чистит корзину раз в Interval, пока не отменен ctx
+func (p *Purger) Run(ctx context.Context) {
+	p.logger.Info("🧹 Trash purger started",
+		zap.Duration("retention", p.cfg.Retention),
+		zap.Duration("interval", p.cfg.Interval))
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.PurgeExpired(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Error("Purger: pass failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			p.logger.Info("🧹 Trash purger stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired удаляет все активы, пролежавшие в корзине дольше Retention
+func (p *Purger) PurgeExpired(ctx context.Context) (Result, error) {
+	var total Result
+	before := p.now().Add(-p.cfg.Retention)
+
+	for {
+		assets, err := p.store.ExpiredTrash(ctx, before, p.cfg.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		for i := range assets {
+			res, err := p.purge(ctx, &assets[i])
+			if err != nil {
+				return total, err
+			}
+			total.Assets += res.Assets
+			total.Files += res.Files
+			total.Bytes += res.Bytes
+		}
+		// В пробном прогоне записи остаются, и следующая выборка вернула бы их же
+		if len(assets) < p.cfg.BatchSize || p.cfg.DryRun {
+			break
+		}
+	}
+
+	if total.Assets > 0 {
+		p.logger.Info("🧹 Trash purged",
+			zap.Int("assets", total.Assets),
+			zap.Int("files", total.Files),
+			zap.Int64("bytes", total.Bytes),
+			zap.Bool("dry_run", p.cfg.DryRun))
+	}
+	return total, nil
+}
+
+// Purge немедленно удаляет актив из корзины, не дожидаясь срока (админский API)
+func (p *Purger) Purge(ctx context.Context, id uuid.UUID) (Result, error) {
+	asset, err := p.store.PurgeAsset(ctx, id)
+	if err != nil {
+		return Result{}, err
+	}
+	return p.removeFiles(ctx, asset), nil
+}
+
+func (p *Purger) purge(ctx context.Context, asset *repository.MediaAsset) (Result, error) {
+	if p.cfg.DryRun {
+		files, _ := AssetFiles(ctx, p.storage, asset)
+		res := Result{Assets: 1, Files: len(files)}
+		for _, f := range files {
+			res.Bytes += f.Size
+		}
+		p.logger.Info("🧹 Would purge asset",
+			zap.String("asset_id", asset.ID.String()),
+			zap.Int("files", res.Files),
+			zap.Int64("bytes", res.Bytes))
+		return res, nil
+	}
+
+	// Сначала запись: файлы без записи найдет fsck, а запись без файлов сломала бы плеер
+	purged, err := p.store.PurgeAsset(ctx, asset.ID)
+	if errors.Is(err, repository.ErrAssetNotFound) {
+		return Result{}, nil // Восстановлен или удален другим узлом
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return p.removeFiles(ctx, purged), nil
+}
+
+func (p *Purger) removeFiles(ctx context.Context, asset *repository.MediaAsset) Result {
+	res := Result{Assets: 1}
+	files, err := AssetFiles(ctx, p.storage, asset)
+	if err != nil {
+		p.logger.Warn("⚠️ Purger: failed to list asset files", zap.String("asset_id", asset.ID.String()), zap.Error(err))
+	}
+
+	// Исходник может делить другой актив с тем же содержимым — тогда он остается
+	sourceKey, _ := storage.Key(asset.StoragePath)
+	unused, err := p.store.ReleaseBlob(context.WithoutCancel(ctx), asset.StoragePath)
+	if err != nil {
+		p.logger.Warn("⚠️ Purger: failed to release source", zap.String("asset_id", asset.ID.String()), zap.Error(err))
+	}
+	for _, f := range files {
+		if f.Key == sourceKey && !unused {
+			continue
+		}
+		if err := p.storage.Delete(context.WithoutCancel(ctx), f.Key); err != nil {
+			p.logger.Warn("⚠️ Purger: failed to delete file", zap.String("key", f.Key), zap.Error(err))
+			continue
+		}
+		res.Files++
+		res.Bytes += f.Size
+	}
+
+	p.logger.Info("🗑️ Asset purged",
+		zap.String("asset_id", asset.ID.String()),
+		zap.String("title", asset.Title),
+		zap.Int("files", res.Files),
+		zap.Int64("bytes", res.Bytes))
+	return res
+}
+
+// AssetFiles перечисляет файлы актива в хранилище: исходник, отдельную аудиодорожку записи эфира
+// (metadata.audio_path), превью (в том числе из metadata.thumbnail) и упакованные VOD.
+// Отсутствующие файлы пропускаются. Исходник может быть общим с другими активами (дедупликация),
+// поэтому пробный прогон считает с запасом.
+func AssetFiles(ctx context.Context, b storage.Backend, asset *repository.MediaAsset) ([]storage.ObjectInfo, error) {
+	keys := []string{asset.StoragePath, packager.ThumbnailKey(asset.ID)}
+	for _, field := range []string{"audio_path", "thumbnail"} {
+		if key, _ := asset.Metadata[field].(string); key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	var files []storage.ObjectInfo
+	for _, key := range keys {
+		info, err := b.Stat(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			continue
+		}
+		if err != nil {
+			return files, err
+		}
+		files = append(files, info)
+	}
+
+	vod, err := b.List(ctx, packager.AssetPrefix(asset.ID))
+	if err != nil {
+		return files, err
+	}
+	return append(files, vod...), nil
+}
@@ -0,0 +1,145 @@
+package purger
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+	"go.uber.org/zap"
+)
+
+// memStore — корзина в памяти
+type memStore struct {
+	trash  map[uuid.UUID]repository.MediaAsset
+	shared map[string]bool // Исходники, на которые ссылаются другие активы
+}
+
+func (m *memStore) ExpiredTrash(_ context.Context, before time.Time, limit int) ([]repository.MediaAsset, error) {
+	var out []repository.MediaAsset
+	for _, a := range m.trash {
+		if a.DeletedAt.Before(before) && len(out) < limit {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) PurgeAsset(_ context.Context, id uuid.UUID) (*repository.MediaAsset, error) {
+	a, ok := m.trash[id]
+	if !ok {
+		return nil, repository.ErrAssetNotFound
+	}
+	delete(m.trash, id)
+	return &a, nil
+}
+
+func (m *memStore) ReleaseBlob(_ context.Context, storagePath string) (bool, error) {
+	return !m.shared[storagePath], nil
+}
+
+func TestPurger_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	backend, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir()})
+	assert.NoError(t, err)
+
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-40 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	expired := repository.MediaAsset{ID: uuid.New(), StoragePath: "1.mp4", DeletedAt: &old}
+	fresh := repository.MediaAsset{ID: uuid.New(), StoragePath: "2.mp4", DeletedAt: &recent}
+	store := &memStore{trash: map[uuid.UUID]repository.MediaAsset{expired.ID: expired, fresh.ID: fresh}}
+
+	put := func(key, data string) {
+		assert.NoError(t, backend.Put(ctx, key, strings.NewReader(data), int64(len(data)), ""))
+	}
+	put("1.mp4", "video")                                     // 5
+	put("thumbnails/"+expired.ID.String()+".jpg", "jpg")      // 3
+	put("vod/"+expired.ID.String()+"/master.m3u8", "#EXTM3U") // 7
+	put("vod/"+expired.ID.String()+"/seg_1.m4s", "segment")   // 7
+	put("2.mp4", "fresh")
+
+	// Пробный прогон только считает
+	dry := New(Config{Retention: 30 * 24 * time.Hour, DryRun: true}, store, backend, zap.NewNop())
+	dry.now = func() time.Time { return now }
+	res, err := dry.PurgeExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Assets: 1, Files: 4, Bytes: 22}, res)
+	assert.Len(t, store.trash, 2)
+
+	p := New(Config{Retention: 30 * 24 * time.Hour}, store, backend, zap.NewNop())
+	p.now = func() time.Time { return now }
+	res, err = p.PurgeExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Assets: 1, Files: 4, Bytes: 22}, res)
+
+	objects, _ := backend.List(ctx, "")
+	if assert.Len(t, objects, 1, "файлы свежего актива из корзины не тронуты") {
+		assert.Equal(t, "2.mp4", objects[0].Key)
+	}
+	_, stillInTrash := store.trash[fresh.ID]
+	assert.True(t, stillInTrash)
+
+	// Немедленная очистка из админки не ждет срока
+	res, err = p.Purge(ctx, fresh.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Assets: 1, Files: 1, Bytes: 5}, res)
+
+	_, err = p.Purge(ctx, fresh.ID)
+	assert.ErrorIs(t, err, repository.ErrAssetNotFound)
+}
+
+func TestPurger_SharedSource(t *testing.T) {
+	ctx := context.Background()
+	backend, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir()})
+	assert.NoError(t, err)
+
+	deleted := time.Now()
+	dup := repository.MediaAsset{ID: uuid.New(), StoragePath: "blobs/intro.mp4", DeletedAt: &deleted}
+	store := &memStore{
+		trash:  map[uuid.UUID]repository.MediaAsset{dup.ID: dup},
+		shared: map[string]bool{"blobs/intro.mp4": true},
+	}
+	assert.NoError(t, backend.Put(ctx, "blobs/intro.mp4", strings.NewReader("intro"), 5, ""))
+	assert.NoError(t, backend.Put(ctx, "thumbnails/"+dup.ID.String()+".jpg", strings.NewReader("jpg"), 3, ""))
+
+	res, err := New(Config{}, store, backend, zap.NewNop()).Purge(ctx, dup.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Assets: 1, Files: 1, Bytes: 3}, res, "удалено только превью")
+
+	_, err = backend.Stat(ctx, "blobs/intro.mp4")
+	assert.NoError(t, err, "исходник нужен другому активу")
+}
+
+func TestAssetFiles_MetadataKeys(t *testing.T) {
+	ctx := context.Background()
+	backend, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir()})
+	assert.NoError(t, err)
+
+	// Запись эфира: звук лежит рядом с видео, превью снято под нестандартным ключом
+	asset := &repository.MediaAsset{
+		ID:          uuid.New(),
+		StoragePath: "recordings/live.h264",
+		Metadata: map[string]interface{}{
+			"audio_path": "recordings/live.ogg",
+			"thumbnail":  "thumbnails/custom.jpg",
+		},
+	}
+	for _, key := range []string{"recordings/live.h264", "recordings/live.ogg", "thumbnails/custom.jpg", "recordings/other.ogg"} {
+		assert.NoError(t, backend.Put(ctx, key, strings.NewReader("data"), 4, ""))
+	}
+
+	files, err := AssetFiles(ctx, backend, asset)
+	assert.NoError(t, err)
+
+	var keys []string
+	for _, f := range files {
+		keys = append(keys, f.Key)
+	}
+	assert.ElementsMatch(t, []string{"recordings/live.h264", "recordings/live.ogg", "thumbnails/custom.jpg"}, keys)
+}
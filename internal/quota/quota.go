@@ -0,0 +1,133 @@
+/*
+Package quota ограничивает место, которое пользователь занимает в хранилище.
+
+Занятое место — сумма metadata.size исходников пользователя (активы из корзины не считаются:
+удалив видео, пользователь сразу освобождает квоту) и его отвергнутых загрузок в карантине
+(их место освобождается после решения админа или по uploads.quarantine_retention). Лимит берется из users.quota_bytes,
+если он задан, иначе из квоты роли (quotas.roles), иначе quotas.default_bytes.
+Лимит 0 — без ограничений.
+*/
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+)
+
+// ErrExceeded — загрузка не помещается в квоту. Подробности — в *ExceededError.
+var ErrExceeded = errors.New("quota: exceeded")
+
+// Откуда взят лимит (Usage.Source)
+const (
+	SourceUser     = "user"
+	SourceRole     = "role"
+	SourceDefault  = "default"
+	SourceDisabled = "disabled"
+)
+
+// UsageStore считает занятое место. Реализуется *repository.MediaRepository.
+type UsageStore interface {
+	OwnerUsage(ctx context.Context, ownerID uuid.UUID) (repository.AssetUsage, error)
+}
+
+// OverrideStore хранит персональные квоты. Реализуется *repository.UserRepository.
+type OverrideStore interface {
+	GetQuota(ctx context.Context, id uuid.UUID) (*int64, error)
+}
+
+// Config — квоты по умолчанию (секция quotas)
+type Config struct {
+	Enabled bool
+	Default int64            // Для ролей, которых нет в Roles
+	Roles   map[string]int64 // Роль -> байты
+}
+
+// Usage — занятое место и лимит пользователя
+type Usage struct {
+	repository.AssetUsage
+	Limit     int64  `json:"limit_bytes"` // 0 — без ограничений
+	Remaining *int64 `json:"remaining_bytes"`
+	Source    string `json:"limit_source"`
+}
+
+// Allows сообщает, поместятся ли еще n байт
+func (u Usage) Allows(n int64) bool {
+	return u.Remaining == nil || n <= *u.Remaining
+}
+
+// ExceededError — подробности отказа; errors.Is(err, ErrExceeded) == true
+type ExceededError struct {
+	Usage
+	Requested int64 `json:"requested_bytes"`
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%v: %d bytes requested, %d of %d used", ErrExceeded, e.Requested, e.Bytes, e.Limit)
+}
+
+func (e *ExceededError) Unwrap() error { return ErrExceeded }
+
+// Service считает и проверяет квоты
+type Service struct {
+	cfg       Config
+	usage     UsageStore
+	overrides OverrideStore
+}
+
+// New создает Service
+func New(cfg Config, usage UsageStore, overrides OverrideStore) *Service {
+	return &Service{cfg: cfg, usage: usage, overrides: overrides}
+}
+
+// Usage возвращает занятое место и лимит пользователя с ролью role
+func (s *Service) Usage(ctx context.Context, userID uuid.UUID, role string) (Usage, error) {
+	used, err := s.usage.OwnerUsage(ctx, userID)
+	if err != nil {
+		return Usage{}, err
+	}
+	u := Usage{AssetUsage: used}
+
+	u.Limit, u.Source, err = s.limit(ctx, userID, role)
+	if err != nil {
+		return Usage{}, err
+	}
+	if u.Limit > 0 {
+		remaining := max(u.Limit-u.Bytes-u.QuarantineBytes, 0)
+		u.Remaining = &remaining
+	}
+	return u, nil
+}
+
+func (s *Service) limit(ctx context.Context, userID uuid.UUID, role string) (int64, string, error) {
+	if !s.cfg.Enabled {
+		return 0, SourceDisabled, nil
+	}
+	override, err := s.overrides.GetQuota(ctx, userID)
+	if err != nil {
+		return 0, "", err
+	}
+	if override != nil {
+		return *override, SourceUser, nil
+	}
+	if limit, ok := s.cfg.Roles[role]; ok {
+		return limit, SourceRole, nil
+	}
+	return s.cfg.Default, SourceDefault, nil
+}
+
+// Check проверяет, что пользователю хватит места еще на size байт.
+// При нехватке возвращает *ExceededError вместе с текущим Usage.
+func (s *Service) Check(ctx context.Context, userID uuid.UUID, role string, size int64) (Usage, error) {
+	u, err := s.Usage(ctx, userID, role)
+	if err != nil {
+		return Usage{}, err
+	}
+	if !u.Allows(size) {
+		return u, &ExceededError{Usage: u, Requested: size}
+	}
+	return u, nil
+}
@@ -0,0 +1,85 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+)
+
+type fakeStore struct {
+	used        int64
+	quarantined int64
+	overrides   map[uuid.UUID]int64
+}
+
+func (f *fakeStore) OwnerUsage(context.Context, uuid.UUID) (repository.AssetUsage, error) {
+	return repository.AssetUsage{Assets: 2, Bytes: f.used, QuarantineBytes: f.quarantined}, nil
+}
+
+func (f *fakeStore) GetQuota(_ context.Context, id uuid.UUID) (*int64, error) {
+	if q, ok := f.overrides[id]; ok {
+		return &q, nil
+	}
+	return nil, nil
+}
+
+func TestService_Check(t *testing.T) {
+	ctx := context.Background()
+	vip, plain := uuid.New(), uuid.New()
+	store := &fakeStore{used: 800, overrides: map[uuid.UUID]int64{vip: 0}}
+	s := New(Config{
+		Enabled: true,
+		Default: 1000,
+		Roles:   map[string]int64{"admin": 0, "streamer": 5000},
+	}, store, store)
+
+	u, err := s.Check(ctx, plain, "user", 200)
+	assert.NoError(t, err, "ровно по лимиту — можно")
+	assert.Equal(t, SourceDefault, u.Source)
+	assert.Equal(t, int64(200), *u.Remaining)
+
+	_, err = s.Check(ctx, plain, "user", 201)
+	assert.ErrorIs(t, err, ErrExceeded)
+	var exceeded *ExceededError
+	if assert.True(t, errors.As(err, &exceeded)) {
+		assert.Equal(t, int64(201), exceeded.Requested)
+		assert.Equal(t, int64(1000), exceeded.Limit)
+		assert.Equal(t, int64(800), exceeded.Bytes)
+	}
+
+	u, err = s.Check(ctx, plain, "streamer", 4000)
+	assert.NoError(t, err)
+	assert.Equal(t, SourceRole, u.Source)
+
+	// Персональная квота важнее роли; 0 — без ограничений
+	u, err = s.Check(ctx, vip, "user", 1<<40)
+	assert.NoError(t, err)
+	assert.Equal(t, SourceUser, u.Source)
+	assert.Nil(t, u.Remaining)
+
+	u, err = s.Check(ctx, plain, "admin", 1<<40)
+	assert.NoError(t, err)
+	assert.Nil(t, u.Remaining)
+
+	// Перерасход (квоту уменьшили) не дает отрицательного остатка
+	store.used = 1500
+	u, err = s.Usage(ctx, plain, "user")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), *u.Remaining)
+
+	// Файлы в карантине занимают место, пока их не разобрали
+	store.used, store.quarantined = 700, 200
+	_, err = s.Check(ctx, plain, "user", 101)
+	assert.ErrorIs(t, err, ErrExceeded)
+	store.used, store.quarantined = 1500, 0
+
+	disabled := New(Config{Default: 1}, store, store)
+	u, err = disabled.Check(ctx, plain, "user", 1<<40)
+	assert.NoError(t, err)
+	assert.Equal(t, SourceDisabled, u.Source)
+	assert.Equal(t, int64(1500), u.Bytes, "занятое место считается и без квот")
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrBlobNotFound — файла с такой контрольной суммой еще нет
+var ErrBlobNotFound = errors.New("repository: blob not found")
+
+// Blob — хранимый файл исходника, общий для активов с одинаковым содержимым.
+// Число ссылок (ref_count) ведут триггеры media_assets.
+type Blob struct {
+	StoragePath string
+	Checksum    string
+	Size        int64 // -1, если неизвестен
+	RefCount    int
+}
+
+// AcquireBlob ищет уже сохраненный файл с такой же контрольной суммой и сразу берет на него ссылку
+// (ref_count + 1): пока загрузка сохраняет актив, параллельная очистка не удалит файл.
+// Ссылку нужно вернуть DropBlobRef, когда актив записан (его ссылку учтет триггер) или запись не удалась.
+func (r *MediaRepository) AcquireBlob(ctx context.Context, checksum string) (*Blob, error) {
+	query := `
+		UPDATE blobs SET ref_count = ref_count + 1
+		WHERE storage_path = (
+			SELECT storage_path FROM blobs
+			WHERE checksum = $1 AND ref_count > 0
+			ORDER BY ref_count DESC
+			LIMIT 1
+			FOR UPDATE
+		)
+		RETURNING storage_path, checksum, COALESCE(size, -1), ref_count
+	`
+	var b Blob
+	err := r.db.QueryRow(ctx, query, checksum).Scan(&b.StoragePath, &b.Checksum, &b.Size, &b.RefCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to acquire blob: %w", err)
+	}
+	return &b, nil
+}
+
+// DropBlobRef возвращает ссылку, взятую AcquireBlob. Удалять ли файл, решает ReleaseBlob.
+func (r *MediaRepository) DropBlobRef(ctx context.Context, storagePath string) error {
+	query := `UPDATE blobs SET ref_count = ref_count - 1 WHERE storage_path = $1`
+	if _, err := r.db.Exec(ctx, query, storagePath); err != nil {
+		return fmt.Errorf("repository: failed to drop blob reference: %w", err)
+	}
+	return nil
+}
+
+// ReleaseBlob вызывается, когда актив перестал ссылаться на файл (очистка, замена, откат загрузки).
+// Возвращает true, если ссылок не осталось и файл можно удалять из хранилища.
+func (r *MediaRepository) ReleaseBlob(ctx context.Context, storagePath string) (bool, error) {
+	query := `
+		WITH gone AS (
+			DELETE FROM blobs WHERE storage_path = $1 AND ref_count <= 0
+		)
+		SELECT NOT EXISTS (SELECT 1 FROM blobs WHERE storage_path = $1 AND ref_count > 0)
+	`
+	var unused bool
+	if err := r.db.QueryRow(ctx, query, storagePath).Scan(&unused); err != nil {
+		return false, fmt.Errorf("repository: failed to release blob: %w", err)
+	}
+	return unused, nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaRepository_Blobs(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	sum := "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	// Ссылка берется тем же запросом, что и поиск: файл не исчезнет до записи актива
+	mock.ExpectQuery(`UPDATE blobs SET ref_count = ref_count \+ 1.+WHERE checksum = \$1 AND ref_count > 0.+FOR UPDATE`).
+		WithArgs(sum).
+		WillReturnRows(pgxmock.NewRows([]string{"storage_path", "checksum", "size", "ref_count"}).
+			AddRow("blobs/"+sum+".mp4", sum, int64(11), 3))
+	blob, err := repo.AcquireBlob(context.Background(), sum)
+	assert.NoError(t, err)
+	assert.Equal(t, "blobs/"+sum+".mp4", blob.StoragePath)
+
+	mock.ExpectExec(`UPDATE blobs SET ref_count = ref_count - 1`).
+		WithArgs(blob.StoragePath).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	assert.NoError(t, repo.DropBlobRef(context.Background(), blob.StoragePath))
+
+	mock.ExpectQuery(`UPDATE blobs`).
+		WithArgs("other").
+		WillReturnRows(pgxmock.NewRows([]string{"storage_path", "checksum", "size", "ref_count"}))
+	_, err = repo.AcquireBlob(context.Background(), "other")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+
+	// Еще есть ссылки — файл не трогаем
+	mock.ExpectQuery(`DELETE FROM blobs WHERE storage_path = \$1 AND ref_count <= 0`).
+		WithArgs("1.mp4").
+		WillReturnRows(pgxmock.NewRows([]string{"unused"}).AddRow(false))
+	unused, err := repo.ReleaseBlob(context.Background(), "1.mp4")
+	assert.NoError(t, err)
+	assert.False(t, unused)
+
+	mock.ExpectQuery(`DELETE FROM blobs`).
+		WithArgs("2.mp4").
+		WillReturnRows(pgxmock.NewRows([]string{"unused"}).AddRow(true))
+	unused, err = repo.ReleaseBlob(context.Background(), "2.mp4")
+	assert.NoError(t, err)
+	assert.True(t, unused)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
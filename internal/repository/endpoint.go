@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Протоколы адаптивной раздачи (streaming_endpoints.protocol)
+const (
+	ProtocolHLS  = "hls"
+	ProtocolDASH = "dash"
+)
+
+// ErrSourceChanged — файл актива заменили, пока его упаковывали: манифесты старого файла не записываются
+var ErrSourceChanged = errors.New("repository: asset source changed")
+
+// StreamingEndpoint — манифест HLS/DASH, подготовленный упаковщиком для медиа-актива
+type StreamingEndpoint struct {
+	ID           uuid.UUID `json:"id"`
+	AssetID      uuid.UUID `json:"asset_id"`
+	Protocol     string    `json:"protocol"`
+	ManifestPath string    `json:"manifest_path"` // Ключ хранилища ("vod/<id>/master.m3u8")
+	Resolution   string    `json:"resolution"`    // "1080p", "720p" или "adaptive" для мастер-манифеста
+}
+
+// EndpointRepository инкапсулирует SQL-запросы к таблице streaming_endpoints
+type EndpointRepository struct {
+	db DBTX
+}
+
+// NewEndpointRepository создает новый экземпляр репозитория
+func NewEndpointRepository(db DBTX) *EndpointRepository {
+	return &EndpointRepository{db: db}
+}
+
+// ReplaceEndpoints заменяет набор манифестов актива (повторная упаковка не плодит дубликаты).
+// Удаление и вставка — один запрос: читатель не застанет актив без манифестов или с половиной набора.
+// source — ключ упакованного файла: если storage_path актива уже другой, ничего не меняется и
+// возвращается ErrSourceChanged.
+func (r *EndpointRepository) ReplaceEndpoints(ctx context.Context, assetID uuid.UUID, source string, endpoints []StreamingEndpoint) error {
+	protocols := make([]string, len(endpoints))
+	paths := make([]string, len(endpoints))
+	resolutions := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		protocols[i], paths[i], resolutions[i] = e.Protocol, e.ManifestPath, e.Resolution
+	}
+
+	query := `
+		WITH asset AS (
+			SELECT id FROM media_assets WHERE id = $1 AND storage_path = $5
+		), cleared AS (
+			DELETE FROM streaming_endpoints WHERE asset_id IN (SELECT id FROM asset)
+		)
+		INSERT INTO streaming_endpoints (asset_id, protocol, manifest_path, resolution)
+		SELECT asset.id, e.protocol, e.manifest_path, e.resolution
+		FROM asset, unnest($2::text[], $3::text[], $4::text[]) AS e(protocol, manifest_path, resolution)
+		RETURNING id, protocol, manifest_path
+	`
+	rows, err := r.db.Query(ctx, query, assetID, protocols, paths, resolutions, source)
+	if err != nil {
+		return fmt.Errorf("repository: failed to replace endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	// Порядок RETURNING не гарантирован: ID раздаем по паре (протокол, манифест)
+	ids := make(map[[2]string]uuid.UUID, len(endpoints))
+	for rows.Next() {
+		var (
+			id                     uuid.UUID
+			protocol, manifestPath string
+		)
+		if err := rows.Scan(&id, &protocol, &manifestPath); err != nil {
+			return fmt.Errorf("repository: failed to replace endpoints: %w", err)
+		}
+		ids[[2]string{protocol, manifestPath}] = id
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("repository: failed to replace endpoints: %w", err)
+	}
+	if len(ids) == 0 && len(endpoints) > 0 {
+		return ErrSourceChanged
+	}
+
+	for i := range endpoints {
+		e := &endpoints[i]
+		e.AssetID = assetID
+		e.ID = ids[[2]string{e.Protocol, e.ManifestPath}]
+	}
+	return nil
+}
+
+// GetByAssetID возвращает все манифесты актива: сначала мастер-манифесты, затем варианты по убыванию качества
+func (r *EndpointRepository) GetByAssetID(ctx context.Context, assetID uuid.UUID) ([]StreamingEndpoint, error) {
+	query := `
+		SELECT id, asset_id, protocol, manifest_path, COALESCE(resolution, '')
+		FROM streaming_endpoints
+		WHERE asset_id = $1
+		ORDER BY protocol, resolution <> 'adaptive', length(resolution) DESC, resolution DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var endpoints []StreamingEndpoint
+	for rows.Next() {
+		var e StreamingEndpoint
+		if err := rows.Scan(&e.ID, &e.AssetID, &e.Protocol, &e.ManifestPath, &e.Resolution); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
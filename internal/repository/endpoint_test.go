@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointRepository_ReplaceEndpoints(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewEndpointRepository(mock)
+	assetID := uuid.New()
+
+	endpoints := []StreamingEndpoint{
+		{Protocol: ProtocolHLS, ManifestPath: "uploads/vod/a/master.m3u8", Resolution: "adaptive"},
+		{Protocol: ProtocolDASH, ManifestPath: "uploads/vod/a/manifest.mpd", Resolution: "adaptive"},
+	}
+
+	// Старые манифесты удаляются и новые вставляются одним запросом
+	mock.ExpectQuery(`WITH asset AS \(.+storage_path = \$5\s+\), cleared AS \(\s+DELETE FROM streaming_endpoints.+INSERT INTO streaming_endpoints`).
+		WithArgs(assetID,
+			[]string{ProtocolHLS, ProtocolDASH},
+			[]string{"uploads/vod/a/master.m3u8", "uploads/vod/a/manifest.mpd"},
+			[]string{"adaptive", "adaptive"},
+			"a.mp4").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "protocol", "manifest_path"}).
+			AddRow(uuid.New(), ProtocolDASH, "uploads/vod/a/manifest.mpd").
+			AddRow(uuid.New(), ProtocolHLS, "uploads/vod/a/master.m3u8"))
+
+	err = repo.ReplaceEndpoints(context.Background(), assetID, "a.mp4", endpoints)
+
+	assert.NoError(t, err)
+	assert.Equal(t, assetID, endpoints[1].AssetID)
+	assert.NotEqual(t, uuid.Nil, endpoints[0].ID)
+	assert.NotEqual(t, endpoints[0].ID, endpoints[1].ID)
+
+	// Файл актива заменили во время упаковки: манифесты старого файла не пишутся
+	mock.ExpectQuery(`WITH asset AS`).
+		WithArgs(assetID, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), "old.mp4").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "protocol", "manifest_path"}))
+	err = repo.ReplaceEndpoints(context.Background(), assetID, "old.mp4", endpoints)
+	assert.ErrorIs(t, err, ErrSourceChanged)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEndpointRepository_GetByAssetID(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewEndpointRepository(mock)
+	assetID := uuid.New()
+
+	mock.ExpectQuery("SELECT (.+) FROM streaming_endpoints").
+		WithArgs(assetID).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "asset_id", "protocol", "manifest_path", "resolution"}).
+			AddRow(uuid.New(), assetID, ProtocolHLS, "uploads/vod/a/master.m3u8", "adaptive").
+			AddRow(uuid.New(), assetID, ProtocolHLS, "uploads/vod/a/media_0.m3u8", "720p"))
+
+	endpoints, err := repo.GetByAssetID(context.Background(), assetID)
+
+	assert.NoError(t, err)
+	assert.Len(t, endpoints, 2)
+	assert.Equal(t, "720p", endpoints[1].Resolution)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
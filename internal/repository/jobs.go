@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Статусы задач (jobs.status)
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobDead      = "dead" // Исчерпаны попытки или неустранимая ошибка (dead-letter)
+	JobCancelled = "cancelled"
+)
+
+// Типы задач обработки медиа
+const (
+	JobTypePackage   = "package"
+	JobTypeThumbnail = "thumbnail"
+)
+
+var (
+	// ErrNoJobs — в очереди нет задач, готовых к выполнению
+	ErrNoJobs = errors.New("repository: no jobs available")
+	// ErrJobNotFound — задачи с таким ID нет
+	ErrJobNotFound = errors.New("repository: job not found")
+	// ErrJobState — переход недопустим из текущего статуса задачи
+	ErrJobState = errors.New("repository: job is in wrong state")
+	// ErrJobLost — задача больше не принадлежит воркеру: отменена или забрана другим после истечения lease
+	ErrJobLost = errors.New("repository: job is no longer held by this worker")
+)
+
+// Job представляет запись в таблице jobs
+type Job struct {
+	ID          uuid.UUID              `json:"id"`
+	Type        string                 `json:"type"`
+	AssetID     uuid.UUID              `json:"asset_id"`
+	Payload     map[string]interface{} `json:"payload"`
+	Status      string                 `json:"status"`
+	Attempts    int                    `json:"attempts"`
+	MaxAttempts int                    `json:"max_attempts"`
+	LastError   string                 `json:"last_error,omitempty"`
+	RunAt       time.Time              `json:"run_at"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// JobFilter — параметры выборки для админки; пустые поля не фильтруют
+type JobFilter struct {
+	Status  string
+	AssetID uuid.UUID
+	Limit   int
+}
+
+// jobColumns — порядок колонок, который ожидает scanJob
+const jobColumns = `id, type, asset_id, payload, status, attempts, max_attempts, COALESCE(last_error, ''), run_at, created_at, updated_at`
+
+// JobRepository — очередь задач поверх Postgres.
+// Конкурентные воркеры забирают задачи через FOR UPDATE SKIP LOCKED и не блокируют друг друга.
+type JobRepository struct {
+	db DBTX
+}
+
+// NewJobRepository создает новый экземпляр репозитория
+func NewJobRepository(db DBTX) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+// Enqueue ставит задачу в очередь. MaxAttempts = 0 означает значение по умолчанию из схемы.
+func (r *JobRepository) Enqueue(ctx context.Context, job *Job) error {
+	if job.Payload == nil {
+		job.Payload = map[string]interface{}{}
+	}
+	query := `
+		INSERT INTO jobs (type, asset_id, payload, max_attempts)
+		VALUES ($1, $2, $3, COALESCE(NULLIF($4, 0), 5))
+		RETURNING id, status, max_attempts, run_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, job.Type, job.AssetID, job.Payload, job.MaxAttempts).
+		Scan(&job.ID, &job.Status, &job.MaxAttempts, &job.RunAt, &job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("repository: failed to enqueue job: %w", err)
+	}
+	return nil
+}
+
+// Claim забирает следующую готовую задачу и переводит ее в running.
+// Задачи, которые висят в running дольше lease (воркер упал), забираются повторно,
+// если у них остались попытки; остальные уводит в dead ReapExpired.
+func (r *JobRepository) Claim(ctx context.Context, workerID string, lease time.Duration) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = NOW(), locked_by = $1, updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = 'pending' AND run_at <= NOW())
+			   OR (status = 'running' AND locked_at < NOW() - $2 * INTERVAL '1 second' AND attempts < max_attempts)
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(r.db.QueryRow(ctx, query, workerID, int64(lease.Seconds())))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoJobs
+		}
+		return nil, fmt.Errorf("repository: failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// ReapExpired переводит в dead брошенные running-задачи (старше lease), у которых кончились попытки:
+// задача, которая раз за разом роняет воркер (OOM в ffmpeg), не должна крутиться вечно.
+// Возвращает активы этих задач, чтобы воркер пересчитал их статус.
+func (r *JobRepository) ReapExpired(ctx context.Context, lease time.Duration) ([]uuid.UUID, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'dead', last_error = 'lease expired on the last attempt (worker ' || COALESCE(locked_by, '?') || ' lost the job)',
+		    locked_at = NULL, locked_by = NULL, updated_at = NOW()
+		WHERE status = 'running' AND locked_at < NOW() - $1 * INTERVAL '1 second' AND attempts >= max_attempts
+		RETURNING asset_id
+	`
+	rows, err := r.db.Query(ctx, query, int64(lease.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to reap expired jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var assets []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		assets = append(assets, id)
+	}
+	return assets, rows.Err()
+}
+
+// Complete отмечает задачу выполненной. Отмененная во время выполнения задача остается cancelled,
+// а задача, которую после истечения lease забрал другой воркер, остается за ним — тогда ErrJobLost.
+func (r *JobRepository) Complete(ctx context.Context, id uuid.UUID, workerID string) error {
+	query := `
+		UPDATE jobs
+		SET status = 'done', last_error = NULL, locked_at = NULL, locked_by = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND locked_by = $2
+	`
+	tag, err := r.db.Exec(ctx, query, id, workerID)
+	if err != nil {
+		return fmt.Errorf("repository: failed to complete job: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrJobLost
+	}
+	return nil
+}
+
+// Fail записывает ошибку и возвращает задачу в очередь через retryIn.
+// Если попытки исчерпаны или permanent = true, задача уходит в dead. Возвращает новый статус.
+// Задача, которая больше не принадлежит workerID (отменена или забрана другим воркером), не меняется.
+func (r *JobRepository) Fail(ctx context.Context, id uuid.UUID, workerID, reason string, retryIn time.Duration, permanent bool) (string, error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN $5 OR attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+		    run_at = NOW() + $4 * INTERVAL '1 millisecond',
+		    last_error = $3, locked_at = NULL, locked_by = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND locked_by = $2
+		RETURNING status
+	`
+
+	var status string
+	err := r.db.QueryRow(ctx, query, id, workerID, reason, retryIn.Milliseconds(), permanent).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Задачу отменили или, после истечения lease, забрал другой воркер: результат этой попытки не нужен
+			return JobCancelled, nil
+		}
+		return "", fmt.Errorf("repository: failed to record job failure: %w", err)
+	}
+	return status, nil
+}
+
+// Retry возвращает в очередь задачу из dead или cancelled со сброшенным счетчиком попыток
+func (r *JobRepository) Retry(ctx context.Context, id uuid.UUID) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status IN ('dead', 'cancelled')
+		RETURNING ` + jobColumns
+	return r.transition(ctx, id, query)
+}
+
+// Cancel снимает задачу из pending или running. Выполняющийся обработчик не прерывается,
+// но его результат уже не изменит статус задачи.
+func (r *JobRepository) Cancel(ctx context.Context, id uuid.UUID) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'cancelled', locked_at = NULL, locked_by = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'running')
+		RETURNING ` + jobColumns
+	return r.transition(ctx, id, query)
+}
+
+// CancelAssetJobs снимает все незавершенные и мертвые задачи актива (файл заменен или удален):
+// их результат больше не нужен, а мертвые не должны перевести новую версию в failed.
+func (r *JobRepository) CancelAssetJobs(ctx context.Context, assetID uuid.UUID) (int64, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'cancelled', locked_at = NULL, locked_by = NULL, updated_at = NOW()
+		WHERE asset_id = $1 AND status IN ('pending', 'running', 'dead')
+	`
+	tag, err := r.db.Exec(ctx, query, assetID)
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to cancel asset jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// transition выполняет смену статуса и отличает "нет задачи" от "недопустимый переход"
+func (r *JobRepository) transition(ctx context.Context, id uuid.UUID, query string) (*Job, error) {
+	job, err := scanJob(r.db.QueryRow(ctx, query, id))
+	if err == nil {
+		return job, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("repository: failed to update job: %w", err)
+	}
+
+	var status string
+	err = r.db.QueryRow(ctx, `SELECT status FROM jobs WHERE id = $1`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch job: %w", err)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrJobState, status)
+}
+
+// List возвращает задачи для админки, новые сверху
+func (r *JobRepository) List(ctx context.Context, f JobFilter) ([]Job, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.Status != "" {
+		args = append(args, f.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.AssetID != uuid.Nil {
+		args = append(args, f.AssetID)
+		where = append(where, fmt.Sprintf("asset_id = $%d", len(args)))
+	}
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 100
+	}
+	args = append(args, f.Limit)
+
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// AssetJobStats считает незавершенные (pending/running) и мертвые задачи актива.
+// По ним воркер решает, пора ли переводить актив в ready или failed.
+func (r *JobRepository) AssetJobStats(ctx context.Context, assetID uuid.UUID) (active int, dead int, err error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE status IN ('pending', 'running')),
+			COUNT(*) FILTER (WHERE status = 'dead')
+		FROM jobs
+		WHERE asset_id = $1
+	`
+	if err := r.db.QueryRow(ctx, query, assetID).Scan(&active, &dead); err != nil {
+		return 0, 0, fmt.Errorf("repository: failed to count asset jobs: %w", err)
+	}
+	return active, dead, nil
+}
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var j Job
+	err := row.Scan(&j.ID, &j.Type, &j.AssetID, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+		&j.LastError, &j.RunAt, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
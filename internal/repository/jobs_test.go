@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobRepository_Enqueue(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewJobRepository(mock)
+	job := &Job{
+		Type:    JobTypePackage,
+		AssetID: uuid.New(),
+		Payload: map[string]interface{}{"storage_key": "1.mp4"},
+	}
+
+	mock.ExpectQuery("INSERT INTO jobs").
+		WithArgs(job.Type, job.AssetID, job.Payload, 0).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "status", "max_attempts", "run_at", "created_at"}).
+			AddRow(uuid.New(), JobPending, 5, time.Now(), time.Now()))
+
+	err = repo.Enqueue(context.Background(), job)
+
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, job.Status)
+	assert.Equal(t, 5, job.MaxAttempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRepository_Claim(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewJobRepository(mock)
+
+	// Пустая очередь — не ошибка, а ErrNoJobs
+	mock.ExpectQuery("UPDATE jobs").
+		WithArgs("worker-1", int64(60)).
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err = repo.Claim(context.Background(), "worker-1", time.Minute)
+
+	assert.ErrorIs(t, err, ErrNoJobs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRepository_ReapExpired(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewJobRepository(mock)
+	assetID := uuid.New()
+
+	// Брошенная задача без оставшихся попыток не забирается снова, а уходит в dead
+	mock.ExpectQuery(`SET status = 'dead'.+attempts >= max_attempts`).
+		WithArgs(int64(60)).
+		WillReturnRows(pgxmock.NewRows([]string{"asset_id"}).AddRow(assetID))
+
+	assets, err := repo.ReapExpired(context.Background(), time.Minute)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{assetID}, assets)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRepository_Fail(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewJobRepository(mock)
+	id := uuid.New()
+
+	mock.ExpectQuery(`UPDATE jobs.+locked_by = \$2`).
+		WithArgs(id, "worker-1", "ffmpeg crashed", int64(20000), false).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(JobPending))
+
+	status, err := repo.Fail(context.Background(), id, "worker-1", "ffmpeg crashed", 20*time.Second, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+
+	// Пока воркер думал, lease истек и задачу забрал другой: чужую попытку не трогаем
+	mock.ExpectQuery("UPDATE jobs").
+		WithArgs(id, "worker-1", "ffmpeg crashed", int64(20000), false).
+		WillReturnError(pgx.ErrNoRows)
+
+	status, err = repo.Fail(context.Background(), id, "worker-1", "ffmpeg crashed", 20*time.Second, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, JobCancelled, status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRepository_CompleteLost(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewJobRepository(mock)
+	id := uuid.New()
+
+	mock.ExpectExec("SET status = 'done'").WithArgs(id, "worker-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	assert.NoError(t, repo.Complete(context.Background(), id, "worker-1"))
+
+	// Задачу отменили или забрал другой воркер: ни одна строка не изменилась
+	mock.ExpectExec("SET status = 'done'").WithArgs(id, "worker-1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	assert.ErrorIs(t, repo.Complete(context.Background(), id, "worker-1"), ErrJobLost)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRepository_RetryWrongState(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewJobRepository(mock)
+	id := uuid.New()
+
+	// Выполняющуюся задачу перезапустить нельзя
+	mock.ExpectQuery("UPDATE jobs").WithArgs(id).WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery("SELECT status FROM jobs").WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(JobRunning))
+
+	_, err = repo.Retry(context.Background(), id)
+
+	assert.ErrorIs(t, err, ErrJobState)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRepository_CancelAssetJobs(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewJobRepository(mock)
+	assetID := uuid.New()
+
+	// Мертвые задачи тоже снимаются: иначе новая версия файла сразу станет failed
+	mock.ExpectExec(`status IN \('pending', 'running', 'dead'\)`).WithArgs(assetID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 3))
+
+	n, err := repo.CancelAssetJobs(context.Background(), assetID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,13 +2,32 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// Видимость актива (media_assets.visibility)
+const (
+	VisibilityPrivate  = "private"  // Владелец и пользователи из asset_shares
+	VisibilityUnlisted = "unlisted" // Любой, кто знает UUID; в чужих списках не показывается
+	VisibilityPublic   = "public"
+)
+
+var (
+	// ErrAssetNotFound — актива нет или он скрыт от зрителя (наружу это неразличимо)
+	ErrAssetNotFound = errors.New("repository: asset not found")
+	// ErrUnknownUser — в списке доступа есть несуществующий пользователь
+	ErrUnknownUser = errors.New("repository: unknown user")
+)
+
 // MediaAsset представляет структуру записи в таблице media_assets
 type MediaAsset struct {
 	ID          uuid.UUID              `json:"id"`
@@ -17,7 +36,35 @@ type MediaAsset struct {
 	Description string                 `json:"description"`
 	Status      string                 `json:"status"`
 	StoragePath string                 `json:"storage_path"`
+	Duration    int                    `json:"duration"` // Секунды (media_assets.duration)
 	Metadata    map[string]interface{} `json:"metadata"` // JSONB передается как map, и pgx сам конвертирует его в JSON для Postgres.
+	Visibility  string                 `json:"visibility"`
+	SharedWith  []uuid.UUID            `json:"shared_with,omitempty"` // Список доступа (asset_shares); видят только владелец и администратор
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	DeletedAt   *time.Time             `json:"deleted_at,omitempty"` // В корзине с этого момента
+	Checksum    string                 `json:"checksum,omitempty"`   // SHA-256 исходника (hex); пусто у загруженных до дедупликации
+}
+
+// ValidVisibility проверяет значение видимости
+func ValidVisibility(v string) bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
+// Viewer — тот, кто запрашивает активы. Пустой UserID — анонимный зритель.
+type Viewer struct {
+	UserID uuid.UUID
+	Role   string
+}
+
+// SeesAll — администраторы и модераторы видят все активы
+func (v Viewer) SeesAll() bool {
+	return v.Role == RoleAdmin || v.Role == RoleModerator
+}
+
+// CanManage — менять доступ к активу может владелец или администратор
+func (v Viewer) CanManage(a *MediaAsset) bool {
+	return v.Role == RoleAdmin || (v.UserID != uuid.Nil && v.UserID == a.OwnerID)
 }
 
 // MediaRepository предоставляет методы для работы с БД
@@ -43,11 +90,15 @@ func NewMediaRepository(db DBTX) *MediaRepository {
 // SaveAsset сохраняет метаданные видео в базу данных
 func (r *MediaRepository) SaveAsset(ctx context.Context, asset *MediaAsset) error {
 	query := `
-		INSERT INTO media_assets (owner_id, title, description, storage_path, status, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO media_assets (owner_id, title, description, storage_path, status, duration, metadata, visibility, checksum)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
 		RETURNING id, created_at
 	`
 
+	if asset.Visibility == "" {
+		asset.Visibility = VisibilityPrivate
+	}
+
 	// Выполняем запрос с использованием пула соединений
 	err := r.db.QueryRow(ctx, query,
 		asset.OwnerID,
@@ -55,7 +106,10 @@ func (r *MediaRepository) SaveAsset(ctx context.Context, asset *MediaAsset) erro
 		asset.Description,
 		asset.StoragePath,
 		asset.Status,
+		asset.Duration,
 		asset.Metadata,
+		asset.Visibility,
+		asset.Checksum,
 	).Scan(&asset.ID, nil) // Получаем сгенерированный базой UUID обратно
 
 	if err != nil {
@@ -65,52 +119,484 @@ func (r *MediaRepository) SaveAsset(ctx context.Context, asset *MediaAsset) erro
 	return nil
 }
 
-// GetAllAssets возвращает список всех медиа-файлов из базы данных.
-func (r *MediaRepository) GetAllAssets(ctx context.Context) ([]MediaAsset, error) {
-	query := `SELECT id, owner_id, title, description, status, storage_path, metadata FROM media_assets ORDER BY created_at DESC`
+// assetColumns — колонки актива в порядке scanAsset; список доступа собирается подзапросом
+const assetColumns = `id, owner_id, title, description, status, storage_path, COALESCE(duration, 0), metadata, visibility,
+		ARRAY(SELECT s.user_id FROM asset_shares s WHERE s.asset_id = media_assets.id ORDER BY s.created_at),
+		created_at, COALESCE(updated_at, created_at), deleted_at, COALESCE(checksum, '')`
 
-	rows, err := r.db.Query(ctx, query)
+func scanAsset(row pgx.Row) (*MediaAsset, error) {
+	var a MediaAsset
+	err := row.Scan(&a.ID, &a.OwnerID, &a.Title, &a.Description, &a.Status, &a.StoragePath, &a.Duration, &a.Metadata, &a.Visibility, &a.SharedWith,
+		&a.CreatedAt, &a.UpdatedAt, &a.DeletedAt, &a.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// AssetFilter — параметры выборки списка активов; пустые поля не фильтруют
+type AssetFilter struct {
+	OwnerID     uuid.UUID
+	Status      string
+	ContentType string    // metadata.type; "video/*" — по префиксу
+	From        time.Time // created_at >= From
+	To          time.Time // created_at < To
+	Query       string    // Полнотекстовый поиск по названию и описанию (синтаксис websearch: "кот -собака")
+	Cursor      string    // NextCursor предыдущей страницы
+	Limit       int
+}
+
+// AssetPage — страница списка активов
+type AssetPage struct {
+	Items         []MediaAsset `json:"items"`
+	NextCursor    string       `json:"next_cursor,omitempty"` // Пусто — страниц больше нет
+	TotalEstimate int64        `json:"total_estimate"`        // Точное число, если совпадений меньше exactCountLimit
+}
+
+// exactCountLimit — до этой оценки планировщика total считается честным COUNT(*)
+const exactCountLimit = 10000
+
+// ErrInvalidCursor — курсор поврежден или выдан не этим API
+var ErrInvalidCursor = errors.New("repository: invalid cursor")
+
+// ListAssets возвращает страницу активов, видимых зрителю: свои, публичные и расшаренные ему
+// (администраторы и модераторы видят все). Unlisted чужие активы и корзина в список не попадают.
+// Сортировка — новые сверху; страницы листаются курсором (keyset), а не OFFSET.
+func (r *MediaRepository) ListAssets(ctx context.Context, viewer Viewer, f AssetFilter) (*AssetPage, error) {
+	var (
+		where = []string{"deleted_at IS NULL"}
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !viewer.SeesAll() {
+		p := arg(viewer.UserID)
+		where = append(where, `(visibility = 'public' OR owner_id = `+p+
+			` OR EXISTS (SELECT 1 FROM asset_shares s WHERE s.asset_id = media_assets.id AND s.user_id = `+p+`))`)
+	}
+	if f.OwnerID != uuid.Nil {
+		where = append(where, "owner_id = "+arg(f.OwnerID))
+	}
+	if f.Status != "" {
+		where = append(where, "status = "+arg(f.Status))
+	}
+	if prefix, ok := strings.CutSuffix(f.ContentType, "*"); ok {
+		where = append(where, "metadata->>'type' LIKE "+arg(escapeLike(prefix)+"%"))
+	} else if f.ContentType != "" {
+		where = append(where, "metadata->>'type' = "+arg(f.ContentType))
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < "+arg(f.To))
+	}
+	if q := strings.TrimSpace(f.Query); q != "" {
+		where = append(where, "search_vector @@ websearch_to_tsquery('simple', "+arg(q)+")")
+	}
+
+	// Оценка считается без курсора: это размер всей выборки, а не остатка
+	total, err := r.estimateAssets(ctx, where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Cursor != "" {
+		createdAt, id, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, "(created_at, id) < ("+arg(createdAt)+", "+arg(id)+")")
+	}
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+
+	query := `SELECT ` + assetColumns + ` FROM media_assets WHERE ` + strings.Join(where, " AND ")
+	// Берем на одну запись больше: так без COUNT понятно, есть ли следующая страница
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ` + arg(f.Limit+1)
+
+	items, err := r.listAssets(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AssetPage{Items: items, TotalEstimate: total}
+	if len(items) > f.Limit {
+		page.Items = items[:f.Limit]
+		last := page.Items[f.Limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// estimateAssets оценивает размер выборки по плану запроса; небольшие выборки досчитывает точно
+func (r *MediaRepository) estimateAssets(ctx context.Context, where []string, args []interface{}) (int64, error) {
+	from := ` FROM media_assets WHERE ` + strings.Join(where, " AND ")
+
+	var plan []byte
+	if err := r.db.QueryRow(ctx, `EXPLAIN (FORMAT JSON) SELECT 1`+from, args...).Scan(&plan); err != nil {
+		return 0, fmt.Errorf("repository: failed to estimate assets: %w", err)
+	}
+	var explain []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explain); err != nil || len(explain) == 0 {
+		return 0, fmt.Errorf("repository: unexpected explain output: %s", plan)
+	}
+
+	estimate := int64(explain[0].Plan.Rows)
+	if estimate >= exactCountLimit {
+		return estimate, nil
+	}
+	var total int64
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("repository: failed to count assets: %w", err)
+	}
+	return total, nil
+}
+
+func (r *MediaRepository) listAssets(ctx context.Context, query string, args ...interface{}) ([]MediaAsset, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("repository: failed to fetch assets: %w", err)
 	}
 	defer rows.Close()
 
-	var assets []MediaAsset
+	assets := []MediaAsset{}
 	for rows.Next() {
-		var a MediaAsset
-		if err := rows.Scan(&a.ID, &a.OwnerID, &a.Title, &a.Description, &a.Status, &a.StoragePath, &a.Metadata); err != nil {
-			return nil, err
+		a, err := scanAsset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: failed to scan asset: %w", err)
 		}
-		assets = append(assets, a)
+		assets = append(assets, *a)
 	}
-	return assets, nil
+	return assets, rows.Err()
 }
 
-// GetAssetByID находит запись о медиа-активе по его UUID.
-// Используется для получения путей к файлам перед генерацией ссылки в VideoProvider.
+// encodeCursor упаковывает позицию последней записи страницы: "<created_at>_<id>" в base64url
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "_" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	ts, idStr, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return createdAt, id, nil
+}
+
+// escapeLike экранирует спецсимволы LIKE, чтобы "video/_" не совпадал с "video/x"
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// GetAssetByID находит запись о медиа-активе по его UUID без проверки видимости (актив в корзине не найдется).
+// Для выдачи наружу используйте GetVisibleAsset.
 func (r *MediaRepository) GetAssetByID(ctx context.Context, id uuid.UUID) (*MediaAsset, error) {
+	query := `SELECT ` + assetColumns + ` FROM media_assets WHERE id = $1 AND deleted_at IS NULL LIMIT 1`
+
+	asset, err := scanAsset(r.db.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch asset: %w", err)
+	}
+	return asset, nil
+}
+
+// GetVisibleAsset находит актив, если зритель имеет право его смотреть: public и unlisted — всем,
+// private — владельцу и списку доступа. Скрытый актив возвращает ErrAssetNotFound, чтобы не раскрывать его существование.
+func (r *MediaRepository) GetVisibleAsset(ctx context.Context, id uuid.UUID, viewer Viewer) (*MediaAsset, error) {
+	if viewer.SeesAll() {
+		return r.GetAssetByID(ctx, id)
+	}
 	query := `
-		SELECT id, owner_id, title, description, status, storage_path, metadata 
-		FROM media_assets 
-		WHERE id = $1 
+		SELECT ` + assetColumns + `
+		FROM media_assets
+		WHERE id = $1
+		  AND deleted_at IS NULL
+		  AND (visibility IN ('public', 'unlisted')
+		   OR owner_id = $2
+		   OR EXISTS (SELECT 1 FROM asset_shares s WHERE s.asset_id = media_assets.id AND s.user_id = $2))
 		LIMIT 1
 	`
 
-	var asset MediaAsset
-	// Выполняем запрос через пул соединений pgx
-	err := r.db.QueryRow(ctx, query, id).Scan(
-		&asset.ID,
-		&asset.OwnerID,
-		&asset.Title,
-		&asset.Description,
-		&asset.Status,
-		&asset.StoragePath,
-		&asset.Metadata,
-	)
+	asset, err := scanAsset(r.db.QueryRow(ctx, query, id, viewer.UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch asset: %w", err)
+	}
+	return asset, nil
+}
+
+// SetAccess меняет видимость актива и заменяет список доступа целиком (одним запросом, без транзакции)
+func (r *MediaRepository) SetAccess(ctx context.Context, id uuid.UUID, visibility string, sharedWith []uuid.UUID) error {
+	if !ValidVisibility(visibility) {
+		return fmt.Errorf("repository: invalid visibility %q", visibility)
+	}
+	if sharedWith == nil {
+		sharedWith = []uuid.UUID{}
+	}
+
+	query := `
+		WITH asset AS (
+			UPDATE media_assets SET visibility = $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING id
+		), removed AS (
+			DELETE FROM asset_shares WHERE asset_id IN (SELECT id FROM asset) AND user_id <> ALL($3::uuid[])
+		)
+		INSERT INTO asset_shares (asset_id, user_id)
+		SELECT asset.id, u.user_id FROM asset, unnest($3::uuid[]) AS u(user_id)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := r.db.Exec(ctx, query, id, visibility, sharedWith); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+			return ErrUnknownUser
+		}
+		return fmt.Errorf("repository: failed to update asset access: %w", err)
+	}
+	return nil
+}
+
+// AssetPatch — частичное обновление актива; nil-поля не меняются
+type AssetPatch struct {
+	Title       *string
+	Description *string
+	Custom      map[string]interface{} // Пользовательские поля: дописываются в metadata.custom (JSONB ||)
+}
+
+// UpdateAsset применяет патч и возвращает актив в новом состоянии.
+// Системные ключи metadata (size, type, duration, thumbnail, audio_path...) пишет только сервер:
+// по ним считаются квоты, работают fsck и плеер. Пользовательские поля живут в metadata.custom.
+func (r *MediaRepository) UpdateAsset(ctx context.Context, id uuid.UUID, patch AssetPatch) (*MediaAsset, error) {
+	query := `
+		UPDATE media_assets
+		SET title = COALESCE($2, title),
+		    description = COALESCE($3, description),
+		    metadata = CASE WHEN $4::jsonb IS NULL THEN metadata ELSE jsonb_set(
+		        COALESCE(metadata, '{}'), '{custom}',
+		        CASE WHEN jsonb_typeof(metadata->'custom') = 'object' THEN metadata->'custom' ELSE '{}' END || $4::jsonb
+		    ) END,
+		    updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + assetColumns
+
+	var custom interface{}
+	if len(patch.Custom) > 0 {
+		custom = patch.Custom
+	}
+
+	asset, err := scanAsset(r.db.QueryRow(ctx, query, id, patch.Title, patch.Description, custom))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to update asset: %w", err)
+	}
+	return asset, nil
+}
+
+// ReplaceSource подменяет исходный файл актива: новый ключ, контрольная сумма, длительность и параметры контейнера.
+// Манифесты старой версии удаляются тем же запросом, актив возвращается в processing.
+// Возвращает ключ прежнего файла, чтобы вызывающий освободил его (ReleaseBlob).
+func (r *MediaRepository) ReplaceSource(ctx context.Context, id uuid.UUID, storagePath, checksum string, duration int, metadata map[string]interface{}) (string, error) {
+	query := `
+		WITH old AS (
+			SELECT id, storage_path FROM media_assets WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		), endpoints AS (
+			DELETE FROM streaming_endpoints WHERE asset_id IN (SELECT id FROM old)
+		)
+		UPDATE media_assets m
+		SET storage_path = $2,
+		    duration = $3,
+		    metadata = COALESCE(m.metadata, '{}') || $4,
+		    checksum = NULLIF($5, ''),
+		    status = 'processing',
+		    updated_at = NOW()
+		FROM old
+		WHERE m.id = old.id
+		RETURNING old.storage_path
+	`
+
+	var oldPath string
+	err := r.db.QueryRow(ctx, query, id, storagePath, duration, metadata, checksum).Scan(&oldPath)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrAssetNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("repository: failed to replace asset source: %w", err)
+	}
+	return oldPath, nil
+}
+
+// TrashAsset переносит актив в корзину: он пропадает из всех выборок, файлы и манифесты остаются
+// до окончательной очистки (PurgeAsset)
+func (r *MediaRepository) TrashAsset(ctx context.Context, id uuid.UUID) (*MediaAsset, error) {
+	query := `
+		UPDATE media_assets SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + assetColumns
+	return r.trashTransition(ctx, query, id)
+}
+
+// RestoreAsset достает актив из корзины
+func (r *MediaRepository) RestoreAsset(ctx context.Context, id uuid.UUID) (*MediaAsset, error) {
+	query := `
+		UPDATE media_assets SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING ` + assetColumns
+	return r.trashTransition(ctx, query, id)
+}
+
+// PurgeAsset окончательно удаляет запись актива из корзины. Манифесты, задачи и список доступа
+// удаляются каскадом (ON DELETE CASCADE) в том же запросе. Возвращает удаленную запись:
+// по ней вызывающий чистит хранилище.
+func (r *MediaRepository) PurgeAsset(ctx context.Context, id uuid.UUID) (*MediaAsset, error) {
+	query := `DELETE FROM media_assets WHERE id = $1 AND deleted_at IS NOT NULL RETURNING ` + assetColumns
+	return r.trashTransition(ctx, query, id)
+}
 
+func (r *MediaRepository) trashTransition(ctx context.Context, query string, id uuid.UUID) (*MediaAsset, error) {
+	asset, err := scanAsset(r.db.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAssetNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("repository: asset not found: %w", err)
+		return nil, fmt.Errorf("repository: failed to update trash: %w", err)
+	}
+	return asset, nil
+}
+
+// ListTrash возвращает корзину, недавно удаленные сверху
+func (r *MediaRepository) ListTrash(ctx context.Context, limit int) ([]MediaAsset, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
 	}
+	query := `SELECT ` + assetColumns + ` FROM media_assets WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC LIMIT $1`
+	return r.listAssets(ctx, query, limit)
+}
 
-	return &asset, nil
+// ExpiredTrash возвращает активы, лежащие в корзине с момента раньше before (старые первыми)
+func (r *MediaRepository) ExpiredTrash(ctx context.Context, before time.Time, limit int) ([]MediaAsset, error) {
+	query := `
+		SELECT ` + assetColumns + `
+		FROM media_assets
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		ORDER BY deleted_at
+		LIMIT $2
+	`
+	return r.listAssets(ctx, query, before, limit)
+}
+
+// UpdateStatus переводит актив по жизненному циклу processing -> ready/failed
+func (r *MediaRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
+	query := `UPDATE media_assets SET status = $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.Exec(ctx, query, id, status); err != nil {
+		return fmt.Errorf("repository: failed to update asset status: %w", err)
+	}
+	return nil
+}
+
+// MergeMetadata дописывает ключи в metadata актива, не затирая остальные (JSONB ||)
+func (r *MediaRepository) MergeMetadata(ctx context.Context, id uuid.UUID, patch map[string]interface{}) error {
+	query := `UPDATE media_assets SET metadata = COALESCE(metadata, '{}') || $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.Exec(ctx, query, id, patch); err != nil {
+		return fmt.Errorf("repository: failed to update asset metadata: %w", err)
+	}
+	return nil
+}
+
+// metadataSize — metadata.size в байтах; NULL, если размер не записан или записан не числом
+const metadataSize = `CASE WHEN jsonb_typeof(metadata->'size') = 'number' THEN (metadata->>'size')::numeric::bigint END`
+
+// AssetUsage — сколько места занимают исходники владельца (по metadata.size)
+type AssetUsage struct {
+	Assets          int   `json:"assets"`
+	Bytes           int64 `json:"used_bytes"`
+	TrashAssets     int   `json:"trash_assets"`
+	TrashBytes      int64 `json:"trash_bytes"`
+	QuarantineBytes int64 `json:"quarantine_bytes"` // Отвергнутые загрузки, ждущие решения админа
+}
+
+// OwnerUsage считает активы и байты владельца: отдельно живые, лежащие в корзине и в карантине
+func (r *MediaRepository) OwnerUsage(ctx context.Context, ownerID uuid.UUID) (AssetUsage, error) {
+	query := `
+		SELECT COUNT(*) FILTER (WHERE deleted_at IS NULL),
+		       COALESCE(SUM(` + metadataSize + `) FILTER (WHERE deleted_at IS NULL), 0)::bigint,
+		       COUNT(*) FILTER (WHERE deleted_at IS NOT NULL),
+		       COALESCE(SUM(` + metadataSize + `) FILTER (WHERE deleted_at IS NOT NULL), 0)::bigint,
+		       (SELECT COALESCE(SUM(size), 0)::bigint FROM quarantined_uploads WHERE owner_id = $1)
+		FROM media_assets
+		WHERE owner_id = $1
+	`
+	var u AssetUsage
+	err := r.db.QueryRow(ctx, query, ownerID).Scan(&u.Assets, &u.Bytes, &u.TrashAssets, &u.TrashBytes, &u.QuarantineBytes)
+	if err != nil {
+		return AssetUsage{}, fmt.Errorf("repository: failed to compute usage: %w", err)
+	}
+	return u, nil
+}
+
+// StorageRef — файлы актива, на которые ссылается запись (для проверки хранилища)
+type StorageRef struct {
+	AssetID     uuid.UUID
+	StoragePath string
+	Status      string
+	AudioPath   string // Отдельная аудиодорожка записи эфира (metadata.audio_path)
+	Thumbnail   string // Превью (metadata.thumbnail)
+	Size        int64  // metadata.size — исходник вместе с аудиодорожкой; -1, если не записан
+	Trashed     bool
+}
+
+// StorageRefs возвращает ссылки на файлы всех активов, включая лежащие в корзине
+func (r *MediaRepository) StorageRefs(ctx context.Context) ([]StorageRef, error) {
+	query := `
+		SELECT id, storage_path, status, COALESCE(` + metadataSize + `, -1),
+		       COALESCE(metadata->>'audio_path', ''), COALESCE(metadata->>'thumbnail', ''),
+		       deleted_at IS NOT NULL
+		FROM media_assets
+	`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to list storage refs: %w", err)
+	}
+	defer rows.Close()
+
+	var refs []StorageRef
+	for rows.Next() {
+		var ref StorageRef
+		if err := rows.Scan(&ref.AssetID, &ref.StoragePath, &ref.Status, &ref.Size, &ref.AudioPath, &ref.Thumbnail, &ref.Trashed); err != nil {
+			return nil, fmt.Errorf("repository: failed to scan storage ref: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to list storage refs: %w", err)
+	}
+	return refs, nil
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -30,11 +31,12 @@ func TestMediaRepository_SaveAsset(t *testing.T) {
 		Description: "Description",
 		StoragePath: "/uploads/test.mp4",
 		Status:      "pending",
+		Duration:    42,
 		Metadata:    map[string]interface{}{"size": 1024},
 	}
 
 	// 3. Настраиваем ожидания (Expectations)
-	// Настраиваем ожидание для ВСЕХ 6 аргументов
+	// Настраиваем ожидание для ВСЕХ 9 аргументов
 	mock.ExpectQuery("INSERT INTO media_assets").
 		WithArgs(
 			asset.OwnerID,     // $1
@@ -42,7 +44,10 @@ func TestMediaRepository_SaveAsset(t *testing.T) {
 			asset.Description, // $3
 			asset.StoragePath, // $4
 			asset.Status,      // $5
-			asset.Metadata,    // $6
+			asset.Duration,    // $6
+			asset.Metadata,    // $7
+			VisibilityPrivate, // $8 — по умолчанию актив приватный
+			asset.Checksum,    // $9 — пустая сумма пишется как NULL
 		).
 		// Возвращаем две колонки: id и created_at (как в RETURNING)
 		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).
@@ -55,3 +60,291 @@ func TestMediaRepository_SaveAsset(t *testing.T) {
 	assert.NoError(t, err)                        //  проверяет, что код не вернул ошибку.
 	assert.NoError(t, mock.ExpectationsWereMet()) // проверяет, что код сделал всё, что обещал сделать с базой данных.
 }
+
+var (
+	assetTestColumns = []string{"id", "owner_id", "title", "description", "status", "storage_path", "duration", "metadata", "visibility", "shared_with", "created_at", "updated_at", "deleted_at", "checksum"}
+	assetTestTime    = time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+)
+
+func TestMediaRepository_ListAssets(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	userID := uuid.New()
+	friendID := uuid.New()
+	secondID := uuid.New()
+	explain := []byte(`[{"Plan": {"Node Type": "Seq Scan", "Plan Rows": 3}}]`)
+
+	// Обычный пользователь: фильтр по видимости, владельцу и списку доступа плюс поиск.
+	// Оценка маленькая, поэтому total досчитывается точно.
+	visible := `\(visibility = 'public' OR owner_id = \$1 OR EXISTS \(SELECT 1 FROM asset_shares s WHERE s.asset_id = media_assets.id AND s.user_id = \$1\)\)`
+	search := ` AND search_vector @@ websearch_to_tsquery\('simple', \$2\)`
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT 1 FROM media_assets WHERE deleted_at IS NULL AND `+visible+search).
+		WithArgs(userID, "кот").
+		WillReturnRows(pgxmock.NewRows([]string{"QUERY PLAN"}).AddRow(explain))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM media_assets WHERE deleted_at IS NULL AND `+visible+search).
+		WithArgs(userID, "кот").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(3)))
+	mock.ExpectQuery(`ORDER BY created_at DESC, id DESC LIMIT \$3`).
+		WithArgs(userID, "кот", 2+1).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns).
+			AddRow(uuid.New(), userID, "Мой кот", "", "ready", "1.mp4", 10, map[string]interface{}{}, VisibilityPrivate, []uuid.UUID{friendID}, assetTestTime, assetTestTime, nil, "").
+			AddRow(secondID, uuid.New(), "Чужой кот", "", "ready", "2.mp4", 10, map[string]interface{}{}, VisibilityPublic, []uuid.UUID{}, assetTestTime, assetTestTime, nil, "").
+			AddRow(uuid.New(), uuid.New(), "Еще кот", "", "ready", "3.mp4", 10, map[string]interface{}{}, VisibilityPublic, []uuid.UUID{}, assetTestTime, assetTestTime, nil, ""))
+
+	page, err := repo.ListAssets(context.Background(), Viewer{UserID: userID, Role: RoleUser}, AssetFilter{Query: "кот", Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), page.TotalEstimate)
+	if assert.Len(t, page.Items, 2) {
+		assert.Equal(t, []uuid.UUID{friendID}, page.Items[0].SharedWith)
+	}
+	assert.NotEmpty(t, page.NextCursor)
+
+	// Модератор видит все; следующая страница продолжает с последней записи
+	bigPlan := []byte(`[{"Plan": {"Plan Rows": 250000}}]`)
+	mock.ExpectQuery(`EXPLAIN \(FORMAT JSON\) SELECT 1 FROM media_assets WHERE deleted_at IS NULL AND metadata->>'type' LIKE \$1$`).
+		WithArgs("video/%").
+		WillReturnRows(pgxmock.NewRows([]string{"QUERY PLAN"}).AddRow(bigPlan))
+	mock.ExpectQuery(`WHERE deleted_at IS NULL AND metadata->>'type' LIKE \$1 AND \(created_at, id\) < \(\$2, \$3\)`).
+		WithArgs("video/%", assetTestTime, secondID, 2+1).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns))
+
+	page, err = repo.ListAssets(context.Background(), Viewer{UserID: uuid.New(), Role: RoleModerator},
+		AssetFilter{ContentType: "video/*", Cursor: page.NextCursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(250000), page.TotalEstimate, "на больших выборках COUNT не выполняется")
+	assert.Empty(t, page.Items)
+	assert.Empty(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_ListAssetsInvalidCursor(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	mock.ExpectQuery(`EXPLAIN`).WillReturnRows(pgxmock.NewRows([]string{"QUERY PLAN"}).
+		AddRow([]byte(`[{"Plan": {"Plan Rows": 20000}}]`)))
+
+	_, err = repo.ListAssets(context.Background(), Viewer{Role: RoleAdmin}, AssetFilter{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestMediaRepository_GetVisibleAsset(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	assetID := uuid.New()
+
+	// Анонимный зритель: приватный актив неотличим от несуществующего
+	mock.ExpectQuery(`visibility IN \('public', 'unlisted'\)`).
+		WithArgs(assetID, uuid.Nil).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns))
+
+	_, err = repo.GetVisibleAsset(context.Background(), assetID, Viewer{})
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+
+	// Администратор получает актив без проверки видимости
+	mock.ExpectQuery(`FROM media_assets WHERE id = \$1 AND deleted_at IS NULL LIMIT 1`).
+		WithArgs(assetID).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns).
+			AddRow(assetID, uuid.New(), "Secret", "", "ready", "2.mp4", 5, map[string]interface{}{}, VisibilityPrivate, []uuid.UUID{}, assetTestTime, assetTestTime, nil, ""))
+
+	asset, err := repo.GetVisibleAsset(context.Background(), assetID, Viewer{UserID: uuid.New(), Role: RoleAdmin})
+	assert.NoError(t, err)
+	assert.Equal(t, "Secret", asset.Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_SetAccess(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	assetID := uuid.New()
+	shared := []uuid.UUID{uuid.New()}
+
+	mock.ExpectExec("UPDATE media_assets SET visibility").
+		WithArgs(assetID, VisibilityUnlisted, shared).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	assert.NoError(t, repo.SetAccess(context.Background(), assetID, VisibilityUnlisted, shared))
+
+	// Несуществующий пользователь в списке доступа — нарушение внешнего ключа
+	mock.ExpectExec("UPDATE media_assets SET visibility").
+		WithArgs(assetID, VisibilityPrivate, []uuid.UUID{}).
+		WillReturnError(&pgconn.PgError{Code: "23503"})
+	assert.ErrorIs(t, repo.SetAccess(context.Background(), assetID, VisibilityPrivate, nil), ErrUnknownUser)
+
+	// Неизвестная видимость не доходит до базы
+	assert.Error(t, repo.SetAccess(context.Background(), assetID, "secret", nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_UpdateAsset(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	assetID := uuid.New()
+	title := "New title"
+	patch := map[string]interface{}{"tags": []string{"demo"}}
+
+	// Описание не передано — COALESCE оставит старое; поля пользователя уходят в metadata.custom
+	mock.ExpectQuery(`UPDATE media_assets\s+SET title = COALESCE\(\$2, title\).+jsonb_set\(\s+COALESCE\(metadata, '\{\}'\), '\{custom\}'`).
+		WithArgs(assetID, &title, (*string)(nil), patch).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns).
+			AddRow(assetID, uuid.New(), title, "old", "ready", "1.mp4", 10, map[string]interface{}{"size": 1024, "custom": map[string]interface{}{"tags": []string{"demo"}}}, VisibilityPublic, []uuid.UUID{}, assetTestTime, assetTestTime, nil, ""))
+
+	asset, err := repo.UpdateAsset(context.Background(), assetID, AssetPatch{Title: &title, Custom: patch})
+	assert.NoError(t, err)
+	assert.Equal(t, "New title", asset.Title)
+	assert.Equal(t, "old", asset.Description)
+
+	mock.ExpectQuery(`UPDATE media_assets`).
+		WithArgs(assetID, (*string)(nil), (*string)(nil), nil).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns))
+
+	_, err = repo.UpdateAsset(context.Background(), assetID, AssetPatch{})
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_ReplaceSource(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	assetID := uuid.New()
+	metadata := map[string]interface{}{"size": 2048}
+
+	// Манифесты старой версии удаляются в том же запросе
+	mock.ExpectQuery(`DELETE FROM streaming_endpoints WHERE asset_id IN \(SELECT id FROM old\)`).
+		WithArgs(assetID, "2.mp4", 20, metadata, "abc123").
+		WillReturnRows(pgxmock.NewRows([]string{"storage_path"}).AddRow("1.mp4"))
+
+	oldKey, err := repo.ReplaceSource(context.Background(), assetID, "2.mp4", "abc123", 20, metadata)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.mp4", oldKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_Trash(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	assetID := uuid.New()
+	deletedAt := assetTestTime.Add(time.Hour)
+	row := func(deleted *time.Time) *pgxmock.Rows {
+		return pgxmock.NewRows(assetTestColumns).
+			AddRow(assetID, uuid.New(), "Gone", "", "ready", "1.mp4", 10, map[string]interface{}{}, VisibilityPrivate, []uuid.UUID{}, assetTestTime, assetTestTime, deleted, "")
+	}
+
+	mock.ExpectQuery(`UPDATE media_assets SET deleted_at = NOW\(\)\s+WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(assetID).
+		WillReturnRows(row(&deletedAt))
+	asset, err := repo.TrashAsset(context.Background(), assetID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, asset.DeletedAt) {
+		assert.Equal(t, deletedAt, *asset.DeletedAt)
+	}
+
+	// Повторное удаление: актив уже в корзине
+	mock.ExpectQuery(`UPDATE media_assets SET deleted_at = NOW\(\)`).
+		WithArgs(assetID).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns))
+	_, err = repo.TrashAsset(context.Background(), assetID)
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+
+	mock.ExpectQuery(`UPDATE media_assets SET deleted_at = NULL\s+WHERE id = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs(assetID).
+		WillReturnRows(row(nil))
+	asset, err = repo.RestoreAsset(context.Background(), assetID)
+	assert.NoError(t, err)
+	assert.Nil(t, asset.DeletedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_PurgeAsset(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	assetID := uuid.New()
+	deletedAt := assetTestTime
+	mock.ExpectQuery(`DELETE FROM media_assets WHERE id = \$1 AND deleted_at IS NOT NULL RETURNING`).
+		WithArgs(assetID).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns).
+			AddRow(assetID, uuid.New(), "Gone", "", "ready", "1.mp4", 10, map[string]interface{}{}, VisibilityPrivate, []uuid.UUID{}, assetTestTime, assetTestTime, &deletedAt, ""))
+
+	asset, err := repo.PurgeAsset(context.Background(), assetID)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.mp4", asset.StoragePath, "по удаленной записи вызывающий чистит хранилище")
+
+	// Актив не в корзине (или уже очищен другим узлом) — не трогаем
+	mock.ExpectQuery(`DELETE FROM media_assets`).
+		WithArgs(assetID).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns))
+	_, err = repo.PurgeAsset(context.Background(), assetID)
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+
+	before := time.Now().Add(-30 * 24 * time.Hour)
+	mock.ExpectQuery(`WHERE deleted_at IS NOT NULL AND deleted_at < \$1\s+ORDER BY deleted_at\s+LIMIT \$2`).
+		WithArgs(before, 100).
+		WillReturnRows(pgxmock.NewRows(assetTestColumns))
+	expired, err := repo.ExpiredTrash(context.Background(), before, 100)
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_StorageRefs(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	live, trashed := uuid.New(), uuid.New()
+	mock.ExpectQuery(`SELECT id, storage_path, status,.+FROM media_assets\s*$`).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "storage_path", "status", "size", "audio_path", "thumbnail", "trashed"}).
+			AddRow(live, "recordings/v.webm", "ready", int64(300), "recordings/a.ogg", "thumbnails/x.jpg", false).
+			AddRow(trashed, "1.mp4", "failed", int64(-1), "", "", true))
+
+	refs, err := repo.StorageRefs(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, refs, 2, "записи из корзины тоже держат свои файлы") {
+		assert.Equal(t, "recordings/a.ogg", refs[0].AudioPath)
+		assert.Equal(t, int64(300), refs[0].Size)
+		assert.True(t, refs[1].Trashed)
+		assert.Equal(t, int64(-1), refs[1].Size)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMediaRepository_OwnerUsage(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewMediaRepository(mock)
+
+	owner := uuid.New()
+	mock.ExpectQuery(`FILTER \(WHERE deleted_at IS NULL\).+FROM quarantined_uploads WHERE owner_id = \$1\)\s+FROM media_assets\s+WHERE owner_id = \$1`).
+		WithArgs(owner).
+		WillReturnRows(pgxmock.NewRows([]string{"assets", "bytes", "trash_assets", "trash_bytes", "quarantine_bytes"}).
+			AddRow(3, int64(1500), 1, int64(200), int64(42)))
+
+	usage, err := repo.OwnerUsage(context.Background(), owner)
+	assert.NoError(t, err)
+	assert.Equal(t, AssetUsage{Assets: 3, Bytes: 1500, TrashAssets: 1, TrashBytes: 200, QuarantineBytes: 42}, usage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrQuarantineNotFound — записи в карантине с таким ID нет (уже разобрана или не было)
+var ErrQuarantineNotFound = errors.New("repository: quarantined upload not found")
+
+// QuarantinedUpload — загрузка, не прошедшая проверку содержимого
+type QuarantinedUpload struct {
+	ID             uuid.UUID         `json:"id"`
+	OwnerID        uuid.UUID         `json:"owner_id"`
+	FilePath       string            `json:"-"` // Имя файла в uploads.quarantine_dir
+	FileName       string            `json:"file_name"`
+	DeclaredType   string            `json:"declared_type"`
+	DetectedFormat string            `json:"detected_format"`
+	Reason         string            `json:"reason"`
+	Size           int64             `json:"size"`
+	Checksum       string            `json:"checksum,omitempty"`
+	Upload         map[string]string `json:"upload"` // title, description, visibility
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// quarantineColumns — порядок колонок, который ожидает scanQuarantined
+const quarantineColumns = `id, owner_id, file_path, file_name, declared_type, detected_format, reason, size, COALESCE(checksum, ''), upload, created_at`
+
+// QuarantineRepository — учет файлов в карантине
+type QuarantineRepository struct {
+	db DBTX
+}
+
+// NewQuarantineRepository создает новый экземпляр репозитория
+func NewQuarantineRepository(db DBTX) *QuarantineRepository {
+	return &QuarantineRepository{db: db}
+}
+
+// Create записывает файл в карантин. Пустой ID генерируется базой.
+func (r *QuarantineRepository) Create(ctx context.Context, q *QuarantinedUpload) error {
+	if q.Upload == nil {
+		q.Upload = map[string]string{}
+	}
+	query := `
+		INSERT INTO quarantined_uploads
+			(id, owner_id, file_path, file_name, declared_type, detected_format, reason, size, checksum, upload)
+		VALUES (COALESCE($1, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+		RETURNING id, created_at
+	`
+	var id *uuid.UUID
+	if q.ID != uuid.Nil {
+		id = &q.ID
+	}
+	err := r.db.QueryRow(ctx, query, id, q.OwnerID, q.FilePath, q.FileName, q.DeclaredType,
+		q.DetectedFormat, q.Reason, q.Size, q.Checksum, q.Upload).Scan(&q.ID, &q.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("repository: failed to quarantine upload: %w", err)
+	}
+	return nil
+}
+
+// List возвращает записи карантина, новые первыми
+func (r *QuarantineRepository) List(ctx context.Context, limit int) ([]QuarantinedUpload, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := `SELECT ` + quarantineColumns + ` FROM quarantined_uploads ORDER BY created_at DESC LIMIT $1`
+
+	rows, err := r.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to list quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	items := []QuarantinedUpload{}
+	for rows.Next() {
+		q, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: failed to scan quarantined upload: %w", err)
+		}
+		items = append(items, *q)
+	}
+	return items, rows.Err()
+}
+
+// Get возвращает запись карантина по ID
+func (r *QuarantineRepository) Get(ctx context.Context, id uuid.UUID) (*QuarantinedUpload, error) {
+	query := `SELECT ` + quarantineColumns + ` FROM quarantined_uploads WHERE id = $1`
+	q, err := scanQuarantined(r.db.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrQuarantineNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch quarantined upload: %w", err)
+	}
+	return q, nil
+}
+
+// Take удаляет запись и возвращает ее. Два админа не смогут разобрать один файл дважды:
+// второй получит ErrQuarantineNotFound.
+func (r *QuarantineRepository) Take(ctx context.Context, id uuid.UUID) (*QuarantinedUpload, error) {
+	query := `DELETE FROM quarantined_uploads WHERE id = $1 RETURNING ` + quarantineColumns
+	q, err := scanQuarantined(r.db.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrQuarantineNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to take quarantined upload: %w", err)
+	}
+	return q, nil
+}
+
+// TakeExpired удаляет и возвращает до limit записей, пролежавших в карантине с момента раньше before.
+// Файлы удаляет вызывающий.
+func (r *QuarantineRepository) TakeExpired(ctx context.Context, before time.Time, limit int) ([]QuarantinedUpload, error) {
+	query := `
+		DELETE FROM quarantined_uploads
+		WHERE id IN (
+			SELECT id FROM quarantined_uploads WHERE created_at < $1 ORDER BY created_at LIMIT $2
+		)
+		RETURNING ` + quarantineColumns
+	rows, err := r.db.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to expire quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	var items []QuarantinedUpload
+	for rows.Next() {
+		q, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: failed to scan quarantined upload: %w", err)
+		}
+		items = append(items, *q)
+	}
+	return items, rows.Err()
+}
+
+func scanQuarantined(row pgx.Row) (*QuarantinedUpload, error) {
+	var q QuarantinedUpload
+	err := row.Scan(&q.ID, &q.OwnerID, &q.FilePath, &q.FileName, &q.DeclaredType, &q.DetectedFormat,
+		&q.Reason, &q.Size, &q.Checksum, &q.Upload, &q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
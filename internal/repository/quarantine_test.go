@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var quarantineTestColumns = []string{"id", "owner_id", "file_path", "file_name", "declared_type",
+	"detected_format", "reason", "size", "checksum", "upload", "created_at"}
+
+func TestQuarantineRepository(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewQuarantineRepository(mock)
+	ctx := context.Background()
+
+	owner, id := uuid.New(), uuid.New()
+	q := &QuarantinedUpload{
+		OwnerID:        owner,
+		FilePath:       "q1.bin",
+		FileName:       "clip.html",
+		DeclaredType:   "text/html",
+		DetectedFormat: "html",
+		Reason:         "dangerous content: html",
+		Size:           42,
+	}
+	mock.ExpectQuery("INSERT INTO quarantined_uploads").
+		WithArgs((*uuid.UUID)(nil), owner, "q1.bin", "clip.html", "text/html", "html",
+			"dangerous content: html", int64(42), "", map[string]string{}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+	assert.NoError(t, repo.Create(ctx, q))
+	assert.Equal(t, id, q.ID)
+
+	mock.ExpectQuery(`SELECT .+ FROM quarantined_uploads ORDER BY created_at DESC`).
+		WithArgs(100).
+		WillReturnRows(pgxmock.NewRows(quarantineTestColumns).
+			AddRow(id, owner, "q1.bin", "clip.html", "text/html", "html", "dangerous content: html",
+				int64(42), "", map[string]string{"title": "Clip"}, time.Now()))
+	items, err := repo.List(ctx, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "Clip", items[0].Upload["title"])
+	}
+
+	// Разобрать запись можно только один раз
+	mock.ExpectQuery(`DELETE FROM quarantined_uploads WHERE id = \$1 RETURNING`).
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows(quarantineTestColumns).
+			AddRow(id, owner, "q1.bin", "clip.html", "text/html", "html", "dangerous content: html",
+				int64(42), "", map[string]string{}, time.Now()))
+	taken, err := repo.Take(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "q1.bin", taken.FilePath)
+
+	mock.ExpectQuery(`DELETE FROM quarantined_uploads`).
+		WithArgs(id).
+		WillReturnError(pgx.ErrNoRows)
+	_, err = repo.Take(ctx, id)
+	assert.ErrorIs(t, err, ErrQuarantineNotFound)
+
+	// Просроченные записи забираются пачкой, старые первыми
+	before := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(`DELETE FROM quarantined_uploads\s+WHERE id IN \(\s+SELECT id FROM quarantined_uploads WHERE created_at < \$1 ORDER BY created_at LIMIT \$2`).
+		WithArgs(before, 50).
+		WillReturnRows(pgxmock.NewRows(quarantineTestColumns).
+			AddRow(id, owner, "q1.bin", "clip.html", "text/html", "html", "dangerous content: html",
+				int64(42), "", map[string]string{}, before.Add(-time.Hour)))
+	expired, err := repo.TakeExpired(ctx, before, 50)
+	assert.NoError(t, err)
+	if assert.Len(t, expired, 1) {
+		assert.Equal(t, "q1.bin", expired[0].FilePath)
+	}
+
+	mock.ExpectQuery(`SELECT .+ FROM quarantined_uploads WHERE id = \$1`).
+		WithArgs(id).
+		WillReturnError(pgx.ErrNoRows)
+	_, err = repo.Get(ctx, id)
+	assert.ErrorIs(t, err, ErrQuarantineNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrStreamKeyNotFound — у пользователя нет активного ключа с таким ID
+	ErrStreamKeyNotFound = errors.New("repository: stream key not found")
+	// ErrStreamKeyInvalid — ключа нет, он отозван или истек
+	ErrStreamKeyInvalid = errors.New("repository: stream key is invalid")
+)
+
+// StreamKey — ключ трансляции. Сам ключ показывается только при создании и ротации.
+type StreamKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Label      string     `json:"label"`
+	Prefix     string     `json:"prefix"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	UseCount   int64      `json:"use_count"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// streamKeyColumns — порядок колонок, который ожидает scanStreamKey
+const streamKeyColumns = `id, user_id, label, prefix, expires_at, revoked_at, rotated_at, last_used_at, COALESCE(last_used_ip, ''), use_count, created_at`
+
+// StreamKeyRepository хранит ключи трансляции (только хеши)
+type StreamKeyRepository struct {
+	db DBTX
+}
+
+// NewStreamKeyRepository создает новый экземпляр репозитория
+func NewStreamKeyRepository(db DBTX) *StreamKeyRepository {
+	return &StreamKeyRepository{db: db}
+}
+
+// Create сохраняет ключ с хешем hash; ID и created_at проставляет база
+func (r *StreamKeyRepository) Create(ctx context.Context, k *StreamKey, hash string) error {
+	query := `
+		INSERT INTO stream_keys (user_id, label, prefix, key_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	if err := r.db.QueryRow(ctx, query, k.UserID, k.Label, k.Prefix, hash, k.ExpiresAt).Scan(&k.ID, &k.CreatedAt); err != nil {
+		return fmt.Errorf("repository: failed to create stream key: %w", err)
+	}
+	return nil
+}
+
+// ListByUser возвращает ключи пользователя, включая отозванные, новые первыми
+func (r *StreamKeyRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]StreamKey, error) {
+	query := `SELECT ` + streamKeyColumns + ` FROM stream_keys WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to list stream keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []StreamKey{}
+	for rows.Next() {
+		k, err := scanStreamKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: failed to scan stream key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// Rotate заменяет секрет активного ключа; метка и срок действия сохраняются, старый секрет сразу перестает работать
+func (r *StreamKeyRepository) Rotate(ctx context.Context, id, userID uuid.UUID, prefix, hash string) (*StreamKey, error) {
+	query := `
+		UPDATE stream_keys
+		SET prefix = $3, key_hash = $4, rotated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		RETURNING ` + streamKeyColumns
+
+	k, err := scanStreamKey(r.db.QueryRow(ctx, query, id, userID, prefix, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrStreamKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to rotate stream key: %w", err)
+	}
+	return k, nil
+}
+
+// Revoke отзывает ключ. Запись остается в списке с revoked_at.
+func (r *StreamKeyRepository) Revoke(ctx context.Context, id, userID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE stream_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return fmt.Errorf("repository: failed to revoke stream key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStreamKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate находит действующий ключ по хешу, отмечает использование (время, IP, счетчик)
+// и возвращает ключ вместе с текущей ролью владельца: смена роли или отключение пользователя
+// сразу действуют и на ключи. Ключ отключенного пользователя отвергается, не отмечаясь использованным.
+func (r *StreamKeyRepository) Authenticate(ctx context.Context, hash, ip string) (*StreamKey, string, error) {
+	query := `
+		UPDATE stream_keys k
+		SET last_used_at = NOW(), last_used_ip = $2, use_count = k.use_count + 1
+		FROM users u
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > NOW())
+		  AND u.id = k.user_id AND u.disabled_at IS NULL
+		RETURNING k.id, k.user_id, k.label, k.prefix, k.expires_at, k.revoked_at, k.rotated_at,
+		          k.last_used_at, COALESCE(k.last_used_ip, ''), k.use_count, k.created_at, u.role
+	`
+	var k StreamKey
+	var role string
+	err := r.db.QueryRow(ctx, query, hash, ip).Scan(&k.ID, &k.UserID, &k.Label, &k.Prefix, &k.ExpiresAt,
+		&k.RevokedAt, &k.RotatedAt, &k.LastUsedAt, &k.LastUsedIP, &k.UseCount, &k.CreatedAt, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", ErrStreamKeyInvalid
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("repository: failed to authenticate stream key: %w", err)
+	}
+	return &k, role, nil
+}
+
+func scanStreamKey(row pgx.Row) (*StreamKey, error) {
+	var k StreamKey
+	err := row.Scan(&k.ID, &k.UserID, &k.Label, &k.Prefix, &k.ExpiresAt, &k.RevokedAt, &k.RotatedAt,
+		&k.LastUsedAt, &k.LastUsedIP, &k.UseCount, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
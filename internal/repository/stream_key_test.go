@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var streamKeyTestColumns = []string{"id", "user_id", "label", "prefix", "expires_at", "revoked_at",
+	"rotated_at", "last_used_at", "last_used_ip", "use_count", "created_at"}
+
+func TestStreamKeyRepository_CreateAndRotate(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewStreamKeyRepository(mock)
+	ctx := context.Background()
+
+	userID, id := uuid.New(), uuid.New()
+	k := &StreamKey{UserID: userID, Label: "OBS", Prefix: "hsk_AbCd1234"}
+	mock.ExpectQuery("INSERT INTO stream_keys").
+		WithArgs(userID, "OBS", "hsk_AbCd1234", "hash1", (*time.Time)(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+	assert.NoError(t, repo.Create(ctx, k, "hash1"))
+	assert.Equal(t, id, k.ID)
+
+	now := time.Now()
+	mock.ExpectQuery(`UPDATE stream_keys\s+SET prefix = \$3, key_hash = \$4`).
+		WithArgs(id, userID, "hsk_Zyxw9876", "hash2").
+		WillReturnRows(pgxmock.NewRows(streamKeyTestColumns).
+			AddRow(id, userID, "OBS", "hsk_Zyxw9876", nil, nil, &now, nil, "", int64(0), now))
+	rotated, err := repo.Rotate(ctx, id, userID, "hsk_Zyxw9876", "hash2")
+	assert.NoError(t, err)
+	assert.Equal(t, "hsk_Zyxw9876", rotated.Prefix)
+	assert.NotNil(t, rotated.RotatedAt)
+
+	// Отозванный или чужой ключ
+	mock.ExpectQuery(`UPDATE stream_keys`).
+		WithArgs(id, userID, "hsk_1", "hash3").
+		WillReturnError(pgx.ErrNoRows)
+	_, err = repo.Rotate(ctx, id, userID, "hsk_1", "hash3")
+	assert.ErrorIs(t, err, ErrStreamKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStreamKeyRepository_Revoke(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewStreamKeyRepository(mock)
+
+	id, userID := uuid.New(), uuid.New()
+	mock.ExpectExec(`UPDATE stream_keys SET revoked_at = NOW\(\)`).
+		WithArgs(id, userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	assert.NoError(t, repo.Revoke(context.Background(), id, userID))
+
+	mock.ExpectExec(`UPDATE stream_keys SET revoked_at`).
+		WithArgs(id, userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	assert.ErrorIs(t, repo.Revoke(context.Background(), id, userID), ErrStreamKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStreamKeyRepository_Authenticate(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewStreamKeyRepository(mock)
+
+	id, userID, now := uuid.New(), uuid.New(), time.Now()
+	// Проверка владельца — в самом UPDATE: ключ отключенного не отмечается использованным
+	mock.ExpectQuery(`SET last_used_at = NOW\(\), last_used_ip = \$2.+FROM users u.+u\.id = k\.user_id AND u\.disabled_at IS NULL\s+RETURNING`).
+		WithArgs("hash", "203.0.113.7").
+		WillReturnRows(pgxmock.NewRows(append(streamKeyTestColumns, "role")).
+			AddRow(id, userID, "OBS", "hsk_AbCd1234", nil, nil, nil, &now, "203.0.113.7", int64(3), now, "streamer"))
+	k, role, err := repo.Authenticate(context.Background(), "hash", "203.0.113.7")
+	assert.NoError(t, err)
+	assert.Equal(t, userID, k.UserID)
+	assert.Equal(t, "streamer", role)
+	assert.Equal(t, int64(3), k.UseCount)
+
+	// Отозван, истек, владелец отключен или ключа нет — одна и та же ошибка
+	mock.ExpectQuery(`UPDATE stream_keys`).
+		WithArgs("other", "203.0.113.7").
+		WillReturnError(pgx.ErrNoRows)
+	_, _, err = repo.Authenticate(context.Background(), "other", "203.0.113.7")
+	assert.ErrorIs(t, err, ErrStreamKeyInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,50 +4,131 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	RoleAdmin     = "admin"
 	RoleModerator = "moderator"
 	RoleUser      = "user"
+	RoleStreamer  = "streamer" // Трансляции (WHIP) и загрузка видео
 )
 
+// Roles — все роли, которые понимает сервер (users_role_check в схеме)
+var Roles = []string{RoleAdmin, RoleModerator, RoleUser, RoleStreamer}
+
+// ValidRole проверяет значение роли
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleModerator || role == RoleUser || role == RoleStreamer
+}
+
+// MinPasswordLength — минимальная длина пароля
+const MinPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,100}$`)
+
+// ValidUsername проверяет логин: 3–100 символов, латиница, цифры, точка, дефис, подчеркивание
+func ValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+// ValidEmail проверяет, что строка — голый адрес (без имени и угловых скобок)
+func ValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= 255
+}
+
+// CheckUser возвращает, что не так с логином, email и ролью (пусто — все в порядке).
+// Общая проверка для API и `hydro user`.
+func CheckUser(username, email, role string) string {
+	switch {
+	case !ValidUsername(username):
+		return "username must be 3-100 characters: latin letters, digits, '.', '_' or '-'"
+	case !ValidEmail(email):
+		return "email is invalid"
+	case !ValidRole(role):
+		return "role must be one of " + strings.Join(Roles, ", ")
+	}
+	return ""
+}
+
+// HashPassword проверяет длину пароля и возвращает bcrypt-хеш для password_hash
+func HashPassword(password string) (string, error) {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("repository: failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Role         string    `db:"role"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"` // Никогда не отдаем хеш в JSON
+	ID           uuid.UUID  `json:"id"`
+	Role         string     `json:"role"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	PasswordHash string     `json:"-"` // Никогда не отдаем хеш в JSON
+	QuotaBytes   *int64     `json:"quota_bytes"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Disabled сообщает, что пользователь отключен
+func (u *User) Disabled() bool { return u.DisabledAt != nil }
+
+var (
+	// ErrUserNotFound — пользователя с таким ID нет
+	ErrUserNotFound = errors.New("repository: user not found")
+	// ErrUserExists — логин или email уже заняты
+	ErrUserExists = errors.New("repository: username or email already taken")
+	// ErrUserHasAssets — у пользователя есть видео: удалить нельзя, только отключить
+	ErrUserHasAssets = errors.New("repository: user owns assets")
+	// ErrWeakPassword — пароль короче MinPasswordLength
+	ErrWeakPassword = fmt.Errorf("repository: password must be at least %d characters", MinPasswordLength)
+)
+
+// userColumns — порядок колонок, который ожидает scanUser
+const userColumns = `id, username, COALESCE(email, ''), password_hash, role, quota_bytes, disabled_at, created_at, updated_at`
+
+// UserFilter — параметры выборки для админки; пустые поля не фильтруют
+type UserFilter struct {
+	Role  string
+	Limit int
+}
+
+// UserPatch — частичное обновление пользователя; nil-поля не меняются
+type UserPatch struct {
+	Username     *string
+	Email        *string
+	PasswordHash *string
+	Role         *string
 }
 
 type UserRepository struct {
-	db *pgxpool.Pool
+	db DBTX
 }
 
-func NewUserRepository(db *pgxpool.Pool) *UserRepository {
+func NewUserRepository(db DBTX) *UserRepository {
 	return &UserRepository{db: db}
 }
 
 // GetByUsername ищет пользователя для проверки пароля
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*User, error) {
-	var u User
-	// Добавляем role в выборку
-	query := `
-		SELECT id, username, password_hash, role 
-		FROM users 
-		WHERE username = $1
-	`
-
-	err := r.db.QueryRow(ctx, query, username).Scan(
-		&u.ID,
-		&u.Username,
-		&u.PasswordHash,
-		&u.Role, // Сканируем роль в структуру
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
 
+	u, err := scanUser(r.db.QueryRow(ctx, query, username))
 	if err != nil {
 		// В 2026 году важно отличать "не нашел" от "ошибка связи"
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -56,5 +137,188 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*U
 		return nil, fmt.Errorf("repository: failed to fetch user: %w", err)
 	}
 
+	return u, nil
+}
+
+// GetByID возвращает пользователя по ID
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+
+	u, err := scanUser(r.db.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch user: %w", err)
+	}
+	return u, nil
+}
+
+// List возвращает пользователей, отсортированных по логину
+func (r *UserRepository) List(ctx context.Context, f UserFilter) ([]User, error) {
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 100
+	}
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE ($1 = '' OR role = $1)
+		ORDER BY username
+		LIMIT $2
+	`
+	rows, err := r.db.Query(ctx, query, f.Role, f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: failed to scan user: %w", err)
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// Create сохраняет пользователя; ID и даты проставляет база. Занятые логин или email — ErrUserExists.
+func (r *UserRepository) Create(ctx context.Context, u *User) error {
+	query := `
+		INSERT INTO users (username, email, password_hash, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + userColumns
+
+	created, err := scanUser(r.db.QueryRow(ctx, query, u.Username, u.Email, u.PasswordHash, u.Role))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+		return fmt.Errorf("repository: failed to create user: %w", err)
+	}
+	*u = *created
+	return nil
+}
+
+// Update применяет патч и возвращает пользователя в новом состоянии
+func (r *UserRepository) Update(ctx context.Context, id uuid.UUID, patch UserPatch) (*User, error) {
+	query := `
+		UPDATE users
+		SET username = COALESCE($2, username),
+		    email = COALESCE($3, email),
+		    password_hash = COALESCE($4, password_hash),
+		    role = COALESCE($5, role)
+		WHERE id = $1
+		RETURNING ` + userColumns
+
+	u, err := scanUser(r.db.QueryRow(ctx, query, id, patch.Username, patch.Email, patch.PasswordHash, patch.Role))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrUserExists
+		}
+		return nil, fmt.Errorf("repository: failed to update user: %w", err)
+	}
+	return u, nil
+}
+
+// SetDisabled отключает пользователя или включает обратно. Повторное отключение не сдвигает disabled_at.
+func (r *UserRepository) SetDisabled(ctx context.Context, id uuid.UUID, disabled bool) (*User, error) {
+	query := `
+		UPDATE users
+		SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END
+		WHERE id = $1
+		RETURNING ` + userColumns
+
+	u, err := scanUser(r.db.QueryRow(ctx, query, id, disabled))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to update user status: %w", err)
+	}
+	return u, nil
+}
+
+// Delete удаляет пользователя без видео. Если видео есть — ErrUserHasAssets: каскад снес бы записи,
+// а файлы остались бы в хранилище без владельца. Таких пользователей отключают.
+func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		WITH target AS (
+			SELECT id, EXISTS (SELECT 1 FROM media_assets WHERE owner_id = $1) AS has_assets
+			FROM users WHERE id = $1
+		), gone AS (
+			DELETE FROM users WHERE id IN (SELECT id FROM target WHERE NOT has_assets)
+		)
+		SELECT has_assets FROM target
+	`
+	var hasAssets bool
+	err := r.db.QueryRow(ctx, query, id).Scan(&hasAssets)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("repository: failed to delete user: %w", err)
+	}
+	if hasAssets {
+		return ErrUserHasAssets
+	}
+	return nil
+}
+
+// GetRole возвращает роль пользователя
+func (r *UserRepository) GetRole(ctx context.Context, id uuid.UUID) (string, error) {
+	var role string
+	err := r.db.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, id).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("repository: failed to fetch role: %w", err)
+	}
+	return role, nil
+}
+
+// GetQuota возвращает персональную квоту пользователя в байтах. nil — действует квота роли.
+func (r *UserRepository) GetQuota(ctx context.Context, id uuid.UUID) (*int64, error) {
+	var quota *int64
+	err := r.db.QueryRow(ctx, `SELECT quota_bytes FROM users WHERE id = $1`, id).Scan(&quota)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to fetch quota: %w", err)
+	}
+	return quota, nil
+}
+
+// SetQuota задает персональную квоту (0 — без ограничений) или, при nil, возвращает квоту роли
+func (r *UserRepository) SetQuota(ctx context.Context, id uuid.UUID, quota *int64) error {
+	tag, err := r.db.Exec(ctx, `UPDATE users SET quota_bytes = $2 WHERE id = $1`, id, quota)
+	if err != nil {
+		return fmt.Errorf("repository: failed to set quota: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func scanUser(row pgx.Row) (*User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.Role, &u.QuotaBytes,
+		&u.DisabledAt, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
 	return &u, nil
 }
+
+// isUniqueViolation — нарушение UNIQUE (логин, email)
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
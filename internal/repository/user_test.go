@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserRepository_Quota(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewUserRepository(mock)
+
+	id := uuid.New()
+	limit := int64(1 << 30)
+	mock.ExpectExec(`UPDATE users SET quota_bytes = \$2 WHERE id = \$1`).
+		WithArgs(id, &limit).
+		WillReturnResult(pgconn.NewCommandTag("UPDATE 1"))
+	assert.NoError(t, repo.SetQuota(context.Background(), id, &limit))
+
+	mock.ExpectQuery(`SELECT quota_bytes FROM users WHERE id = \$1`).
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"quota_bytes"}).AddRow(&limit))
+	quota, err := repo.GetQuota(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, limit, *quota)
+
+	// NULL — квота роли
+	mock.ExpectQuery(`SELECT quota_bytes FROM users`).
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"quota_bytes"}).AddRow(nil))
+	quota, err = repo.GetQuota(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Nil(t, quota)
+
+	mock.ExpectExec(`UPDATE users SET quota_bytes`).
+		WithArgs(id, (*int64)(nil)).
+		WillReturnResult(pgconn.NewCommandTag("UPDATE 0"))
+	assert.ErrorIs(t, repo.SetQuota(context.Background(), id, nil), ErrUserNotFound)
+
+	// Роль нужна квоте записи эфира, где токена уже нет
+	mock.ExpectQuery(`SELECT role FROM users WHERE id = \$1`).
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"role"}).AddRow("streamer"))
+	role, err := repo.GetRole(context.Background(), id)
+	assert.NoError(t, err)
+	assert.Equal(t, "streamer", role)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+var userTestColumns = []string{"id", "username", "email", "password_hash", "role", "quota_bytes",
+	"disabled_at", "created_at", "updated_at"}
+
+func TestUserRepository_CreateAndUpdate(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewUserRepository(mock)
+	ctx := context.Background()
+
+	id, now := uuid.New(), time.Now()
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("alice", "alice@example.com", "hash", RoleStreamer).
+		WillReturnRows(pgxmock.NewRows(userTestColumns).
+			AddRow(id, "alice", "alice@example.com", "hash", RoleStreamer, nil, nil, now, now))
+	u := &User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash", Role: RoleStreamer}
+	assert.NoError(t, repo.Create(ctx, u))
+	assert.Equal(t, id, u.ID)
+
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("alice", "alice@example.com", "hash", RoleStreamer).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	assert.ErrorIs(t, repo.Create(ctx, &User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash", Role: RoleStreamer}), ErrUserExists)
+
+	role := RoleModerator
+	mock.ExpectQuery(`UPDATE users\s+SET username = COALESCE\(\$2, username\)`).
+		WithArgs(id, (*string)(nil), (*string)(nil), (*string)(nil), &role).
+		WillReturnRows(pgxmock.NewRows(userTestColumns).
+			AddRow(id, "alice", "alice@example.com", "hash", RoleModerator, nil, nil, now, now))
+	updated, err := repo.Update(ctx, id, UserPatch{Role: &role})
+	assert.NoError(t, err)
+	assert.Equal(t, RoleModerator, updated.Role)
+
+	mock.ExpectQuery(`SET disabled_at = CASE WHEN \$2`).
+		WithArgs(id, true).
+		WillReturnRows(pgxmock.NewRows(userTestColumns).
+			AddRow(id, "alice", "alice@example.com", "hash", RoleModerator, nil, &now, now, now))
+	disabled, err := repo.SetDisabled(ctx, id, true)
+	assert.NoError(t, err)
+	assert.True(t, disabled.Disabled())
+
+	mock.ExpectQuery(`SELECT .+ FROM users WHERE id = \$1`).
+		WithArgs(id).
+		WillReturnError(pgx.ErrNoRows)
+	_, err = repo.GetByID(ctx, id)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_Delete(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+	repo := NewUserRepository(mock)
+	id := uuid.New()
+
+	mock.ExpectQuery(`DELETE FROM users`).
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"has_assets"}).AddRow(false))
+	assert.NoError(t, repo.Delete(context.Background(), id))
+
+	// С видео удалять нельзя: файлы остались бы без владельца
+	mock.ExpectQuery(`DELETE FROM users`).
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"has_assets"}).AddRow(true))
+	assert.ErrorIs(t, repo.Delete(context.Background(), id), ErrUserHasAssets)
+
+	mock.ExpectQuery(`DELETE FROM users`).
+		WithArgs(id).
+		WillReturnRows(pgxmock.NewRows([]string{"has_assets"}))
+	assert.ErrorIs(t, repo.Delete(context.Background(), id), ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckUser(t *testing.T) {
+	assert.Empty(t, CheckUser("alice.b-1", "alice@example.com", RoleStreamer))
+	assert.Contains(t, CheckUser("al", "alice@example.com", RoleUser), "username")
+	assert.Contains(t, CheckUser("alice bob", "alice@example.com", RoleUser), "username")
+	assert.Contains(t, CheckUser("alice", "Alice <alice@example.com>", RoleUser), "email")
+	assert.Contains(t, CheckUser("alice", "alice@example.com", "root"), "role")
+
+	_, err := HashPassword("short")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	hash, err := HashPassword("long enough")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "long enough", hash)
+}
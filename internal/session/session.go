@@ -0,0 +1,161 @@
+/*
+Package session хранит семейства refresh-токенов в Redis.
+
+Семейство начинается при входе и живет, пока пользователь обновляет токены. В Redis лежит
+только ID семейства, владелец и ID (jti) текущего refresh-токена — сам JWT не хранится.
+Каждое обновление делает текущим новый jti. Если снова предъявлен уже замененный токен,
+значит, его кто-то скопировал: семейство отзывается целиком, и разлогинивает и вора, и владельца.
+
+Исключение — гонка вкладок: прежний токен, предъявленный в течение grace после ротации,
+получает отказ без отзыва семейства (новый токен к этому времени уже в куке браузера).
+
+Семейства пользователя перечислены в множестве refresh_user:<id>: смена пароля или отключение
+учетной записи отзывают их все разом (RevokeUser).
+*/
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrNotFound — семейства нет: истекло, отозвано или выход выполнен
+	ErrNotFound = errors.New("session: not found")
+	// ErrReused — предъявлен уже замененный токен; семейство отозвано
+	ErrReused = errors.New("session: refresh token reuse detected")
+	// ErrRaced — прежний токен в пределах grace (параллельное обновление из другой вкладки)
+	ErrRaced = errors.New("session: refresh token already rotated")
+)
+
+const (
+	// keyPrefix — ключ семейства: refresh_family:<id> -> hash {user, current, previous, rotated_at}
+	keyPrefix = "refresh_family:"
+	// userKeyPrefix — семейства пользователя: refresh_user:<id> -> set {<family id>}
+	userKeyPrefix = "refresh_user:"
+)
+
+// rotateScript атомарно сверяет jti с текущим и либо сдвигает семейство, либо отзывает его.
+// KEYS[1] — семейство, KEYS[2] — семейства пользователя;
+// ARGV: user, jti, новый jti, ttl (мс), сейчас (мс), grace (мс), ID семейства.
+var rotateScript = redis.NewScript(`
+local user = redis.call('HGET', KEYS[1], 'user')
+if not user or user ~= ARGV[1] then
+	return 'missing'
+end
+local current = redis.call('HGET', KEYS[1], 'current')
+if current == ARGV[2] then
+	redis.call('HSET', KEYS[1], 'current', ARGV[3], 'previous', ARGV[2], 'rotated_at', ARGV[5])
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	redis.call('PEXPIRE', KEYS[2], ARGV[4])
+	return 'ok'
+end
+local previous = redis.call('HGET', KEYS[1], 'previous')
+local rotated = tonumber(redis.call('HGET', KEYS[1], 'rotated_at') or '0')
+if previous == ARGV[2] and tonumber(ARGV[5]) - rotated <= tonumber(ARGV[6]) then
+	return 'raced'
+end
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], ARGV[7])
+return 'reused'
+`)
+
+// revokeUserScript удаляет все семейства из множества KEYS[1] и само множество; возвращает,
+// сколько семейств еще было живо. Атомарно, чтобы вход, случившийся одновременно, не уцелел.
+var revokeUserScript = redis.NewScript(`
+local revoked = 0
+for _, family in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	revoked = revoked + redis.call('DEL', ARGV[1] .. family)
+end
+redis.call('DEL', KEYS[1])
+return revoked
+`)
+
+// Store — семейства refresh-токенов
+type Store struct {
+	rdb   redis.Cmdable
+	ttl   time.Duration
+	grace time.Duration
+}
+
+// New создает хранилище. ttl — срок жизни семейства без обновлений (auth.refresh_token_ttl),
+// grace — окно, в котором прежний токен не считается украденным (auth.refresh_reuse_grace).
+func New(rdb redis.Cmdable, ttl, grace time.Duration) *Store {
+	return &Store{rdb: rdb, ttl: ttl, grace: grace}
+}
+
+// Start заводит семейство для нового входа с первым токеном tokenID
+func (s *Store) Start(ctx context.Context, familyID string, userID uuid.UUID, tokenID string) error {
+	key, userKey := keyPrefix+familyID, userKeyPrefix+userID.String()
+	_, err := s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, key, "user", userID.String(), "current", tokenID)
+		p.PExpire(ctx, key, s.ttl)
+		// Множество живет не меньше самого свежего семейства
+		p.SAdd(ctx, userKey, familyID)
+		p.PExpire(ctx, userKey, s.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("session: failed to start family: %w", err)
+	}
+	return nil
+}
+
+// Rotate делает newTokenID текущим, если tokenID — текущий токен семейства пользователя.
+// Замененный токен вне grace — ErrReused (семейство уже удалено), внутри grace — ErrRaced.
+func (s *Store) Rotate(ctx context.Context, familyID string, userID uuid.UUID, tokenID, newTokenID string) error {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	keys := []string{keyPrefix + familyID, userKeyPrefix + userID.String()}
+	res, err := rotateScript.Run(ctx, s.rdb, keys,
+		userID.String(), tokenID, newTokenID, s.ttl.Milliseconds(), now, s.grace.Milliseconds(), familyID).Text()
+	if err != nil {
+		return fmt.Errorf("session: failed to rotate family: %w", err)
+	}
+
+	switch res {
+	case "ok":
+		return nil
+	case "raced":
+		return ErrRaced
+	case "reused":
+		return ErrReused
+	default:
+		return ErrNotFound
+	}
+}
+
+// Revoke удаляет семейство: все его токены перестают обновляться
+func (s *Store) Revoke(ctx context.Context, familyID string) error {
+	key := keyPrefix + familyID
+	user, err := s.rdb.HGet(ctx, key, "user").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("session: failed to revoke family: %w", err)
+	}
+	_, err = s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, key)
+		p.SRem(ctx, userKeyPrefix+user, familyID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("session: failed to revoke family: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser отзывает все семейства пользователя (смена пароля, отключение) и возвращает их число
+func (s *Store) RevokeUser(ctx context.Context, userID uuid.UUID) (int, error) {
+	n, err := revokeUserScript.Run(ctx, s.rdb, []string{userKeyPrefix + userID.String()}, keyPrefix).Int()
+	if err != nil {
+		return 0, fmt.Errorf("session: failed to revoke user sessions: %w", err)
+	}
+	return n, nil
+}
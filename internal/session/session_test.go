@@ -0,0 +1,89 @@
+package session
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStore подключается к HYDRO_TEST_REDIS_ADDR: логика ротации — Lua-скрипт, его проверяет только настоящий Redis
+func newTestStore(t *testing.T, grace time.Duration) *Store {
+	addr := os.Getenv("HYDRO_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("HYDRO_TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = rdb.Close() })
+	require.NoError(t, rdb.Ping(context.Background()).Err())
+	return New(rdb, time.Minute, grace)
+}
+
+func TestStore_RotateAndReuse(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	family, user := uuid.NewString(), uuid.New()
+
+	require.NoError(t, s.Start(ctx, family, user, "t1"))
+	assert.NoError(t, s.Rotate(ctx, family, user, "t1", "t2"))
+	assert.NoError(t, s.Rotate(ctx, family, user, "t2", "t3"))
+
+	// Повтор замененного токена отзывает семейство, и текущий токен тоже перестает работать
+	time.Sleep(5 * time.Millisecond)
+	assert.ErrorIs(t, s.Rotate(ctx, family, user, "t1", "x"), ErrReused)
+	assert.ErrorIs(t, s.Rotate(ctx, family, user, "t3", "t4"), ErrNotFound)
+}
+
+func TestStore_Grace(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, time.Minute)
+	family, user := uuid.NewString(), uuid.New()
+
+	require.NoError(t, s.Start(ctx, family, user, "t1"))
+	require.NoError(t, s.Rotate(ctx, family, user, "t1", "t2"))
+
+	// Соседняя вкладка с прежним токеном: отказ без отзыва
+	assert.ErrorIs(t, s.Rotate(ctx, family, user, "t1", "x"), ErrRaced)
+	assert.NoError(t, s.Rotate(ctx, family, user, "t2", "t3"))
+}
+
+func TestStore_WrongUserAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	family, user := uuid.NewString(), uuid.New()
+
+	require.NoError(t, s.Start(ctx, family, user, "t1"))
+	assert.ErrorIs(t, s.Rotate(ctx, family, uuid.New(), "t1", "t2"), ErrNotFound)
+
+	require.NoError(t, s.Revoke(ctx, family))
+	assert.ErrorIs(t, s.Rotate(ctx, family, user, "t1", "t2"), ErrNotFound)
+}
+
+func TestStore_RevokeUser(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, 0)
+	user, other := uuid.New(), uuid.New()
+	laptop, phone, foreign := uuid.NewString(), uuid.NewString(), uuid.NewString()
+
+	require.NoError(t, s.Start(ctx, laptop, user, "l1"))
+	require.NoError(t, s.Start(ctx, phone, user, "p1"))
+	require.NoError(t, s.Start(ctx, foreign, other, "f1"))
+	require.NoError(t, s.Rotate(ctx, phone, user, "p1", "p2"))
+
+	n, err := s.RevokeUser(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ErrorIs(t, s.Rotate(ctx, laptop, user, "l1", "l2"), ErrNotFound)
+	assert.ErrorIs(t, s.Rotate(ctx, phone, user, "p2", "p3"), ErrNotFound)
+
+	// Чужие семейства не затронуты, повторный отзыв — пустой
+	assert.NoError(t, s.Rotate(ctx, foreign, other, "f1", "f2"))
+	n, err = s.RevokeUser(ctx, user)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"strings"
+)
+
+// blobPrefix — исходники адресуются содержимым: "blobs/<sha256>-<copy><ext>"
+const blobPrefix = "blobs/"
+
+// BlobKey возвращает новый ключ исходника по SHA-256 (hex) и расширению (".mp4").
+// Каждая сохраненная копия получает свой суффикс: удаление освободившейся копии не заденет
+// файл, который параллельная загрузка того же содержимого кладет в хранилище прямо сейчас.
+func BlobKey(checksum, ext string) string {
+	copyID := make([]byte, 6)
+	_, _ = rand.Read(copyID)
+	return blobPrefix + checksum + "-" + hex.EncodeToString(copyID) + strings.ToLower(ext)
+}
+
+// BlobChecksum достает SHA-256 из ключа, построенного BlobKey (в том числе без суффикса копии).
+// Для остальных ключей ok = false.
+func BlobChecksum(key string) (checksum string, ok bool) {
+	name, found := strings.CutPrefix(key, blobPrefix)
+	if !found || strings.Contains(name, "/") {
+		return "", false
+	}
+	sum, _, _ := strings.Cut(strings.TrimSuffix(name, path.Ext(name)), "-")
+	if len(sum) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", false
+	}
+	return sum, true
+}
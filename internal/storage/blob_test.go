@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobKey(t *testing.T) {
+	sum := "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	key := BlobKey(sum, ".MP4")
+	assert.Regexp(t, `^blobs/`+sum+`-[0-9a-f]{12}\.mp4$`, key)
+	assert.NotEqual(t, key, BlobKey(sum, ".mp4"), "у каждой копии свой ключ")
+
+	for _, k := range []string{key, "blobs/" + sum + ".mp4"} {
+		got, ok := BlobChecksum(k)
+		assert.True(t, ok, k)
+		assert.Equal(t, sum, got)
+	}
+
+	for _, k := range []string{"1700000000.mp4", "blobs/short.mp4", "blobs/x/" + sum + ".mp4", "vod/" + sum + ".mp4", "blobs/" + sum[:63] + "z.mp4"} {
+		_, ok := BlobChecksum(k)
+		assert.False(t, ok, k)
+	}
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Помощники для кода, которому нужны настоящие файлы на диске (ffmpeg, запись эфиров, tus).
+
+// PutFile переносит локальный файл в хранилище. Исходный файл после успеха больше не существует:
+// локальное хранилище забирает его переименованием, удаленное — загрузкой и удалением.
+func PutFile(ctx context.Context, b Backend, key, src string) error {
+	if l, ok := b.(*Local); ok {
+		return l.Move(ctx, src, key)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("storage: %w", err)
+	}
+	err = b.Put(ctx, key, f, stat.Size(), ContentType(key))
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Fetch дает путь к объекту на локальном диске. Для локального хранилища это сам файл,
+// для удаленного — копия во временной папке workDir. cleanup удаляет копию (файл хранилища не трогает).
+func Fetch(ctx context.Context, b Backend, key, workDir string) (localPath string, cleanup func(), err error) {
+	if l, ok := b.(*Local); ok {
+		p, err := l.Path(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := os.Stat(p); err != nil {
+			return "", nil, l.mapErr(key, err)
+		}
+		return p, func() {}, nil
+	}
+
+	obj, _, err := b.Get(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { _ = obj.Close() }()
+
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("storage: failed to create work dir: %w", err)
+	}
+	// Расширение сохраняем: по нему ffmpeg и probe угадывают формат
+	tmp, err := os.CreateTemp(workDir, "fetch-*"+path.Ext(key))
+	if err != nil {
+		return "", nil, fmt.Errorf("storage: failed to create temp file: %w", err)
+	}
+	cleanup = func() { _ = os.Remove(tmp.Name()) }
+
+	_, err = io.Copy(tmp, obj)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("storage: failed to download %s: %w", key, err)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// PutDir переносит содержимое папки dir в хранилище под префиксом prefix и удаляет объекты
+// префикса, которых в новой версии нет. Плейлисты (.m3u8, .mpd) публикуются последними,
+// чтобы плеер не получил манифест со ссылками на еще не загруженные сегменты.
+func PutDir(ctx context.Context, b Backend, prefix, dir string) error {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage: failed to read %s: %w", dir, err)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return !isManifest(files[i]) && isManifest(files[j]) })
+
+	old, err := b.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	published := make(map[string]bool, len(files))
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(rel)
+		if err := PutFile(ctx, b, key, f); err != nil {
+			return err
+		}
+		published[key] = true
+	}
+
+	for _, obj := range old {
+		if !published[obj.Key] {
+			if err := b.Delete(ctx, obj.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isManifest(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".m3u8", ".mpd":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tempPrefix — незавершенные записи Put; List их не показывает
+const tempPrefix = ".put-"
+
+// LocalConfig — параметры локального хранилища
+type LocalConfig struct {
+	Root    string // Папка с файлами (video.storage_path)
+	BaseURL string // Префикс роута раздачи ("/api/v1/storage/"), из него строятся ссылки Presign
+}
+
+// Local хранит объекты в папке на диске
+type Local struct {
+	root    string
+	baseURL string
+}
+
+// NewLocal создает хранилище и его корневую папку
+func NewLocal(cfg LocalConfig) (*Local, error) {
+	if cfg.Root == "" {
+		return nil, errors.New("storage: local root is not set")
+	}
+	if err := os.MkdirAll(cfg.Root, 0755); err != nil {
+		return nil, fmt.Errorf("storage: failed to create root: %w", err)
+	}
+	baseURL := cfg.BaseURL
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Local{root: cfg.Root, baseURL: baseURL}, nil
+}
+
+// Root возвращает корневую папку
+func (l *Local) Root() string { return l.root }
+
+// Path возвращает путь к файлу объекта на диске
+func (l *Local) Path(key string) (string, error) {
+	_, p, err := l.resolve(key)
+	return p, err
+}
+
+// resolve нормализует ключ и строит путь к файлу
+func (l *Local) resolve(key string) (string, string, error) {
+	key, err := Key(key)
+	if err != nil {
+		return "", "", err
+	}
+	return key, filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	dst, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("storage: failed to create dir: %w", err)
+	}
+
+	// Пишем во временный файл рядом и подменяем атомарно: читатель не увидит половину файла
+	tmp, err := os.CreateTemp(filepath.Dir(dst), tempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("storage: failed to create file: %w", err)
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("storage: failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// Move переносит готовый файл в хранилище без копирования (если src на той же файловой системе)
+func (l *Local) Move(ctx context.Context, src, key string) error {
+	dst, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("storage: failed to create dir: %w", err)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// Другая файловая система — копируем
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	err = l.Put(ctx, key, f, -1, "")
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (l *Local) Get(_ context.Context, key string) (Object, ObjectInfo, error) {
+	key, p, err := l.resolve(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, ObjectInfo{}, l.mapErr(key, err)
+	}
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		_ = f.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return f, l.info(key, stat), nil
+}
+
+func (l *Local) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	key, p, err := l.resolve(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, l.mapErr(key, err)
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return l.info(key, stat), nil
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	p, err := l.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("storage: failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (l *Local) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	// Обходим только папку, в которой может лежать префикс, а не все хранилище
+	dir := l.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = filepath.Join(l.root, filepath.FromSlash(prefix[:i]))
+	}
+
+	var objects []ObjectInfo
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return nil // Файл удалили во время обхода
+		}
+		objects = append(objects, l.info(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to list %q: %w", prefix, err)
+	}
+	return objects, nil
+}
+
+// Presign для локального хранилища возвращает ссылку на роут раздачи
+func (l *Local) Presign(_ context.Context, key string, _ time.Duration) (string, error) {
+	key, err := Key(key)
+	if err != nil {
+		return "", err
+	}
+	return l.baseURL + (&url.URL{Path: key}).EscapedPath(), nil
+}
+
+func (l *Local) info(key string, stat fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: ContentType(key),
+		ModTime:     stat.ModTime(),
+	}
+}
+
+func (l *Local) mapErr(key string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return fmt.Errorf("storage: %w", err)
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	l, err := NewLocal(LocalConfig{Root: t.TempDir(), BaseURL: "/api/v1/storage"})
+	assert.NoError(t, err)
+	return l
+}
+
+func TestLocal_PutGetStatDelete(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	assert.NoError(t, l.Put(ctx, "vod/1/master.m3u8", strings.NewReader("#EXTM3U"), 7, ""))
+
+	obj, info, err := l.Get(ctx, "vod/1/master.m3u8")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(obj)
+	_ = obj.Close()
+	assert.Equal(t, "#EXTM3U", string(data))
+	assert.Equal(t, int64(7), info.Size)
+	assert.Equal(t, "application/vnd.apple.mpegurl", info.ContentType)
+
+	// Legacy storage_path с префиксом uploads/ указывает на тот же объект
+	info, err = l.Stat(ctx, "uploads/vod/1/master.m3u8")
+	assert.NoError(t, err)
+	assert.Equal(t, "vod/1/master.m3u8", info.Key)
+
+	assert.NoError(t, l.Delete(ctx, "vod/1/master.m3u8"))
+	assert.NoError(t, l.Delete(ctx, "vod/1/master.m3u8"), "повторное удаление — не ошибка")
+	_, err = l.Stat(ctx, "vod/1/master.m3u8")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = l.Get(ctx, "vod/1")
+	assert.ErrorIs(t, err, ErrNotFound, "папка — не объект")
+}
+
+func TestLocal_ListAndPresign(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	for _, key := range []string{"vod/1/a.m4s", "vod/1/master.m3u8", "vod/10/a.m4s", "1.mp4"} {
+		assert.NoError(t, l.Put(ctx, key, strings.NewReader("x"), 1, ""))
+	}
+
+	objects, err := l.List(ctx, "vod/1/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+
+	objects, err = l.List(ctx, "vod/1")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 3, "префикс, а не папка")
+
+	objects, err = l.List(ctx, "missing/")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	u, err := l.Presign(ctx, "uploads/my video.mp4", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/storage/my%20video.mp4", u)
+}
+
+func TestPutFileAndPutDir(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	src := filepath.Join(t.TempDir(), "upload.mp4")
+	assert.NoError(t, os.WriteFile(src, []byte("video"), 0644))
+	assert.NoError(t, PutFile(ctx, l, "1.mp4", src))
+	_, err := os.Stat(src)
+	assert.ErrorIs(t, err, os.ErrNotExist, "файл перенесен, а не скопирован")
+
+	path, cleanup, err := Fetch(ctx, l, "1.mp4", t.TempDir())
+	assert.NoError(t, err)
+	cleanup()
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "video", string(data), "cleanup не трогает файл локального хранилища")
+
+	// Повторная упаковка: устаревший сегмент из прошлой версии удаляется
+	assert.NoError(t, l.Put(ctx, "vod/1/old.m4s", strings.NewReader("x"), 1, ""))
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "master.m3u8"), []byte("#EXTM3U"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "seg.m4s"), []byte("seg"), 0644))
+	assert.NoError(t, PutDir(ctx, l, "vod/1", dir))
+
+	objects, err := l.List(ctx, "vod/1/")
+	assert.NoError(t, err)
+	var keys []string
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	assert.ElementsMatch(t, []string{"vod/1/master.m3u8", "vod/1/seg.m4s"}, keys)
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1.mp4", "1.mp4", false},
+		{"uploads/1.mp4", "1.mp4", false},
+		{"vod//1/./master.m3u8", "vod/1/master.m3u8", false},
+		{`thumbnails\1.jpg`, "thumbnails/1.jpg", false},
+		{"../etc/passwd", "", true},
+		{"vod/../../etc/passwd", "", true},
+		{"/etc/passwd", "", true},
+		{"", "", true},
+		{"uploads/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Key(tt.in)
+		if tt.wantErr {
+			assert.ErrorIs(t, err, ErrInvalidKey, tt.in)
+			continue
+		}
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestInline(t *testing.T) {
+	for _, ct := range []string{"video/mp4", "audio/ogg", "image/jpeg", "application/vnd.apple.mpegurl", "application/dash+xml", "text/vtt; charset=utf-8"} {
+		assert.True(t, Inline(ct), ct)
+	}
+	for _, ct := range []string{"text/html", "image/svg+xml", "application/javascript", "text/xml", "application/octet-stream", ""} {
+		assert.False(t, Inline(ct), ct)
+	}
+	assert.True(t, Inline(ContentType("blobs/abc.mkv")))
+	assert.False(t, Inline(ContentType("evil.html")))
+}
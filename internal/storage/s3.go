@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config — параметры S3-совместимого хранилища
+type S3Config struct {
+	Endpoint     string // host:port без схемы ("s3.amazonaws.com", "minio:9000")
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	UseSSL       bool
+	PathStyle    bool // Адресация bucket в пути (нужна MinIO и большинству self-hosted решений)
+	CreateBucket bool // Создать bucket при старте, если его нет
+}
+
+// S3 хранит объекты в bucket S3-совместимого хранилища
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 подключается к хранилищу и проверяет bucket
+func NewS3(ctx context.Context, cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("storage: s3 endpoint and bucket are required")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to create s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to check bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		if !cfg.CreateBucket {
+			return nil, fmt.Errorf("storage: bucket %s does not exist", cfg.Bucket)
+		}
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("storage: failed to create bucket %s: %w", cfg.Bucket, err)
+		}
+	}
+
+	return &S3{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	key, err := Key(key)
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = ContentType(key)
+	}
+	if _, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType}); err != nil {
+		return fmt.Errorf("storage: failed to put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (Object, ObjectInfo, error) {
+	key, err := Key(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, s.mapErr(key, err)
+	}
+	// GetObject ленивый: реальный запрос (и ошибка NoSuchKey) появляется на Stat
+	stat, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		return nil, ObjectInfo{}, s.mapErr(key, err)
+	}
+	return obj, s.info(stat), nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	key, err := Key(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s.mapErr(key, err)
+	}
+	return s.info(stat), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	key, err := Key(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("storage: failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("storage: failed to list %q: %w", prefix, obj.Err)
+		}
+		objects = append(objects, s.info(obj))
+	}
+	return objects, nil
+}
+
+func (s *S3) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	key, err := Key(key)
+	if err != nil {
+		return "", err
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, ttl, nil)
+	if err != nil {
+		return "", fmt.Errorf("storage: failed to presign %s: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3) info(obj minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:         obj.Key,
+		Size:        obj.Size,
+		ContentType: obj.ContentType,
+		ModTime:     obj.LastModified,
+	}
+}
+
+func (s *S3) mapErr(key string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return fmt.Errorf("storage: failed to read %s: %w", key, err)
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 — минимальный S3 (path-style) в памяти: хватает для PUT/GET/HEAD/DELETE и ListObjectsV2.
+// Подписи не проверяются. Для проверки на настоящем MinIO задайте HYDRO_TEST_S3_ENDPOINT.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			body = decodeAWSChunked(body)
+		}
+		f.objects[key] = fakeObject{data: body, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, key, obj.modTime, bytes.NewReader(obj.data))
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// decodeAWSChunked снимает обертку aws-chunked: "<hex-size>;chunk-signature=...\r\n<data>\r\n" ... "0;..."
+func decodeAWSChunked(body []byte) []byte {
+	var out []byte
+	for len(body) > 0 {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			break
+		}
+		sizeHex, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			break
+		}
+		out = append(out, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+	return out
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+		ETag         string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: f.bucket, Prefix: prefix}
+
+	for key, obj := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{
+				Key:          key,
+				Size:         int64(len(obj.data)),
+				LastModified: obj.modTime.Format(time.RFC3339),
+				ETag:         `"etag"`,
+			})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3(t *testing.T) *S3 {
+	cfg := S3Config{
+		Endpoint:     os.Getenv("HYDRO_TEST_S3_ENDPOINT"),
+		Region:       "us-east-1",
+		Bucket:       "hydro-test",
+		AccessKey:    os.Getenv("HYDRO_TEST_S3_ACCESS_KEY"),
+		SecretKey:    os.Getenv("HYDRO_TEST_S3_SECRET_KEY"),
+		PathStyle:    true,
+		CreateBucket: true,
+	}
+	if cfg.Endpoint == "" {
+		srv := httptest.NewServer(&fakeS3{bucket: cfg.Bucket, objects: map[string]fakeObject{}})
+		t.Cleanup(srv.Close)
+		cfg.Endpoint = strings.TrimPrefix(srv.URL, "http://")
+		cfg.AccessKey, cfg.SecretKey = "test", "test-secret"
+	}
+
+	s, err := NewS3(context.Background(), cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return s
+}
+
+func TestS3_Backend(t *testing.T) {
+	ctx := context.Background()
+	s := newTestS3(t)
+
+	assert.NoError(t, s.Put(ctx, "uploads/vod/s3/master.m3u8", strings.NewReader("#EXTM3U"), 7, ""))
+	assert.NoError(t, s.Put(ctx, "vod/s3/seg_1.m4s", strings.NewReader("segment"), 7, ""))
+
+	info, err := s.Stat(ctx, "vod/s3/master.m3u8")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), info.Size)
+	assert.Equal(t, "application/vnd.apple.mpegurl", info.ContentType)
+
+	obj, _, err := s.Get(ctx, "vod/s3/seg_1.m4s")
+	if assert.NoError(t, err) {
+		// Seek нужен http.ServeContent для Range-запросов
+		_, err = obj.Seek(3, io.SeekStart)
+		assert.NoError(t, err)
+		rest, _ := io.ReadAll(obj)
+		assert.Equal(t, "ment", string(rest))
+		_ = obj.Close()
+	}
+
+	objects, err := s.List(ctx, "vod/s3/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+
+	u, err := s.Presign(ctx, "vod/s3/master.m3u8", time.Minute)
+	assert.NoError(t, err)
+	assert.Contains(t, u, "/hydro-test/vod/s3/master.m3u8?")
+	assert.Contains(t, u, "X-Amz-Signature=")
+
+	// Fetch скачивает копию для ffmpeg
+	path, cleanup, err := Fetch(ctx, s, "vod/s3/seg_1.m4s", t.TempDir())
+	assert.NoError(t, err)
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "segment", string(data))
+	cleanup()
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, o := range objects {
+		assert.NoError(t, s.Delete(ctx, o.Key))
+	}
+	_, err = s.Stat(ctx, "vod/s3/master.m3u8")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = s.Get(ctx, "vod/s3/seg_1.m4s")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,169 @@
+/*
+Package storage абстрагирует хранилище медиафайлов.
+
+Все файлы адресуются ключом — путем относительно корня хранилища ("blobs/<sha256>-<copy>.mp4",
+"vod/<id>/master.m3u8", "thumbnails/<id>.jpg"). Именно ключ лежит в media_assets.storage_path
+и streaming_endpoints.manifest_path. Исходники адресуются содержимым (BlobKey), загруженные
+раньше лежат под "<unixnano>.mp4". Старые записи с префиксом "uploads/" понимает Key.
+
+Реализации: Local (папка video.storage_path) и S3 (любое S3-совместимое хранилище: AWS, MinIO, Ceph).
+*/
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Драйверы хранилища (storage.driver в hydro.yaml)
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// legacyPrefix — префикс storage_path до появления Backend (файлы лежали в web/dist/uploads)
+const legacyPrefix = "uploads/"
+
+var (
+	// ErrNotFound — объекта с таким ключом нет
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrInvalidKey — ключ пустой или выходит за пределы хранилища ("../")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// ObjectInfo — метаданные объекта
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Object — открытый на чтение объект. Поддерживает Seek (нужен http.ServeContent для Range)
+// и ReadAt (нужен probe).
+type Object interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// Backend — контракт хранилища
+type Backend interface {
+	// Put сохраняет объект целиком. size = -1, если размер неизвестен.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект на чтение. Вызывающий обязан закрыть Object.
+	Get(ctx context.Context, key string) (Object, ObjectInfo, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete удаляет объект. Удаление несуществующего объекта — не ошибка.
+	Delete(ctx context.Context, key string) error
+	// List возвращает все объекты, ключ которых начинается с prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Presign возвращает URL, по которому объект можно скачать без авторизации в течение ttl
+	Presign(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// Config — выбор и параметры хранилища
+type Config struct {
+	Driver string
+	Local  LocalConfig
+	S3     S3Config
+}
+
+// New создает хранилище по конфигу
+func New(ctx context.Context, cfg Config, logger *zap.Logger) (Backend, error) {
+	switch cfg.Driver {
+	case "", DriverLocal:
+		b, err := NewLocal(cfg.Local)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("💾 Storage: local filesystem", zap.String("root", b.Root()))
+		return b, nil
+	case DriverS3:
+		b, err := NewS3(ctx, cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("☁️ Storage: S3",
+			zap.String("endpoint", cfg.S3.Endpoint),
+			zap.String("bucket", cfg.S3.Bucket))
+		return b, nil
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", cfg.Driver)
+	}
+}
+
+// Key приводит storage_path к ключу: убирает legacy-префикс "uploads/", лишние слеши и точки.
+// Ключи, выходящие за корень хранилища, отвергаются.
+func Key(storagePath string) (string, error) {
+	p := strings.ReplaceAll(storagePath, "\\", "/")
+	if p == "" || strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, storagePath)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %q", ErrInvalidKey, storagePath)
+		}
+	}
+
+	key := strings.TrimPrefix(path.Clean(p), legacyPrefix)
+	if key == "." || key+"/" == legacyPrefix {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, storagePath)
+	}
+	return key, nil
+}
+
+// ContentType определяет MIME-тип по расширению ключа
+func ContentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if ct, ok := streamingTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// Inline сообщает, можно ли отдавать объект с таким типом для показа в браузере.
+// Все, что браузер способен исполнить (HTML, SVG, скрипты, XML кроме DASH), отдается только вложением.
+func Inline(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "image/"):
+		return true
+	}
+	return inlineTypes[mediaType]
+}
+
+// inlineTypes — не медиа-типы, которые тоже безопасно показывать: манифесты и субтитры
+var inlineTypes = map[string]bool{
+	"application/vnd.apple.mpegurl": true,
+	"application/x-mpegurl":         true,
+	"application/dash+xml":          true,
+	"text/vtt":                      true,
+}
+
+// streamingTypes — типы, которых нет (или которые неверны) в системной mime-таблице
+var streamingTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4s":  "video/iso.segment",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".jpg":  "image/jpeg",
+}
@@ -1,22 +1,39 @@
 package streaming
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/xela07ax/universal-backend-streaming/internal/discovery"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
 	"go.uber.org/zap"
 )
 
 // VideoProvider отвечает за поиск видеофайлов в хранилище
 // и подготовку их к стримингу.
 type VideoProvider struct {
-	// Базовый путь к папке с видео (например, "./web/dist/uploads")
+	// Базовый путь к папке с видео (например, "./uploads")
 	basePath string
 
+	// Хранилище, в котором лежат файлы
+	storage storage.Backend
+	// true — отдавать прямые presigned-ссылки хранилища вместо роута /api/v1/storage/*
+	directURLs bool
+	urlTTL     time.Duration
+
+	// Подпись ссылок (video.signed_urls); без нее роут хранилища открыт всем
+	signer *URLSigner
+	// Абсолютные ссылки на внешний origin (video.scheme://video.host:video.port), например CDN
+	absoluteURLs bool
+	scheme       string
+
 	// Логгер для отслеживания ошибок чтения и доступа
 	logger *zap.Logger
 
@@ -27,7 +44,7 @@ type VideoProvider struct {
 
 // NewVideoProvider создает новый экземпляр VideoProvider.
 // Он разрешает имя сервиса через переданный ServiceDiscovery и подготавливает финальный хост.
-func NewVideoProvider(sd discovery.ServiceDiscovery, logger *zap.Logger) (*VideoProvider, error) {
+func NewVideoProvider(sd discovery.ServiceDiscovery, backend storage.Backend, logger *zap.Logger) (*VideoProvider, error) {
 	// 1. Сразу задаем дефолты из статического конфига
 	host := viper.GetString("video.host")
 	port := viper.GetInt("video.port")
@@ -60,25 +77,110 @@ func NewVideoProvider(sd discovery.ServiceDiscovery, logger *zap.Logger) (*Video
 
 	basePath := viper.GetString("video.storage_path")
 	if basePath == "" {
-		basePath = "./web/dist/uploads"
+		basePath = "./uploads"
 		logger.Warn("video.storage_path not set, using default", zap.String("path", basePath))
 	}
 
+	urlTTL := viper.GetDuration("storage.url_ttl")
+	if urlTTL <= 0 {
+		urlTTL = time.Hour
+	}
+
+	var signer *URLSigner
+	if viper.GetBool("video.signed_urls") {
+		secret := viper.GetString("video.signing_secret")
+		if secret == "" {
+			// Подходит для одного узла; для отдельного origin/CDN секрет нужно задать явно на всех узлах
+			secret = viper.GetString("auth.jwt_secret")
+			logger.Warn("⚠️ video.signing_secret not set, signing playback URLs with auth.jwt_secret")
+		}
+		if secret == "" {
+			// JWT подписываются ключами из auth.keys_dir, а ссылкам нужен общий секрет
+			return nil, fmt.Errorf("streaming: video.signing_secret is required when auth.jwt_secret is not set")
+		}
+		signer = NewURLSigner(secret)
+	} else {
+		logger.Warn("⚠️ video.signed_urls disabled: storage route is public")
+	}
+
 	return &VideoProvider{
-		basePath: basePath,
-		host:     host,
-		port:     port,
-		logger:   logger,
+		basePath:     basePath,
+		storage:      backend,
+		directURLs:   viper.GetBool("storage.direct_urls"),
+		urlTTL:       urlTTL,
+		signer:       signer,
+		absoluteURLs: viper.GetBool("video.absolute_urls"),
+		scheme:       viper.GetString("video.scheme"),
+		host:         host,
+		port:         port,
+		logger:       logger,
 	}, nil
 }
 
-// BuildURL генерирует полный URL для указанного роута, используя
-// закешированное базовое состояние хоста.
-func (p *VideoProvider) BuildURL(storagePath string) string {
-	// Превращаем "uploads/my_video.mp4" -> "/api/v1/storage/my_video.mp4"
-	// Мы убираем префикс папки "uploads/", так как роут в Chi уже указывает на неё
-	cleanPath := strings.TrimPrefix(storagePath, "uploads/")
-	return "/api/v1/storage/" + cleanPath
+// StorageRoute — роут, через который API раздает файлы хранилища
+const StorageRoute = "/api/v1/storage/"
+
+// URLGrant — к чему привязана выдаваемая ссылка
+type URLGrant struct {
+	AssetID string // Записывается в токен для аудита
+	UserID  string // Если задан, файл отдадут только с JWT этого пользователя
+	// Dir подписывает всю папку файла, а не только его: нужно манифестам HLS/DASH,
+	// чьи сегменты запрашиваются по относительным ссылкам
+	Dir bool
+}
+
+// BuildURL генерирует ссылку на файл хранилища по его storage_path.
+// Файл раздается через роут API ("vod/1/master.m3u8" -> "/api/v1/storage/t/<token>/vod/1/master.m3u8"),
+// токен ограничивает срок (storage.url_ttl) и область действия ссылки. С storage.direct_urls
+// удаленное хранилище отдает файл само по своей presigned-ссылке.
+func (p *VideoProvider) BuildURL(ctx context.Context, storagePath string, grant URLGrant) (string, error) {
+	if _, local := p.storage.(*storage.Local); p.directURLs && !local {
+		return p.storage.Presign(ctx, storagePath, p.urlTTL)
+	}
+	key, err := storage.Key(storagePath)
+	if err != nil {
+		return "", err
+	}
+
+	route := StorageRoute
+	if p.signer != nil {
+		scope := key
+		if dir := path.Dir(key); grant.Dir && dir != "." {
+			scope = dir + "/"
+		}
+		route = SignedRoute + p.signer.Sign(URLClaims{
+			Scope:     scope,
+			ExpiresAt: time.Now().Add(p.urlTTL).Unix(),
+			AssetID:   grant.AssetID,
+			UserID:    grant.UserID,
+		}) + "/"
+	}
+	return p.origin() + route + (&url.URL{Path: key}).EscapedPath(), nil
+}
+
+// Signer возвращает подписчик ссылок или nil, если подпись выключена
+func (p *VideoProvider) Signer() *URLSigner {
+	return p.signer
+}
+
+// origin — "scheme://host[:port]" для video.absolute_urls, иначе пусто (ссылка относительно API)
+func (p *VideoProvider) origin() string {
+	if !p.absoluteURLs {
+		return ""
+	}
+	scheme := p.scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	if (scheme == "http" && p.port == 80) || (scheme == "https" && p.port == 443) || p.port == 0 {
+		return scheme + "://" + p.host
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, p.host, p.port)
+}
+
+// Storage возвращает хранилище файлов
+func (p *VideoProvider) Storage() storage.Backend {
+	return p.storage
 }
 
 // GetBasePath возвращает текущий путь к хранилищу видео
@@ -1,9 +1,13 @@
 package streaming
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
 	"go.uber.org/zap"
 )
 
@@ -55,3 +59,48 @@ func TestVideoProvider_GetSafePath(t *testing.T) {
 		})
 	}
 }
+
+func TestVideoProvider_BuildURL(t *testing.T) {
+	backend, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir(), BaseURL: StorageRoute})
+	assert.NoError(t, err)
+	p := &VideoProvider{storage: backend, logger: zap.NewNop()}
+
+	// Без подписи (video.signed_urls: false): новые ключи и legacy storage_path ("uploads/...") дают одну и ту же ссылку
+	for _, path := range []string{"vod/1/master.m3u8", "uploads/vod/1/master.m3u8"} {
+		u, err := p.BuildURL(context.Background(), path, URLGrant{})
+		assert.NoError(t, err)
+		assert.Equal(t, "/api/v1/storage/vod/1/master.m3u8", u)
+	}
+
+	_, err = p.BuildURL(context.Background(), "../secret.mp4", URLGrant{})
+	assert.ErrorIs(t, err, storage.ErrInvalidKey)
+}
+
+func TestVideoProvider_BuildSignedURL(t *testing.T) {
+	backend, err := storage.NewLocal(storage.LocalConfig{Root: t.TempDir(), BaseURL: StorageRoute})
+	assert.NoError(t, err)
+	signer := NewURLSigner("test-secret")
+	p := &VideoProvider{
+		storage:      backend,
+		signer:       signer,
+		urlTTL:       time.Hour,
+		absoluteURLs: true,
+		scheme:       "https",
+		host:         "cdn.example.com",
+		port:         443,
+		logger:       zap.NewNop(),
+	}
+
+	u, err := p.BuildURL(context.Background(), "uploads/vod/1/master.m3u8", URLGrant{AssetID: "1", Dir: true})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u, "https://cdn.example.com/api/v1/storage/t/"))
+	assert.True(t, strings.HasSuffix(u, "/vod/1/master.m3u8"))
+
+	// Токен из ссылки на манифест открывает соседние сегменты, но не чужую папку
+	token := strings.Split(strings.TrimPrefix(u, "https://cdn.example.com"+SignedRoute), "/")[0]
+	claims, err := signer.Verify(token, "vod/1/seg_5.m4s")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", claims.AssetID)
+	_, err = signer.Verify(token, "vod/2/master.m3u8")
+	assert.ErrorIs(t, err, ErrOutOfScope)
+}
@@ -0,0 +1,49 @@
+package streaming
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLSigner(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := NewURLSigner("secret")
+	s.now = func() time.Time { return now }
+
+	token := s.Sign(URLClaims{Scope: "1.mp4", ExpiresAt: now.Add(time.Minute).Unix(), UserID: "u1"})
+
+	claims, err := s.Verify(token, "1.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", claims.UserID)
+
+	_, err = s.Verify(token, "2.mp4")
+	assert.ErrorIs(t, err, ErrOutOfScope, "токен файла не открывает соседний файл")
+
+	_, err = NewURLSigner("other").Verify(token, "1.mp4")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Подмена payload при сохранении подписи
+	forged := s.Sign(URLClaims{Scope: "", ExpiresAt: now.Add(time.Hour).Unix()})
+	_, sig, _ := strings.Cut(token, ".")
+	body, _, _ := strings.Cut(forged, ".")
+	_, err = s.Verify(body+"."+sig, "1.mp4")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = s.Verify("garbage", "1.mp4")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	now = now.Add(2 * time.Minute)
+	_, err = s.Verify(token, "1.mp4")
+	assert.ErrorIs(t, err, ErrURLExpired)
+}
+
+func TestURLClaims_Covers(t *testing.T) {
+	dir := URLClaims{Scope: "vod/1/"}
+	assert.True(t, dir.Covers("vod/1/master.m3u8"))
+	assert.True(t, dir.Covers("vod/1/media_0.m3u8"))
+	assert.False(t, dir.Covers("vod/10/master.m3u8"))
+	assert.False(t, dir.Covers("vod/1"))
+}
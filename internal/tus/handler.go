@@ -0,0 +1,483 @@
+/*
+Package tus реализует протокол возобновляемых загрузок tus 1.0.0 (https://tus.io/protocols/resumable-upload).
+
+Поддерживаются core-протокол и расширения creation, termination и expiration:
+  - POST   /uploads       — создание загрузки (Upload-Length, Upload-Metadata)
+  - HEAD   /uploads/{id}  — текущее смещение (Upload-Offset)
+  - PATCH  /uploads/{id}  — дозапись чанка с указанного смещения
+  - DELETE /uploads/{id}  — отмена загрузки
+
+Состояние хранится в Store (Redis), байты — в файле .part на диске. Когда приходит
+последний байт, вызывается CompleteFunc, которая превращает файл в MediaAsset.
+*/
+package tus
+
+import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+// Version — единственная поддерживаемая версия протокола
+const Version = "1.0.0"
+
+// Extensions — поддерживаемые расширения (заголовок Tus-Extension)
+const Extensions = "creation,termination,expiration"
+
+// AssetIDHeader — в нем ответ на последний PATCH сообщает ID созданного MediaAsset
+const AssetIDHeader = "X-Asset-ID"
+
+// offsetContentType — обязательный Content-Type тела PATCH
+const offsetContentType = "application/offset+octet-stream"
+
+// ErrRejected оборачивает отказ CompleteFunc принять файл (не медиа и т.п.): загрузка удаляется, клиент получает 415
+var ErrRejected = errors.New("tus: upload rejected")
+
+// ErrTooLarge оборачивает отказ CompleteFunc из-за размера (квота): загрузка удаляется, клиент получает 413
+var ErrTooLarge = errors.New("tus: upload too large")
+
+// CompleteFunc вызывается, когда файл загружен целиком. Возвращает ID созданного актива.
+// Файл по partPath функция может переместить — после успешного вызова Handler его не трогает.
+type CompleteFunc func(ctx context.Context, u *Upload, partPath string) (assetID string, err error)
+
+// Config — параметры загрузчика
+type Config struct {
+	Dir        string        // Папка для незавершенных загрузок (.part)
+	BasePath   string        // URL-префикс для Location ("/api/v1/uploads")
+	MaxSize    int64         // Предельный размер файла (Tus-Max-Size)
+	Expiration time.Duration // Сколько живет незавершенная загрузка
+	// Authorize вызывается перед созданием загрузки длиной length (квоты).
+	// false — загрузка не создается, ответ клиенту функция уже отправила.
+	Authorize func(w http.ResponseWriter, r *http.Request, length int64) bool
+}
+
+// Handler обслуживает tus-эндпоинты
+type Handler struct {
+	cfg      Config
+	store    Store
+	complete CompleteFunc
+	logger   *zap.Logger
+}
+
+// NewHandler создает обработчик и папку для .part файлов
+func NewHandler(cfg Config, store Store, complete CompleteFunc, logger *zap.Logger) (*Handler, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("tus: failed to create upload dir: %w", err)
+	}
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = 24 * time.Hour
+	}
+	return &Handler{cfg: cfg, store: store, complete: complete, logger: logger}, nil
+}
+
+// Routes монтирует эндпоинты протокола в роутер
+func (h *Handler) Routes(r chi.Router) {
+	r.Options("/", h.HandleOptions)
+	r.Post("/", h.HandleCreate)
+	r.Head("/{id}", h.HandleHead)
+	r.Patch("/{id}", h.HandlePatch)
+	r.Delete("/{id}", h.HandleDelete)
+}
+
+// HandleOptions сообщает возможности сервера (не требует Tus-Resumable)
+func (h *Handler) HandleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", Version)
+	w.Header().Set("Tus-Version", Version)
+	w.Header().Set("Tus-Extension", Extensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.cfg.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCreate создает загрузку: POST с Upload-Length и необязательным Upload-Metadata
+func (h *Handler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	ownerID, ok := types.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Upload-Defer-Length is not supported", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if h.cfg.MaxSize > 0 && length > h.cfg.MaxSize {
+		http.Error(w, fmt.Sprintf("Upload exceeds maximum size of %d bytes", h.cfg.MaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, err := ParseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+	if h.cfg.Authorize != nil && !h.cfg.Authorize(w, r, length) {
+		return
+	}
+
+	now := time.Now()
+	u := &Upload{
+		ID:        uuid.NewString(),
+		OwnerID:   ownerID.String(),
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.cfg.Expiration),
+	}
+
+	f, err := os.Create(h.partPath(u.ID))
+	if err != nil {
+		h.logger.Error("tus: failed to create part file", zap.Error(err))
+		http.Error(w, "Storage error", http.StatusInternalServerError)
+		return
+	}
+	_ = f.Close()
+
+	if err := h.store.Create(r.Context(), u); err != nil {
+		_ = os.Remove(h.partPath(u.ID))
+		h.logger.Error("tus: failed to save upload state", zap.Error(err))
+		http.Error(w, "Storage error", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("⬆️ Resumable upload created",
+		zap.String("upload_id", u.ID),
+		zap.String("user_id", u.OwnerID),
+		zap.Int64("length", length),
+		zap.String("filename", metadata["filename"]))
+
+	w.Header().Set("Location", strings.TrimSuffix(h.cfg.BasePath, "/")+"/"+u.ID)
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Tus-Resumable", Version)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleHead возвращает смещение, с которого клиенту нужно продолжить
+func (h *Handler) HandleHead(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeState(w, u)
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if meta := EncodeMetadata(u.Metadata); meta != "" {
+		w.Header().Set("Upload-Metadata", meta)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePatch дописывает чанк. Upload-Offset должен совпадать с уже принятым объемом.
+func (h *Handler) HandlePatch(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != offsetContentType {
+		http.Error(w, "Content-Type must be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	unlock, err := h.store.Lock(r.Context(), u.ID)
+	if errors.Is(err, ErrUploadLocked) {
+		http.Error(w, "Upload is locked by another request", http.StatusLocked)
+		return
+	}
+	if err != nil {
+		h.logger.Error("tus: lock failed", zap.Error(err))
+		http.Error(w, "Storage error", http.StatusInternalServerError)
+		return
+	}
+	defer unlock()
+
+	// Перечитываем под блокировкой: параллельный PATCH мог сдвинуть смещение
+	if u, err = h.store.Get(r.Context(), u.ID); err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if offset != u.Offset {
+		h.writeState(w, u)
+		http.Error(w, "Upload-Offset does not match", http.StatusConflict)
+		return
+	}
+
+	if !u.Complete() {
+		if err := h.writeChunk(r, u); err != nil {
+			h.logger.Warn("tus: chunk interrupted",
+				zap.String("upload_id", u.ID),
+				zap.Int64("offset", u.Offset),
+				zap.Error(err))
+			// Принятое до обрыва уже сохранено — клиент продолжит с нового смещения
+			if errors.Is(err, errChunkTooLarge) {
+				http.Error(w, "Chunk exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if u.Offset == offset {
+				http.Error(w, "Failed to store chunk", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	// Последний чанк (или повтор PATCH после неудачной финализации) — создаем актив
+	if u.Complete() && u.AssetID == "" {
+		if !h.finish(w, r, u) {
+			return
+		}
+	}
+
+	h.writeState(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDelete отменяет загрузку и удаляет принятые байты
+func (h *Handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	u, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	unlock, err := h.store.Lock(r.Context(), u.ID)
+	if errors.Is(err, ErrUploadLocked) {
+		http.Error(w, "Upload is locked by another request", http.StatusLocked)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Storage error", http.StatusInternalServerError)
+		return
+	}
+	defer unlock()
+
+	h.discard(r.Context(), u)
+	h.logger.Info("🗑️ Resumable upload terminated", zap.String("upload_id", u.ID))
+
+	w.Header().Set("Tus-Resumable", Version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errChunkTooLarge = errors.New("tus: chunk exceeds upload length")
+
+// writeChunk пишет тело запроса в .part начиная с u.Offset и сохраняет новое смещение,
+// даже если соединение оборвалось посередине
+func (h *Handler) writeChunk(r *http.Request, u *Upload) error {
+	f, err := os.OpenFile(h.partPath(u.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// Хвост после сохраненного смещения мог остаться от оборванной записи — он недостоверен
+	if err := f.Truncate(u.Offset); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.Seek(u.Offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	h256, err := u.hasher()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	remaining := u.Length - u.Offset
+	n, copyErr := io.Copy(hashingWriter{w: f, h: h256}, io.LimitReader(r.Body, remaining))
+	if copyErr == nil && n == remaining {
+		// Проверяем, что клиент не прислал больше заявленного
+		var probe [1]byte
+		if m, _ := r.Body.Read(probe[:]); m > 0 {
+			copyErr = errChunkTooLarge
+		}
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	if n > 0 {
+		u.Offset += n
+		if u.HashState, err = h256.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+			return err
+		}
+		if err := h.store.Save(context.WithoutCancel(r.Context()), u); err != nil {
+			return err
+		}
+	}
+	return copyErr
+}
+
+// finish вызывает CompleteFunc. false — ответ с ошибкой уже отправлен.
+func (h *Handler) finish(w http.ResponseWriter, r *http.Request, u *Upload) bool {
+	// Клиент свое дело сделал — финализацию не прерываем, даже если он отключится
+	ctx := context.WithoutCancel(r.Context())
+
+	h256, err := u.hasher()
+	if err != nil {
+		h.logger.Error("tus: corrupted hash state", zap.String("upload_id", u.ID), zap.Error(err))
+		http.Error(w, "Failed to finalize upload", http.StatusInternalServerError)
+		return false
+	}
+	u.Checksum = hex.EncodeToString(h256.Sum(nil))
+
+	assetID, err := h.complete(ctx, u, h.partPath(u.ID))
+	if errors.Is(err, ErrRejected) || errors.Is(err, ErrTooLarge) {
+		code, reason := http.StatusUnsupportedMediaType, ErrRejected
+		if errors.Is(err, ErrTooLarge) {
+			code, reason = http.StatusRequestEntityTooLarge, ErrTooLarge
+		}
+		h.logger.Warn("tus: upload rejected", zap.String("upload_id", u.ID), zap.Error(err))
+		h.discard(ctx, u)
+		http.Error(w, strings.TrimPrefix(err.Error(), reason.Error()+": "), code)
+		return false
+	}
+	if err != nil {
+		h.logger.Error("tus: failed to finalize upload", zap.String("upload_id", u.ID), zap.Error(err))
+		http.Error(w, "Failed to finalize upload", http.StatusInternalServerError)
+		return false
+	}
+
+	u.AssetID = assetID
+	if err := h.store.Save(ctx, u); err != nil {
+		h.logger.Warn("tus: failed to save completed state", zap.String("upload_id", u.ID), zap.Error(err))
+	}
+	h.logger.Info("✅ Resumable upload completed",
+		zap.String("upload_id", u.ID),
+		zap.String("asset_id", assetID),
+		zap.Int64("bytes", u.Length))
+	return true
+}
+
+// load достает загрузку и проверяет, что она принадлежит текущему пользователю. false — ответ уже отправлен.
+func (h *Handler) load(w http.ResponseWriter, r *http.Request) (*Upload, bool) {
+	u, err := h.store.Get(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, ErrUploadNotFound) {
+		w.Header().Set("Tus-Resumable", Version)
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error("tus: failed to load upload", zap.Error(err))
+		http.Error(w, "Storage error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Чужую загрузку не показываем вовсе
+	userID, _ := types.GetUserID(r.Context())
+	if u.OwnerID != userID.String() {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	return u, true
+}
+
+func (h *Handler) discard(ctx context.Context, u *Upload) {
+	if err := os.Remove(h.partPath(u.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		h.logger.Warn("tus: failed to remove part file", zap.String("upload_id", u.ID), zap.Error(err))
+	}
+	if err := h.store.Delete(ctx, u.ID); err != nil {
+		h.logger.Warn("tus: failed to delete upload state", zap.String("upload_id", u.ID), zap.Error(err))
+	}
+}
+
+// writeState выставляет заголовки текущего состояния загрузки
+func (h *Handler) writeState(w http.ResponseWriter, u *Upload) {
+	w.Header().Set("Tus-Resumable", Version)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	if u.AssetID != "" {
+		w.Header().Set(AssetIDHeader, u.AssetID)
+	}
+}
+
+// checkVersion требует Tus-Resumable: 1.0.0 (иначе 412 и список поддерживаемых версий)
+func (h *Handler) checkVersion(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") == Version {
+		return true
+	}
+	w.Header().Set("Tus-Resumable", Version)
+	w.Header().Set("Tus-Version", Version)
+	http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+	return false
+}
+
+func (h *Handler) partPath(id string) string {
+	return filepath.Join(h.cfg.Dir, id+".part")
+}
+
+// ParseMetadata разбирает Upload-Metadata: "key base64value,key2 base64value2,flag"
+func ParseMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("tus: empty metadata key")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("tus: metadata %q is not base64: %w", key, err)
+		}
+		meta[key] = string(decoded)
+	}
+	return meta, nil
+}
+
+// EncodeMetadata — обратное ParseMetadata преобразование для ответа HEAD
+func EncodeMetadata(meta map[string]string) string {
+	pairs := make([]string, 0, len(meta))
+	for k, v := range meta {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// hashingWriter пишет в файл и хеширует ровно то, что записалось (даже при обрыве посередине)
+type hashingWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+func (hw hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	return n, err
+}
@@ -0,0 +1,275 @@
+package tus
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xela07ax/universal-backend-streaming/internal/types"
+	"go.uber.org/zap"
+)
+
+// memStore — Store в памяти для тестов
+type memStore struct {
+	mu      sync.Mutex
+	uploads map[string]Upload
+	locked  map[string]bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{uploads: map[string]Upload{}, locked: map[string]bool{}}
+}
+
+func (m *memStore) Create(ctx context.Context, u *Upload) error { return m.Save(ctx, u) }
+
+func (m *memStore) Get(_ context.Context, id string) (*Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	return &u, nil
+}
+
+func (m *memStore) Save(_ context.Context, u *Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads[u.ID] = *u
+	return nil
+}
+
+func (m *memStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, id)
+	return nil
+}
+
+func (m *memStore) Lock(_ context.Context, id string) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked[id] {
+		return nil, ErrUploadLocked
+	}
+	m.locked[id] = true
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.locked, id)
+	}, nil
+}
+
+type testEnv struct {
+	store    *memStore
+	router   chi.Router
+	owner    uuid.UUID
+	received []byte
+	checksum string
+}
+
+func newTestEnv(t *testing.T, complete CompleteFunc) *testEnv {
+	env := &testEnv{store: newMemStore(), owner: uuid.New()}
+	if complete == nil {
+		complete = func(_ context.Context, u *Upload, partPath string) (string, error) {
+			data, err := os.ReadFile(partPath)
+			env.received = data
+			env.checksum = u.Checksum
+			return "asset-1", err
+		}
+	}
+	h, err := NewHandler(Config{
+		Dir:      t.TempDir(),
+		BasePath: "/uploads",
+		MaxSize:  100,
+	}, env.store, complete, zap.NewNop())
+	assert.NoError(t, err)
+
+	env.router = chi.NewRouter()
+	env.router.Route("/uploads", h.Routes)
+	return env
+}
+
+func (e *testEnv) do(method, target string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", Version)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), types.UserIDKey, e.owner))
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (e *testEnv) patch(location string, offset, chunk string) *httptest.ResponseRecorder {
+	return e.do(http.MethodPatch, location, map[string]string{
+		"Content-Type":  offsetContentType,
+		"Upload-Offset": offset,
+	}, chunk)
+}
+
+func TestHandler_FullFlow(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	meta := "filename " + base64.StdEncoding.EncodeToString([]byte("clip.mp4"))
+	rec := env.do(http.MethodPost, "/uploads/", map[string]string{"Upload-Length": "11", "Upload-Metadata": meta}, "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	location := rec.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "/uploads/"))
+
+	rec = env.patch(location, "0", "hello ")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "6", rec.Header().Get("Upload-Offset"))
+	assert.Empty(t, rec.Header().Get(AssetIDHeader))
+
+	// Клиент переподключился и узнает, с какого места продолжать
+	rec = env.do(http.MethodHead, location, nil, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "6", rec.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", rec.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	rec = env.patch(location, "6", "world")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "11", rec.Header().Get("Upload-Offset"))
+	assert.Equal(t, "asset-1", rec.Header().Get(AssetIDHeader))
+	assert.Equal(t, "hello world", string(env.received))
+	// SHA-256 считался по чанкам, между запросами состояние жило в Store
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", env.checksum)
+
+	rec = env.do(http.MethodDelete, location, nil, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = env.do(http.MethodHead, location, nil, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_Errors(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	rec := env.do(http.MethodPost, "/uploads/", map[string]string{"Upload-Length": "101"}, "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "Upload-Length above MaxSize")
+
+	rec = env.do(http.MethodPost, "/uploads/", map[string]string{"Upload-Length": "5"}, "")
+	location := rec.Header().Get("Location")
+
+	rec = env.patch(location, "3", "abc")
+	assert.Equal(t, http.StatusConflict, rec.Code, "offset mismatch")
+	assert.Equal(t, "0", rec.Header().Get("Upload-Offset"))
+
+	rec = env.patch(location, "0", "abcdefgh")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "chunk beyond Upload-Length")
+
+	rec = env.do(http.MethodPatch, location, map[string]string{"Upload-Offset": "0"}, "abc")
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code, "wrong Content-Type")
+
+	req := httptest.NewRequest(http.MethodHead, location, nil)
+	rec = httptest.NewRecorder()
+	env.router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code, "missing Tus-Resumable")
+
+	// Чужая загрузка выглядит как несуществующая
+	other := *env
+	other.owner = uuid.New()
+	rec = other.do(http.MethodHead, location, nil, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = env.do(http.MethodOptions, "/uploads/", nil, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get("Tus-Max-Size"))
+}
+
+func TestHandler_Rejected(t *testing.T) {
+	env := newTestEnv(t, func(context.Context, *Upload, string) (string, error) {
+		return "", ErrRejected
+	})
+
+	rec := env.do(http.MethodPost, "/uploads/", map[string]string{"Upload-Length": "3"}, "")
+	location := rec.Header().Get("Location")
+
+	rec = env.patch(location, "0", "abc")
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	_, err := env.store.Get(context.Background(), strings.TrimPrefix(location, "/uploads/"))
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+}
+
+func TestParseMetadata(t *testing.T) {
+	meta, err := ParseMetadata("filename bXkudmlkZW8ubXA0,is_private")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"filename": "my.video.mp4", "is_private": ""}, meta)
+
+	_, err = ParseMetadata("filename ???")
+	assert.Error(t, err)
+
+	round, err := ParseMetadata(EncodeMetadata(map[string]string{"title": "Привет"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "Привет", round["title"])
+}
+
+func TestHandler_Authorize(t *testing.T) {
+	env := newTestEnv(t, nil)
+	h, err := NewHandler(Config{
+		Dir:      t.TempDir(),
+		BasePath: "/uploads",
+		Authorize: func(w http.ResponseWriter, _ *http.Request, length int64) bool {
+			if length > 10 {
+				http.Error(w, "quota", http.StatusRequestEntityTooLarge)
+				return false
+			}
+			return true
+		},
+	}, env.store, func(context.Context, *Upload, string) (string, error) {
+		return "", fmt.Errorf("%w: quota exceeded", ErrTooLarge)
+	}, zap.NewNop())
+	assert.NoError(t, err)
+	env.router = chi.NewRouter()
+	env.router.Route("/uploads", h.Routes)
+
+	rec := env.do(http.MethodPost, "/uploads/", map[string]string{"Upload-Length": "11"}, "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Empty(t, env.store.uploads, "отказанная загрузка не создается")
+
+	// Квота кончилась, пока файл докачивался (параллельные загрузки)
+	rec = env.do(http.MethodPost, "/uploads/", map[string]string{"Upload-Length": "3"}, "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = env.patch(rec.Header().Get("Location"), "0", "abc")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, "quota exceeded\n", rec.Body.String())
+	assert.Empty(t, env.store.uploads)
+}
+
+func TestHandler_Sweep(t *testing.T) {
+	store := newMemStore()
+	dir := t.TempDir()
+	h, err := NewHandler(Config{Dir: dir, BasePath: "/uploads"}, store, nil, zap.NewNop())
+	require.NoError(t, err)
+
+	old := time.Now().Add(-2 * sweepMinAge)
+	for _, id := range []string{"live", "abandoned", "fresh"} {
+		require.NoError(t, os.WriteFile(h.partPath(id), []byte("data"), 0644))
+	}
+	require.NoError(t, os.Chtimes(h.partPath("live"), old, old))
+	require.NoError(t, os.Chtimes(h.partPath("abandoned"), old, old))
+	require.NoError(t, store.Save(context.Background(), &Upload{ID: "live"}))
+
+	removed, err := h.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	_, err = os.Stat(h.partPath("abandoned"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.FileExists(t, h.partPath("live"))
+	assert.FileExists(t, h.partPath("fresh"), "только что созданный файл еще может ждать состояния")
+}
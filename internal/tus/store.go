@@ -0,0 +1,130 @@
+package tus
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrUploadNotFound — загрузки нет или ее состояние истекло
+	ErrUploadNotFound = errors.New("tus: upload not found")
+	// ErrUploadLocked — в загрузку уже пишет другой запрос
+	ErrUploadLocked = errors.New("tus: upload is locked by another request")
+)
+
+// Upload — состояние одной возобновляемой загрузки
+type Upload struct {
+	ID        string            `json:"id"`
+	OwnerID   string            `json:"owner_id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	AssetID   string            `json:"asset_id,omitempty"`   // Заполняется, когда последний чанк превращен в MediaAsset
+	HashState []byte            `json:"hash_state,omitempty"` // Состояние SHA-256 после Offset байт: сумма считается по мере приема чанков
+	Checksum  string            `json:"checksum,omitempty"`   // SHA-256 файла (hex), когда приняты все байты
+}
+
+// Complete — все байты получены
+func (u *Upload) Complete() bool { return u.Offset >= u.Length }
+
+// hasher восстанавливает SHA-256 принятых байт из HashState
+func (u *Upload) hasher() (hash.Hash, error) {
+	h := sha256.New()
+	if len(u.HashState) == 0 {
+		return h, nil
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(u.HashState); err != nil {
+		return nil, fmt.Errorf("tus: invalid hash state: %w", err)
+	}
+	return h, nil
+}
+
+// Store хранит состояние загрузок. Данные (байты файла) лежат на диске, см. Handler.
+type Store interface {
+	Create(ctx context.Context, u *Upload) error
+	Get(ctx context.Context, id string) (*Upload, error)
+	Save(ctx context.Context, u *Upload) error
+	Delete(ctx context.Context, id string) error
+	// Lock захватывает загрузку на время PATCH, чтобы два запроса не писали в один файл
+	Lock(ctx context.Context, id string) (unlock func(), err error)
+}
+
+// RedisStore — Store поверх Redis: состояние живет до ExpiresAt и удаляется само
+type RedisStore struct {
+	rdb     *redis.Client
+	lockTTL time.Duration
+}
+
+// NewRedisStore создает хранилище. lockTTL — страховка на случай, если процесс упадет, держа блокировку.
+func NewRedisStore(rdb *redis.Client, lockTTL time.Duration) *RedisStore {
+	return &RedisStore{rdb: rdb, lockTTL: lockTTL}
+}
+
+func uploadKey(id string) string { return "tus:upload:" + id }
+func lockKey(id string) string   { return "tus:lock:" + id }
+
+func (s *RedisStore) Create(ctx context.Context, u *Upload) error {
+	return s.Save(ctx, u)
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (*Upload, error) {
+	data, err := s.rdb.Get(ctx, uploadKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tus: failed to load upload: %w", err)
+	}
+
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("tus: corrupted upload state: %w", err)
+	}
+	return &u, nil
+}
+
+func (s *RedisStore) Save(ctx context.Context, u *Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("tus: failed to encode upload: %w", err)
+	}
+	ttl := time.Until(u.ExpiresAt)
+	if ttl <= 0 {
+		return ErrUploadNotFound
+	}
+	if err := s.rdb.Set(ctx, uploadKey(u.ID), data, ttl).Err(); err != nil {
+		return fmt.Errorf("tus: failed to save upload: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	if err := s.rdb.Del(ctx, uploadKey(id), lockKey(id)).Err(); err != nil {
+		return fmt.Errorf("tus: failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Lock(ctx context.Context, id string) (func(), error) {
+	ok, err := s.rdb.SetNX(ctx, lockKey(id), "1", s.lockTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("tus: failed to lock upload: %w", err)
+	}
+	if !ok {
+		return nil, ErrUploadLocked
+	}
+	return func() {
+		// Запрос клиента уже мог быть отменен — снимаем блокировку независимо от него
+		s.rdb.Del(context.WithoutCancel(ctx), lockKey(id))
+	}, nil
+}
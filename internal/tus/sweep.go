@@ -0,0 +1,73 @@
+package tus
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sweepMinAge — моложе этого .part не трогаем: HandleCreate создает файл раньше состояния в Store
+const sweepMinAge = time.Hour
+
+// Sweep удаляет .part файлы брошенных загрузок: состояние в Store истекло (Expiration) или удалено,
+// а файл остался на диске. Возвращает число удаленных файлов.
+func (h *Handler) Sweep(ctx context.Context) (int, error) {
+	entries, err := os.ReadDir(h.cfg.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+		id, ok := strings.CutSuffix(e.Name(), ".part")
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < sweepMinAge {
+			continue
+		}
+
+		// Любая ошибка, кроме "нет такой загрузки" (Redis недоступен), — файл оставляем
+		if _, err := h.store.Get(ctx, id); !errors.Is(err, ErrUploadNotFound) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(h.cfg.Dir, e.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			h.logger.Warn("tus: failed to remove abandoned part file", zap.String("upload_id", id), zap.Error(err))
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunSweeper вызывает Sweep раз в interval, пока не отменен ctx
+func (h *Handler) RunSweeper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		removed, err := h.Sweep(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			h.logger.Error("tus: sweep failed", zap.Error(err))
+		case removed > 0:
+			h.logger.Info("🧹 Abandoned uploads removed", zap.Int("files", removed))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
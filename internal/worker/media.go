@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/packager"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"github.com/xela07ax/universal-backend-streaming/internal/storage"
+)
+
+// thumbnailOffset — с какого момента видео снимается превью (первый кадр часто черный)
+const thumbnailOffset = 3 * time.Second
+
+// MetadataStore — контракт для дописывания результатов обработки в metadata актива
+type MetadataStore interface {
+	MergeMetadata(ctx context.Context, id uuid.UUID, patch map[string]interface{}) error
+}
+
+// Source — откуда воркер берет исходники задач
+type Source struct {
+	Storage storage.Backend
+	WorkDir string // Сюда скачиваются исходники из удаленного хранилища
+}
+
+// Fetch дает локальный путь к исходному файлу задачи (payload.storage_key).
+// cleanup нужно вызвать после обработки: он удаляет скачанную копию.
+func (s Source) Fetch(ctx context.Context, job *repository.Job) (string, func(), error) {
+	key, _ := job.Payload["storage_key"].(string)
+	if key == "" {
+		return "", nil, Permanent(errors.New("worker: job payload has no storage_key"))
+	}
+	path, cleanup, err := storage.Fetch(ctx, s.Storage, key, s.WorkDir)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		return "", nil, Permanent(fmt.Errorf("worker: source file is gone: %w", err))
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+// PackageHandler упаковывает исходник в HLS/DASH (см. packager.Package).
+// timeout ограничивает одну попытку, чтобы зависший ffmpeg не держал задачу до истечения lease.
+func PackageHandler(p *packager.Packager, src Source, timeout time.Duration) HandlerFunc {
+	return func(ctx context.Context, job *repository.Job) error {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		input, cleanup, err := src.Fetch(ctx, job)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		source, _ := job.Payload["storage_key"].(string)
+		if _, err := p.Package(ctx, job.AssetID, source, input); err != nil {
+			if errors.Is(err, packager.ErrNoVideo) || errors.Is(err, repository.ErrSourceChanged) {
+				return Permanent(err)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// ThumbnailHandler снимает превью и сохраняет его путь в metadata.thumbnail
+func ThumbnailHandler(p *packager.Packager, src Source, assets MetadataStore) HandlerFunc {
+	return func(ctx context.Context, job *repository.Job) error {
+		input, cleanup, err := src.Fetch(ctx, job)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		path, err := p.Thumbnail(ctx, job.AssetID, input, thumbnailOffset)
+		if err != nil {
+			return err
+		}
+		return assets.MergeMetadata(ctx, job.AssetID, map[string]interface{}{"thumbnail": path})
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Package worker выполняет фоновые задачи обработки медиа из очереди jobs.
+
+Каждая задача проходит pending -> running -> done. Ошибка возвращает задачу в pending
+с экспоненциальной задержкой; после max_attempts (или при неустранимой ошибке) задача
+уходит в dead (dead-letter), откуда ее можно вернуть через админский API.
+Статус актива следует за задачами: processing, пока есть незавершенные, затем ready или failed.
+*/
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"go.uber.org/zap"
+)
+
+// Статусы актива (media_assets.status)
+const (
+	AssetProcessing = "processing"
+	AssetReady      = "ready"
+	AssetFailed     = "failed"
+)
+
+// HandlerFunc выполняет задачу одного типа
+type HandlerFunc func(ctx context.Context, job *repository.Job) error
+
+// Queue — контракт очереди задач. Реализуется *repository.JobRepository.
+type Queue interface {
+	Claim(ctx context.Context, workerID string, lease time.Duration) (*repository.Job, error)
+	ReapExpired(ctx context.Context, lease time.Duration) ([]uuid.UUID, error)
+	Complete(ctx context.Context, id uuid.UUID, workerID string) error
+	Fail(ctx context.Context, id uuid.UUID, workerID, reason string, retryIn time.Duration, permanent bool) (string, error)
+	AssetJobStats(ctx context.Context, assetID uuid.UUID) (active int, dead int, err error)
+}
+
+// AssetStatusStore — контракт для перевода актива по жизненному циклу. Реализуется *repository.MediaRepository.
+type AssetStatusStore interface {
+	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+}
+
+// Config — параметры воркера
+type Config struct {
+	ID           string        // Имя воркера в jobs.locked_by
+	Concurrency  int           // Сколько задач выполняется параллельно
+	PollInterval time.Duration // Пауза, когда очередь пуста
+	Lease        time.Duration // Через сколько running-задача считается брошенной
+	BackoffBase  time.Duration // Задержка перед второй попыткой, дальше удваивается
+	BackoffMax   time.Duration
+}
+
+// permanentError помечает ошибку, которую бессмысленно повторять
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent отправляет задачу сразу в dead, минуя повторные попытки (битый файл, нет видео и т.д.)
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Worker забирает задачи из очереди и выполняет зарегистрированные обработчики
+type Worker struct {
+	cfg      Config
+	queue    Queue
+	assets   AssetStatusStore
+	logger   *zap.Logger
+	handlers map[string]HandlerFunc
+}
+
+// New создает воркер, подставляя значения по умолчанию для пустых полей конфига
+func New(cfg Config, queue Queue, assets AssetStatusStore, logger *zap.Logger) *Worker {
+	if cfg.ID == "" {
+		host, _ := os.Hostname()
+		cfg.ID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Hour
+	}
+	if cfg.BackoffBase <= 0 {
+		cfg.BackoffBase = 10 * time.Second
+	}
+	if cfg.BackoffMax < cfg.BackoffBase {
+		cfg.BackoffMax = 10 * time.Minute
+	}
+	return &Worker{
+		cfg:      cfg,
+		queue:    queue,
+		assets:   assets,
+		logger:   logger,
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Handle регистрирует обработчик для типа задачи
+func (w *Worker) Handle(jobType string, fn HandlerFunc) {
+	w.handlers[jobType] = fn
+}
+
+// Run обрабатывает очередь до отмены ctx. Начатые задачи дорабатываются с отмененным контекстом.
+func (w *Worker) Run(ctx context.Context) {
+	w.logger.Info("⚙️ Worker started",
+		zap.String("id", w.cfg.ID),
+		zap.Int("concurrency", w.cfg.Concurrency))
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	w.logger.Info("Worker stopped", zap.String("id", w.cfg.ID))
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		processed, err := w.ProcessNext(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logger.Error("Worker: queue error", zap.Error(err))
+		}
+		if processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.cfg.PollInterval):
+		}
+	}
+}
+
+// ProcessNext забирает и выполняет одну задачу. false — очередь пуста.
+func (w *Worker) ProcessNext(ctx context.Context) (bool, error) {
+	// Брошенные задачи без попыток — в dead, их активы — в failed
+	reaped, err := w.queue.ReapExpired(ctx, w.cfg.Lease)
+	if err != nil {
+		return false, err
+	}
+	for _, assetID := range reaped {
+		w.logger.Error("💀 Abandoned job moved to dead-letter", zap.String("asset_id", assetID.String()))
+		w.settleAsset(ctx, assetID)
+	}
+
+	job, err := w.queue.Claim(ctx, w.cfg.ID, w.cfg.Lease)
+	if errors.Is(err, repository.ErrNoJobs) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	log := w.logger.With(
+		zap.String("job_id", job.ID.String()),
+		zap.String("type", job.Type),
+		zap.String("asset_id", job.AssetID.String()),
+		zap.Int("attempt", job.Attempts))
+
+	started := time.Now()
+	err = w.execute(ctx, job)
+
+	// Результат фиксируем даже при остановке воркера, иначе задача провисит до истечения lease
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		err := w.queue.Complete(saveCtx, job.ID, w.cfg.ID)
+		if errors.Is(err, repository.ErrJobLost) {
+			// Задачу отменили или забрал другой воркер: актив больше не наш
+			log.Info("Job was cancelled or taken over while running")
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		log.Info("✅ Job done", zap.Duration("took", time.Since(started)))
+		w.settleAsset(saveCtx, job.AssetID)
+		return true, nil
+	}
+
+	var perm *permanentError
+	permanent := errors.As(err, &perm)
+	retryIn := Backoff(w.cfg.BackoffBase, w.cfg.BackoffMax, job.Attempts)
+
+	status, failErr := w.queue.Fail(saveCtx, job.ID, w.cfg.ID, err.Error(), retryIn, permanent)
+	if failErr != nil {
+		return true, failErr
+	}
+
+	switch status {
+	case repository.JobDead:
+		log.Error("💀 Job moved to dead-letter", zap.Error(err))
+		w.settleAsset(saveCtx, job.AssetID)
+	case repository.JobCancelled:
+		log.Info("Job was cancelled or taken over while running", zap.Error(err))
+		w.settleAsset(saveCtx, job.AssetID)
+	default:
+		log.Warn("⚠️ Job failed, will retry", zap.Error(err), zap.Duration("retry_in", retryIn))
+	}
+	return true, nil
+}
+
+// execute вызывает обработчик, превращая панику и неизвестный тип в ошибку задачи
+func (w *Worker) execute(ctx context.Context, job *repository.Job) (err error) {
+	handler, ok := w.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("worker: no handler for job type %q", job.Type))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("worker: handler panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// settleAsset переводит актив в ready/failed, когда у него не осталось незавершенных задач
+func (w *Worker) settleAsset(ctx context.Context, assetID uuid.UUID) {
+	active, dead, err := w.queue.AssetJobStats(ctx, assetID)
+	if err != nil {
+		w.logger.Error("Worker: failed to check asset jobs", zap.String("asset_id", assetID.String()), zap.Error(err))
+		return
+	}
+
+	status := AssetStatusFor(active, dead)
+	if status == "" {
+		return
+	}
+
+	if err := w.assets.UpdateStatus(ctx, assetID, status); err != nil {
+		w.logger.Error("Worker: failed to update asset status",
+			zap.String("asset_id", assetID.String()),
+			zap.String("status", status),
+			zap.Error(err))
+		return
+	}
+	w.logger.Info("🎬 Asset processing finished", zap.String("asset_id", assetID.String()), zap.String("status", status))
+}
+
+// AssetStatusFor выводит статус актива из счетчиков его задач; "" — обработка еще идет
+func AssetStatusFor(active, dead int) string {
+	switch {
+	case dead > 0:
+		return AssetFailed
+	case active == 0:
+		return AssetReady
+	}
+	return ""
+}
+
+// Backoff — экспоненциальная задержка перед попыткой attempt+1: base, 2*base, 4*base... не больше max
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
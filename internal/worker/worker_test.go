@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/xela07ax/universal-backend-streaming/internal/repository"
+	"go.uber.org/zap"
+)
+
+// memQueue — очередь в памяти с той же семантикой статусов, что и JobRepository
+type memQueue struct {
+	jobs     []*repository.Job
+	statuses map[uuid.UUID]string
+}
+
+func (q *memQueue) Claim(_ context.Context, _ string, _ time.Duration) (*repository.Job, error) {
+	for _, j := range q.jobs {
+		if j.Status == repository.JobPending {
+			j.Status = repository.JobRunning
+			j.Attempts++
+			return j, nil
+		}
+	}
+	return nil, repository.ErrNoJobs
+}
+
+func (q *memQueue) ReapExpired(_ context.Context, _ time.Duration) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func (q *memQueue) Complete(_ context.Context, id uuid.UUID, _ string) error {
+	j := q.find(id)
+	if j.Status != repository.JobRunning {
+		return repository.ErrJobLost
+	}
+	j.Status = repository.JobDone
+	return nil
+}
+
+func (q *memQueue) Fail(_ context.Context, id uuid.UUID, _, reason string, _ time.Duration, permanent bool) (string, error) {
+	j := q.find(id)
+	j.LastError = reason
+	j.Status = repository.JobPending
+	if permanent || j.Attempts >= j.MaxAttempts {
+		j.Status = repository.JobDead
+	}
+	return j.Status, nil
+}
+
+func (q *memQueue) AssetJobStats(_ context.Context, assetID uuid.UUID) (int, int, error) {
+	var active, dead int
+	for _, j := range q.jobs {
+		if j.AssetID != assetID {
+			continue
+		}
+		switch j.Status {
+		case repository.JobPending, repository.JobRunning:
+			active++
+		case repository.JobDead:
+			dead++
+		}
+	}
+	return active, dead, nil
+}
+
+func (q *memQueue) UpdateStatus(_ context.Context, id uuid.UUID, status string) error {
+	q.statuses[id] = status
+	return nil
+}
+
+func (q *memQueue) find(id uuid.UUID) *repository.Job {
+	for _, j := range q.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (q *memQueue) add(jobType string, assetID uuid.UUID) *repository.Job {
+	j := &repository.Job{ID: uuid.New(), Type: jobType, AssetID: assetID, Status: repository.JobPending, MaxAttempts: 3}
+	q.jobs = append(q.jobs, j)
+	return j
+}
+
+func drain(t *testing.T, w *Worker) {
+	for {
+		processed, err := w.ProcessNext(context.Background())
+		assert.NoError(t, err)
+		if !processed {
+			return
+		}
+	}
+}
+
+func TestWorker_AssetLifecycle(t *testing.T) {
+	q := &memQueue{statuses: map[uuid.UUID]string{}}
+	w := New(Config{}, q, q, zap.NewNop())
+
+	calls := 0
+	w.Handle(repository.JobTypePackage, func(ctx context.Context, job *repository.Job) error {
+		calls++
+		if calls < 2 {
+			return errors.New("ffmpeg crashed")
+		}
+		return nil
+	})
+	w.Handle(repository.JobTypeThumbnail, func(ctx context.Context, job *repository.Job) error { return nil })
+
+	asset := uuid.New()
+	pkg := q.add(repository.JobTypePackage, asset)
+	q.add(repository.JobTypeThumbnail, asset)
+
+	drain(t, w)
+
+	// Первая попытка упала, вторая прошла — актив готов
+	assert.Equal(t, repository.JobDone, pkg.Status)
+	assert.Equal(t, 2, pkg.Attempts)
+	assert.Equal(t, AssetReady, q.statuses[asset])
+}
+
+func TestWorker_DeadLetter(t *testing.T) {
+	q := &memQueue{statuses: map[uuid.UUID]string{}}
+	w := New(Config{}, q, q, zap.NewNop())
+	w.Handle(repository.JobTypePackage, func(ctx context.Context, job *repository.Job) error {
+		return errors.New("always broken")
+	})
+	w.Handle(repository.JobTypeThumbnail, func(ctx context.Context, job *repository.Job) error {
+		return Permanent(errors.New("no video stream"))
+	})
+
+	retried := q.add(repository.JobTypePackage, uuid.New())
+	permanent := q.add(repository.JobTypeThumbnail, uuid.New())
+	unknown := q.add("transcribe", uuid.New())
+
+	drain(t, w)
+
+	assert.Equal(t, repository.JobDead, retried.Status)
+	assert.Equal(t, 3, retried.Attempts)
+	assert.Equal(t, "always broken", retried.LastError)
+
+	// Неустранимые ошибки не повторяются
+	assert.Equal(t, repository.JobDead, permanent.Status)
+	assert.Equal(t, 1, permanent.Attempts)
+	assert.Equal(t, repository.JobDead, unknown.Status)
+	assert.Equal(t, AssetFailed, q.statuses[permanent.AssetID])
+}
+
+func TestWorker_CancelledWhileRunning(t *testing.T) {
+	q := &memQueue{statuses: map[uuid.UUID]string{}}
+	w := New(Config{}, q, q, zap.NewNop())
+
+	asset := uuid.New()
+	pkg := q.add(repository.JobTypePackage, asset)
+	w.Handle(repository.JobTypePackage, func(ctx context.Context, job *repository.Job) error {
+		// Файл актива заменили, пока задача выполнялась
+		pkg.Status = repository.JobCancelled
+		return nil
+	})
+
+	drain(t, w)
+
+	// Результат потерянной задачи не трогает ни ее статус, ни статус актива
+	assert.Equal(t, repository.JobCancelled, pkg.Status)
+	assert.NotContains(t, q.statuses, asset)
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 10*time.Second, time.Minute
+
+	assert.Equal(t, 10*time.Second, Backoff(base, max, 1))
+	assert.Equal(t, 20*time.Second, Backoff(base, max, 2))
+	assert.Equal(t, 40*time.Second, Backoff(base, max, 3))
+	assert.Equal(t, time.Minute, Backoff(base, max, 10))
+}
@@ -35,6 +35,11 @@ client.interceptors.response.use(
                 originalRequest.headers.Authorization = `Bearer ${newToken}`;
                 return client(originalRequest);
             } catch (refreshError) {
+                // 409: соседняя вкладка уже обновила токен — берем ее токен из LocalStorage
+                if (refreshError.response?.status === 409) {
+                    originalRequest.headers.Authorization = `Bearer ${localStorage.getItem('hydro_token')}`;
+                    return client(originalRequest);
+                }
                 // Если рефреш не удался (сессия в Redis удалена) — полная очистка
                 localStorage.removeItem('hydro_token');
                 window.location.href = '/'; // Редирект на логин
@@ -59,7 +64,8 @@ export const MediaAPI = {
     },
 
     logout: async () => {
-        try { await client.post('/logout'); }
+        // Кука refresh отправляется только на /refresh/*: там сервер отзывает всю сессию
+        try { await client.post('/refresh/logout'); }
         finally {
             localStorage.removeItem('hydro_token');
             window.location.reload();
@@ -67,7 +73,11 @@ export const MediaAPI = {
     },
 
     // Работа с файлами (VOD)
-    getAssets: () => client.get('/assets').then(res => res.data.data),
+    // Первая страница (по умолчанию 50 новых); params: { q, status, cursor, limit }
+    getAssets: (params = {}) => client.get('/assets', { params }).then(res => res.data.data.items),
+
+    // Занятое место и квота: { used_bytes, limit_bytes, remaining_bytes, ... }
+    getUsage: () => client.get('/me/usage').then(res => res.data.data),
 
     getVideoUrl: (id) => client.get(`/video/${id}`).then(res => {
         // Логируем для отладки — в 2026 это лучший способ найти причину